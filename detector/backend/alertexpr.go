@@ -0,0 +1,569 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Alert conditions are written in a small expression language, e.g.
+//
+//	avg(activity_pct, 3h) < 20 && hour in work_hours
+//	sum(idle_seconds, 2h) > 5400 || last(activity_pct) == 0
+//
+// Grammar (lowest precedence first):
+//
+//	or      = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | cmp
+//	cmp     = sum [ ("<" | "<=" | ">" | ">=" | "==" | "!=") sum | "in" set ]
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | "true" | "false" | variable | call | "(" or ")"
+//
+// Variables: hour (0-23) and weekday (0 = Sunday), in the schedule's time
+// zone. Sets: work_hours and work_days, from the schedule setting.
+// Calls: avg, min, max, sum and count over a metric and a window
+// (count takes only the window), and last(metric). A window of 3h covers
+// the three latest complete hours. Metrics are activity_pct, idle_seconds
+// and samples.
+//
+// Expressions are type-checked when compiled and evaluated by closures
+// with no loops, I/O or reflection; avg/min/max/last over an empty window
+// yield NaN, so comparisons against them are false.
+
+const (
+	maxExprLen   = 1024
+	maxExprDepth = 32
+)
+
+type exprType int
+
+const (
+	exprNum exprType = iota
+	exprBool
+	exprDuration
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprNum:
+		return "number"
+	case exprBool:
+		return "boolean"
+	default:
+		return "duration"
+	}
+}
+
+// exprNode is a compiled subexpression; exactly one of num/bool is set,
+// except for duration literals which only carry dur.
+type exprNode struct {
+	typ  exprType
+	num  func(*alertEnv) float64
+	bool func(*alertEnv) bool
+	dur  time.Duration
+}
+
+// AlertExpr is a compiled condition.
+type AlertExpr struct {
+	src string
+	// MaxWindow is the widest window any call looks back over, i.e. how
+	// much history the evaluator must load.
+	MaxWindow time.Duration
+	root      func(*alertEnv) bool
+}
+
+func (e *AlertExpr) String() string { return e.src }
+
+// Eval reports whether the condition holds in env.
+func (e *AlertExpr) Eval(env *alertEnv) bool { return e.root(env) }
+
+// CompileAlertExpr parses and type-checks src, which must be boolean.
+func CompileAlertExpr(src string) (*AlertExpr, error) {
+	if len(src) > maxExprLen {
+		return nil, fmt.Errorf("expression longer than %d characters", maxExprLen)
+	}
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks, expr: &AlertExpr{src: src}}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	if n.typ != exprBool {
+		return nil, fmt.Errorf("expression must be a condition, got a %s", n.typ)
+	}
+	p.expr.root = n.bool
+	if p.expr.MaxWindow == 0 {
+		p.expr.MaxWindow = time.Hour // last() still needs the latest hour
+	}
+	return p.expr, nil
+}
+
+// ---- lexer ----
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokDuration
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind tokKind
+	text string
+	pos  int
+	num  float64
+	dur  time.Duration
+}
+
+func lexExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			k := j
+			if k < len(src) && unicode.IsLetter(rune(src[k])) {
+				// duration: digits and units may alternate, as in 1h30m
+				for k < len(src) && (unicode.IsLetter(rune(src[k])) || unicode.IsDigit(rune(src[k])) || src[k] == '.') {
+					k++
+				}
+			}
+			if k > j {
+				d, err := parseExprDuration(src[i:k])
+				if err != nil {
+					return nil, fmt.Errorf("at %d: invalid duration %q", i, src[i:k])
+				}
+				toks = append(toks, exprToken{kind: tokDuration, text: src[i:k], pos: i, dur: d})
+			} else {
+				f, err := strconv.ParseFloat(src[i:j], 64)
+				if err != nil {
+					return nil, fmt.Errorf("at %d: invalid number %q", i, src[i:j])
+				}
+				toks = append(toks, exprToken{kind: tokNum, text: src[i:j], pos: i, num: f})
+			}
+			i = k
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			toks = append(toks, exprToken{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, cand := range []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!", "+", "-", "*", "/", "(", ")", ","} {
+				if strings.HasPrefix(src[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %d: unexpected character %q", i, c)
+			}
+			toks = append(toks, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, exprToken{kind: tokEOF, text: "end of expression", pos: len(src)}), nil
+}
+
+// parseExprDuration accepts Go durations plus a "d" (24h) unit.
+func parseExprDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ---- parser ----
+
+type exprParser struct {
+	toks  []exprToken
+	i     int
+	depth int
+	expr  *AlertExpr
+}
+
+func (p *exprParser) peek() exprToken { return p.toks[p.i] }
+
+func (p *exprParser) next() exprToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) want(n exprNode, typ exprType, what string) error {
+	if n.typ != typ {
+		return p.errorf("%s needs a %s, got a %s", what, typ, n.typ)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExprDepth {
+		return exprNode{}, p.errorf("expression nested too deeply")
+	}
+	l, err := p.parseAnd()
+	if err != nil {
+		return l, err
+	}
+	for p.accept("||") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return r, err
+		}
+		if err := p.want(l, exprBool, "||"); err != nil {
+			return l, err
+		}
+		if err := p.want(r, exprBool, "||"); err != nil {
+			return r, err
+		}
+		lf, rf := l.bool, r.bool
+		l = exprNode{typ: exprBool, bool: func(e *alertEnv) bool { return lf(e) || rf(e) }}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return l, err
+	}
+	for p.accept("&&") {
+		r, err := p.parseNot()
+		if err != nil {
+			return r, err
+		}
+		if err := p.want(l, exprBool, "&&"); err != nil {
+			return l, err
+		}
+		if err := p.want(r, exprBool, "&&"); err != nil {
+			return r, err
+		}
+		lf, rf := l.bool, r.bool
+		l = exprNode{typ: exprBool, bool: func(e *alertEnv) bool { return lf(e) && rf(e) }}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.accept("!") {
+		n, err := p.parseNot()
+		if err != nil {
+			return n, err
+		}
+		if err := p.want(n, exprBool, "!"); err != nil {
+			return n, err
+		}
+		f := n.bool
+		return exprNode{typ: exprBool, bool: func(e *alertEnv) bool { return !f(e) }}, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *exprParser) parseCmp() (exprNode, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return l, err
+	}
+	if t := p.peek(); t.kind == tokIdent && t.text == "in" {
+		p.next()
+		if err := p.want(l, exprNum, "in"); err != nil {
+			return l, err
+		}
+		set := p.next()
+		lf := l.num
+		switch set.text {
+		case "work_hours":
+			return exprNode{typ: exprBool, bool: func(e *alertEnv) bool { return e.inWorkHours(lf(e)) }}, nil
+		case "work_days":
+			return exprNode{typ: exprBool, bool: func(e *alertEnv) bool { return e.inWorkDays(lf(e)) }}, nil
+		}
+		return exprNode{}, fmt.Errorf("at %d: unknown set %q (use work_hours or work_days)", set.pos, set.text)
+	}
+
+	t := p.peek()
+	if t.kind != tokOp {
+		return l, nil
+	}
+	var cmp func(a, b float64) bool
+	switch t.text {
+	case "<":
+		cmp = func(a, b float64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b float64) bool { return a <= b }
+	case ">":
+		cmp = func(a, b float64) bool { return a > b }
+	case ">=":
+		cmp = func(a, b float64) bool { return a >= b }
+	case "==":
+		cmp = func(a, b float64) bool { return a == b }
+	case "!=":
+		cmp = func(a, b float64) bool { return a != b }
+	default:
+		return l, nil
+	}
+	p.next()
+	r, err := p.parseSum()
+	if err != nil {
+		return r, err
+	}
+	if err := p.want(l, exprNum, t.text); err != nil {
+		return l, err
+	}
+	if err := p.want(r, exprNum, t.text); err != nil {
+		return r, err
+	}
+	lf, rf := l.num, r.num
+	return exprNode{typ: exprBool, bool: func(e *alertEnv) bool { return cmp(lf(e), rf(e)) }}, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return l, err
+	}
+	for {
+		var op string
+		switch {
+		case p.accept("+"):
+			op = "+"
+		case p.accept("-"):
+			op = "-"
+		default:
+			return l, nil
+		}
+		r, err := p.parseProduct()
+		if err != nil {
+			return r, err
+		}
+		if err := p.want(l, exprNum, op); err != nil {
+			return l, err
+		}
+		if err := p.want(r, exprNum, op); err != nil {
+			return r, err
+		}
+		lf, rf := l.num, r.num
+		if op == "+" {
+			l = exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return lf(e) + rf(e) }}
+		} else {
+			l = exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return lf(e) - rf(e) }}
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return l, err
+	}
+	for {
+		var op string
+		switch {
+		case p.accept("*"):
+			op = "*"
+		case p.accept("/"):
+			op = "/"
+		default:
+			return l, nil
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return r, err
+		}
+		if err := p.want(l, exprNum, op); err != nil {
+			return l, err
+		}
+		if err := p.want(r, exprNum, op); err != nil {
+			return r, err
+		}
+		lf, rf := l.num, r.num
+		if op == "*" {
+			l = exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return lf(e) * rf(e) }}
+		} else {
+			// x/0 is ±Inf or NaN, which compares the way a reader expects
+			l = exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return lf(e) / rf(e) }}
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("-") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return n, err
+		}
+		if err := p.want(n, exprNum, "-"); err != nil {
+			return n, err
+		}
+		f := n.num
+		return exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return -f(e) }}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		v := t.num
+		return exprNode{typ: exprNum, num: func(*alertEnv) float64 { return v }}, nil
+	case tokDuration:
+		return exprNode{typ: exprDuration, dur: t.dur}, nil
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return n, err
+			}
+			if !p.accept(")") {
+				return n, p.errorf("missing )")
+			}
+			return n, nil
+		}
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			v := t.text == "true"
+			return exprNode{typ: exprBool, bool: func(*alertEnv) bool { return v }}, nil
+		case "hour":
+			return exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return float64(e.local().Hour()) }}, nil
+		case "weekday":
+			return exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return float64(e.local().Weekday()) }}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		return exprNode{}, fmt.Errorf("at %d: unknown name %q", t.pos, t.text)
+	}
+	return exprNode{}, fmt.Errorf("at %d: unexpected %q", t.pos, t.text)
+}
+
+// parseCall parses the arguments of fn after its opening parenthesis.
+func (p *exprParser) parseCall(fn exprToken) (exprNode, error) {
+	switch fn.text {
+	case "avg", "min", "max", "sum", "count", "last":
+	default:
+		return exprNode{}, fmt.Errorf("at %d: unknown function %q", fn.pos, fn.text)
+	}
+	metric := ""
+	if fn.text != "count" {
+		m := p.next()
+		switch m.text {
+		case "activity_pct", "idle_seconds", "samples":
+			metric = m.text
+		default:
+			return exprNode{}, fmt.Errorf("at %d: %s needs a metric (activity_pct, idle_seconds or samples)", m.pos, fn.text)
+		}
+	}
+
+	var window time.Duration
+	if fn.text != "last" {
+		if metric != "" && !p.accept(",") {
+			return exprNode{}, p.errorf("%s needs a window, e.g. %s(%s, 3h)", fn.text, fn.text, metric)
+		}
+		w := p.next()
+		if w.kind != tokDuration || w.dur < time.Hour {
+			return exprNode{}, fmt.Errorf("at %d: %s window must be a duration of at least 1h", w.pos, fn.text)
+		}
+		window = w.dur
+		if window > p.expr.MaxWindow {
+			p.expr.MaxWindow = window
+		}
+	}
+	if !p.accept(")") {
+		return exprNode{}, p.errorf("missing ) after %s arguments", fn.text)
+	}
+
+	var agg func(vals []float64) float64
+	switch fn.text {
+	case "avg":
+		agg = func(vals []float64) float64 {
+			if len(vals) == 0 {
+				return math.NaN()
+			}
+			s := 0.0
+			for _, v := range vals {
+				s += v
+			}
+			return s / float64(len(vals))
+		}
+	case "min", "max":
+		isMin := fn.text == "min"
+		agg = func(vals []float64) float64 {
+			if len(vals) == 0 {
+				return math.NaN()
+			}
+			m := vals[0]
+			for _, v := range vals[1:] {
+				if (isMin && v < m) || (!isMin && v > m) {
+					m = v
+				}
+			}
+			return m
+		}
+	case "sum":
+		agg = func(vals []float64) float64 {
+			s := 0.0
+			for _, v := range vals {
+				s += v
+			}
+			return s
+		}
+	case "count":
+		return exprNode{typ: exprNum, num: func(e *alertEnv) float64 {
+			return float64(len(e.window(window)))
+		}}, nil
+	default: // last
+		return exprNode{typ: exprNum, num: func(e *alertEnv) float64 { return e.last(metric) }}, nil
+	}
+	return exprNode{typ: exprNum, num: func(e *alertEnv) float64 {
+		rows := e.window(window)
+		vals := make([]float64, len(rows))
+		for i, r := range rows {
+			vals[i] = metricOf(r, metric)
+		}
+		return agg(vals)
+	}}, nil
+}
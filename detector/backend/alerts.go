@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// alertEnv is what a condition sees when evaluated for one host at one
+// point in time: that host's hourly rows (oldest first) and the schedule
+// behind hour/weekday and the work_hours/work_days sets.
+type alertEnv struct {
+	now   time.Time
+	loc   *time.Location
+	sched Schedule
+	rows  []ActivityRow
+	times []time.Time
+}
+
+func newAlertEnv(now time.Time, sched Schedule, rows []ActivityRow) *alertEnv {
+	loc := time.UTC
+	if sched.TZ != "" {
+		if l, err := time.LoadLocation(sched.TZ); err == nil {
+			loc = l
+		}
+	}
+	// gap rows say nothing about the user; a down agent must not read as
+	// an hour of zero activity
+	measured := make([]ActivityRow, 0, len(rows))
+	for _, r := range rows {
+		if Status(r.Status).Measured() {
+			measured = append(measured, r)
+		}
+	}
+	times := make([]time.Time, len(measured))
+	for i, r := range measured {
+		times[i], _ = time.Parse(time.RFC3339, r.HourStart)
+	}
+	return &alertEnv{now: now, loc: loc, sched: sched, rows: measured, times: times}
+}
+
+// at returns a copy of e evaluated at another instant, sharing the rows.
+func (e *alertEnv) at(now time.Time) *alertEnv {
+	c := *e
+	c.now = now
+	return &c
+}
+
+func (e *alertEnv) local() time.Time { return e.now.In(e.loc) }
+
+// window returns the complete hours that ended within (now-d, now].
+func (e *alertEnv) window(d time.Duration) []ActivityRow {
+	from, to := e.now.Add(-d-time.Hour), e.now.Add(-time.Hour)
+	lo, hi := -1, -1
+	for i, t := range e.times {
+		if !t.After(from) {
+			continue
+		}
+		if t.After(to) {
+			break
+		}
+		if lo < 0 {
+			lo = i
+		}
+		hi = i
+	}
+	if lo < 0 {
+		return nil
+	}
+	return e.rows[lo : hi+1]
+}
+
+// last returns metric of the latest complete hour, or NaN.
+func (e *alertEnv) last(metric string) float64 {
+	to := e.now.Add(-time.Hour)
+	for i := len(e.times) - 1; i >= 0; i-- {
+		if !e.times[i].After(to) {
+			return metricOf(e.rows[i], metric)
+		}
+	}
+	return math.NaN()
+}
+
+func (e *alertEnv) inWorkHours(h float64) bool {
+	sh, _, ok1 := parseHHMM(e.sched.Start)
+	eh, em, ok2 := parseHHMM(e.sched.End)
+	if !ok1 || !ok2 {
+		return false
+	}
+	if em > 0 {
+		eh++ // 16:30 still counts hour 16
+	}
+	return h >= float64(sh) && h < float64(eh)
+}
+
+func (e *alertEnv) inWorkDays(d float64) bool {
+	for _, wd := range e.sched.Weekdays {
+		if float64(wd) == d {
+			return true
+		}
+	}
+	return false
+}
+
+func metricOf(r ActivityRow, metric string) float64 {
+	switch metric {
+	case "activity_pct":
+		return r.ActivityPct
+	case "idle_seconds":
+		return r.IdleSeconds
+	default:
+		return float64(r.Samples)
+	}
+}
+
+// Condition compiles the rule's expression. Rules created before the
+// expression language carry metric/op/threshold/window instead, which is
+// the same as "avg(metric, window) op threshold".
+func (rule AlertRule) Condition() (*AlertExpr, error) {
+	if rule.Expr != "" {
+		return CompileAlertExpr(rule.Expr)
+	}
+	d, err := time.ParseDuration(rule.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window %q", rule.Window)
+	}
+	return CompileAlertExpr(fmt.Sprintf("avg(%s, %dm) %s %g", rule.Metric, int(d.Minutes()), rule.Op, rule.Threshold))
+}
+
+// FiredAlert is one would-be notification found by backtestRule.
+type FiredAlert struct {
+	Host string `json:"host"`
+	At   string `json:"at"`
+}
+
+// backtestRule replays cond at every hour boundary in (from, to] for each
+// host, with the same rising-edge rule as AlertJob: a condition that stays
+// true fires once. byHost holds each host's rows, oldest first, and must
+// reach back cond.MaxWindow+1h before from.
+func backtestRule(cond *AlertExpr, sched Schedule, byHost map[string][]ActivityRow, from, to time.Time) []FiredAlert {
+	var fired []FiredAlert
+	for host, rows := range byHost {
+		env := newAlertEnv(from, sched, rows)
+		firing := false
+		for t := from.Truncate(time.Hour).Add(time.Hour); !t.After(to); t = t.Add(time.Hour) {
+			holds := cond.Eval(env.at(t))
+			if holds && !firing {
+				fired = append(fired, FiredAlert{Host: host, At: t.Format(time.RFC3339)})
+			}
+			firing = holds
+		}
+	}
+	sort.Slice(fired, func(i, j int) bool {
+		if fired[i].At != fired[j].At {
+			return fired[i].At < fired[j].At
+		}
+		return fired[i].Host < fired[j].Host
+	})
+	return fired
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Roles of the tokens issued through POST /admin/tokens, each bound to
+// one tenant. ADMIN_TOKEN acts as admin of any tenant (see bindTenant)
+// and alone manages tenants; INGEST_TOKEN acts as agent of the default
+// tenant, enrolled agent tokens as agent of the tenant they enrolled in.
+const (
+	roleAdmin    = "admin"     // everything, including /admin
+	roleManager  = "manager"   // every read endpoint, for any user
+	roleSelfView = "self-view" // read endpoints scoped to one user only
+	roleAgent    = "agent"     // agent write routes (/ingest, /agent, /logs)
+)
+
+var validRoles = map[string]bool{roleAdmin: true, roleManager: true, roleSelfView: true, roleAgent: true}
+
+// apiTokenKey is the fiber local holding the APIToken a request came with.
+const apiTokenKey = "api_token"
+
+// operatorKey is the fiber local set on requests made with ADMIN_TOKEN.
+const operatorKey = "operator"
+
+// bearerToken extracts the token from "Authorization: Bearer <token>".
+func bearerToken(c *fiber.Ctx) string {
+	h := c.Get(fiber.HeaderAuthorization)
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// checkAPIToken looks got up in tokens and keeps it on c when live.
+func checkAPIToken(c *fiber.Ctx, tokens *TokenRepo, got string) (APIToken, bool, error) {
+	t, ok, err := tokens.Check(c.UserContext(), got)
+	if err != nil || !ok {
+		return t, ok, err
+	}
+	c.Locals(apiTokenKey, t)
+	return t, true, nil
+}
+
+// RequireAdmin protects admin routes with the ADMIN_TOKEN bearer token or
+// an admin API token. With neither the admin API is disabled entirely.
+func RequireAdmin(tokens *TokenRepo, tenants *TenantRepo) fiber.Handler {
+	token := os.Getenv("ADMIN_TOKEN")
+	return func(c *fiber.Ctx) error {
+		got := bearerToken(c)
+		if token != "" && got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			c.Locals(operatorKey, true)
+			if err := bindTenant(c, tenants, defaultTenant, true); err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		if got != "" {
+			t, ok, err := checkAPIToken(c, tokens, got)
+			if err != nil {
+				return dbError(err)
+			}
+			if ok && t.Role == roleAdmin {
+				if err := bindTenant(c, tenants, t.Tenant, false); err != nil {
+					return err
+				}
+				return c.Next()
+			}
+			if ok {
+				return fiber.NewError(fiber.StatusForbidden, "a "+t.Role+" token cannot use the admin API")
+			}
+		}
+		if token == "" {
+			return fiber.NewError(fiber.StatusForbidden, "admin API disabled (set ADMIN_TOKEN)")
+		}
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid admin token")
+	}
+}
+
+// RequireOperator keeps a route to ADMIN_TOKEN, after RequireAdmin:
+// tenant admins only manage their own tenant.
+func RequireOperator() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if op, _ := c.Locals(operatorKey).(bool); !op {
+			return fiber.NewError(fiber.StatusForbidden, "only ADMIN_TOKEN manages tenants")
+		}
+		return c.Next()
+	}
+}
+
+// RequireReader guards the read API. Admin and manager tokens see
+// everything; a self-view token only reaches routes registered with
+// selfScoped, whose "user" query parameter is forced to the token's user
+// so that one's colleagues stay out of reach. Without a token the request
+// goes through, reading the default tenant, unless READ_AUTH=required, as
+// before roles existed; a token that is sent must be valid either way.
+func RequireReader(tokens *TokenRepo, tenants *TenantRepo, selfScoped bool) fiber.Handler {
+	required := os.Getenv("READ_AUTH") == "required"
+	admin := os.Getenv("ADMIN_TOKEN")
+	return func(c *fiber.Ctx) error {
+		got := bearerToken(c)
+		if got == "" {
+			if required {
+				return fiber.NewError(fiber.StatusUnauthorized, "a read token is required")
+			}
+			if err := bindTenant(c, tenants, defaultTenant, false); err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		if admin != "" && subtle.ConstantTimeCompare([]byte(got), []byte(admin)) == 1 {
+			if err := bindTenant(c, tenants, defaultTenant, true); err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		t, ok, err := checkAPIToken(c, tokens, got)
+		if err != nil {
+			return dbError(err)
+		}
+		if !ok {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+		}
+		if err := bindTenant(c, tenants, t.Tenant, false); err != nil {
+			return err
+		}
+		switch t.Role {
+		case roleAdmin, roleManager:
+			return c.Next()
+		case roleSelfView:
+			if !selfScoped {
+				return fiber.NewError(fiber.StatusForbidden, "a self-view token only reaches its own user's activity")
+			}
+			c.Request().URI().QueryArgs().Set("user", t.UserName)
+			return c.Next()
+		}
+		return fiber.NewError(fiber.StatusForbidden, "a "+t.Role+" token cannot read activity")
+	}
+}
+
+// RequireIngestToken guards agent write routes with the shared
+// INGEST_TOKEN, a token from POST /enroll or an agent API token, and binds
+// the request to the token's tenant. With neither INGEST_TOKEN nor
+// ENROLLMENT_SECRET set ingestion stays open, as direct rqlite writes are
+// today, for the default tenant.
+func RequireIngestToken(enrollments *EnrollmentRepo, tokens *TokenRepo, tenants *TenantRepo) fiber.Handler {
+	token := os.Getenv("INGEST_TOKEN")
+	open := token == "" && os.Getenv("ENROLLMENT_SECRET") == ""
+	return func(c *fiber.Ctx) error {
+		if open {
+			if err := bindTenant(c, tenants, defaultTenant, false); err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		got := bearerToken(c)
+		if got == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid ingest token")
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			if err := bindTenant(c, tenants, defaultTenant, false); err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		e, ok, err := enrollments.Check(c.UserContext(), got)
+		if err != nil {
+			return dbError(err)
+		}
+		if ok {
+			c.Locals(enrolledHostKey, e.Host)
+			if err := bindTenant(c, tenants, e.Tenant, false); err != nil {
+				return err
+			}
+			return c.Next()
+		}
+		t, ok, err := checkAPIToken(c, tokens, got)
+		if err != nil {
+			return dbError(err)
+		}
+		if !ok || t.Role != roleAgent {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid ingest token")
+		}
+		if err := bindTenant(c, tenants, t.Tenant, false); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// knownKey reports whether key is a credential the backend issued:
+// ADMIN_TOKEN, INGEST_TOKEN, a live API token or enrolled agent token. The
+// rate limiter only gives such keys a bucket of their own.
+func knownKey(c *fiber.Ctx, key string, enrollments *EnrollmentRepo, tokens *TokenRepo) bool {
+	for _, env := range []string{"ADMIN_TOKEN", "INGEST_TOKEN"} {
+		if t := os.Getenv(env); t != "" && subtle.ConstantTimeCompare([]byte(key), []byte(t)) == 1 {
+			return true
+		}
+	}
+	if _, ok, err := enrollments.Check(c.UserContext(), key); err == nil && ok {
+		return true
+	}
+	_, ok, err := tokens.Check(c.UserContext(), key)
+	return err == nil && ok
+}
+
+// actorFrom names whoever is behind an admin request for the audit log:
+// the API token's ID, or with the shared admin token whatever X-Actor
+// says.
+func actorFrom(c *fiber.Ctx) string {
+	if t, ok := c.Locals(apiTokenKey).(APIToken); ok {
+		return t.ID
+	}
+	if a := strings.TrimSpace(c.Get("X-Actor")); a != "" {
+		return a
+	}
+	return "admin"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// readBody returns the request body, decompressed according to
+// Content-Encoding (gzip, zstd or none), and rejects bodies that
+// decompress to more than limit bytes. Fiber's own decompression has no
+// limit, so the raw body is read instead. Sizes are counted in bodySizes.
+func readBody(c *fiber.Ctx, limit int) ([]byte, error) {
+	wire := c.Request().Body()
+	var body io.Reader = bytes.NewReader(wire)
+	encoding := strings.ToLower(c.Get(fiber.HeaderContentEncoding))
+	switch encoding {
+	case "":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "invalid gzip body")
+		}
+		defer zr.Close()
+		body = zr
+	case "zstd":
+		// the window cap keeps a hostile frame from reserving more memory
+		// than the body may decompress to
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(uint64(limit)))
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "invalid zstd body")
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, "Content-Encoding must be gzip, zstd or none")
+	}
+	data, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid %s body", encoding))
+	}
+	if len(data) > limit {
+		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("body too large (max %d MiB)", limit>>20))
+	}
+	bodySizes.add(c.Path(), encoding, len(wire), len(data))
+	return data, nil
+}
+
+// BodySize totals the request bodies of one path and Content-Encoding
+// since the backend started.
+type BodySize struct {
+	Path         string  `json:"path"`
+	Encoding     string  `json:"encoding"` // "none" when uncompressed
+	Requests     int64   `json:"requests"`
+	WireBytes    int64   `json:"wire_bytes"`
+	DecodedBytes int64   `json:"decoded_bytes"`
+	Ratio        float64 `json:"ratio"` // decoded per wire byte
+}
+
+type bodySizeMeter struct {
+	mu     sync.Mutex
+	totals map[[2]string]*BodySize
+}
+
+var bodySizes = &bodySizeMeter{totals: make(map[[2]string]*BodySize)}
+
+func (m *bodySizeMeter) add(path, encoding string, wire, decoded int) {
+	if encoding == "" {
+		encoding = "none"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.totals[[2]string{path, encoding}]
+	if t == nil {
+		t = &BodySize{Path: path, Encoding: encoding}
+		m.totals[[2]string{path, encoding}] = t
+	}
+	t.Requests++
+	t.WireBytes += int64(wire)
+	t.DecodedBytes += int64(decoded)
+}
+
+// Snapshot returns the totals ordered by path, then encoding.
+func (m *bodySizeMeter) Snapshot() []BodySize {
+	m.mu.Lock()
+	out := make([]BodySize, 0, len(m.totals))
+	for _, t := range m.totals {
+		s := *t
+		if s.WireBytes > 0 {
+			s.Ratio = float64(s.DecodedBytes) / float64(s.WireBytes)
+		}
+		out = append(out, s)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Encoding < out[j].Encoding
+	})
+	return out
+}
+
+// GET /admin/ingest/sizes
+// Wire and decoded body sizes of agent uploads on this replica since it
+// started, by path and Content-Encoding.
+func GetBodySizes(c *fiber.Ctx) error {
+	return c.JSON(bodySizes.Snapshot())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// activityCache is an in-memory TTL cache in front of ActivityRepo.GetBetween.
+// Dashboards poll the same ranges every few seconds, so even a short TTL
+// removes most of the rqlite load.
+type activityCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	start   time.Time
+	end     time.Time
+	rows    []ActivityRow
+	expires time.Time
+}
+
+func newActivityCache(ttl time.Duration) *activityCache {
+	return &activityCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+func cacheKey(tenant, startRFC3339, endRFC3339, host string) string {
+	return tenant + "|" + startRFC3339 + "|" + endRFC3339 + "|" + host
+}
+
+func (c *activityCache) get(tenant, startRFC3339, endRFC3339, host string) ([]ActivityRow, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(tenant, startRFC3339, endRFC3339, host)
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.rows, true
+}
+
+func (c *activityCache) put(tenant, startRFC3339, endRFC3339, host string, rows []ActivityRow) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	start, err1 := time.Parse(time.RFC3339, startRFC3339)
+	end, err2 := time.Parse(time.RFC3339, endRFC3339)
+	if err1 != nil || err2 != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	// opportunistic sweep so abandoned ranges don't accumulate
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[cacheKey(tenant, startRFC3339, endRFC3339, host)] = cacheEntry{
+		start:   start,
+		end:     end,
+		rows:    rows,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// invalidateRange drops every cached range overlapping [from, to).
+func (c *activityCache) invalidateRange(from, to time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if e.start.Before(to) && from.Before(e.end) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// meeting is one accepted, timed calendar event, in UTC.
+type meeting struct {
+	eventID    string
+	start, end time.Time
+}
+
+// calendarProvider is one OAuth calendar API. Accounts hold a refresh
+// token obtained out of band (admin consent flow, gcloud, ...); every sync
+// trades it for a short-lived access token.
+type calendarProvider struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+	// meetings lists the accepted meetings overlapping [from, to)
+	meetings func(ctx context.Context, p *calendarProvider, token, calendarID string, from, to time.Time) ([]meeting, error)
+	client   *http.Client
+}
+
+// calendarProvidersFromEnv returns the providers with client credentials
+// configured:
+//
+//	MS_GRAPH_CLIENT_ID, MS_GRAPH_CLIENT_SECRET, MS_GRAPH_TENANT (default "common")
+//	GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET
+func calendarProvidersFromEnv() map[string]*calendarProvider {
+	client := &http.Client{Timeout: 15 * time.Second}
+	providers := make(map[string]*calendarProvider)
+	if id := os.Getenv("MS_GRAPH_CLIENT_ID"); id != "" {
+		tenant := os.Getenv("MS_GRAPH_TENANT")
+		if tenant == "" {
+			tenant = "common"
+		}
+		providers["microsoft"] = &calendarProvider{
+			tokenURL:     "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0/token",
+			clientID:     id,
+			clientSecret: os.Getenv("MS_GRAPH_CLIENT_SECRET"),
+			scope:        "offline_access https://graph.microsoft.com/Calendars.Read",
+			meetings:     graphMeetings,
+			client:       client,
+		}
+	}
+	if id := os.Getenv("GOOGLE_CLIENT_ID"); id != "" {
+		providers["google"] = &calendarProvider{
+			tokenURL:     "https://oauth2.googleapis.com/token",
+			clientID:     id,
+			clientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			meetings:     googleMeetings,
+			client:       client,
+		}
+	}
+	return providers
+}
+
+// refresh returns an access token for refreshToken, and the refresh token
+// to keep: Microsoft rotates it on every use.
+func (p *calendarProvider) refresh(ctx context.Context, refreshToken string) (access, next string, err error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+	}
+	if p.scope != "" {
+		form.Set("scope", p.scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var out struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := p.do(req, &out); err != nil {
+		return "", "", fmt.Errorf("token refresh: %w", err)
+	}
+	if out.RefreshToken == "" {
+		out.RefreshToken = refreshToken
+	}
+	return out.AccessToken, out.RefreshToken, nil
+}
+
+// get fetches a JSON document with the access token.
+func (p *calendarProvider) get(ctx context.Context, token, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	// Graph answers in UTC instead of each event's own zone
+	req.Header.Set("Prefer", `outlook.timezone="UTC"`)
+	return p.do(req, out)
+}
+
+func (p *calendarProvider) do(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode >= 300 {
+		if len(body) > 256 {
+			body = body[:256]
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// graphMeetings reads /me/calendarView: the user's own meetings and the
+// invitations they accepted, all-day events and "free" slots excluded.
+func graphMeetings(ctx context.Context, p *calendarProvider, token, _ string, from, to time.Time) ([]meeting, error) {
+	q := url.Values{
+		"startDateTime": {from.UTC().Format(time.RFC3339)},
+		"endDateTime":   {to.UTC().Format(time.RFC3339)},
+		"$select":       {"id,start,end,showAs,isAllDay,isCancelled,responseStatus"},
+		"$top":          {"100"},
+	}
+	next := "https://graph.microsoft.com/v1.0/me/calendarView?" + q.Encode()
+	var out []meeting
+	for next != "" {
+		var page struct {
+			Value []struct {
+				ID    string `json:"id"`
+				Start struct {
+					DateTime string `json:"dateTime"`
+				} `json:"start"`
+				End struct {
+					DateTime string `json:"dateTime"`
+				} `json:"end"`
+				ShowAs         string `json:"showAs"`
+				IsAllDay       bool   `json:"isAllDay"`
+				IsCancelled    bool   `json:"isCancelled"`
+				ResponseStatus struct {
+					Response string `json:"response"`
+				} `json:"responseStatus"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		if err := p.get(ctx, token, next, &page); err != nil {
+			return nil, err
+		}
+		for _, e := range page.Value {
+			switch {
+			case e.IsAllDay, e.IsCancelled, e.ShowAs == "free":
+				continue
+			case e.ResponseStatus.Response != "organizer" && e.ResponseStatus.Response != "accepted":
+				continue
+			}
+			// "2026-03-02T09:30:00.0000000", UTC per the Prefer header
+			start, err1 := time.Parse("2006-01-02T15:04:05", strings.SplitN(e.Start.DateTime, ".", 2)[0])
+			end, err2 := time.Parse("2006-01-02T15:04:05", strings.SplitN(e.End.DateTime, ".", 2)[0])
+			if err1 != nil || err2 != nil || !end.After(start) {
+				continue
+			}
+			out = append(out, meeting{eventID: e.ID, start: start, end: end})
+		}
+		next = page.NextLink
+	}
+	return out, nil
+}
+
+// googleMeetings reads the events of calendarID ("primary" by default):
+// events the user organizes alone or accepted, all-day and "transparent"
+// (show as available) events excluded.
+func googleMeetings(ctx context.Context, p *calendarProvider, token, calendarID string, from, to time.Time) ([]meeting, error) {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	q := url.Values{
+		"timeMin":      {from.UTC().Format(time.RFC3339)},
+		"timeMax":      {to.UTC().Format(time.RFC3339)},
+		"singleEvents": {"true"},
+		"maxResults":   {"250"},
+	}
+	base := "https://www.googleapis.com/calendar/v3/calendars/" + url.PathEscape(calendarID) + "/events?"
+	var out []meeting
+	for {
+		var page struct {
+			Items []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+				Start  struct {
+					DateTime string `json:"dateTime"`
+				} `json:"start"`
+				End struct {
+					DateTime string `json:"dateTime"`
+				} `json:"end"`
+				Transparency string `json:"transparency"`
+				Attendees    []struct {
+					Self           bool   `json:"self"`
+					ResponseStatus string `json:"responseStatus"`
+				} `json:"attendees"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := p.get(ctx, token, base+q.Encode(), &page); err != nil {
+			return nil, err
+		}
+		for _, e := range page.Items {
+			if e.Status == "cancelled" || e.Transparency == "transparent" || e.Start.DateTime == "" {
+				continue
+			}
+			accepted := true
+			for _, a := range e.Attendees {
+				if a.Self {
+					accepted = a.ResponseStatus == "accepted"
+				}
+			}
+			if !accepted {
+				continue
+			}
+			start, err1 := time.Parse(time.RFC3339, e.Start.DateTime)
+			end, err2 := time.Parse(time.RFC3339, e.End.DateTime)
+			if err1 != nil || err2 != nil || !end.After(start) {
+				continue
+			}
+			out = append(out, meeting{eventID: e.ID, start: start.UTC(), end: end.UTC()})
+		}
+		if page.NextPageToken == "" {
+			return out, nil
+		}
+		q.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// meetingHours is the set of "user|hour_start" pairs that overlap a
+// meeting.
+type meetingHours map[string]bool
+
+func (m meetingHours) has(user, hourStart string) bool {
+	return user != "" && m[user+"|"+hourStart]
+}
+
+// hourSpan returns the [from, to) range covering hour starts, for loading
+// the meetingHours of a batch of rows; ok is false when none parse.
+func hourSpan(hourStarts []string) (from, to time.Time, ok bool) {
+	for _, s := range hourStarts {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			continue
+		}
+		if !ok || t.Before(from) {
+			from = t
+		}
+		if !ok || !t.Before(to) {
+			to = t.Add(time.Hour)
+		}
+		ok = true
+	}
+	return from, to, ok
+}
+
+// labelMeetings returns rows with the LOW hours that overlap a meeting of
+// their user shown as IN_MEETING, for rows the calendar job has not
+// relabeled yet. rows itself may be cached and is not modified.
+func labelMeetings(ctx context.Context, calendars *CalendarRepo, rows []ActivityRow) ([]ActivityRow, error) {
+	var low []string
+	for _, r := range rows {
+		if r.Status == string(StatusLow) && r.UserName != "" {
+			low = append(low, r.HourStart)
+		}
+	}
+	from, to, ok := hourSpan(low)
+	if !ok {
+		return rows, nil
+	}
+	hours, err := calendars.MeetingHours(ctx, from, to)
+	if err != nil || len(hours) == 0 {
+		return rows, err
+	}
+	out := make([]ActivityRow, len(rows))
+	copy(out, rows)
+	for i, r := range out {
+		if r.Status == string(StatusLow) && hours.has(r.UserName, r.HourStart) {
+			out[i].Status = string(StatusInMeeting)
+		}
+	}
+	return out, nil
+}
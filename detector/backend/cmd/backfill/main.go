@@ -0,0 +1,246 @@
+// Command backfill recovers hourly history from the agent's daily log
+// files when the rqlite sink was disabled or unreachable:
+//
+//	backfill -dir 'C:\ProgramData\ActivityMonitor' -host PC-COMPTA-01 -user sara \
+//	         -rqlite http://192.168.1.15:4001 -from 2026-01-01 -to 2026-02-01
+//
+// It reads every activity-YYYY-MM-DD.log in dir, rebuilds hourly buckets
+// from the STATUS / MODE CHANGE and MOUSE MOVE lines (see logimport) and
+// inserts the hours that are not stored yet or only hold a NO_DATA /
+// AGENT_DOWN placeholder; hours the agent did upload are never
+// overwritten, so running it twice is harmless.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"detector-api/logimport"
+	"detector-api/pseudonym"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// batchSize matches the backend's maxIngestRows.
+const batchSize = 500
+
+// statusThresholds mirrors the backend's status_thresholds setting.
+type statusThresholds struct {
+	LowBelow    float64 `json:"low_below"`
+	ActiveBelow float64 `json:"active_below"`
+}
+
+type row struct {
+	hourStart   string
+	activityPct float64
+	idleSeconds float64
+	samples     int64
+	status      string
+}
+
+func main() {
+	hn, _ := os.Hostname()
+	rqliteURL := os.Getenv("RQLITE_URL")
+	if rqliteURL == "" {
+		rqliteURL = "http://192.168.1.15:4001"
+	}
+	var (
+		dir         = flag.String("dir", `C:\ProgramData\ActivityMonitor`, "directory holding activity-YYYY-MM-DD.log files")
+		base        = flag.String("base", "activity", "log base name (the agent's LogBaseName)")
+		rqlite      = flag.String("rqlite", rqliteURL, "rqlite URL, credentials included if any")
+		host        = flag.String("host", hn, "host the logs belong to")
+		userName    = flag.String("user", os.Getenv("USERNAME"), "user_name for the rows")
+		displayName = flag.String("display-name", "", "display_name for the rows")
+		team        = flag.String("team", "", "team for the rows")
+		from        = flag.String("from", "", "first day to import, YYYY-MM-DD (default: all)")
+		to          = flag.String("to", "", "day to stop before, YYYY-MM-DD (default: all)")
+		dryRun      = flag.Bool("dry-run", false, "print the hours instead of inserting them")
+		key         = flag.String("pseudonym-key", os.Getenv("PSEUDONYM_KEY"), "site key the agent pseudonymized with (its PseudonymKey), if any")
+		tenant      = flag.String("tenant", "default", "tenant the host belongs to")
+	)
+	flag.Parse()
+	if *host == "" {
+		log.Fatal("-host is required")
+	}
+	// store the same tokens the agent would have
+	if *key != "" {
+		*host = pseudonym.Token(*key, pseudonym.Host, *host)
+		if *userName != "" {
+			*userName = pseudonym.Token(*key, pseudonym.User, *userName)
+		}
+		*displayName = ""
+	}
+
+	files, err := logFiles(*dir, *base, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(files) == 0 {
+		log.Fatalf("no %s-YYYY-MM-DD.log files in %s for that range", *base, *dir)
+	}
+
+	// parse every file before bucketing so sessions spanning midnight
+	// are stitched back together
+	var points []logimport.Point
+	for _, f := range files {
+		fh, err := os.Open(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p, skipped, err := logimport.Parse(fh)
+		fh.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", f, err)
+		}
+		if skipped > 0 {
+			log.Printf("%s: skipped %d unreadable lines", filepath.Base(f), skipped)
+		}
+		points = append(points, p...)
+	}
+	hours := logimport.Bucket(points)
+
+	conn, err := gorqlite.Open(*rqlite)
+	if err != nil {
+		log.Fatalf("rqlite: %v", err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	thresholds, err := loadThresholds(ctx, conn, *tenant)
+	if err != nil {
+		log.Fatalf("rqlite: %v", err)
+	}
+	rows := make([]row, 0, len(hours))
+	for _, h := range hours {
+		pct := h.ActivityPct()
+		samples := int64(h.Monitored)
+		rows = append(rows, row{
+			hourStart:   h.Start.Format("2006-01-02T15:00:00Z"),
+			activityPct: pct,
+			idleSeconds: h.IdleSeconds,
+			samples:     samples,
+			status:      classify(pct, samples, thresholds),
+		})
+	}
+
+	if *dryRun {
+		for _, r := range rows {
+			fmt.Printf("%s activity=%.0f%% idleSeconds=%.0f samples=%d status=%s\n",
+				r.hourStart, r.activityPct, r.idleSeconds, r.samples, r.status)
+		}
+		log.Printf("%d files, %d hours (dry run)", len(files), len(rows))
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var inserted int64
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		stmts := make([]gorqlite.ParameterizedStatement, 0, end-start)
+		for _, r := range rows[start:end] {
+			stmts = append(stmts, gorqlite.ParameterizedStatement{
+				Query: `INSERT INTO activity_hourly
+				        (tenant, hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at)
+				        VALUES (?, ?, ?, ?, ?, ?, '{}', ?, ?, ?, ?, ?)
+				        ON CONFLICT (tenant, hour_start, host, user_name) DO UPDATE SET
+				          user_name = excluded.user_name, display_name = excluded.display_name, team = excluded.team,
+				          activity_pct = excluded.activity_pct, idle_seconds = excluded.idle_seconds,
+				          samples = excluded.samples, status = excluded.status, created_at = excluded.created_at
+				        WHERE activity_hourly.deleted_at IS NULL AND activity_hourly.status IN ('NO_DATA', 'AGENT_DOWN')`,
+				Arguments: []interface{}{*tenant, r.hourStart, *host, *userName, *displayName, *team,
+					r.activityPct, r.idleSeconds, r.samples, r.status, now},
+			})
+		}
+		res, err := conn.WriteParameterizedContext(ctx, stmts)
+		if err != nil {
+			log.Fatalf("rqlite: %v (%d hours inserted before the failure)", err, inserted)
+		}
+		for _, wr := range res {
+			inserted += wr.RowsAffected
+		}
+	}
+	log.Printf("%d files, %d hours: %d inserted, %d already present",
+		len(files), len(rows), inserted, int64(len(rows))-inserted)
+}
+
+// logFiles lists base-YYYY-MM-DD.log files in dir within [from, to), in
+// date order.
+func logFiles(dir, base, from, to string) ([]string, error) {
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return nil, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", d)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, base+"-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		day := strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), ".log")
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			continue
+		}
+		if (from != "" && day < from) || (to != "" && day >= to) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadThresholds reads tenant's status_thresholds setting, falling back to
+// the backend's defaults when no admin has set one.
+func loadThresholds(ctx context.Context, conn *gorqlite.Connection, tenant string) (statusThresholds, error) {
+	t := statusThresholds{LowBelow: 50, ActiveBelow: 60}
+	qr, err := conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+		Query:     `SELECT value FROM settings WHERE tenant = ? AND key = ?`,
+		Arguments: []interface{}{tenant, "status_thresholds"},
+	})
+	if err != nil {
+		return t, err
+	}
+	if qr.Next() {
+		var v string
+		if err := qr.Scan(&v); err != nil {
+			return t, err
+		}
+		if err := json.Unmarshal([]byte(v), &t); err != nil {
+			return t, fmt.Errorf("status_thresholds: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// classify mirrors Classify in the backend.
+func classify(activityPct float64, samples int64, t statusThresholds) string {
+	if samples == 0 || activityPct == 0 {
+		return "OFF"
+	}
+	if activityPct < t.LowBelow {
+		return "LOW"
+	}
+	if activityPct < t.ActiveBelow {
+		return "ACTIVE"
+	}
+	return "HIGH_PRODUCTION"
+}
@@ -0,0 +1,308 @@
+// Command loadgen simulates a fleet of agents against a backend to size
+// the rqlite cluster before a rollout:
+//
+//	loadgen -backend http://staging:8080 -agents 500 -duration 10m
+//
+// Every simulated agent heartbeats, uploads an hourly bucket and uploads a
+// compressed chunk of raw samples at the configured rates (the defaults
+// compress an agent's hour into a minute), each agent starting at a random
+// offset so requests spread like a real fleet's. At the end it prints the
+// request count, error count and latency distribution of each endpoint.
+//
+// Rows are written for hosts named -prefix plus a number: point it at a
+// staging cluster, not production. Run the backend with RATE_LIMIT_IP=0
+// and RATE_LIMIT_KEY=0, or every agent shares one client's quota and most
+// requests come back 429.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"taxonomy"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// endpoints in report order
+var endpoints = []string{"/agent/heartbeat", "/ingest/hourly", "/ingest/samples"}
+
+func main() {
+	var (
+		backend     = flag.String("backend", envOr("BACKEND_URL", "http://localhost:8080"), "backend URL")
+		token       = flag.String("token", os.Getenv("INGEST_TOKEN"), "the backend's INGEST_TOKEN, if set")
+		agents      = flag.Int("agents", 50, "simulated agents")
+		duration    = flag.Duration("duration", time.Minute, "how long to run")
+		prefix      = flag.String("prefix", "loadgen-", "host name prefix of the simulated agents")
+		heartbeat   = flag.Duration("heartbeat-every", 5*time.Second, "heartbeat interval per agent (agents: 5m)")
+		hourly      = flag.Duration("hourly-every", time.Minute, "hourly bucket interval per agent (agents: 1h)")
+		samples     = flag.Duration("samples-every", 5*time.Second, "raw sample chunk interval per agent (agents: 5m)")
+		chunk       = flag.Int("samples-per-chunk", 300, "samples per chunk (agents: 300 at 1s sampling)")
+		compression = flag.String("compression", "gzip", "sample chunk encoding: gzip, zstd or none")
+	)
+	flag.Parse()
+	if *agents <= 0 || *chunk <= 0 {
+		log.Fatal("-agents and -samples-per-chunk must be positive")
+	}
+	if *compression != "gzip" && *compression != "zstd" && *compression != "none" {
+		log.Fatal("-compression must be gzip, zstd or none")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	l := &loadgen{
+		backend:     strings.TrimRight(*backend, "/"),
+		token:       *token,
+		compression: *compression,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: *agents},
+		},
+		stats: make(map[string]*latencies),
+	}
+	for _, e := range endpoints {
+		l.stats[e] = &latencies{codes: make(map[int]int)}
+	}
+
+	log.Printf("loadgen: %d agents for %s against %s", *agents, *duration, l.backend)
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < *agents; i++ {
+		a := &agent{
+			host:   fmt.Sprintf("%s%04d", *prefix, i),
+			user:   fmt.Sprintf("user%04d", i),
+			hour:   time.Now().UTC().Truncate(time.Hour),
+			cursor: time.Now().UTC().Truncate(time.Second).Add(-24 * time.Hour),
+		}
+		wg.Add(3)
+		go func() { defer wg.Done(); l.every(ctx, *heartbeat, a.heartbeat) }()
+		go func() { defer wg.Done(); l.every(ctx, *hourly, a.hourly) }()
+		go func() { defer wg.Done(); l.every(ctx, *samples, func() (string, any) { return a.samples(*chunk) }) }()
+	}
+	wg.Wait()
+	l.report(os.Stdout, time.Since(started))
+}
+
+// loadgen sends the requests and records their outcome per endpoint.
+type loadgen struct {
+	backend     string
+	token       string
+	compression string
+	client      *http.Client
+
+	mu    sync.Mutex
+	stats map[string]*latencies
+}
+
+// every sends next's request every interval, after a random first delay
+// within one interval, until ctx ends.
+func (l *loadgen) every(ctx context.Context, interval time.Duration, next func() (path string, body any)) {
+	wait := time.Duration(rand.Int64N(int64(interval)))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		path, body := next()
+		l.send(ctx, path, body)
+		wait = interval
+	}
+}
+
+func (l *loadgen) send(ctx context.Context, path string, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoding := ""
+	if path == "/ingest/samples" && l.compression != "none" {
+		encoding = l.compression
+		if data, err = compress(encoding, data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.backend+path, bytes.NewReader(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if l.token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.token)
+	}
+
+	start := time.Now()
+	resp, err := l.client.Do(req)
+	took := time.Since(start)
+	code := 0
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		code = resp.StatusCode
+	} else if ctx.Err() != nil {
+		return // cut short by the end of the run
+	}
+	l.mu.Lock()
+	l.stats[path].add(took, code)
+	l.mu.Unlock()
+}
+
+func compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "zstd" {
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// agent is one simulated machine. Each hourly upload is a new hour before
+// the previous one and each sample chunk follows the previous one, so the
+// backend's dedupe and INSERT OR IGNORE never short-circuit a write.
+type agent struct {
+	host, user string
+
+	mu     sync.Mutex
+	hour   time.Time // last hour uploaded
+	cursor time.Time // next sample timestamp
+}
+
+func (a *agent) heartbeat() (string, any) {
+	return "/agent/heartbeat", map[string]any{
+		"host":             a.host,
+		"user_name":        a.user,
+		"agent_version":    "loadgen",
+		"protocol_version": 1,
+		"os":               "windows",
+	}
+}
+
+func (a *agent) hourly() (string, any) {
+	a.mu.Lock()
+	a.hour = a.hour.Add(-time.Hour)
+	hour := a.hour
+	a.mu.Unlock()
+	idle := rand.Float64() * 3600
+	pct := 100 * (1 - idle/3600)
+	return "/ingest/hourly", []map[string]any{{
+		"hour_start":   hour.Format(time.RFC3339),
+		"host":         a.host,
+		"user_name":    a.user,
+		"activity_pct": pct,
+		"idle_seconds": idle,
+		"samples":      3600,
+		"status":       taxonomy.Classify(pct, 3600, taxonomy.DefaultThresholds),
+		"mouse_events": rand.IntN(2000),
+		"key_events":   rand.IntN(8000),
+	}}
+}
+
+func (a *agent) samples(n int) (string, any) {
+	a.mu.Lock()
+	start := a.cursor
+	a.cursor = a.cursor.Add(time.Duration(n) * time.Second)
+	a.mu.Unlock()
+	samples := make([]map[string]any, n)
+	idle := int64(0)
+	for i := range samples {
+		// idle grows by the second until a random input resets it
+		if rand.IntN(20) == 0 {
+			idle = 0
+		} else {
+			idle += 1000
+		}
+		samples[i] = map[string]any{
+			"ts":          start.Add(time.Duration(i) * time.Second).Format(time.RFC3339),
+			"idle_ms":     idle,
+			"interval_ms": 1000,
+		}
+	}
+	return "/ingest/samples", map[string]any{"host": a.host, "user_name": a.user, "samples": samples}
+}
+
+// latencies is one endpoint's outcomes; code 0 is a transport error.
+type latencies struct {
+	took  []time.Duration
+	codes map[int]int
+}
+
+func (s *latencies) add(took time.Duration, code int) {
+	s.took = append(s.took, took)
+	s.codes[code]++
+}
+
+// percentile returns the p-th percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+func (l *loadgen) report(w io.Writer, elapsed time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(w, "%-18s %8s %8s %8s %9s %9s %9s %9s  %s\n",
+		"endpoint", "requests", "errors", "req/s", "p50", "p90", "p99", "max", "status codes")
+	for _, e := range endpoints {
+		s := l.stats[e]
+		sort.Slice(s.took, func(i, j int) bool { return s.took[i] < s.took[j] })
+		errors := 0
+		var codes []string
+		for code, n := range s.codes {
+			if code < 200 || code > 299 {
+				errors += n
+			}
+			codes = append(codes, fmt.Sprintf("%d:%d", code, n))
+		}
+		sort.Strings(codes)
+		fmt.Fprintf(w, "%-18s %8d %8d %8.1f %9s %9s %9s %9s  %s\n",
+			e, len(s.took), errors, float64(len(s.took))/elapsed.Seconds(),
+			ms(percentile(s.took, 50)), ms(percentile(s.took, 90)), ms(percentile(s.took, 99)),
+			ms(percentile(s.took, 100)), strings.Join(codes, " "))
+	}
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORSFromEnv configures cross-origin access for the dashboard:
+//
+//	CORS_ALLOW_ORIGINS      comma-separated origins, "*" for any (default: Vite dev server)
+//	CORS_ALLOW_METHODS      default GET,POST,PUT,PATCH,DELETE,OPTIONS
+//	CORS_ALLOW_HEADERS      default Content-Type,Authorization,X-API-Key,X-Request-ID,traceparent
+//	CORS_ALLOW_CREDENTIALS  "true" to allow cookies/Authorization (not with "*")
+func CORSFromEnv() fiber.Handler {
+	cfg := cors.Config{
+		AllowOrigins:     envList("CORS_ALLOW_ORIGINS", "http://localhost:5173"),
+		AllowMethods:     envList("CORS_ALLOW_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"),
+		AllowHeaders:     envList("CORS_ALLOW_HEADERS", "Content-Type,Authorization,X-API-Key,X-Request-ID,traceparent"),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		ExposeHeaders:    "X-Request-ID,X-RateLimit-Limit,X-RateLimit-Remaining,Retry-After,Content-Disposition",
+		MaxAge:           600,
+	}
+	if cfg.AllowCredentials && cfg.AllowOrigins == "*" {
+		log.Fatal("CORS_ALLOW_CREDENTIALS=true requires explicit CORS_ALLOW_ORIGINS, not *")
+	}
+	return cors.New(cfg)
+}
+
+// envList normalizes a comma-separated env value ("a, b" -> "a,b").
+func envList(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	parts := strings.Split(v, ",")
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, ",")
+}
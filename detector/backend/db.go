@@ -1,20 +1,332 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rqlite/gorqlite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func OpenRqliteFromEnv() *gorqlite.Connection {
-	url := os.Getenv("RQLITE_URL")
-	if url == "" {
-		url = "http://192.168.1.15:4001"
+// Read consistency levels understood by rqlite.
+const (
+	ConsistencyNone   = "none"
+	ConsistencyWeak   = "weak"
+	ConsistencyStrong = "strong"
+)
+
+func validConsistency(level string) bool {
+	switch level {
+	case ConsistencyNone, ConsistencyWeak, ConsistencyStrong:
+		return true
 	}
-	conn, err := gorqlite.Open(url)
-	if err != nil {
+	return false
+}
+
+// DB holds a small pool of gorqlite connections per read consistency
+// level. A gorqlite connection carries its level, so per-request overrides
+// pick another pool instead of mutating a shared connection, and calls are
+// spread over the pool round-robin since a connection refreshes its
+// cluster view in place.
+//
+// RQLITE_URL may list several nodes separated by commas. Connections are
+// opened against the first reachable node, and a query failing because
+// the node is unreachable is retried against the next one. Every call is
+// bounded by RQLITE_TIMEOUT and timed in queryStats.
+type DB struct {
+	nodes        []string
+	defaultLevel string
+	poolSize     int
+	timeout      time.Duration
+
+	mu      sync.Mutex
+	current int // index into nodes
+	conns   map[string][]*gorqlite.Connection
+	next    atomic.Uint64 // round-robin over a pool
+}
+
+func OpenRqliteFromEnv() *DB {
+	raw := os.Getenv("RQLITE_URL")
+	if raw == "" {
+		raw = "http://192.168.1.15:4001"
+	}
+	var nodes []string
+	for _, n := range strings.Split(raw, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == 0 {
+		log.Fatal("RQLITE_URL lists no nodes")
+	}
+
+	level := os.Getenv("RQLITE_CONSISTENCY")
+	if level == "" {
+		level = ConsistencyWeak
+	}
+	if !validConsistency(level) {
+		log.Fatalf("invalid RQLITE_CONSISTENCY %q (use none, weak or strong)", level)
+	}
+
+	poolSize := 4
+	if v := os.Getenv("RQLITE_POOL"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid RQLITE_POOL %q (want a positive count)", v)
+		}
+		poolSize = n
+	}
+	// gorqlite connections share http.DefaultTransport, which keeps only
+	// two idle connections per node: concurrent queries beyond that would
+	// each open a new TCP connection
+	if t, ok := http.DefaultTransport.(*http.Transport); ok && t.MaxIdleConnsPerHost < 4*poolSize {
+		t.MaxIdleConnsPerHost = 4 * poolSize
+	}
+
+	db := &DB{
+		nodes:        nodes,
+		defaultLevel: level,
+		poolSize:     poolSize,
+		timeout:      envDuration("RQLITE_TIMEOUT", 10*time.Second),
+		conns:        make(map[string][]*gorqlite.Connection),
+	}
+	if _, _, err := db.conn(""); err != nil {
 		log.Fatal(err)
 	}
-	return conn
+	return db
+}
+
+// conn returns the next connection of level's pool, opening the pool on
+// first use. An empty level selects RQLITE_CONSISTENCY. The index of the
+// node it points at is returned too, so a caller seeing it fail can fail
+// over from that node.
+func (db *DB) conn(level string) (*gorqlite.Connection, int, error) {
+	if level == "" {
+		level = db.defaultLevel
+	}
+	if !validConsistency(level) {
+		return nil, 0, fmt.Errorf("invalid consistency level %q", level)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if pool, ok := db.conns[level]; ok {
+		return pool[db.next.Add(1)%uint64(len(pool))], db.current, nil
+	}
+
+	var errs []error
+	for i := 0; i < len(db.nodes); i++ {
+		idx := (db.current + i) % len(db.nodes)
+		connURL, err := withLevel(db.nodes[idx], level)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pool, err := openPool(connURL, db.poolSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", redactNode(db.nodes[idx]), err))
+			continue
+		}
+		if idx != db.current {
+			// connections for other levels still point at the old node
+			db.switchTo(idx)
+		}
+		db.conns[level] = pool
+		return pool[0], idx, nil
+	}
+	return nil, 0, fmt.Errorf("no rqlite node reachable: %w", errors.Join(errs...))
+}
+
+// openPool opens n connections to connURL, or none.
+func openPool(connURL string, n int) ([]*gorqlite.Connection, error) {
+	pool := make([]*gorqlite.Connection, 0, n)
+	for len(pool) < n {
+		conn, err := gorqlite.Open(connURL)
+		if err != nil {
+			for _, c := range pool {
+				c.Close()
+			}
+			return nil, err
+		}
+		pool = append(pool, conn)
+	}
+	return pool, nil
+}
+
+// failover moves away from node unless another caller already did.
+func (db *DB) failover(node int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if node != db.current || len(db.nodes) < 2 {
+		return
+	}
+	next := (node + 1) % len(db.nodes)
+	log.Printf("rqlite: node %s unreachable, failing over to %s", redactNode(db.nodes[node]), redactNode(db.nodes[next]))
+	db.switchTo(next)
+}
+
+// switchTo must be called with db.mu held.
+func (db *DB) switchTo(idx int) {
+	db.closeAll()
+	db.current = idx
+}
+
+// closeAll must be called with db.mu held.
+func (db *DB) closeAll() {
+	for level, pool := range db.conns {
+		for _, c := range pool {
+			c.Close()
+		}
+		delete(db.conns, level)
+	}
+}
+
+// withFailover runs fn against the current node, retrying on the next node
+// while the error says the node could not be reached at all. fn gets ctx
+// bounded by RQLITE_TIMEOUT; a call that runs out of time fails with an
+// error wrapping the context's, without failing over, since gorqlite
+// reports it like an unreachable node.
+func (db *DB) withFailover(ctx context.Context, op, level, sql string, fn func(context.Context, *gorqlite.Connection) error) error {
+	stmt := compactSQL(sql)
+	ctx, sp := startSpan(ctx, "rqlite."+op, trace.SpanKindClient,
+		attribute.String("db.system", "rqlite"),
+		attribute.String("db.operation", op),
+		attribute.String("db.statement", stmt),
+		attribute.String("rqlite.level", level),
+	)
+	var err error
+	start := time.Now()
+	defer func() {
+		queryStats.add(op, stmt, time.Since(start), err)
+		sp.End(err)
+	}()
+	if db.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, db.timeout)
+		defer cancel()
+	}
+
+	for attempt := 0; attempt < len(db.nodes); attempt++ {
+		var (
+			conn *gorqlite.Connection
+			node int
+		)
+		conn, node, err = db.conn(level)
+		if err != nil {
+			return err
+		}
+		err = fn(ctx, conn)
+		if err != nil && ctx.Err() != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				markQueryTimedOut(ctx)
+			}
+			err = fmt.Errorf("rqlite %s: %w", op, ctx.Err())
+			return err
+		}
+		if err == nil || !isUnreachable(err) {
+			return err
+		}
+		db.failover(node)
+	}
+	return err
+}
+
+// QueryOne runs one parameterized SELECT with failover.
+func (db *DB) QueryOne(ctx context.Context, level string, stmt gorqlite.ParameterizedStatement) (gorqlite.QueryResult, error) {
+	var qr gorqlite.QueryResult
+	err := db.withFailover(ctx, "query", level, stmt.Query, func(ctx context.Context, conn *gorqlite.Connection) error {
+		var err error
+		qr, err = conn.QueryOneParameterizedContext(ctx, stmt)
+		return err
+	})
+	return qr, err
+}
+
+// compactSQLs memoizes compactSQL: statements are mostly package-level
+// constants, so the same few hundred strings come back on every request.
+// rqlite's HTTP API has no prepared statements to reuse server-side.
+var compactSQLs sync.Map // raw SQL -> compacted
+
+// compactSQL collapses whitespace and truncates a statement for span logs
+// and query metrics.
+func compactSQL(sql string) string {
+	if v, ok := compactSQLs.Load(sql); ok {
+		return v.(string)
+	}
+	short := strings.Join(strings.Fields(sql), " ")
+	if len(short) > 160 {
+		short = short[:160] + "..."
+	}
+	compactSQLs.Store(sql, short)
+	return short
+}
+
+// isUnreachable reports transport failures; SQL errors come back in the
+// result instead and must not trigger a failover.
+func isUnreachable(err error) bool {
+	return strings.Contains(err.Error(), "tried all peers unsuccessfully")
+}
+
+// withLevel sets the gorqlite "level" option on an rqlite URL.
+func withLevel(rawURL, level string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("level", level)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// redactNode strips credentials from a node URL for logging.
+func redactNode(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
+
+// Write runs statements as one transaction with failover and returns the
+// first per-statement error, if any.
+func (db *DB) Write(ctx context.Context, stmts []gorqlite.ParameterizedStatement) ([]gorqlite.WriteResult, error) {
+	var results []gorqlite.WriteResult
+	sql := ""
+	if len(stmts) > 0 {
+		sql = stmts[0].Query
+	}
+	err := db.withFailover(ctx, "write", "", sql, func(ctx context.Context, conn *gorqlite.Connection) error {
+		var err error
+		results, err = conn.WriteParameterizedContext(ctx, stmts)
+		return err
+	})
+	for _, wr := range results {
+		if wr.Err != nil {
+			return results, wr.Err
+		}
+	}
+	return results, err
+}
+
+// Close marks every open connection closed.
+func (db *DB) Close() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closeAll()
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Deadline gives every request a time budget carried in c.UserContext()
+// down to the rqlite calls. Clients may ask for a shorter (or longer)
+// budget with X-Request-Timeout ("2.5" seconds or a Go duration like
+// "1500ms"), capped at max. Requests that run out get a 504, and so do
+// requests where a single rqlite call ran out of RQLITE_TIMEOUT first,
+// even though handlers report database errors as 502.
+func Deadline(def, max time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		budget := def
+		if h := c.Get("X-Request-Timeout"); h != "" {
+			d, ok := parseTimeoutHeader(h)
+			if !ok {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid X-Request-Timeout (use seconds or a duration like 1500ms)")
+			}
+			budget = d
+		}
+		if budget > max {
+			budget = max
+		}
+
+		queryTimedOut := new(atomic.Bool)
+		ctx, cancel := context.WithTimeout(context.WithValue(c.UserContext(), queryTimeoutKey{}, queryTimedOut), budget)
+		defer cancel()
+		c.SetUserContext(ctx)
+		c.Set("X-Request-Timeout", budget.String())
+
+		err := c.Next()
+		if err == nil {
+			return nil
+		}
+		message := ""
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			message = "request did not complete within its time budget"
+		case queryTimedOut.Load() || errors.Is(err, context.DeadlineExceeded):
+			message = "a database query did not complete within RQLITE_TIMEOUT"
+		}
+		if message != "" {
+			return &APIError{
+				Status:  fiber.StatusGatewayTimeout,
+				Code:    "deadline_exceeded",
+				Message: message,
+				Details: fiber.Map{"budget_ms": budget.Milliseconds()},
+			}
+		}
+		return err
+	}
+}
+
+type queryTimeoutKey struct{}
+
+// markQueryTimedOut records on the request behind ctx, if any, that one of
+// its database calls ran out of time, so Deadline answers 504 whatever
+// error the handler turned that into.
+func markQueryTimedOut(ctx context.Context) {
+	if flag, ok := ctx.Value(queryTimeoutKey{}).(*atomic.Bool); ok {
+		flag.Store(true)
+	}
+}
+
+func parseTimeoutHeader(h string) (time.Duration, bool) {
+	if secs, err := strconv.ParseFloat(h, 64); err == nil {
+		if secs <= 0 {
+			return 0, false
+		}
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	d, err := time.ParseDuration(h)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// envDuration reads a Go duration ("30s", "6h") from the environment,
+// falling back to def when unset or malformed.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.Error("invalid duration, using default", "key", key, "value", v, "default", def.String())
+		return def
+	}
+	return d
+}
+
+// envInt reads a positive integer from the environment, falling back to
+// def when unset or malformed.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		logger.Error("invalid integer, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return n
+}
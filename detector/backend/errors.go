@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIError is the body of every error reply:
+//
+//	{"code": "not_found", "message": "no row for that hour and host", "request_id": "..."}
+//
+// Code is one of errorCodes and is what clients should branch on; Message
+// is for people. Handlers keep returning fiber.NewError, whose status
+// picks the code, or an *APIError when they have details to add.
+type APIError struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// ErrorCode describes one code an error reply may carry.
+type ErrorCode struct {
+	Code        string `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+// errorCodes are the codes of APIError, one per HTTP status the API uses.
+var errorCodes = []ErrorCode{
+	{"bad_request", fiber.StatusBadRequest, "malformed request or invalid parameter"},
+	{"unauthorized", fiber.StatusUnauthorized, "missing or invalid admin or ingest token"},
+	{"forbidden", fiber.StatusForbidden, "the API is disabled on this backend"},
+	{"not_found", fiber.StatusNotFound, "no such route or record"},
+	{"method_not_allowed", fiber.StatusMethodNotAllowed, "the route does not accept this method"},
+	{"canceled", fiber.StatusRequestTimeout, "the client went away before the reply"},
+	{"conflict", fiber.StatusConflict, "the request is ambiguous or clashes with stored data"},
+	{"payload_too_large", fiber.StatusRequestEntityTooLarge, "body or batch over the size limit"},
+	{"unsupported_media_type", fiber.StatusUnsupportedMediaType, "unknown Content-Encoding"},
+	{"invalid_value", fiber.StatusUnprocessableEntity, "well-formed request with an out-of-range or unknown value"},
+	{"rate_limited", fiber.StatusTooManyRequests, "too many requests from this client or key, retry later"},
+	{"internal", fiber.StatusInternalServerError, "bug or broken setting on the backend"},
+	{"db_error", fiber.StatusBadGateway, "rqlite rejected or failed the query"},
+	{"db_unavailable", fiber.StatusServiceUnavailable, "no rqlite node could be reached"},
+	{"deadline_exceeded", fiber.StatusGatewayTimeout, "the request or one of its queries ran out of time"},
+}
+
+// codeFor returns the code of status.
+func codeFor(status int) string {
+	for _, c := range errorCodes {
+		if c.Status == status {
+			return c.Code
+		}
+	}
+	if status >= 500 {
+		return "internal"
+	}
+	return "bad_request"
+}
+
+// dbError maps an error from a repo to the reply it deserves: 504 when
+// the request or query ran out of time, 503 when no node answered, 409 on
+// a constraint violation and 502 for anything else rqlite reported.
+func dbError(err error) error {
+	msg := err.Error()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fiber.NewError(fiber.StatusGatewayTimeout, msg)
+	case errors.Is(err, context.Canceled):
+		return fiber.NewError(fiber.StatusRequestTimeout, msg)
+	case isUnreachable(err):
+		return fiber.NewError(fiber.StatusServiceUnavailable, msg)
+	case strings.Contains(msg, "constraint failed"):
+		return fiber.NewError(fiber.StatusConflict, msg)
+	}
+	return fiber.NewError(fiber.StatusBadGateway, msg)
+}
+
+// toAPIError turns any error a handler returned into the reply envelope.
+// Other errors are bugs (500) unless they say the database timed out or
+// could not be reached.
+func toAPIError(err error) *APIError {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		if ae.Code == "" {
+			ae.Code = codeFor(ae.Status)
+		}
+		return ae
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return &APIError{Status: fe.Code, Code: codeFor(fe.Code), Message: fe.Message}
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || isUnreachable(err) {
+		return toAPIError(dbError(err))
+	}
+	return &APIError{Status: fiber.StatusInternalServerError, Code: "internal", Message: err.Error()}
+}
+
+// ErrorHandler writes errors returned by handlers and middleware as an
+// APIError, tagged with the request ID.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	ae := toAPIError(err)
+	ae.RequestID = requestIDFrom(c.UserContext())
+	return c.Status(ae.Status).JSON(ae)
+}
+
+// GET /errors
+// The codes error replies may carry, with their HTTP status.
+func GetErrorCodes(c *fiber.Ctx) error {
+	return c.JSON(errorCodes)
+}
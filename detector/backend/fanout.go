@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// fanOut calls fn for every key with at most workers calls in flight and
+// returns the results in key order. The first error cancels the remaining
+// calls and is returned.
+func fanOut[T any](ctx context.Context, keys []string, workers int, fn func(ctx context.Context, key string) (T, error)) ([]T, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]T, len(keys))
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+
+	for i, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			v, err := fn(ctx, key)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = v
+		}(i, key)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
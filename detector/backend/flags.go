@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// envFlags are the settings that can also be given on the command line,
+// handy in container specs where args are easier to patch than env. A flag
+// that is set wins over its environment variable; everything else is
+// configured through the environment only.
+var envFlags = []struct{ name, env, usage string }{
+	{"listen", "LISTEN_ADDR", "address to serve HTTP on (default :$PORT, PORT defaulting to 8080)"},
+	{"rqlite-url", "RQLITE_URL", "rqlite node URLs, comma-separated"},
+	{"rqlite-consistency", "RQLITE_CONSISTENCY", "default read consistency: none, weak or strong"},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "how long to drain in-flight requests on SIGTERM"},
+	{"shutdown-delay", "SHUTDOWN_DELAY", "how long to report not ready before draining"},
+	{"dashboard", "DASHBOARD", `"off" to skip serving the embedded dashboard`},
+}
+
+// parseFlags parses the command line into the environment, before anything
+// reads it.
+func parseFlags() {
+	values := make(map[string]*string, len(envFlags))
+	for _, f := range envFlags {
+		values[f.name] = flag.String(f.name, "", f.usage+" ($"+f.env+")")
+	}
+	flag.Parse()
+	flag.Visit(func(set *flag.Flag) {
+		for _, f := range envFlags {
+			if f.name == set.Name {
+				os.Setenv(f.env, *values[f.name])
+			}
+		}
+	})
+}
+
+// listenAddr is LISTEN_ADDR, or every interface on PORT.
+func listenAddr() string {
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		return addr
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return ":" + port
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/gofiber/fiber/v2"
+)
+
+//go:generate go tool gqlgen generate
+
+// NewGraphQLHandler serves schema.graphqls, the hourly data as team ->
+// members -> days -> hours, so dashboards can fetch exactly the shape
+// they need in one round trip. Each top-level field loads its range with
+// one repo query; everything nested is resolved from those rows in
+// memory. The executor is generated by gqlgen into graphql_gen.go.
+func NewGraphQLHandler(repo ActivityRepository) fiber.Handler {
+	exec := executor.New(NewExecutableSchema(Config{Resolvers: &gqlResolver{repo: repo}}))
+	exec.Use(extension.FixedComplexityLimit(gqlComplexityLimit))
+	return func(c *fiber.Ctx) error {
+		var req graphql.RawParams
+		if c.Method() == fiber.MethodGet {
+			req.Query = c.Query("query")
+			req.OperationName = c.Query("operationName")
+			if v := c.Query("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					return fiber.NewError(fiber.StatusBadRequest, "invalid variables")
+				}
+			}
+		} else if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+		}
+		if req.Query == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "query is required")
+		}
+
+		ctx := graphql.StartOperationTrace(c.UserContext())
+		op, errs := exec.CreateOperationContext(ctx, &req)
+		if errs != nil {
+			return c.JSON(exec.DispatchError(graphql.WithOperationContext(ctx, op), errs))
+		}
+		responses, ctx := exec.DispatchOperation(ctx, op)
+		return c.JSON(responses(ctx))
+	}
+}
+
+// gqlComplexityLimit bounds the fields a query selects, aliases included.
+// No type in the schema nests itself, so only a query padded with aliased
+// copies of the same fields gets near it.
+const gqlComplexityLimit = 500
+
+// gqlResolver is the gqlgen ResolverRoot; Query is its only resolver,
+// the other types are bound to gqlTeam, gqlMember, gqlDay and ActivityRow
+// in gqlgen.yml.
+type gqlResolver struct {
+	repo ActivityRepository
+}
+
+func (r *gqlResolver) Query() QueryResolver { return &gqlQuery{repo: r.repo} }
+
+type gqlQuery struct {
+	repo ActivityRepository
+}
+
+// rows loads [from, to) for host ("" for every host), defaulting to the
+// last 7 days.
+func (q *gqlQuery) rows(ctx context.Context, fromDay, toDay *string, host string) ([]ActivityRow, error) {
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -7)
+	var err error
+	if toDay != nil {
+		if to, err = parseDay("to", *toDay, time.UTC); err != nil {
+			return nil, err
+		}
+		if fromDay == nil {
+			from = to.AddDate(0, 0, -7)
+		}
+	}
+	if fromDay != nil {
+		if from, err = parseDay("from", *fromDay, time.UTC); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkRange("from", "to", from, to); err != nil {
+		return nil, err
+	}
+	return q.repo.GetBetween(ctx, from.Format(time.RFC3339), to.Format(time.RFC3339), host, "")
+}
+
+func (q *gqlQuery) Teams(ctx context.Context, from, to *string) ([]*gqlTeam, error) {
+	rows, err := q.rows(ctx, from, to, "")
+	if err != nil {
+		return nil, err
+	}
+	return buildTeams(rows), nil
+}
+
+func (q *gqlQuery) Team(ctx context.Context, name string, from, to *string) (*gqlTeam, error) {
+	rows, err := q.rows(ctx, from, to, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range buildTeams(rows) {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *gqlQuery) Member(ctx context.Context, host string, from, to *string) (*gqlMember, error) {
+	rows, err := q.rows(ctx, from, to, host)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return newGQLMember(rows), nil
+}
+
+type gqlTeam struct {
+	name    string
+	members []*gqlMember
+	rows    []ActivityRow
+}
+
+// buildTeams groups rows (ordered by hour) into teams and members. Rows
+// without a team are reported under "".
+func buildTeams(rows []ActivityRow) []*gqlTeam {
+	byTeam := make(map[string]map[string][]ActivityRow)
+	for _, r := range rows {
+		if byTeam[r.Team] == nil {
+			byTeam[r.Team] = make(map[string][]ActivityRow)
+		}
+		byTeam[r.Team][r.Host] = append(byTeam[r.Team][r.Host], r)
+	}
+	teams := make([]*gqlTeam, 0, len(byTeam))
+	for name, hosts := range byTeam {
+		t := &gqlTeam{name: name}
+		for _, hostRows := range hosts {
+			t.members = append(t.members, newGQLMember(hostRows))
+			t.rows = append(t.rows, hostRows...)
+		}
+		sort.Slice(t.members, func(i, j int) bool { return t.members[i].host < t.members[j].host })
+		teams = append(teams, t)
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].name < teams[j].name })
+	return teams
+}
+
+func (t *gqlTeam) Name() string            { return t.name }
+func (t *gqlTeam) Members() []*gqlMember   { return t.members }
+func (t *gqlTeam) AvgActivityPct() float64 { return avgActivity(t.rows) }
+
+type gqlMember struct {
+	host, userName, displayName, team string
+	rows                              []ActivityRow
+}
+
+// newGQLMember takes one host's rows; identity comes from the latest row.
+func newGQLMember(rows []ActivityRow) *gqlMember {
+	last := rows[len(rows)-1]
+	return &gqlMember{host: last.Host, userName: last.UserName, displayName: last.DisplayName, team: last.Team, rows: rows}
+}
+
+func (m *gqlMember) Host() string            { return m.host }
+func (m *gqlMember) UserName() string        { return m.userName }
+func (m *gqlMember) DisplayName() string     { return m.displayName }
+func (m *gqlMember) Team() string            { return m.team }
+func (m *gqlMember) AvgActivityPct() float64 { return avgActivity(m.rows) }
+
+func (m *gqlMember) Days() []*gqlDay {
+	var days []*gqlDay
+	for _, r := range m.rows {
+		d := dayOf(r.HourStart)
+		if len(days) == 0 || days[len(days)-1].date != d {
+			days = append(days, &gqlDay{date: d})
+		}
+		days[len(days)-1].rows = append(days[len(days)-1].rows, r)
+	}
+	return days
+}
+
+type gqlDay struct {
+	date string
+	rows []ActivityRow
+}
+
+func (d *gqlDay) Date() string            { return d.date }
+func (d *gqlDay) AvgActivityPct() float64 { return avgActivity(d.rows) }
+
+func (d *gqlDay) ActiveHours() int32 {
+	n := int32(0)
+	for _, r := range d.rows {
+		if r.Status != string(StatusOff) && Status(r.Status).Measured() {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *gqlDay) IdleSeconds() float64 {
+	s := 0.0
+	for _, r := range d.rows {
+		s += r.IdleSeconds
+	}
+	return s
+}
+
+// Hours are the day's rows, bound to the Hour type as they are.
+func (d *gqlDay) Hours() []ActivityRow { return d.rows }
+
+func avgActivity(rows []ActivityRow) float64 {
+	s, n := 0.0, 0
+	for _, r := range rows {
+		if Status(r.Status).Measured() {
+			s += r.ActivityPct
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return s / float64(n)
+}
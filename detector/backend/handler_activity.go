@@ -1,72 +1,121 @@
 package main
 
 import (
+	"context"
 	"time"
 
+	"taxonomy"
+
 	"github.com/gofiber/fiber/v2"
 )
 
 type ActivityHandler struct {
-	repo *ActivityRepo
+	repo      ActivityRepository
+	settings  *SettingsRepo
+	profiles  *ProfileRepo
+	calendars *CalendarRepo
 }
 
-func NewActivityHandler(repo *ActivityRepo) *ActivityHandler {
-	return &ActivityHandler{repo: repo}
+func NewActivityHandler(repo ActivityRepository, settings *SettingsRepo, profiles *ProfileRepo, calendars *CalendarRepo) *ActivityHandler {
+	return &ActivityHandler{repo: repo, settings: settings, profiles: profiles, calendars: calendars}
 }
 
-func parseHHMM(s string) (h, m int, ok bool) {
-	if len(s) != 5 || s[2] != ':' {
-		return 0, 0, false
+// dayWindow resolves the date/start/end/tz query parameters shared by the
+// day-level endpoints into an RFC3339 [start, end) range. start, end and
+// tz default to sched.
+func dayWindow(c *fiber.Ctx, sched Schedule) (string, string, error) {
+	// timezone: "UTC", "Local" or an IANA name
+	loc, err := queryTZ(c, "tz", sched.TZ)
+	if err != nil {
+		return "", "", err
+	}
+
+	day := time.Now().In(loc)
+	if v := c.Query("date", ""); v != "" {
+		if day, err = parseDay("date", v, loc); err != nil {
+			return "", "", err
+		}
 	}
-	h = int((s[0]-'0')*10 + (s[1] - '0'))
-	m = int((s[3]-'0')*10 + (s[4] - '0'))
-	if h < 0 || h > 23 || m < 0 || m > 59 {
-		return 0, 0, false
+
+	sh, sm, err := queryHHMM(c, "start", sched.Start)
+	if err != nil {
+		return "", "", err
+	}
+	eh, em, err := queryHHMM(c, "end", sched.End)
+	if err != nil {
+		return "", "", err
 	}
-	return h, m, true
+	if eh*60+em <= sh*60+sm {
+		return "", "", badParam("end must be after start (got start=%02d:%02d, end=%02d:%02d)", sh, sm, eh, em)
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), sh, sm, 0, 0, loc).Format(time.RFC3339)
+	end := time.Date(day.Year(), day.Month(), day.Day(), eh, em, 0, 0, loc).Format(time.RFC3339)
+
+	return start, end, nil
 }
 
-// GET /activity/today?start=07:00&end=16:00&tz=UTC&date=2026-02-07
-func (h *ActivityHandler) GetToday(c *fiber.Ctx) error {
-	// timezone
-	tz := c.Query("tz", "UTC")
-	loc := time.UTC
-	if tz == "Local" {
-		loc = time.Local
+// globalSchedule returns the schedule setting of ctx's tenant.
+func globalSchedule(ctx context.Context, settings *SettingsRepo) (Schedule, error) {
+	var sched Schedule
+	if err := settings.Get(ctx, SettingSchedule, &sched); err != nil {
+		return sched, fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
+	return sched, nil
+}
 
-	// date
-	dateStr := c.Query("date", "")
-	var day time.Time
-	if dateStr == "" {
-		day = time.Now().In(loc)
-	} else {
-		parsed, err := time.ParseInLocation("2006-01-02", dateStr, loc)
+// scheduleFor returns the work-hours profile of user, falling back to the
+// global schedule when user is empty or has no profile.
+func (h *ActivityHandler) scheduleFor(c *fiber.Ctx, user string) (Schedule, error) {
+	if user != "" {
+		p, ok, err := h.profiles.Get(c.UserContext(), user)
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "invalid date (use YYYY-MM-DD)")
+			return Schedule{}, dbError(err)
+		}
+		if ok {
+			return p.Schedule, nil
 		}
-		day = parsed
 	}
+	return globalSchedule(c.UserContext(), h.settings)
+}
 
-	// start/end
-	startStr := c.Query("start", "07:00")
-	endStr := c.Query("end", "16:00")
+// GET /activity/today?start=07:00&end=16:00&tz=UTC&date=2026-02-07&host=PC-042&user=jdoe&consistency=strong
+// With user, the window defaults to that user's work-hours profile and
+// only their rows are returned. LOW hours spent in a calendar meeting
+// read IN_MEETING.
+func (h *ActivityHandler) GetToday(c *fiber.Ctx) error {
+	// read consistency override (none/weak/strong)
+	level := c.Query("consistency", "")
+	if level != "" && !validConsistency(level) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid consistency (use none, weak or strong)")
+	}
 
-	sh, sm, ok := parseHHMM(startStr)
-	if !ok {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid start (use HH:MM)")
+	user := c.Query("user", "")
+	sched, err := h.scheduleFor(c, user)
+	if err != nil {
+		return err
 	}
-	eh, em, ok := parseHHMM(endStr)
-	if !ok {
-		return fiber.NewError(fiber.StatusBadRequest, "invalid end (use HH:MM)")
+	start, end, err := dayWindow(c, sched)
+	if err != nil {
+		return err
 	}
 
-	start := time.Date(day.Year(), day.Month(), day.Day(), sh, sm, 0, 0, loc).Format(time.RFC3339)
-	end := time.Date(day.Year(), day.Month(), day.Day(), eh, em, 0, 0, loc).Format(time.RFC3339)
-
-	rows, err := h.repo.GetBetween(start, end)
+	rows, err := h.repo.GetBetween(c.UserContext(), start, end, c.Query("host", ""), level)
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadGateway, err.Error())
+		return dbError(err)
+	}
+	if user != "" {
+		kept := make([]ActivityRow, 0, len(rows))
+		for _, r := range rows {
+			if r.UserName == user {
+				kept = append(kept, r)
+			}
+		}
+		rows = kept
+	}
+	rows, err = labelMeetings(c.UserContext(), h.calendars, rows)
+	if err != nil {
+		return dbError(err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -76,3 +125,18 @@ func (h *ActivityHandler) GetToday(c *fiber.Ctx) error {
 		"rows":  rows,
 	})
 }
+
+// GET /statuses
+// The status taxonomy: every value activity_hourly.status can hold, which
+// ones agents report, which count as measured, and the thresholds
+// currently used to classify hours.
+func (h *ActivityHandler) GetStatuses(c *fiber.Ctx) error {
+	var thresholds StatusThresholds
+	if err := h.settings.Get(c.UserContext(), SettingStatusThresholds, &thresholds); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{
+		"statuses":   taxonomy.Statuses,
+		"thresholds": thresholds,
+	})
+}
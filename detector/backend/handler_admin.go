@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxBacktestWeeks bounds how much history one backtest may replay.
+const maxBacktestWeeks = 12
+
+type AdminHandler struct {
+	settings *SettingsRepo
+	rules    *AlertRuleRepo
+	repo     ActivityRepository
+}
+
+func NewAdminHandler(settings *SettingsRepo, rules *AlertRuleRepo, repo ActivityRepository) *AdminHandler {
+	return &AdminHandler{settings: settings, rules: rules, repo: repo}
+}
+
+// GET /admin/settings
+func (h *AdminHandler) ListSettings(c *fiber.Ctx) error {
+	return c.JSON(h.settings.All(c.UserContext()))
+}
+
+// GET /admin/settings/:key
+func (h *AdminHandler) GetSetting(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := defaultSettings[key]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "unknown setting")
+	}
+	var v json.RawMessage
+	if err := h.settings.Get(c.UserContext(), key, &v); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(v)
+}
+
+// PUT /admin/settings/:key
+func (h *AdminHandler) PutSetting(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := defaultSettings[key]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "unknown setting")
+	}
+	value, err := validateSetting(key, c.Body())
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err := h.settings.Put(c.UserContext(), key, value); err != nil {
+		return dbError(err)
+	}
+	return c.JSON(value)
+}
+
+// DELETE /admin/settings/:key reverts to the built-in default.
+func (h *AdminHandler) DeleteSetting(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := defaultSettings[key]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "unknown setting")
+	}
+	if err := h.settings.Delete(c.UserContext(), key); err != nil {
+		return dbError(err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// validateSetting decodes body strictly into the setting's type, checks it
+// and returns the normalized JSON to store.
+func validateSetting(key string, body []byte) (json.RawMessage, error) {
+	var v interface{}
+	switch key {
+	case SettingStatusThresholds:
+		var t StatusThresholds
+		if err := json.Unmarshal(body, &t); err != nil {
+			return nil, err
+		}
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		v = t
+	case SettingSchedule:
+		var s Schedule
+		if err := json.Unmarshal(body, &s); err != nil {
+			return nil, err
+		}
+		if err := validateSchedule(s); err != nil {
+			return nil, err
+		}
+		v = s
+	case SettingRetention:
+		var r Retention
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		if r.RawDays < 0 || r.HourlyDays < 0 || r.DailyDays < 0 {
+			return nil, fmt.Errorf("retention days cannot be negative (0 keeps forever)")
+		}
+		v = r
+	case SettingAgentIntervals:
+		var i AgentIntervals
+		if err := json.Unmarshal(body, &i); err != nil {
+			return nil, err
+		}
+		if i.Heartbeat == "" || i.ConfigPoll == "" {
+			return nil, fmt.Errorf("heartbeat and config_poll are required")
+		}
+		if err := validateAgentIntervals(i); err != nil {
+			return nil, err
+		}
+		v = i
+	case SettingTimesheet:
+		var t TimesheetSettings
+		if err := json.Unmarshal(body, &t); err != nil {
+			return nil, err
+		}
+		if err := validateTimesheet(t); err != nil {
+			return nil, err
+		}
+		v = t
+	case SettingCollectionPolicy:
+		var p CollectionPolicy
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		if p.Version == "" {
+			return nil, fmt.Errorf("version is required")
+		}
+		v = p
+	default:
+		return nil, fmt.Errorf("unknown setting %q", key)
+	}
+	return json.Marshal(v)
+}
+
+// GET /admin/alert-rules
+func (h *AdminHandler) ListAlertRules(c *fiber.Ctx) error {
+	rules, err := h.rules.List(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(rules), "rules": rules})
+}
+
+// GET /admin/alert-rules/:id
+func (h *AdminHandler) GetAlertRule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	rule, ok, err := h.rules.Get(c.UserContext(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "alert rule not found")
+	}
+	return c.JSON(rule)
+}
+
+// POST /admin/alert-rules
+func (h *AdminHandler) CreateAlertRule(c *fiber.Ctx) error {
+	var rule AlertRule
+	if err := c.BodyParser(&rule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if err := validateAlertRule(rule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	rule, err := h.rules.Create(c.UserContext(), rule)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// PUT /admin/alert-rules/:id
+func (h *AdminHandler) UpdateAlertRule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	var rule AlertRule
+	if err := c.BodyParser(&rule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if err := validateAlertRule(rule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	rule.ID = id
+	rule, ok, err := h.rules.Update(c.UserContext(), rule)
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "alert rule not found")
+	}
+	return c.JSON(rule)
+}
+
+// DELETE /admin/alert-rules/:id
+func (h *AdminHandler) DeleteAlertRule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	ok, err := h.rules.Delete(c.UserContext(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "alert rule not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// POST /admin/alert-rules/backtest?weeks=4
+// Body: a proposed alert rule (not stored). Replays it hour by hour over
+// the last weeks of data and reports when and for which hosts it would
+// have fired, so thresholds can be tuned before the rule is enabled.
+func (h *AdminHandler) BacktestAlertRule(c *fiber.Ctx) error {
+	var rule AlertRule
+	if err := c.BodyParser(&rule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if rule.Name == "" {
+		rule.Name = "backtest"
+	}
+	if err := validateAlertRule(rule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	weeks, err := queryInt(c, "weeks", 4, 1, maxBacktestWeeks)
+	if err != nil {
+		return err
+	}
+	cond, err := rule.Condition()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	var sched Schedule
+	if err := h.settings.Get(c.UserContext(), SettingSchedule, &sched); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	to := time.Now().UTC().Truncate(time.Hour)
+	from := to.AddDate(0, 0, -7*weeks)
+	rows, err := h.repo.GetBetween(c.UserContext(), from.Add(-cond.MaxWindow-time.Hour).Format(time.RFC3339), to.Format(time.RFC3339), rule.Host, "")
+	if err != nil {
+		return dbError(err)
+	}
+	byHost := make(map[string][]ActivityRow)
+	for _, r := range rows {
+		byHost[r.Host] = append(byHost[r.Host], r)
+	}
+
+	fired := backtestRule(cond, sched, byHost, from, to)
+	perHost := make(map[string]int)
+	for _, f := range fired {
+		perHost[f.Host]++
+	}
+	return c.JSON(fiber.Map{
+		"condition": cond.String(),
+		"from":      from.Format(time.RFC3339),
+		"to":        to.Format(time.RFC3339),
+		"hosts":     len(byHost),
+		"fired":     len(fired),
+		"per_host":  perHost,
+		"alerts":    fired,
+	})
+}
+
+// validateSchedule checks the global schedule setting and per-user
+// profiles alike.
+func validateSchedule(s Schedule) error {
+	sh, sm, ok1 := parseHHMM(s.Start)
+	eh, em, ok2 := parseHHMM(s.End)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("start and end must be HH:MM")
+	}
+	if eh*60+em <= sh*60+sm {
+		return fmt.Errorf("end must be after start")
+	}
+	for _, d := range s.Weekdays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("weekdays are 0 (Sunday) to 6 (Saturday)")
+		}
+	}
+	if _, err := time.LoadLocation(s.TZ); err != nil {
+		return fmt.Errorf("unknown tz %q", s.TZ)
+	}
+	return nil
+}
+
+func validateAlertRule(rule AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.Expr != "" {
+		if rule.Metric != "" || rule.Op != "" || rule.Window != "" {
+			return fmt.Errorf("use either expr or metric/op/threshold/window, not both")
+		}
+		if _, err := CompileAlertExpr(rule.Expr); err != nil {
+			return fmt.Errorf("expr: %v", err)
+		}
+		return nil
+	}
+	switch rule.Metric {
+	case "activity_pct", "idle_seconds":
+	default:
+		return fmt.Errorf("metric must be activity_pct or idle_seconds")
+	}
+	switch rule.Op {
+	case "<", "<=", ">", ">=":
+	default:
+		return fmt.Errorf("op must be one of <, <=, >, >=")
+	}
+	if d, err := time.ParseDuration(rule.Window); err != nil || d < time.Hour {
+		return fmt.Errorf("window must be a duration of at least 1h")
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"detector-api/idleclient"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// protocolVersion is the agent<->backend protocol this backend speaks.
+// Bump it when heartbeat or ingest payloads change incompatibly.
+const protocolVersion = 1
+
+// Bounds for heartbeat and config-poll intervals handed to agents; the
+// agent clamps to the same range.
+const (
+	minAgentInterval = 30 * time.Second
+	maxAgentInterval = 24 * time.Hour
+)
+
+type AgentHandler struct {
+	agents   *AgentRepo
+	settings *SettingsRepo
+	repo     ActivityRepository
+	samples  *SampleRepo
+	consents *ConsentRepo
+	// agents below either minimum are told to upgrade
+	minProtocol int
+	minVersion  string
+	// agents reporting a heartbeat round trip above slowRTT get their
+	// intervals doubled, so slow links carry less chatter
+	slowRTT time.Duration
+	// GET /agents: agents silent longer than offlineAfter are offline;
+	// ingested hours are searched back to inventoryLookback
+	offlineAfter      time.Duration
+	inventoryLookback time.Duration
+	// GET /activity/now: users without input for awayAfter are away
+	awayAfter time.Duration
+}
+
+// NewAgentHandlerFromEnv reads MIN_AGENT_PROTOCOL (default 1),
+// MIN_AGENT_VERSION (default none, e.g. "1.4.0"), AGENT_SLOW_RTT
+// (default 2s, 0 disables the back-off), AGENT_OFFLINE_AFTER (default
+// 15m), AGENT_INVENTORY_LOOKBACK (default 90 days) and PRESENCE_AWAY_AFTER
+// (default 5m).
+func NewAgentHandlerFromEnv(agents *AgentRepo, settings *SettingsRepo, repo ActivityRepository, samples *SampleRepo, consents *ConsentRepo) *AgentHandler {
+	minProtocol := 1
+	if n, err := strconv.Atoi(os.Getenv("MIN_AGENT_PROTOCOL")); err == nil && n > 0 {
+		minProtocol = n
+	}
+	return &AgentHandler{
+		agents:      agents,
+		settings:    settings,
+		repo:        repo,
+		samples:     samples,
+		consents:    consents,
+		minProtocol: minProtocol,
+		minVersion:  os.Getenv("MIN_AGENT_VERSION"),
+		slowRTT:     envDuration("AGENT_SLOW_RTT", 2*time.Second),
+
+		offlineAfter:      envDuration("AGENT_OFFLINE_AFTER", 15*time.Minute),
+		inventoryLookback: envDuration("AGENT_INVENTORY_LOOKBACK", 90*24*time.Hour),
+		awayAfter:         envDuration("PRESENCE_AWAY_AFTER", 5*time.Minute),
+	}
+}
+
+type heartbeatRequest struct {
+	Host            string `json:"host"`
+	UserName        string `json:"user_name"`
+	AgentVersion    string `json:"agent_version"`
+	AgentCommit     string `json:"agent_commit"`
+	AgentBuildDate  string `json:"agent_build_date"`
+	ProtocolVersion int    `json:"protocol_version"`
+	OS              string `json:"os"`
+	// round trip of the previous heartbeat as measured by the agent
+	RTTMillis int64 `json:"rtt_ms"`
+	// the agent's own footprint; null from agents that predate it
+	Resources *AgentResources `json:"resources"`
+	// the user's latest input (RFC3339) and the agent's windowed mode,
+	// empty when unknown
+	LastInput string `json:"last_input"`
+	Mode      string `json:"mode"`
+}
+
+// heartbeatResponse is the backend's half of the version handshake.
+type heartbeatResponse struct {
+	ProtocolVersion    int    `json:"protocol_version"`
+	MinProtocolVersion int    `json:"min_protocol_version"`
+	MinAgentVersion    string `json:"min_agent_version,omitempty"`
+	UpgradeRequired    bool   `json:"upgrade_required"`
+	Message            string `json:"message,omitempty"`
+	// how often the agent should heartbeat and re-read its config
+	HeartbeatInterval  string `json:"heartbeat_interval"`
+	ConfigPollInterval string `json:"config_poll_interval"`
+	// set while the collection policy requires consent and the user has
+	// not given it for PolicyVersion; the agent then samples nothing
+	ConsentRequired bool   `json:"consent_required,omitempty"`
+	PolicyVersion   string `json:"policy_version,omitempty"`
+}
+
+// POST /agent/heartbeat
+// Records the agent and answers with the protocol versions this backend
+// accepts; outdated agents get upgrade_required and surface it locally.
+// The answer also carries the intervals the agent should use from now on.
+func (h *AgentHandler) PostHeartbeat(c *fiber.Ctx) error {
+	var req heartbeatRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	agent := Agent{
+		Host:            req.Host,
+		UserName:        req.UserName,
+		AgentVersion:    req.AgentVersion,
+		AgentCommit:     req.AgentCommit,
+		AgentBuildDate:  req.AgentBuildDate,
+		ProtocolVersion: req.ProtocolVersion,
+		OS:              req.OS,
+		RemoteAddr:      c.IP(),
+	}
+	if req.Resources != nil {
+		agent.Resources = *req.Resources
+	}
+	// presence is best effort: a bad value is dropped, not the heartbeat
+	if t, err := time.Parse(time.RFC3339, req.LastInput); err == nil {
+		agent.LastInput = t.UTC().Format(time.RFC3339)
+	}
+	if st, err := ParseStatus(req.Mode); err == nil && req.Mode != "" {
+		agent.Mode = string(st)
+	}
+	if err := h.agents.Seen(c.UserContext(), agent); err != nil {
+		return dbError(err)
+	}
+
+	intervals, err := h.intervalsFor(c, req.Host, time.Duration(req.RTTMillis)*time.Millisecond)
+	if err != nil {
+		return dbError(err)
+	}
+
+	resp := heartbeatResponse{
+		ProtocolVersion:    protocolVersion,
+		MinProtocolVersion: h.minProtocol,
+		MinAgentVersion:    h.minVersion,
+		HeartbeatInterval:  intervals.Heartbeat,
+		ConfigPollInterval: intervals.ConfigPoll,
+	}
+	if resp.ConsentRequired, resp.PolicyVersion, err = h.consentRequired(c, req.UserName); err != nil {
+		return err
+	}
+	if h.outdated(req.ProtocolVersion, req.AgentVersion) {
+		resp.UpgradeRequired = true
+		resp.Message = fmt.Sprintf("agent %s (protocol %d) is no longer supported; install at least %s",
+			req.AgentVersion, req.ProtocolVersion, h.minimumLabel())
+	}
+	c.Set("X-Protocol-Version", strconv.Itoa(protocolVersion))
+	return c.JSON(resp)
+}
+
+// consentRequired tells whether the agent of user must stop sampling for
+// lack of consent to the current collection policy, and that policy's
+// version.
+func (h *AgentHandler) consentRequired(c *fiber.Ctx, user string) (bool, string, error) {
+	var p CollectionPolicy
+	if err := h.settings.Get(c.UserContext(), SettingCollectionPolicy, &p); err != nil {
+		return false, "", fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if !p.RequireConsent || user == "" {
+		return false, p.Version, nil
+	}
+	granted, err := h.consents.Granted(c.UserContext(), user, p.Version)
+	if err != nil {
+		return false, "", dbError(err)
+	}
+	return !granted, p.Version, nil
+}
+
+// GET /admin/agents?outdated=true
+func (h *AgentHandler) ListAgents(c *fiber.Ctx) error {
+	agents, err := h.agents.List(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	onlyOutdated := c.QueryBool("outdated", false)
+	out := agents[:0]
+	for _, a := range agents {
+		a.Outdated = h.outdated(a.ProtocolVersion, a.AgentVersion)
+		if !onlyOutdated || a.Outdated {
+			out = append(out, a)
+		}
+	}
+	return c.JSON(fiber.Map{"count": len(out), "agents": out})
+}
+
+// Agent states in GET /agents.
+const (
+	agentOnline  = "online"  // heartbeat within offlineAfter
+	agentOffline = "offline" // silent longer, or never sent a heartbeat
+)
+
+// agentInventory is one host's line in GET /agents: what it runs and
+// when it was last heard from, without the network and footprint
+// details kept for admins. Hosts that upload hours but never heartbeat
+// (no BackendBaseURL) are listed too, always offline.
+type agentInventory = idleclient.AgentInventory
+
+// GET /agents?state=offline&outdated=true
+// Fleet health in one call: every known host with its last heartbeat,
+// last ingested hour, agent build and online/offline state, plus counts
+// per state and per version.
+func (h *AgentHandler) ListInventory(c *fiber.Ctx) error {
+	state := c.Query("state")
+	if state != "" && state != agentOnline && state != agentOffline {
+		return fiber.NewError(fiber.StatusBadRequest, "state must be online or offline")
+	}
+	onlyOutdated := c.QueryBool("outdated", false)
+
+	ctx := c.UserContext()
+	agents, err := h.agents.List(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	now := time.Now().UTC()
+	last, err := h.repo.LastHours(ctx, now.Add(-h.inventoryLookback).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339))
+	if err != nil {
+		return dbError(err)
+	}
+
+	byHost := make(map[string]*agentInventory, len(agents)+len(last))
+	for _, a := range agents {
+		inv := &agentInventory{
+			Host:           a.Host,
+			UserName:       a.UserName,
+			AgentVersion:   a.AgentVersion,
+			AgentCommit:    a.AgentCommit,
+			AgentBuildDate: a.AgentBuildDate,
+			LastSeen:       a.LastSeen,
+			State:          agentOffline,
+			Outdated:       h.outdated(a.ProtocolVersion, a.AgentVersion),
+		}
+		if t, err := time.Parse(time.RFC3339, a.LastSeen); err == nil && now.Sub(t) <= h.offlineAfter {
+			inv.State = agentOnline
+		}
+		byHost[a.Host] = inv
+	}
+	for _, l := range last {
+		inv, ok := byHost[l.Host]
+		if !ok {
+			inv = &agentInventory{Host: l.Host, UserName: l.UserName, State: agentOffline}
+			byHost[l.Host] = inv
+		}
+		inv.LastHour = l.HourStart
+	}
+
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	out := make([]agentInventory, 0, len(hosts))
+	states := map[string]int{agentOnline: 0, agentOffline: 0}
+	versions := make(map[string]int)
+	for _, host := range hosts {
+		inv := byHost[host]
+		if (state != "" && inv.State != state) || (onlyOutdated && !inv.Outdated) {
+			continue
+		}
+		out = append(out, *inv)
+		states[inv.State]++
+		versions[inv.AgentVersion]++
+	}
+	return c.JSON(fiber.Map{"count": len(out), "states": states, "versions": versions, "agents": out})
+}
+
+// Presence states in GET /activity/now.
+const (
+	presencePresent = "present" // input within awayAfter
+	presenceAway    = "away"    // agent up, no input for longer
+	presenceOffline = "offline" // no heartbeat or sample within offlineAfter
+)
+
+// presence is one host's line in GET /activity/now.
+type presence = idleclient.Presence
+
+// GET /activity/now?host=PC-042
+// Who is at their desk right now: each host's state, mode and minutes
+// since the user's last input, from the latest heartbeat or raw sample,
+// whichever is newer. Hosts heard from in neither within offlineAfter are
+// offline with mode OFF. Unlike /activity/live this does not wait for the
+// hour to be uploaded.
+func (h *AgentHandler) GetNow(c *fiber.Ctx) error {
+	host := c.Query("host")
+	ctx := c.UserContext()
+	agents, err := h.agents.List(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	now := time.Now().UTC()
+	sampled, err := h.samples.LastInputs(ctx, now.Add(-h.offlineAfter).Format(time.RFC3339), host)
+	if err != nil {
+		return dbError(err)
+	}
+
+	byHost := make(map[string]*presence, len(agents)+len(sampled))
+	inputs := make(map[string]time.Time, len(byHost))
+	for _, a := range agents {
+		if host != "" && a.Host != host {
+			continue
+		}
+		p := &presence{Host: a.Host, UserName: a.UserName, Mode: a.Mode, LastSeen: a.LastSeen, Source: "heartbeat"}
+		byHost[a.Host] = p
+		seen, err := time.Parse(time.RFC3339, a.LastSeen)
+		if err != nil || now.Sub(seen) > h.offlineAfter {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, a.LastInput); err == nil {
+			inputs[a.Host] = t
+		} else {
+			// agents that predate presence: up, but the user cannot be
+			// told at the desk
+			inputs[a.Host] = time.Time{}
+		}
+	}
+	for _, s := range sampled {
+		p, ok := byHost[s.Host]
+		if !ok {
+			p = &presence{Host: s.Host, UserName: s.UserName}
+			byHost[s.Host] = p
+		}
+		if t, up := inputs[s.Host]; !up || s.LastInput.After(t) {
+			inputs[s.Host] = s.LastInput
+			p.Source = "samples"
+			if s.TS > p.LastSeen {
+				p.LastSeen = s.TS
+			}
+		}
+	}
+
+	hosts := make([]string, 0, len(byHost))
+	for name := range byHost {
+		hosts = append(hosts, name)
+	}
+	sort.Strings(hosts)
+	out := make([]presence, 0, len(hosts))
+	states := map[string]int{presencePresent: 0, presenceAway: 0, presenceOffline: 0}
+	for _, host := range hosts {
+		p := byHost[host]
+		input, up := inputs[host]
+		switch {
+		case !up:
+			p.State, p.Mode = presenceOffline, string(StatusOff)
+		case input.IsZero():
+			p.State = presenceAway
+		default:
+			idle := now.Sub(input)
+			if idle < 0 {
+				idle = 0
+			}
+			p.LastInput = input.Format(time.RFC3339)
+			p.IdleMinutes = math.Round(idle.Minutes()*10) / 10
+			p.State = presencePresent
+			if idle >= h.awayAfter {
+				p.State = presenceAway
+			}
+		}
+		if p.Mode == "" && up {
+			// no windowed mode from the agent: present users count as
+			// active, away ones as low
+			p.Mode = string(StatusActive)
+			if p.State == presenceAway {
+				p.Mode = string(StatusLow)
+			}
+		}
+		out = append(out, *p)
+		states[p.State]++
+	}
+	return c.JSON(fiber.Map{"at": now.Format(time.RFC3339), "count": len(out), "states": states, "hosts": out})
+}
+
+// PUT /admin/agents/:host/intervals
+// Body: {"heartbeat": "1h", "config_poll": ""}; empty fields fall back to
+// the agent_intervals setting. Takes effect at the agent's next heartbeat.
+func (h *AgentHandler) PutIntervals(c *fiber.Ctx) error {
+	var i AgentIntervals
+	if err := json.Unmarshal(c.Body(), &i); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if err := validateAgentIntervals(i); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	found, err := h.agents.SetIntervals(c.UserContext(), c.Params("host"), i)
+	if err != nil {
+		return dbError(err)
+	}
+	if !found {
+		return fiber.NewError(fiber.StatusNotFound, "agent not found")
+	}
+	return c.JSON(i)
+}
+
+// GET /admin/agents/:host/signing-key
+// The key to set as the agent's SigningKey on host, derived from
+// BUCKET_SIGNING_KEY; see signing.go.
+func (h *AgentHandler) GetSigningKey(c *fiber.Ctx) error {
+	if len(signingKey) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "bucket signing is off (BUCKET_SIGNING_KEY unset)")
+	}
+	host := c.Params("host")
+	return c.JSON(fiber.Map{"host": host, "signing_key": agentSigningKey(host)})
+}
+
+// intervalsFor resolves host's intervals: its override, else the global
+// setting, doubled when the agent reports a slow link.
+func (h *AgentHandler) intervalsFor(c *fiber.Ctx, host string, rtt time.Duration) (AgentIntervals, error) {
+	var global AgentIntervals
+	if err := h.settings.Get(c.UserContext(), SettingAgentIntervals, &global); err != nil {
+		return global, err
+	}
+	out, err := h.agents.Intervals(c.UserContext(), host)
+	if err != nil {
+		return out, err
+	}
+	if out.Heartbeat == "" {
+		out.Heartbeat = global.Heartbeat
+	}
+	if out.ConfigPoll == "" {
+		out.ConfigPoll = global.ConfigPoll
+	}
+	if h.slowRTT > 0 && rtt > h.slowRTT {
+		out.Heartbeat = backOff(out.Heartbeat)
+		out.ConfigPoll = backOff(out.ConfigPoll)
+	}
+	return out, nil
+}
+
+// backOff doubles a stored interval, capped at maxAgentInterval.
+func backOff(interval string) string {
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return interval
+	}
+	if d *= 2; d > maxAgentInterval {
+		d = maxAgentInterval
+	}
+	return d.String()
+}
+
+// validateAgentIntervals checks that each non-empty interval is a Go
+// duration between minAgentInterval and maxAgentInterval.
+func validateAgentIntervals(i AgentIntervals) error {
+	for name, v := range map[string]string{"heartbeat": i.Heartbeat, "config_poll": i.ConfigPoll} {
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if d < minAgentInterval || d > maxAgentInterval {
+			return fmt.Errorf("%s must be between %s and %s", name, minAgentInterval, maxAgentInterval)
+		}
+	}
+	return nil
+}
+
+func (h *AgentHandler) outdated(proto int, version string) bool {
+	if proto < h.minProtocol {
+		return true
+	}
+	return h.minVersion != "" && compareVersions(version, h.minVersion) < 0
+}
+
+func (h *AgentHandler) minimumLabel() string {
+	if h.minVersion != "" {
+		return fmt.Sprintf("%s (protocol %d)", h.minVersion, h.minProtocol)
+	}
+	return fmt.Sprintf("protocol %d", h.minProtocol)
+}
+
+// compareVersions compares dotted numeric versions ("1.4.2", "v1.5"),
+// ignoring any pre-release suffix; unparseable parts count as 0.
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(strings.SplitN(pa[i], "-", 2)[0])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(strings.SplitN(pb[i], "-", 2)[0])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
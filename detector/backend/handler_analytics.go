@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"detector-api/idleclient"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PeriodStats summarizes hourly rows over one period.
+type PeriodStats struct {
+	From           string         `json:"from"`
+	To             string         `json:"to"`
+	Hours          int            `json:"hours"`
+	ActiveHours    int            `json:"active_hours"`
+	AvgActivityPct float64        `json:"avg_activity_pct"`
+	StatusCounts   map[string]int `json:"status_counts"`
+}
+
+func periodStats(from, to time.Time, rows []ActivityRow) PeriodStats {
+	s := PeriodStats{
+		From:         from.Format("2006-01-02"),
+		To:           to.Format("2006-01-02"),
+		Hours:        len(rows),
+		StatusCounts: make(map[string]int),
+	}
+	sum := 0.0
+	measured := 0
+	for _, row := range rows {
+		s.StatusCounts[row.Status]++
+		if !Status(row.Status).Measured() {
+			continue
+		}
+		measured++
+		sum += row.ActivityPct
+		if row.Status != "OFF" {
+			s.ActiveHours++
+		}
+	}
+	if measured > 0 {
+		s.AvgActivityPct = sum / float64(measured)
+	}
+	return s
+}
+
+// parseDateRange reads two YYYY-MM-DD query params as a UTC [from, to) range.
+func parseDateRange(c *fiber.Ctx, fromKey, toKey string) (time.Time, time.Time, error) {
+	from, err := parseDay(fromKey, c.Query(fromKey), time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseDay(toKey, c.Query(toKey), time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, to, checkRange(fromKey, toKey, from, to)
+}
+
+// GET /activity/compare?a_from=2026-01-05&a_to=2026-01-12&b_from=2026-02-02&b_to=2026-02-09&host=PC-042
+// Ranges are UTC [from, to). Deltas are b minus a; status_share_delta is
+// the change in each status' share of hours, in percentage points.
+func (h *ActivityHandler) GetCompare(c *fiber.Ctx) error {
+	aFrom, aTo, err := parseDateRange(c, "a_from", "a_to")
+	if err != nil {
+		return err
+	}
+	bFrom, bTo, err := parseDateRange(c, "b_from", "b_to")
+	if err != nil {
+		return err
+	}
+	host := c.Query("host", "")
+	ctx := c.UserContext()
+
+	aRows, err := h.repo.GetBetween(ctx, aFrom.Format(time.RFC3339), aTo.Format(time.RFC3339), host, "")
+	if err != nil {
+		return dbError(err)
+	}
+	bRows, err := h.repo.GetBetween(ctx, bFrom.Format(time.RFC3339), bTo.Format(time.RFC3339), host, "")
+	if err != nil {
+		return dbError(err)
+	}
+
+	a := periodStats(aFrom, aTo, aRows)
+	b := periodStats(bFrom, bTo, bRows)
+
+	shareDelta := make(map[string]float64)
+	share := func(s PeriodStats, status string) float64 {
+		if s.Hours == 0 {
+			return 0
+		}
+		return float64(s.StatusCounts[status]) * 100 / float64(s.Hours)
+	}
+	for status := range a.StatusCounts {
+		shareDelta[status] = share(b, status) - share(a, status)
+	}
+	for status := range b.StatusCounts {
+		shareDelta[status] = share(b, status) - share(a, status)
+	}
+
+	return c.JSON(fiber.Map{
+		"host": host,
+		"a":    a,
+		"b":    b,
+		"delta": fiber.Map{
+			"active_hours":       b.ActiveHours - a.ActiveHours,
+			"avg_activity_pct":   b.AvgActivityPct - a.AvgActivityPct,
+			"status_share_delta": shareDelta,
+		},
+	})
+}
+
+// GET /activity/heatmap?from=2026-01-01&to=2026-02-01&host=PC-042
+func (h *ActivityHandler) GetHeatmap(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+	hm, err := h.repo.Heatmap(c.UserContext(), from.Format(time.RFC3339), to.Format(time.RFC3339), c.Query("host", ""))
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"heatmap": hm,
+	})
+}
+
+// GET /activity/stats?from=2026-01-01&to=2026-02-01&host=PC-042&bucket=10
+// Distribution of hourly activity_pct over measured hours (gap rows
+// skipped): p50/p90/p99, mean, standard deviation and a histogram of
+// bucket-wide bins (default 10, must divide 100). Without host it covers
+// the whole fleet.
+func (h *ActivityHandler) GetStats(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+	width, err := queryInt(c, "bucket", 10, 1, 100)
+	if err != nil {
+		return err
+	}
+	if 100%width != 0 {
+		return badParam("bucket must divide 100 (e.g. 5, 10 or 20), got %d", width)
+	}
+	st, err := h.repo.Stats(c.UserContext(), from.Format(time.RFC3339), to.Format(time.RFC3339), c.Query("host", ""), width)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+		"host":  c.Query("host", ""),
+		"stats": st,
+	})
+}
+
+// GET /activity/breaks?from=2026-03-02&to=2026-03-09&host=PC-042&user=jdoe&tz=Europe/Paris
+// Breaks per host and day: idle periods the agents measured between their
+// BreakMin and BreakMax (5 to 60 minutes by default), counted where they
+// ended. Days are local to tz (default UTC), using its offset at from;
+// many short breaks and one long absence no longer look alike.
+func (h *ActivityHandler) GetBreaks(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+	tz := c.Query("tz", "UTC")
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid tz")
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	_, offset := from.Zone()
+
+	days, err := h.repo.BreakDays(c.UserContext(), from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339),
+		c.Query("host", ""), c.Query("user", ""), fmt.Sprintf("%+d minutes", offset/60))
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		"tz":   tz,
+		"days": days,
+	})
+}
+
+// GET /activity/categories?from=2026-01-01&to=2026-02-01&host=PC-042&user=jdoe
+// Active foreground time per application category (development,
+// communication, ...) as reported by agents with TrackAppCategories on,
+// with each category's share of the categorized time.
+func (h *ActivityHandler) GetCategories(c *fiber.Ctx) error {
+	return h.secondsTotals(c, "category_seconds", "categories")
+}
+
+// GET /activity/domains?from=2026-01-01&to=2026-02-01&host=PC-042&user=jdoe
+// Active browser time per web domain as reported by agents with
+// DomainTracking on; domains filtered out on the agent read "other".
+func (h *ActivityHandler) GetDomains(c *fiber.Ctx) error {
+	return h.secondsTotals(c, "domain_seconds", "domains")
+}
+
+// secondsTotals answers GetCategories and GetDomains: the totals of
+// column over the from/to range, under key.
+func (h *ActivityHandler) secondsTotals(c *fiber.Ctx, column, key string) error {
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+	totals, err := h.repo.SecondsTotals(c.UserContext(), column, from.Format(time.RFC3339), to.Format(time.RFC3339), c.Query("host", ""), c.Query("user", ""))
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		key:    totals,
+	})
+}
+
+// Scorecard is the manager dashboard's KPI summary for one user.
+type Scorecard = idleclient.Scorecard
+
+// GET /activity/scorecard?user=jdoe&period=week&date=2026-02-07
+// KPIs over the week (7 days) or month (30 days) ending on date (default
+// today), in the user's profile time zone. Punctuality compares the hour
+// of first activity with the schedule start on scheduled weekdays only.
+func (h *ActivityHandler) GetScorecard(c *fiber.Ctx) error {
+	user := c.Query("user", "")
+	if user == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "user is required")
+	}
+	period := c.Query("period", "week")
+	var days int
+	switch period {
+	case "week":
+		days = 7
+	case "month":
+		days = 30
+	default:
+		return badParam("period must be week or month, got %q", period)
+	}
+
+	sched, err := h.scheduleFor(c, user)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(sched.TZ)
+	if err != nil {
+		loc = time.UTC
+	}
+	var thresholds StatusThresholds
+	if err := h.settings.Get(c.UserContext(), SettingStatusThresholds, &thresholds); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	day := time.Now().In(loc)
+	if d := c.Query("date", ""); d != "" {
+		if day, err = parseDay("date", d, loc); err != nil {
+			return err
+		}
+	}
+	to := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -days)
+	_, offset := from.Zone()
+	tzModifier := fmt.Sprintf("%+d minutes", offset/60)
+
+	rows, err := h.repo.ScorecardDays(c.UserContext(), user, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), tzModifier, thresholds.ActiveBelow)
+	if err != nil {
+		return dbError(err)
+	}
+
+	sc := Scorecard{
+		User:   user,
+		Period: period,
+		From:   from.Format("2006-01-02"),
+		To:     to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Days:   rows,
+	}
+	sh, sm, _ := parseHHMM(sched.Start)
+	startMin := sh*60 + sm
+	workday := make(map[int]bool, len(sched.Weekdays))
+	for _, wd := range sched.Weekdays {
+		workday[wd] = true
+	}
+	var (
+		lateSum, idleSum float64
+		tracked, streaks int
+		latenessDays     int
+	)
+	for _, d := range rows {
+		sc.ActiveHours += d.ActiveHours
+		idleSum += d.IdleSeconds
+		tracked += d.TrackedHours
+		streaks += d.FocusStreak
+		t, err := time.Parse("2006-01-02", d.Day)
+		if err != nil || !workday[int(t.Weekday())] {
+			continue
+		}
+		sc.WorkDays++
+		if d.FirstActiveHour == nil {
+			continue
+		}
+		late := *d.FirstActiveHour*60 - startMin
+		if late <= 0 {
+			sc.OnTimeDays++
+		}
+		lateSum += float64(late)
+		latenessDays++
+	}
+	if latenessDays > 0 {
+		avg := lateSum / float64(latenessDays)
+		sc.AvgLatenessMinutes = &avg
+	}
+	if len(rows) > 0 {
+		sc.AvgFocusStreak = float64(streaks) / float64(len(rows))
+	}
+	if tracked > 0 {
+		sc.IdleRatio = idleSum / (float64(tracked) * 3600)
+	}
+	return c.JSON(sc)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	audit *AuditRepo
+}
+
+func NewAuditHandler(audit *AuditRepo) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// GET /audit?actor=&action=&target=&from=&to=&before_id=&limit=100
+// from/to are RFC3339 timestamps; results are newest first, and
+// next_before_id pages further back.
+func (h *AuditHandler) GetAudit(c *fiber.Ctx) error {
+	f := AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Limit:  100,
+	}
+	for _, p := range []struct {
+		key string
+		dst *string
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := c.Query(p.key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return badParam("invalid %s %q (use RFC3339)", p.key, v)
+			}
+			*p.dst = t.UTC().Format(time.RFC3339)
+		}
+	}
+	if v := c.Query("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return badParam("before_id must be a positive integer, got %q", v)
+		}
+		f.BeforeID = id
+	}
+	limit, err := queryInt(c, "limit", f.Limit, 1, 1000)
+	if err != nil {
+		return err
+	}
+	f.Limit = limit
+
+	entries, err := h.audit.List(c.UserContext(), f)
+	if err != nil {
+		return dbError(err)
+	}
+	resp := fiber.Map{"count": len(entries), "entries": entries}
+	if len(entries) == f.Limit {
+		resp["next_before_id"] = entries[len(entries)-1].ID
+	}
+	return c.JSON(resp)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type CalendarHandler struct {
+	calendars *CalendarRepo
+}
+
+func NewCalendarHandler(calendars *CalendarRepo) *CalendarHandler {
+	return &CalendarHandler{calendars: calendars}
+}
+
+// GET /admin/calendars
+// Linked calendars with their sync state; refresh tokens are not returned.
+func (h *CalendarHandler) ListCalendars(c *fiber.Ctx) error {
+	accounts, err := h.calendars.Accounts(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(accounts), "calendars": accounts})
+}
+
+// PUT /admin/calendars/:user
+// Body: {"provider":"microsoft","refresh_token":"..."} or
+// {"provider":"google","calendar_id":"jdoe@example.com","refresh_token":"..."}.
+// :user is the user_name agents report. Meetings show up on the next
+// calendar sync.
+func (h *CalendarHandler) PutCalendar(c *fiber.Ctx) error {
+	var req struct {
+		Provider     string `json:"provider"`
+		CalendarID   string `json:"calendar_id"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Provider != "microsoft" && req.Provider != "google" {
+		return fiber.NewError(fiber.StatusBadRequest, "provider must be microsoft or google")
+	}
+	if req.RefreshToken == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "refresh_token is required")
+	}
+	a, err := h.calendars.Put(c.UserContext(), CalendarAccount{
+		UserName:     c.Params("user"),
+		Provider:     req.Provider,
+		CalendarID:   req.CalendarID,
+		RefreshToken: req.RefreshToken,
+	})
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(a)
+}
+
+// DELETE /admin/calendars/:user
+// Unlinks the calendar and drops its meetings; hours already labeled
+// IN_MEETING go back to LOW on the next sync.
+func (h *CalendarHandler) DeleteCalendar(c *fiber.Ctx) error {
+	ok, err := h.calendars.Delete(c.UserContext(), c.Params("user"))
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "calendar not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// agentCommands are the commands an admin may send to an agent; the agent
+// runs them like the same words on its control pipe.
+var agentCommands = map[string]bool{
+	"flush":         true, // upload pending hours and sync the log file
+	"rotate-log":    true,
+	"reload-config": true,
+	"send-logs":     true, // upload recent log lines, see log shipping
+}
+
+// Long-poll bounds for GET /agent/commands. Polls are also capped by the
+// request deadline, less commandPollMargin for the reply to get out.
+const (
+	maxCommandWait    = 60 * time.Second
+	commandPollMargin = 2 * time.Second
+	// re-read the table this often while waiting, for commands queued
+	// through another replica
+	commandRecheck = 5 * time.Second
+)
+
+// commandHub wakes this replica's long polls when a command is queued.
+type commandHub struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func (h *commandHub) wait(host string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	if h.waiters[host] == nil {
+		h.waiters[host] = make(map[chan struct{}]struct{})
+	}
+	h.waiters[host][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.waiters[host], ch)
+		if len(h.waiters[host]) == 0 {
+			delete(h.waiters, host)
+		}
+	}
+}
+
+func (h *commandHub) notify(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.waiters[host] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// CommandHandler lets admins push commands (flush now, send logs) to one
+// agent without remoting into the machine. Agents long-poll for them
+// over the ingest token and post back their reply line.
+type CommandHandler struct {
+	cmds *CommandRepo
+	hub  commandHub
+}
+
+func NewCommandHandler(cmds *CommandRepo) *CommandHandler {
+	return &CommandHandler{cmds: cmds, hub: commandHub{waiters: make(map[string]map[chan struct{}]struct{})}}
+}
+
+// POST /admin/agents/:host/commands
+// Body: {"command": "flush"}. Answers 202 with the queued command; the
+// agent picks it up on its next poll, within seconds when it is online.
+func (h *CommandHandler) PostCommand(c *fiber.Ctx) error {
+	var req struct {
+		Command string `json:"command"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if !agentCommands[req.Command] {
+		return fiber.NewError(fiber.StatusBadRequest, "command must be flush, rotate-log, reload-config or send-logs")
+	}
+	cmd, err := h.cmds.Queue(c.UserContext(), c.Params("host"), req.Command)
+	if err != nil {
+		return dbError(err)
+	}
+	h.hub.notify(cmd.Host)
+	return c.Status(fiber.StatusAccepted).JSON(cmd)
+}
+
+// GET /admin/agents/:host/commands?limit=20
+// The host's recent commands, newest first, with the agents' replies.
+func (h *CommandHandler) ListCommands(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit", 20, 1, 500)
+	if err != nil {
+		return err
+	}
+	cmds, err := h.cmds.Recent(c.UserContext(), c.Params("host"), limit)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(cmds), "commands": cmds})
+}
+
+// GET /agent/commands?host=PC-042&wait=25s
+// Long poll: answers as soon as host has commands, or with an empty list
+// once wait (or the request deadline) runs out.
+func (h *CommandHandler) PollCommands(c *fiber.Ctx) error {
+	host := c.Query("host")
+	if host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	wait := 25 * time.Second
+	if v := c.Query("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "wait must be a duration like 25s")
+		}
+		wait = min(d, maxCommandWait)
+	}
+	ctx := c.UserContext()
+	if dl, ok := ctx.Deadline(); ok {
+		wait = min(wait, time.Until(dl)-commandPollMargin)
+	}
+
+	woken, done := h.hub.wait(host)
+	defer done()
+	timeout := time.NewTimer(max(wait, 0))
+	defer timeout.Stop()
+	recheck := time.NewTicker(commandRecheck)
+	defer recheck.Stop()
+	for {
+		cmds, err := h.cmds.Take(ctx, host)
+		if err != nil {
+			return dbError(err)
+		}
+		if len(cmds) > 0 {
+			return c.JSON(fiber.Map{"commands": cmds})
+		}
+		select {
+		case <-woken:
+		case <-recheck.C:
+		case <-timeout.C:
+			return c.JSON(fiber.Map{"commands": []AgentCommand{}})
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// POST /agent/commands/:id/result
+// Body: {"host": "PC-042", "result": "ok flushed log, uploaded 1 pending rows"}
+func (h *CommandHandler) PostResult(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid command id")
+	}
+	var req struct {
+		Host   string `json:"host"`
+		Result string `json:"result"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	if len(req.Result) > 4096 {
+		req.Result = req.Result[:4096]
+	}
+	ok, err := h.cmds.Complete(c.UserContext(), id, req.Host, req.Result)
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "no delivered command with that id for this host")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CorrectionHandler struct {
+	repo ActivityRepository
+	live *LiveToday
+}
+
+func NewCorrectionHandler(repo ActivityRepository, live *LiveToday) *CorrectionHandler {
+	return &CorrectionHandler{repo: repo, live: live}
+}
+
+// rowCorrection is a PATCH body; absent fields are left unchanged.
+type rowCorrection struct {
+	ActivityPct *float64 `json:"activity_pct"`
+	IdleSeconds *float64 `json:"idle_seconds"`
+	Samples     *int64   `json:"samples"`
+	Status      *string  `json:"status"`
+	Note        *string  `json:"note"`
+}
+
+// hourAndHost reads the :hour_start path parameter and ?host= shared by
+// the correction routes.
+func hourAndHost(c *fiber.Ctx) (time.Time, string, error) {
+	t, err := time.Parse(time.RFC3339, c.Params("hour_start"))
+	if err != nil {
+		return time.Time{}, "", fiber.NewError(fiber.StatusBadRequest, "invalid hour_start (use RFC3339)")
+	}
+	t = t.UTC()
+	if !t.Equal(t.Truncate(time.Hour)) {
+		return time.Time{}, "", fiber.NewError(fiber.StatusBadRequest, "hour_start must be on the hour")
+	}
+	host := c.Query("host", "")
+	if host == "" {
+		return time.Time{}, "", fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	return t, host, nil
+}
+
+// hourRow loads the row the correction routes act on. ?user= picks one
+// user's share of a shared workstation's hour; it is required only when
+// several users hold that hour.
+func (h *CorrectionHandler) hourRow(c *fiber.Ctx, hour time.Time, host string) (ActivityRow, error) {
+	rows, err := h.repo.GetHour(c.UserContext(), hour, host, c.Query("user", ""))
+	if err != nil {
+		return ActivityRow{}, dbError(err)
+	}
+	switch len(rows) {
+	case 0:
+		return ActivityRow{}, fiber.NewError(fiber.StatusNotFound, "no row for that hour and host")
+	case 1:
+		return rows[0], nil
+	}
+	return ActivityRow{}, fiber.NewError(fiber.StatusConflict, "several users hold that hour, pass user")
+}
+
+// PATCH /activity/:hour_start?host=PC-042[&user=alice]
+// Corrects measured values or annotates a row with a note.
+func (h *CorrectionHandler) PatchRow(c *fiber.Ctx) error {
+	hour, host, err := hourAndHost(c)
+	if err != nil {
+		return err
+	}
+	var body rowCorrection
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+
+	ctx := c.UserContext()
+	before, err := h.hourRow(c, hour, host)
+	if err != nil {
+		return err
+	}
+
+	after := before
+	if body.ActivityPct != nil {
+		if *body.ActivityPct < 0 || *body.ActivityPct > 100 {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "activity_pct must be within 0-100")
+		}
+		after.ActivityPct = *body.ActivityPct
+	}
+	if body.IdleSeconds != nil {
+		if *body.IdleSeconds < 0 || *body.IdleSeconds > 3600 {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "idle_seconds must be within 0-3600")
+		}
+		after.IdleSeconds = *body.IdleSeconds
+	}
+	if body.Samples != nil {
+		if *body.Samples < 0 {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "samples cannot be negative")
+		}
+		after.Samples = *body.Samples
+	}
+	if body.Status != nil {
+		st, err := ParseStatus(*body.Status)
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+		}
+		after.Status = string(st)
+	}
+	if body.Note != nil {
+		after.Note = *body.Note
+	}
+
+	audit, err := auditStmt(c, "activity.correct", host+"@"+before.HourStart, before, after)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := h.repo.Correct(ctx, after, audit); err != nil {
+		return dbError(err)
+	}
+	h.live.Apply(tenantOf(ctx), []HourlyIngest{{
+		HourStart:   after.HourStart,
+		Host:        after.Host,
+		UserName:    after.UserName,
+		ActivityPct: after.ActivityPct,
+		IdleSeconds: after.IdleSeconds,
+		Samples:     after.Samples,
+		Status:      after.Status,
+	}})
+	return c.JSON(after)
+}
+
+// DELETE /activity/:hour_start?host=PC-042[&user=alice]
+// Tombstones the row: it disappears from every read and cannot be
+// resurrected by an agent re-sending the hour, but stays in the table.
+func (h *CorrectionHandler) DeleteRow(c *fiber.Ctx) error {
+	hour, host, err := hourAndHost(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.UserContext()
+	before, err := h.hourRow(c, hour, host)
+	if err != nil {
+		return err
+	}
+
+	audit, err := auditStmt(c, "activity.delete", host+"@"+before.HourStart, before, nil)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := h.repo.Tombstone(ctx, hour, host, before.UserName, audit); err != nil {
+		return dbError(err)
+	}
+	h.live.Drop(tenantOf(ctx), host, before.HourStart, before.UserName)
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// enrolledHostKey is the fiber local holding the host an agent token was
+// issued to.
+const enrolledHostKey = "enrolled_host"
+
+// EnrollHandler hands each agent its own token in exchange for the site's
+// ENROLLMENT_SECRET, so the secret only has to be present at install time
+// and a leaked token can be revoked alone.
+type EnrollHandler struct {
+	enrollments *EnrollmentRepo
+	tenants     *TenantRepo
+	secret      string
+}
+
+// NewEnrollHandlerFromEnv reads ENROLLMENT_SECRET; empty disables POST
+// /enroll.
+func NewEnrollHandlerFromEnv(enrollments *EnrollmentRepo, tenants *TenantRepo) *EnrollHandler {
+	return &EnrollHandler{enrollments: enrollments, tenants: tenants, secret: os.Getenv("ENROLLMENT_SECRET")}
+}
+
+// POST /enroll
+// Body: {"host": "PC-042", "enrollment_secret": "..."}
+// Answers 201 with {"agent_id", "tenant", "token", "signing_key"}: the token
+// goes in "Authorization: Bearer" on every agent request from then on, and
+// signing_key (present when BUCKET_SIGNING_KEY is set) signs its hourly
+// rows. Enrolling a host again revokes its previous token. The secret
+// decides the tenant: ENROLLMENT_SECRET itself for the default one, the
+// one from GET /admin/tenants/:id/enrollment-secret for the others.
+func (h *EnrollHandler) PostEnroll(c *fiber.Ctx) error {
+	if h.secret == "" {
+		return fiber.NewError(fiber.StatusForbidden, "enrollment disabled (set ENROLLMENT_SECRET)")
+	}
+	var req struct {
+		Host   string `json:"host"`
+		Secret string `json:"enrollment_secret"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	tenant := enrollmentTenant(req.Secret)
+	if subtle.ConstantTimeCompare([]byte(req.Secret), []byte(tenantEnrollmentSecret(h.secret, tenant))) != 1 {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid enrollment secret")
+	}
+	if req.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	ok, err := h.tenants.Exists(c.UserContext(), tenant)
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid enrollment secret")
+	}
+	e, token, err := h.enrollments.Enroll(withTenant(c.UserContext(), tenant), req.Host, c.IP())
+	if err != nil {
+		return dbError(err)
+	}
+	resp := fiber.Map{"agent_id": e.AgentID, "tenant": e.Tenant, "host": e.Host, "token": token}
+	if len(signingKey) > 0 {
+		resp["signing_key"] = agentSigningKey(e.Host)
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// GET /admin/enrollments
+func (h *EnrollHandler) ListEnrollments(c *fiber.Ctx) error {
+	list, err := h.enrollments.List(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(list), "enrollments": list})
+}
+
+// DELETE /admin/enrollments/:agent_id
+// Revokes an agent's token; backends honor the revocation within
+// enrollmentCacheTTL. The agent has to enroll again.
+func (h *EnrollHandler) DeleteEnrollment(c *fiber.Ctx) error {
+	ok, err := h.enrollments.Revoke(c.UserContext(), c.Params("agent_id"))
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "no live enrollment with that agent_id")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
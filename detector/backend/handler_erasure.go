@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErasureHandler takes data subject erasure requests (GDPR right to
+// erasure); the erasure job carries them out.
+type ErasureHandler struct {
+	erasures *ErasureRepo
+}
+
+func NewErasureHandler(erasures *ErasureRepo) *ErasureHandler {
+	return &ErasureHandler{erasures: erasures}
+}
+
+// DELETE /users/:user/data?mode=delete
+// Queues the erasure of everything held about user and answers 202 with
+// the request, to follow on GET /admin/erasures/:id. mode delete (the
+// default) removes the user's rows; anonymize keeps activity figures
+// under a random name so team totals stay right. Either way profiles,
+// calendars, tokens, consents, window titles and log lines naming the
+// user are deleted. Archives already exported (ARCHIVE_*) are not
+// touched; the audit log keeps a record of the request.
+func (h *ErasureHandler) DeleteUserData(c *fiber.Ctx) error {
+	user := c.Params("user")
+	if user == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "user is required")
+	}
+	mode := c.Query("mode", erasureDelete)
+	if mode != erasureDelete && mode != erasureAnonymize {
+		return badParam("mode must be delete or anonymize, got %q", mode)
+	}
+	e := Erasure{
+		ID:          "e-" + randomHex(8),
+		UserName:    user,
+		Mode:        mode,
+		Status:      erasureQueued,
+		RequestedBy: actorFrom(c),
+		RequestID:   requestIDFrom(c.UserContext()),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	audit, err := auditStmt(c, "user.erase.request", user, nil, fiber.Map{"erasure_id": e.ID, "mode": mode})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := h.erasures.Queue(c.UserContext(), e, audit); err != nil {
+		return dbError(err)
+	}
+	c.Location("/admin/erasures/" + e.ID)
+	return c.Status(fiber.StatusAccepted).JSON(e)
+}
+
+// GET /admin/erasures/:id
+func (h *ErasureHandler) GetErasure(c *fiber.Ctx) error {
+	e, ok, err := h.erasures.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "no erasure with that id")
+	}
+	return c.JSON(e)
+}
+
+// GET /admin/erasures?limit=100
+// The latest erasure requests, newest first.
+func (h *ErasureHandler) ListErasures(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit", 100, 1, 1000)
+	if err != nil {
+		return err
+	}
+	list, err := h.erasures.Recent(c.UserContext(), limit)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(list), "erasures": list})
+}
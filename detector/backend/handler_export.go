@@ -0,0 +1,226 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ExportHandler struct {
+	repo ActivityRepository
+}
+
+func NewExportHandler(repo ActivityRepository) *ExportHandler {
+	return &ExportHandler{repo: repo}
+}
+
+type archiveFile struct {
+	Name   string `json:"name"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+type archiveManifest struct {
+	From        string        `json:"from"`
+	To          string        `json:"to"`
+	GeneratedAt string        `json:"generated_at"`
+	Hosts       []string      `json:"hosts"`
+	Files       []archiveFile `json:"files"`
+}
+
+var hourlyCSVHeader = []string{"hour_start", "host", "user_name", "display_name", "team", "activity_pct", "idle_seconds", "samples", "status", "created_at"}
+
+// GET /export/archive?from=2026-01-01&to=2026-02-01
+// Streams a zip with hosts/<host>.csv, daily_summary.csv and manifest.json
+// covering [from, to) in UTC.
+func (h *ExportHandler) GetArchive(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+
+	// Query before streaming so database errors still get a proper status.
+	rows, err := h.repo.GetBetween(c.UserContext(), from.Format(time.RFC3339), to.Format(time.RFC3339), "", "")
+	if err != nil {
+		return dbError(err)
+	}
+
+	name := fmt.Sprintf("activity-%s_%s.zip", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		_ = writeArchive(w, from, to, rows)
+		_ = w.Flush()
+	})
+	return nil
+}
+
+// writeArchive writes the zip described in GetArchive to w.
+func writeArchive(w io.Writer, from, to time.Time, rows []ActivityRow) error {
+	zw := zip.NewWriter(w)
+
+	byHost := make(map[string][]ActivityRow)
+	for _, row := range rows {
+		byHost[row.Host] = append(byHost[row.Host], row)
+	}
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	manifest := archiveManifest{
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Hosts:       hosts,
+	}
+
+	for _, host := range hosts {
+		records := make([][]string, 0, len(byHost[host])+1)
+		records = append(records, hourlyCSVHeader)
+		for _, row := range byHost[host] {
+			records = append(records, hourlyCSVRecord(row))
+		}
+		name := "hosts/" + archiveHostName(host) + ".csv"
+		f, err := writeZipCSV(zw, name, records)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	f, err := writeZipCSV(zw, "daily_summary.csv", dailySummaryRecords(rows))
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, f)
+
+	mw, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func hourlyCSVRecord(row ActivityRow) []string {
+	return []string{
+		row.HourStart,
+		row.Host,
+		row.UserName,
+		row.DisplayName,
+		row.Team,
+		strconv.FormatFloat(row.ActivityPct, 'f', 2, 64),
+		strconv.FormatFloat(row.IdleSeconds, 'f', 0, 64),
+		strconv.FormatInt(row.Samples, 10),
+		row.Status,
+		row.CreatedAt,
+	}
+}
+
+// dailySummaryRecords rolls hourly rows up to one line per UTC day and host.
+// A day with only gap rows has no measured hour and an empty average.
+func dailySummaryRecords(rows []ActivityRow) [][]string {
+	type key struct{ day, host string }
+	type agg struct {
+		hours, activeHours, samples int64
+		pctSum, idleSeconds         float64
+	}
+	sums := make(map[key]*agg)
+	var keys []key
+	for _, row := range rows {
+		k := key{day: dayOf(row.HourStart), host: row.Host}
+		a, ok := sums[k]
+		if !ok {
+			a = &agg{}
+			sums[k] = a
+			keys = append(keys, k)
+		}
+		if !Status(row.Status).Measured() {
+			continue
+		}
+		a.hours++
+		if row.Status != string(StatusOff) {
+			a.activeHours++
+		}
+		a.samples += row.Samples
+		a.pctSum += row.ActivityPct
+		a.idleSeconds += row.IdleSeconds
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day != keys[j].day {
+			return keys[i].day < keys[j].day
+		}
+		return keys[i].host < keys[j].host
+	})
+
+	records := [][]string{{"date", "host", "hours", "active_hours", "avg_activity_pct", "idle_seconds", "samples"}}
+	for _, k := range keys {
+		a := sums[k]
+		avg := ""
+		if a.hours > 0 {
+			avg = strconv.FormatFloat(a.pctSum/float64(a.hours), 'f', 2, 64)
+		}
+		records = append(records, []string{
+			k.day,
+			k.host,
+			strconv.FormatInt(a.hours, 10),
+			strconv.FormatInt(a.activeHours, 10),
+			avg,
+			strconv.FormatFloat(a.idleSeconds, 'f', 0, 64),
+			strconv.FormatInt(a.samples, 10),
+		})
+	}
+	return records
+}
+
+// dayOf returns the YYYY-MM-DD prefix of an hour_start value.
+func dayOf(hourStart string) string {
+	if len(hourStart) < 10 {
+		return hourStart
+	}
+	return hourStart[:10]
+}
+
+// writeZipCSV adds a CSV entry and reports its data rows and checksum.
+func writeZipCSV(zw *zip.Writer, name string, records [][]string) (archiveFile, error) {
+	w, err := zw.Create(name)
+	if err != nil {
+		return archiveFile{}, err
+	}
+	sum := sha256.New()
+	cw := csv.NewWriter(io.MultiWriter(w, sum))
+	if err := cw.WriteAll(records); err != nil {
+		return archiveFile{}, err
+	}
+	return archiveFile{Name: name, Rows: len(records) - 1, SHA256: hex.EncodeToString(sum.Sum(nil))}, nil
+}
+
+// archiveHostName makes a host safe to use as a zip entry name.
+func archiveHostName(host string) string {
+	if host == "" {
+		return "_unknown"
+	}
+	b := []byte(host)
+	for i, ch := range b {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_' || ch == '.') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FleetHandler struct {
+	repo     ActivityRepository
+	settings *SettingsRepo
+	workers  int
+}
+
+// NewFleetHandler bounds per-host fan-out with FANOUT_WORKERS (default 8).
+func NewFleetHandler(repo ActivityRepository, settings *SettingsRepo) *FleetHandler {
+	workers := 8
+	if n, err := strconv.Atoi(os.Getenv("FANOUT_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+	return &FleetHandler{repo: repo, settings: settings, workers: workers}
+}
+
+// GET /activity/fleet?date=2026-02-07&start=07:00&end=16:00&hosts=PC-1,PC-2
+// Summarizes every host (or the listed ones) over the day window. Hosts
+// are queried concurrently so wallboards stay fast as the fleet grows.
+func (h *FleetHandler) GetFleet(c *fiber.Ctx) error {
+	sched, err := globalSchedule(c.UserContext(), h.settings)
+	if err != nil {
+		return err
+	}
+	start, end, err := dayWindow(c, sched)
+	if err != nil {
+		return err
+	}
+	ctx := c.UserContext()
+
+	var hosts []string
+	if list := c.Query("hosts", ""); list != "" {
+		for _, host := range strings.Split(list, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	} else if hosts, err = h.repo.Hosts(ctx, start, end); err != nil {
+		return dbError(err)
+	}
+
+	summaries, err := fanOut(ctx, hosts, h.workers, func(ctx context.Context, host string) (HostSummary, error) {
+		rows, err := h.repo.GetBetween(ctx, start, end, host, "")
+		if err != nil {
+			return HostSummary{}, err
+		}
+		return summarizeHost(host, rows), nil
+	})
+	if err != nil {
+		return dbError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"start": start,
+		"end":   end,
+		"count": len(summaries),
+		"hosts": summaries,
+	})
+}
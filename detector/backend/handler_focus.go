@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FocusHandler serves the focus sessions agents detect with
+// FocusSessions on.
+type FocusHandler struct {
+	focus *FocusRepo
+}
+
+func NewFocusHandler(focus *FocusRepo) *FocusHandler {
+	return &FocusHandler{focus: focus}
+}
+
+// GET /activity/focus?from=2026-03-02&to=2026-03-09&host=PC-042&user=alice
+// Sessions started in the UTC range [from, to), oldest first, with their
+// total duration in seconds.
+func (h *FocusHandler) GetFocus(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+	start, end := from.Format(time.RFC3339), to.Format(time.RFC3339)
+	sessions, err := h.focus.Between(c.UserContext(), start, end, c.Query("host", ""), c.Query("user", ""))
+	if err != nil {
+		return dbError(err)
+	}
+	total := 0.0
+	for _, s := range sessions {
+		total += s.DurationSeconds
+	}
+	return c.JSON(fiber.Map{
+		"from":          from.Format("2006-01-02"),
+		"to":            to.Format("2006-01-02"),
+		"count":         len(sessions),
+		"focus_seconds": total,
+		"sessions":      sessions,
+	})
+}
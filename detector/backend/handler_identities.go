@@ -0,0 +1,89 @@
+package main
+
+import (
+	"detector-api/pseudonym"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIdentities bounds one register or reveal body.
+const maxIdentities = 1000
+
+// IdentityHandler serves the de-anonymization mapping. It needs the site
+// key agents pseudonymize with (PSEUDONYM_KEY); without it both routes
+// answer 403.
+type IdentityHandler struct {
+	ids *IdentityRepo
+	key string
+}
+
+func NewIdentityHandler(ids *IdentityRepo, key string) *IdentityHandler {
+	return &IdentityHandler{ids: ids, key: key}
+}
+
+// POST /admin/identities
+// Body: {"kind":"user","values":["sara","amine"]}
+// Computes the pseudonyms agents will report for these names and records
+// the mapping, e.g. from a directory export.
+func (h *IdentityHandler) PostIdentities(c *fiber.Ctx) error {
+	if h.key == "" {
+		return fiber.NewError(fiber.StatusForbidden, "pseudonymization disabled (set PSEUDONYM_KEY)")
+	}
+	var req struct {
+		Kind   string   `json:"kind"`
+		Values []string `json:"values"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Kind != pseudonym.Host && req.Kind != pseudonym.User {
+		return fiber.NewError(fiber.StatusBadRequest, "kind must be host or user")
+	}
+	if len(req.Values) == 0 || len(req.Values) > maxIdentities {
+		return fiber.NewError(fiber.StatusBadRequest, "values must hold 1-1000 names")
+	}
+	ids := make([]Identity, 0, len(req.Values))
+	for _, v := range req.Values {
+		if v == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "empty name in values")
+		}
+		ids = append(ids, Identity{Pseudonym: pseudonym.Token(h.key, req.Kind, v), Kind: req.Kind, Value: v})
+	}
+	if err := h.ids.Put(c.UserContext(), ids); err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(ids), "identities": ids})
+}
+
+// POST /admin/identities/reveal
+// Body: {"pseudonyms":["u-3f9a1c0b7d2e4a55"]}
+// A POST rather than a GET so every reveal lands in the audit log.
+func (h *IdentityHandler) PostReveal(c *fiber.Ctx) error {
+	if h.key == "" {
+		return fiber.NewError(fiber.StatusForbidden, "pseudonymization disabled (set PSEUDONYM_KEY)")
+	}
+	var req struct {
+		Pseudonyms []string `json:"pseudonyms"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if len(req.Pseudonyms) == 0 || len(req.Pseudonyms) > maxIdentities {
+		return fiber.NewError(fiber.StatusBadRequest, "pseudonyms must hold 1-1000 tokens")
+	}
+	ids, err := h.ids.Lookup(c.UserContext(), req.Pseudonyms)
+	if err != nil {
+		return dbError(err)
+	}
+	found := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		found[id.Pseudonym] = true
+	}
+	unknown := make([]string, 0)
+	for _, p := range req.Pseudonyms {
+		if !found[p] {
+			unknown = append(unknown, p)
+		}
+	}
+	return c.JSON(fiber.Map{"identities": ids, "unknown": unknown})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"detector-api/logimport"
+	"detector-api/pseudonym"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImportHandler struct {
+	repo         ActivityRepository
+	settings     *SettingsRepo
+	pseudonymKey string
+}
+
+func NewImportHandler(repo ActivityRepository, settings *SettingsRepo, pseudonymKey string) *ImportHandler {
+	return &ImportHandler{repo: repo, settings: settings, pseudonymKey: pseudonymKey}
+}
+
+// POST /import?host=PC-01&user=sara&format=log|csv&dry_run=true
+// Body: one agent log file (activity-YYYY-MM-DD.log) or a CSV in the
+// /export/archive layout. Log files are rebuilt into hourly buckets from
+// their STATUS/MODE CHANGE lines. Hours already stored are left alone, so
+// re-importing is safe. format defaults from Content-Type (text/csv) or
+// the first line; host, user, display_name and team fill identity fields
+// the file does not carry. With PSEUDONYM_KEY set, clear host and user
+// names are pseudonymized like agents do and display names dropped.
+func (h *ImportHandler) PostImport(c *fiber.Ctx) error {
+	body := c.Body()
+	if len(bytes.TrimSpace(body)) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "empty body")
+	}
+	format := c.Query("format")
+	if format == "" {
+		format = "log"
+		if strings.HasPrefix(string(c.Request().Header.ContentType()), "text/csv") || bytes.HasPrefix(body, []byte("hour_start")) {
+			format = "csv"
+		}
+	}
+
+	var thresholds StatusThresholds
+	if err := h.settings.Get(c.UserContext(), SettingStatusThresholds, &thresholds); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	var (
+		rows    []HourlyIngest
+		skipped int
+	)
+	switch format {
+	case "log":
+		points, n, err := logimport.Parse(bytes.NewReader(body))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		rows, skipped = hourlyFromLog(logimport.Bucket(points), thresholds), n
+	case "csv":
+		var err error
+		if rows, err = parseHourlyCSV(bytes.NewReader(body), thresholds); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "format must be log or csv")
+	}
+
+	for i := range rows {
+		r := &rows[i]
+		if r.Host == "" {
+			r.Host = c.Query("host")
+		}
+		if r.UserName == "" {
+			r.UserName = c.Query("user")
+		}
+		if r.DisplayName == "" {
+			r.DisplayName = c.Query("display_name")
+		}
+		if r.Team == "" {
+			r.Team = c.Query("team")
+		}
+		if h.pseudonymKey != "" {
+			if !pseudonym.IsToken(r.Host) {
+				r.Host = pseudonym.Token(h.pseudonymKey, pseudonym.Host, r.Host)
+			}
+			if r.UserName != "" && !pseudonym.IsToken(r.UserName) {
+				r.UserName = pseudonym.Token(h.pseudonymKey, pseudonym.User, r.UserName)
+			}
+			r.DisplayName = ""
+		}
+		if err := validateHourly(r); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("hour %d: %v", i, err))
+		}
+	}
+
+	out := fiber.Map{"format": format, "hours": len(rows), "skipped_lines": skipped}
+	if c.QueryBool("dry_run", false) {
+		out["rows"] = rows
+		return c.JSON(out)
+	}
+	var inserted int64
+	for start := 0; start < len(rows); start += maxIngestRows {
+		end := start + maxIngestRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		n, err := h.repo.InsertMissing(c.UserContext(), rows[start:end])
+		if err != nil {
+			return dbError(err)
+		}
+		inserted += n
+	}
+	out["inserted"] = inserted
+	out["already_present"] = int64(len(rows)) - inserted
+	return c.JSON(out)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rqlite/gorqlite"
+)
+
+// maxIngestRows and maxIngestBytes (after decompression) bound one POST
+// /ingest/hourly body.
+const (
+	maxIngestRows  = 500
+	maxIngestBytes = 4 << 20
+)
+
+// maxMonitors bounds the per-display breakdown of one row.
+const maxMonitors = 16
+
+// maxCategories and maxDomains bound the per-category and per-domain
+// breakdowns of one row.
+const (
+	maxCategories = 32
+	maxDomains    = 64
+)
+
+type IngestHandler struct {
+	repo      ActivityRepository
+	live      *LiveToday
+	calendars *CalendarRepo
+	keys      *IngestKeyRepo
+}
+
+func NewIngestHandler(repo ActivityRepository, live *LiveToday, calendars *CalendarRepo, keys *IngestKeyRepo) *IngestHandler {
+	return &IngestHandler{repo: repo, live: live, calendars: calendars, keys: keys}
+}
+
+// POST /ingest/hourly
+// Body: one HourlyIngest object or an array of them, optionally with
+// Content-Encoding: gzip or zstd. Statuses are
+// normalized (legacy spellings mapped) and unknown ones rejected, so the
+// table only ever holds canonical values; statuses the backend assigns
+// itself (GET /statuses) are rejected too. LOW hours that overlap a
+// synced calendar meeting are stored as IN_MEETING. A row identical to
+// one ingested within the dedupe window is a retry: it is acknowledged
+// but not written again, and counted in "duplicates".
+func (h *IngestHandler) PostHourly(c *fiber.Ctx) error {
+	data, err := readBody(c, maxIngestBytes)
+	if err != nil {
+		return err
+	}
+	rows, err := decodeHourly(data)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	for i := range rows {
+		// before validateHourly normalizes the status the agent signed
+		verifyIngest(&rows[i])
+		if err := validateHourly(&rows[i]); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("row %d: %v", i, err))
+		}
+		if !Status(rows[i].Status).Reported() {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("row %d: status %s is assigned by the backend, not agents", i, rows[i].Status))
+		}
+	}
+	posted := len(rows)
+	rows, keys, err := h.dedupe(c.UserContext(), rows)
+	if err != nil {
+		return dbError(err)
+	}
+	duplicates := posted - len(rows)
+	if len(rows) == 0 {
+		return c.JSON(fiber.Map{"accepted": 0, "duplicates": duplicates})
+	}
+
+	if err := h.labelMeetings(c.UserContext(), rows); err != nil {
+		// the calendar job relabels these rows on its next run
+		log.Printf("ingest: meeting lookup failed: %v", err)
+	}
+	var extra []gorqlite.ParameterizedStatement
+	if len(keys) > 0 {
+		extra = append(extra, h.keys.recordStmt(c.UserContext(), keys))
+	}
+	if err := h.repo.Upsert(c.UserContext(), rows, extra...); err != nil {
+		return dbError(err)
+	}
+	h.live.Apply(tenantOf(c.UserContext()), rows)
+	return c.JSON(fiber.Map{"accepted": len(rows), "duplicates": duplicates})
+}
+
+// dedupe drops the rows whose idempotency key was seen within the dedupe
+// window, as well as repeats within the batch. It returns the rows left
+// and the keys of the whole batch (nil when deduplication is off), to be
+// recorded with the write.
+func (h *IngestHandler) dedupe(ctx context.Context, rows []HourlyIngest) ([]HourlyIngest, []string, error) {
+	if h.keys.window <= 0 {
+		return rows, nil, nil
+	}
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		k, err := ingestKey(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[i] = k
+	}
+	seen, err := h.keys.Seen(ctx, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	fresh := rows[:0:0]
+	for i, r := range rows {
+		if seen[keys[i]] {
+			continue
+		}
+		seen[keys[i]] = true
+		fresh = append(fresh, r)
+	}
+	return fresh, keys, nil
+}
+
+// labelMeetings sets LOW rows that overlap a meeting of their user to
+// IN_MEETING.
+func (h *IngestHandler) labelMeetings(ctx context.Context, rows []HourlyIngest) error {
+	var low []string
+	for _, r := range rows {
+		if r.Status == string(StatusLow) && r.UserName != "" {
+			low = append(low, r.HourStart)
+		}
+	}
+	from, to, ok := hourSpan(low)
+	if !ok {
+		return nil
+	}
+	hours, err := h.calendars.MeetingHours(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	for i, r := range rows {
+		if r.Status == string(StatusLow) && hours.has(r.UserName, r.HourStart) {
+			rows[i].Status = string(StatusInMeeting)
+		}
+	}
+	return nil
+}
+
+func decodeHourly(body []byte) ([]HourlyIngest, error) {
+	var rows []HourlyIngest
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %v", err)
+		}
+	} else {
+		var row HourlyIngest
+		if err := json.Unmarshal(body, &row); err != nil {
+			return nil, fmt.Errorf("invalid JSON object: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows")
+	}
+	if len(rows) > maxIngestRows {
+		return nil, fmt.Errorf("too many rows (max %d)", maxIngestRows)
+	}
+	return rows, nil
+}
+
+// validateHourly checks one row and normalizes it in place.
+func validateHourly(row *HourlyIngest) error {
+	t, err := time.Parse(time.RFC3339, row.HourStart)
+	if err != nil {
+		return fmt.Errorf("hour_start must be RFC3339")
+	}
+	t = t.UTC()
+	if !t.Equal(t.Truncate(time.Hour)) {
+		return fmt.Errorf("hour_start must be on the hour")
+	}
+	row.HourStart = t.Format("2006-01-02T15:00:00Z")
+	if row.LocalHour != "" {
+		lt, err := time.Parse(time.RFC3339, row.LocalHour)
+		if err != nil || !lt.Equal(t) {
+			return fmt.Errorf("local_hour must be hour_start with a zone offset")
+		}
+	}
+
+	if row.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if row.ActivityPct < 0 || row.ActivityPct > 100 {
+		return fmt.Errorf("activity_pct must be within 0-100")
+	}
+	if row.IdleSeconds < 0 || row.IdleSeconds > 3600 {
+		return fmt.Errorf("idle_seconds must be within 0-3600")
+	}
+	if row.Samples < 0 {
+		return fmt.Errorf("samples cannot be negative")
+	}
+	if row.BatterySeconds < 0 || row.BatterySeconds > 3600 {
+		return fmt.Errorf("battery_seconds must be within 0-3600")
+	}
+	if row.BatteryPct != nil && (*row.BatteryPct < 0 || *row.BatteryPct > 100) {
+		return fmt.Errorf("battery_pct must be within 0-100")
+	}
+	if row.EWMAPct != nil && (*row.EWMAPct < 0 || *row.EWMAPct > 100) {
+		return fmt.Errorf("ewma_pct must be within 0-100")
+	}
+	if row.DegradedSeconds < 0 || row.DegradedSeconds > 3600 {
+		return fmt.Errorf("degraded_seconds must be within 0-3600")
+	}
+	if len(row.CategorySeconds) > maxCategories {
+		return fmt.Errorf("category_seconds: at most %d categories", maxCategories)
+	}
+	for name, secs := range row.CategorySeconds {
+		if name == "" || secs < 0 || secs > 3600 {
+			return fmt.Errorf("category_seconds[%q] must be within 0-3600", name)
+		}
+	}
+	if len(row.DomainSeconds) > maxDomains {
+		return fmt.Errorf("domain_seconds: at most %d domains", maxDomains)
+	}
+	for name, secs := range row.DomainSeconds {
+		if name == "" || secs < 0 || secs > 3600 {
+			return fmt.Errorf("domain_seconds[%q] must be within 0-3600", name)
+		}
+	}
+	if len(row.MonitorSeconds) > maxMonitors {
+		return fmt.Errorf("monitor_seconds: at most %d displays", maxMonitors)
+	}
+	for name, secs := range row.MonitorSeconds {
+		if name == "" || secs < 0 || secs > 3600 {
+			return fmt.Errorf("monitor_seconds[%q] must be within 0-3600", name)
+		}
+	}
+	if row.MouseEvents < 0 || row.KeyEvents < 0 || row.TouchEvents < 0 {
+		return fmt.Errorf("input event counts cannot be negative")
+	}
+	if err := normalizeInputSpan(row); err != nil {
+		return err
+	}
+	if row.Breaks < 0 || row.BreakSeconds < 0 {
+		return fmt.Errorf("breaks and break_seconds cannot be negative")
+	}
+	if row.SyntheticConfidence < 0 || row.SyntheticConfidence > 1 {
+		return fmt.Errorf("synthetic_confidence must be within 0-1")
+	}
+	st, err := ParseStatus(row.Status)
+	if err != nil {
+		return err
+	}
+	row.Status = string(st)
+	return nil
+}
+
+// normalizeInputSpan checks that first_input and last_input, when set,
+// fall within the row's hour in order, and stores them as UTC.
+func normalizeInputSpan(row *HourlyIngest) error {
+	hour, err := time.Parse(time.RFC3339, row.HourStart)
+	if err != nil {
+		return nil // reported by the hour_start check
+	}
+	var first, last time.Time
+	for _, f := range []struct {
+		name string
+		v    *string
+		t    *time.Time
+	}{{"first_input", &row.FirstInput, &first}, {"last_input", &row.LastInput, &last}} {
+		if *f.v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *f.v)
+		if err != nil {
+			return fmt.Errorf("%s must be RFC3339", f.name)
+		}
+		if t.Before(hour) || !t.Before(hour.Add(time.Hour)) {
+			return fmt.Errorf("%s must fall within the hour", f.name)
+		}
+		*f.t = t
+		*f.v = t.UTC().Format(time.RFC3339)
+	}
+	if !first.IsZero() && !last.IsZero() && last.Before(first) {
+		return fmt.Errorf("last_input cannot be before first_input")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sseKeepAlive is how often an idle stream gets a comment line, so
+// proxies don't time the connection out.
+const sseKeepAlive = 15 * time.Second
+
+type LiveHandler struct {
+	live *LiveToday
+}
+
+func NewLiveHandler(live *LiveToday) *LiveHandler {
+	return &LiveHandler{live: live}
+}
+
+// GET /activity/live?host=PC-042
+// Today-so-far (UTC) per host from the in-memory aggregate; no rqlite
+// round-trip.
+func (h *LiveHandler) GetLive(c *fiber.Ctx) error {
+	hosts := h.live.Get(tenantOf(c.UserContext()), c.Query("host", ""))
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return c.JSON(fiber.Map{
+		"count": len(hosts),
+		"hosts": hosts,
+	})
+}
+
+// GET /activity/stream?host=PC-042
+// Server-sent events: a "today" event with the current aggregate of each
+// (matching) host, then one per update as rows are ingested.
+func (h *LiveHandler) GetStream(c *fiber.Ctx) error {
+	host, tenant := c.Query("host", ""), tenantOf(c.UserContext())
+	updates, cancel := h.live.Subscribe()
+	initial := h.live.Get(tenant, host)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		for _, t := range initial {
+			if writeSSE(w, "today", t) != nil {
+				return
+			}
+		}
+		if w.Flush() != nil {
+			return
+		}
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case t, ok := <-updates:
+				if !ok {
+					return
+				}
+				if t.Tenant != tenant || (host != "" && t.Host != host) {
+					continue
+				}
+				if writeSSE(w, "today", t) != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+			// a failed flush means the client went away
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func writeSSE(w *bufio.Writer, event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
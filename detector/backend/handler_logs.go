@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Bounds on one POST /logs batch, checked after decompression.
+const (
+	maxLogBatchBytes = 8 << 20
+	maxLogBatchLines = 5000
+	maxLogLineBytes  = 4096
+)
+
+// LogHandler receives agent log lines, so troubleshooting does not need
+// filesystem access to every workstation.
+type LogHandler struct {
+	logs *LogRepo
+}
+
+func NewLogHandler(logs *LogRepo) *LogHandler {
+	return &LogHandler{logs: logs}
+}
+
+// POST /logs
+// Body: {"host": "PC-042", "lines": ["[2026-03-02T10:00:00+01:00] START ..."]},
+// optionally with Content-Encoding: gzip or zstd. Lines longer than 4 KiB are cut.
+func (h *LogHandler) PostLogs(c *fiber.Ctx) error {
+	data, err := readBody(c, maxLogBatchBytes)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Host  string   `json:"host"`
+		Lines []string `json:"lines"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	if len(req.Lines) > maxLogBatchLines {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "too many lines (max 5000)")
+	}
+	if len(req.Lines) == 0 {
+		return c.JSON(fiber.Map{"stored": 0})
+	}
+	for i, l := range req.Lines {
+		if len(l) > maxLogLineBytes {
+			req.Lines[i] = l[:maxLogLineBytes]
+		}
+	}
+	if err := h.logs.Append(c.UserContext(), req.Host, req.Lines); err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"stored": len(req.Lines)})
+}
+
+// GET /admin/agents/:host/logs?after=<id>&limit=500
+// The host's last limit lines, or the lines after id for following a log.
+func (h *LogHandler) GetLogs(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit", 500, 1, maxLogBatchLines)
+	if err != nil {
+		return err
+	}
+	after, err := queryInt(c, "after", 0, 0, math.MaxInt)
+	if err != nil {
+		return err
+	}
+	lines, err := h.logs.Tail(c.UserContext(), c.Params("host"), int64(after), limit)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(lines), "lines": lines})
+}
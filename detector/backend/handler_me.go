@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// collectedItem is one kind of data agents can collect about a user.
+type collectedItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	When        string `json:"when"`
+}
+
+// collectedData is what GET /me/collection-policy lists; keep it in step
+// with the agent's Config.
+var collectedData = []collectedItem{
+	{"identity", "Host name, user name, display name, team and labels set by IT", "always"},
+	{"hourly_activity", "Per hour: share of active time, idle seconds, sample count, status, and counts of mouse, keyboard and touch events (never which keys, nor where)", "always"},
+	{"breaks", "First and last input of each hour, and idle periods between BreakMin and BreakMax", "always"},
+	{"synthetic_input", "Whether the hour's input looked machine-made (mouse jigglers), with a confidence", "always"},
+	{"presence", "Time of the last input and the current mode, sent with heartbeats", "when the agent reports to the backend"},
+	{"raw_samples", "Each sample's time and idle duration", "when RawSamples is on"},
+	{"app_categories", "Active time per application category", "when TrackAppCategories is on"},
+	{"domains", "Active browser time per web domain", "when DomainTracking is on"},
+	{"focus_sessions", "Uninterrupted stretches spent in one application", "when FocusSessions is on"},
+	{"window_titles", "Foreground window titles, readable by administrators only", "when WindowTitles is on"},
+}
+
+// MeHandler lets monitored users, through their self-view token, see what
+// is held about them and answer the collection policy.
+type MeHandler struct {
+	repo     ActivityRepository
+	focus    *FocusRepo
+	settings *SettingsRepo
+	consents *ConsentRepo
+}
+
+func NewMeHandler(repo ActivityRepository, focus *FocusRepo, settings *SettingsRepo, consents *ConsentRepo) *MeHandler {
+	return &MeHandler{repo: repo, focus: focus, settings: settings, consents: consents}
+}
+
+// meUser is the user of the request's self-view token.
+func meUser(c *fiber.Ctx) (string, error) {
+	t, ok := c.Locals(apiTokenKey).(APIToken)
+	if !ok || t.Role != roleSelfView {
+		return "", fiber.NewError(fiber.StatusForbidden, "/me needs a self-view token (POST /admin/tokens)")
+	}
+	return t.UserName, nil
+}
+
+func (h *MeHandler) policy(c *fiber.Ctx) (CollectionPolicy, error) {
+	var p CollectionPolicy
+	if err := h.settings.Get(c.UserContext(), SettingCollectionPolicy, &p); err != nil {
+		return p, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return p, nil
+}
+
+// GET /me/activity?from=2026-03-02&to=2026-03-09
+// Every hourly row and focus session stored for the token's user over the
+// UTC range [from, to), with all their fields.
+func (h *MeHandler) GetActivity(c *fiber.Ctx) error {
+	user, err := meUser(c)
+	if err != nil {
+		return err
+	}
+	from, to, err := parseDateRange(c, "from", "to")
+	if err != nil {
+		return err
+	}
+	start, end := from.Format(time.RFC3339), to.Format(time.RFC3339)
+	rows, err := h.repo.GetBetween(c.UserContext(), start, end, "", "")
+	if err != nil {
+		return dbError(err)
+	}
+	mine := make([]ActivityRow, 0, len(rows))
+	for _, r := range rows {
+		if r.UserName == user {
+			mine = append(mine, r)
+		}
+	}
+	sessions, err := h.focus.Between(c.UserContext(), start, end, "", user)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"user":           user,
+		"from":           from.Format("2006-01-02"),
+		"to":             to.Format("2006-01-02"),
+		"rows":           mine,
+		"focus_sessions": sessions,
+	})
+}
+
+// GET /me/collection-policy
+// The policy notice, what agents may collect and for how long it is kept,
+// and the token's user's answer to the current version (null if none).
+func (h *MeHandler) GetCollectionPolicy(c *fiber.Ctx) error {
+	user, err := meUser(c)
+	if err != nil {
+		return err
+	}
+	p, err := h.policy(c)
+	if err != nil {
+		return err
+	}
+	var retention Retention
+	if err := h.settings.Get(c.UserContext(), SettingRetention, &retention); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	consent, ok, err := h.consents.Get(c.UserContext(), user, p.Version)
+	if err != nil {
+		return dbError(err)
+	}
+	resp := fiber.Map{
+		"user":      user,
+		"policy":    p,
+		"collected": collectedData,
+		"retention": retention,
+		"consent":   nil,
+	}
+	if ok {
+		resp["consent"] = consent
+	}
+	return c.JSON(resp)
+}
+
+// POST /me/consent
+// Body: {"policy_version": "1", "granted": true}
+// Records the token's user's answer to the current policy version; an
+// older version is refused with 409 so nobody consents to a notice they
+// were not shown. A user can withdraw by posting granted false.
+func (h *MeHandler) PostConsent(c *fiber.Ctx) error {
+	user, err := meUser(c)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		PolicyVersion string `json:"policy_version"`
+		Granted       *bool  `json:"granted"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Granted == nil {
+		return badParam("granted is required")
+	}
+	p, err := h.policy(c)
+	if err != nil {
+		return err
+	}
+	if req.PolicyVersion != p.Version {
+		return fiber.NewError(fiber.StatusConflict, "policy_version "+req.PolicyVersion+" is not the current version "+p.Version)
+	}
+	consent := Consent{
+		UserName:      user,
+		PolicyVersion: p.Version,
+		Granted:       *req.Granted,
+		At:            time.Now().UTC().Format(time.RFC3339),
+		RemoteAddr:    c.IP(),
+	}
+	var before interface{}
+	prev, ok, err := h.consents.Get(c.UserContext(), user, p.Version)
+	if err != nil {
+		return dbError(err)
+	}
+	if ok {
+		before = prev
+	}
+	audit, err := auditStmt(c, "consent.record", user, before, consent)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := h.consents.Record(c.UserContext(), consent, audit); err != nil {
+		return dbError(err)
+	}
+	return c.JSON(consent)
+}
+
+// GET /admin/consents?version=1
+// Every user's answer to version (default the current one; "all" for
+// every version), newest first.
+func (h *MeHandler) ListConsents(c *fiber.Ctx) error {
+	version := c.Query("version")
+	if version == "" {
+		p, err := h.policy(c)
+		if err != nil {
+			return err
+		}
+		version = p.Version
+	}
+	if version == "all" {
+		version = ""
+	}
+	list, err := h.consents.List(c.UserContext(), version)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(list), "consents": list})
+}
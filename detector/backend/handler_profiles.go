@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProfileHandler struct {
+	profiles *ProfileRepo
+}
+
+func NewProfileHandler(profiles *ProfileRepo) *ProfileHandler {
+	return &ProfileHandler{profiles: profiles}
+}
+
+// GET /admin/profiles
+func (h *ProfileHandler) ListProfiles(c *fiber.Ctx) error {
+	profiles, err := h.profiles.List(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(profiles), "profiles": profiles})
+}
+
+// GET /admin/profiles/:user
+func (h *ProfileHandler) GetProfile(c *fiber.Ctx) error {
+	p, ok, err := h.profiles.Get(c.UserContext(), c.Params("user"))
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "profile not found")
+	}
+	return c.JSON(p)
+}
+
+// PUT /admin/profiles/:user
+// Body: {"start":"08:30","end":"17:00","weekdays":[1,2,3,4,5],"tz":"Africa/Algiers"}
+func (h *ProfileHandler) PutProfile(c *fiber.Ctx) error {
+	var p UserProfile
+	if err := c.BodyParser(&p); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	p.UserName = c.Params("user")
+	if p.TZ == "" {
+		p.TZ = "UTC"
+	}
+	if err := validateSchedule(p.Schedule); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	p, err := h.profiles.Put(c.UserContext(), p)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(p)
+}
+
+// DELETE /admin/profiles/:user
+func (h *ProfileHandler) DeleteProfile(c *fiber.Ctx) error {
+	ok, err := h.profiles.Delete(c.UserContext(), c.Params("user"))
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "profile not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxQueryHosts bounds the host list of one POST /activity/query.
+const maxQueryHosts = 500
+
+// activityQuery is the body of POST /activity/query.
+type activityQuery struct {
+	Hosts       []string `json:"hosts"`
+	From        string   `json:"from"` // YYYY-MM-DD or RFC3339
+	To          string   `json:"to"`   // exclusive
+	Granularity string   `json:"granularity"`
+	GroupBy     string   `json:"group_by"`
+	TZ          string   `json:"tz"`
+}
+
+// parseQueryTime reads an RFC3339 timestamp or a YYYY-MM-DD date taken as
+// midnight in loc.
+func parseQueryTime(s string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// POST /activity/query
+// Body: {"hosts": ["PC-042", "PC-043"], "from": "2026-02-02", "to": "2026-02-09", "granularity": "day", "group_by": "status", "tz": "Europe/Paris"}
+// Aggregates every listed host in one query instead of one request per
+// machine. granularity is hour (default), day, week (starting Monday) or
+// month; group_by is empty, user, team or status. Buckets are local to tz
+// (default UTC), using its offset at from. The reply's "hosts" maps every
+// requested host to its buckets, empty when it has no rows.
+func (h *ActivityHandler) PostQuery(c *fiber.Ctx) error {
+	var q activityQuery
+	if err := json.Unmarshal(c.Body(), &q); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if len(q.Hosts) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "hosts is required")
+	}
+	if len(q.Hosts) > maxQueryHosts {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d hosts per query", maxQueryHosts))
+	}
+	if q.Granularity == "" {
+		q.Granularity = "hour"
+	}
+	if _, ok := queryBucketSQL[q.Granularity]; !ok {
+		return badParam("granularity must be hour, day, week or month, got %q", q.Granularity)
+	}
+	if _, ok := queryGroupSQL[q.GroupBy]; !ok {
+		return badParam("group_by must be empty, user, team or status, got %q", q.GroupBy)
+	}
+	loc, err := parseTZ("tz", q.TZ)
+	if err != nil {
+		return err
+	}
+	from, ok := parseQueryTime(q.From, loc)
+	if !ok {
+		return badParam("invalid from %q (use YYYY-MM-DD or RFC3339)", q.From)
+	}
+	to, ok := parseQueryTime(q.To, loc)
+	if !ok {
+		return badParam("invalid to %q (use YYYY-MM-DD or RFC3339)", q.To)
+	}
+	if err := checkRange("from", "to", from, to); err != nil {
+		return err
+	}
+	_, offset := from.In(loc).Zone()
+	tzModifier := fmt.Sprintf("%+d minutes", offset/60)
+
+	buckets, err := h.repo.QueryBuckets(c.UserContext(), q.Hosts,
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), q.Granularity, q.GroupBy, tzModifier)
+	if err != nil {
+		return dbError(err)
+	}
+	byHost := make(map[string][]QueryBucket, len(q.Hosts))
+	for _, host := range q.Hosts {
+		byHost[host] = []QueryBucket{}
+	}
+	for _, b := range buckets {
+		byHost[b.Host] = append(byHost[b.Host], b)
+	}
+
+	return c.JSON(fiber.Map{
+		"from":        from.Format(time.RFC3339),
+		"to":          to.Format(time.RFC3339),
+		"granularity": q.Granularity,
+		"group_by":    q.GroupBy,
+		"tz":          q.TZ,
+		"hosts":       byHost,
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RecomputeHandler struct {
+	samples  *SampleRepo
+	repo     ActivityRepository
+	settings *SettingsRepo
+}
+
+func NewRecomputeHandler(samples *SampleRepo, repo ActivityRepository, settings *SettingsRepo) *RecomputeHandler {
+	return &RecomputeHandler{samples: samples, repo: repo, settings: settings}
+}
+
+type recomputeRequest struct {
+	From                 string `json:"from"` // YYYY-MM-DD, UTC
+	To                   string `json:"to"`   // YYYY-MM-DD, exclusive
+	Host                 string `json:"host"`
+	ActiveIfIdleLessThan string `json:"active_if_idle_less_than"` // e.g. "45s"
+	Apply                bool   `json:"apply"`                    // write the result to activity_hourly
+}
+
+// POST /activity/recompute
+// Re-derives hourly buckets from raw samples with another idle threshold.
+// Without "apply" it is a preview; with it the buckets replace the stored
+// ones, so admins can try scoring policies retroactively.
+func (h *RecomputeHandler) PostRecompute(c *fiber.Ctx) error {
+	var req recomputeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	from, err := parseDay("from", req.From, time.UTC)
+	if err != nil {
+		return err
+	}
+	to, err := parseDay("to", req.To, time.UTC)
+	if err != nil {
+		return err
+	}
+	if err := checkRange("from", "to", from, to); err != nil {
+		return err
+	}
+	threshold, err := time.ParseDuration(req.ActiveIfIdleLessThan)
+	if err != nil || threshold <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid active_if_idle_less_than (use a duration like 30s)")
+	}
+
+	var thresholds StatusThresholds
+	if err := h.settings.Get(c.UserContext(), SettingStatusThresholds, &thresholds); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	ctx := c.UserContext()
+	rows, err := h.samples.RecomputeHourly(ctx, from.Format(time.RFC3339), to.Format(time.RFC3339), req.Host, threshold, thresholds)
+	if err != nil {
+		return dbError(err)
+	}
+
+	if req.Apply && len(rows) > 0 {
+		// keep identity columns the agent reported for those hours
+		existing, err := h.repo.GetBetween(ctx, from.Format(time.RFC3339), to.Format(time.RFC3339), req.Host, ConsistencyStrong)
+		if err != nil {
+			return dbError(err)
+		}
+		byKey := make(map[string]ActivityRow, len(existing))
+		for _, e := range existing {
+			byKey[e.HourStart+"|"+e.Host+"|"+e.UserName] = e
+		}
+		for i := range rows {
+			if e, ok := byKey[rows[i].HourStart+"|"+rows[i].Host+"|"+rows[i].UserName]; ok {
+				rows[i].DisplayName, rows[i].Team, rows[i].Labels = e.DisplayName, e.Team, e.Labels
+				rows[i].BatterySeconds, rows[i].BatteryPct = e.BatterySeconds, e.BatteryPct
+				rows[i].MonitorSeconds = e.MonitorSeconds
+				rows[i].MouseEvents, rows[i].KeyEvents, rows[i].TouchEvents = e.MouseEvents, e.KeyEvents, e.TouchEvents
+				rows[i].LocalHour, rows[i].EWMAPct = e.LocalHour, e.EWMAPct
+				rows[i].DegradedSeconds, rows[i].CategorySeconds, rows[i].DomainSeconds = e.DegradedSeconds, e.CategorySeconds, e.DomainSeconds
+				rows[i].FirstInput, rows[i].LastInput = e.FirstInput, e.LastInput
+				rows[i].Breaks, rows[i].BreakSeconds = e.Breaks, e.BreakSeconds
+				rows[i].SuspectedSynthetic, rows[i].SyntheticConfidence = e.SuspectedSynthetic, e.SyntheticConfidence
+				rows[i].MediaInhibit = e.MediaInhibit
+			}
+		}
+		if err := h.repo.Upsert(ctx, rows); err != nil {
+			return dbError(err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"from":                     req.From,
+		"to":                       req.To,
+		"active_if_idle_less_than": threshold.String(),
+		"applied":                  req.Apply,
+		"count":                    len(rows),
+		"rows":                     rows,
+	})
+}
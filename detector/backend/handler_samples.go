@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Bounds on one POST /ingest/samples batch, checked after decompression.
+const (
+	maxSampleBatchBytes = 8 << 20
+	maxSampleBatch      = 5000
+)
+
+// SampleHandler receives raw agent samples, from which hourly rows can be
+// recomputed under any policy (see POST /activity/recompute).
+type SampleHandler struct {
+	samples *SampleRepo
+}
+
+func NewSampleHandler(samples *SampleRepo) *SampleHandler {
+	return &SampleHandler{samples: samples}
+}
+
+// GET /activity/rollups?from=2026-03-02&to=2026-03-03&resolution=5m&host=PC-042&active_if_idle_less_than=30s
+// Activity from the raw sample roll-ups, at 5m, hour (default) or day
+// resolution and under one of the kept idle thresholds (default 30s,
+// the agent's). from and to are UTC dates or RFC3339 timestamps.
+func (h *SampleHandler) GetRollups(c *fiber.Ctx) error {
+	resolution := c.Query("resolution", "hour")
+	if _, ok := rollupTables[resolution]; !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "resolution must be 5m, hour or day")
+	}
+	threshold, err := time.ParseDuration(c.Query("active_if_idle_less_than", "30s"))
+	if err != nil || rollupKey(threshold) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "active_if_idle_less_than must be one of "+rollupThresholdList())
+	}
+	from, ok := parseQueryTime(c.Query("from"), time.UTC)
+	if !ok {
+		return badParam("invalid from %q (use YYYY-MM-DD or RFC3339)", c.Query("from"))
+	}
+	to, ok := parseQueryTime(c.Query("to"), time.UTC)
+	if !ok {
+		return badParam("invalid to %q (use YYYY-MM-DD or RFC3339)", c.Query("to"))
+	}
+	if err := checkRange("from", "to", from, to); err != nil {
+		return err
+	}
+	buckets, err := h.samples.Rollups(c.UserContext(), resolution,
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), c.Query("host", ""), threshold)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"from":                     from.UTC().Format(time.RFC3339),
+		"to":                       to.UTC().Format(time.RFC3339),
+		"resolution":               resolution,
+		"active_if_idle_less_than": threshold.String(),
+		"buckets":                  buckets,
+	})
+}
+
+// POST /ingest/samples
+// Body: {"host": "PC-042", "user_name": "jdoe", "samples": [{"ts": "2026-03-02T09:00:01Z", "idle_ms": 1200, "interval_ms": 1000}]},
+// optionally with Content-Encoding: gzip or zstd. Timestamps are stored as UTC
+// seconds; samples already stored for the same host and second are
+// ignored, so agents can retry a chunk freely.
+func (h *SampleHandler) PostSamples(c *fiber.Ctx) error {
+	data, err := readBody(c, maxSampleBatchBytes)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Host     string      `json:"host"`
+		UserName string      `json:"user_name"`
+		Samples  []RawSample `json:"samples"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if req.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "host is required")
+	}
+	if len(req.Samples) > maxSampleBatch {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("too many samples (max %d)", maxSampleBatch))
+	}
+	for i := range req.Samples {
+		s := &req.Samples[i]
+		t, err := time.Parse(time.RFC3339, s.TS)
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("sample %d: ts must be RFC3339", i))
+		}
+		s.TS = t.UTC().Truncate(time.Second).Format(time.RFC3339)
+		if s.IdleMs < 0 {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("sample %d: idle_ms cannot be negative", i))
+		}
+		if s.IntervalMs <= 0 || s.IntervalMs > 3600*1000 {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("sample %d: interval_ms must be within 1-3600000", i))
+		}
+	}
+	if len(req.Samples) == 0 {
+		return c.JSON(fiber.Map{"stored": 0})
+	}
+	if err := h.samples.Insert(c.UserContext(), req.Host, req.UserName, req.Samples); err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"stored": len(req.Samples)})
+}
+
+// rollupThresholdList renders rollupThresholds for error messages.
+func rollupThresholdList() string {
+	parts := make([]string, len(rollupThresholds))
+	for i, t := range rollupThresholds {
+		parts[i] = t.String()
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantHandler lets the operator (ADMIN_TOKEN) add subsidiaries. Each
+// tenant's own admins then work through tokens bound to it.
+type TenantHandler struct {
+	tenants *TenantRepo
+	secret  string
+}
+
+// NewTenantHandlerFromEnv reads ENROLLMENT_SECRET, which per-tenant
+// enrollment secrets are derived from.
+func NewTenantHandlerFromEnv(tenants *TenantRepo) *TenantHandler {
+	return &TenantHandler{tenants: tenants, secret: os.Getenv("ENROLLMENT_SECRET")}
+}
+
+// GET /admin/tenants
+func (h *TenantHandler) ListTenants(c *fiber.Ctx) error {
+	list, err := h.tenants.List(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(list), "tenants": list})
+}
+
+// POST /admin/tenants
+// Body: {"id": "acme-dz", "name": "ACME Algeria"}
+// id is lowercase letters, digits and dashes, at most 32 characters. The
+// new tenant starts with the built-in settings; its first admin token is
+// issued with POST /admin/tokens and "X-Tenant: <id>".
+func (h *TenantHandler) PostTenant(c *fiber.Ctx) error {
+	var t Tenant
+	if err := json.Unmarshal(c.Body(), &t); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if !tenantIDPattern.MatchString(t.ID) {
+		return badParam("id must match %s, got %q", tenantIDPattern, t.ID)
+	}
+	if t.Name == "" {
+		t.Name = t.ID
+	}
+	exists, err := h.tenants.Exists(c.UserContext(), t.ID)
+	if err != nil {
+		return dbError(err)
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("tenant %q already exists", t.ID))
+	}
+	t.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	audit, err := auditStmt(c, "tenant.create", t.ID, nil, t)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := h.tenants.Create(c.UserContext(), t, audit); err != nil {
+		return dbError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(t)
+}
+
+// GET /admin/tenants/:id/enrollment-secret
+// The secret the tenant's agents enroll with (POST /enroll), derived from
+// ENROLLMENT_SECRET.
+func (h *TenantHandler) GetEnrollmentSecret(c *fiber.Ctx) error {
+	if h.secret == "" {
+		return fiber.NewError(fiber.StatusNotFound, "enrollment disabled (set ENROLLMENT_SECRET)")
+	}
+	id := c.Params("id")
+	ok, err := h.tenants.Exists(c.UserContext(), id)
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "unknown tenant")
+	}
+	return c.JSON(fiber.Map{"tenant": id, "enrollment_secret": tenantEnrollmentSecret(h.secret, id)})
+}
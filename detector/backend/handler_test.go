@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Handler tests run against MemActivityRepo, so they cover request
+// parsing, filtering and error mapping without an rqlite node.
+
+var testRows = []ActivityRow{
+	{HourStart: "2026-02-02T09:00:00Z", Host: "PC-001", UserName: "alice", ActivityPct: 80, Samples: 720, Status: "ACTIVE"},
+	{HourStart: "2026-02-02T10:00:00Z", Host: "PC-001", UserName: "alice", ActivityPct: 20, Samples: 720, Status: "LOW"},
+	{HourStart: "2026-02-02T09:00:00Z", Host: "PC-002", UserName: "bob", ActivityPct: 60, Samples: 720, Status: "ACTIVE"},
+	{HourStart: "2026-02-02T11:00:00Z", Host: "PC-002", UserName: "bob", Status: "AGENT_DOWN"},
+	// a shared workstation: two users in one hour
+	{HourStart: "2026-02-02T09:00:00Z", Host: "PC-003", UserName: "carol", ActivityPct: 40, Samples: 360, Status: "ACTIVE"},
+	{HourStart: "2026-02-02T09:00:00Z", Host: "PC-003", UserName: "dave", ActivityPct: 50, Samples: 360, Status: "ACTIVE"},
+}
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// failingRepo fails every read with err.
+type failingRepo struct {
+	*MemActivityRepo
+	err error
+}
+
+func (r failingRepo) GetBetween(context.Context, string, string, string, string) ([]ActivityRow, error) {
+	return nil, r.err
+}
+
+func (r failingRepo) GetHour(context.Context, time.Time, string, string) ([]ActivityRow, error) {
+	return nil, r.err
+}
+
+func newTestApp(repo ActivityRepository) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(RequestLogger())
+	activity := NewActivityHandler(repo, nil, nil, nil)
+	corrections := NewCorrectionHandler(repo, NewLiveToday())
+	app.Get("/activity/compare", activity.GetCompare)
+	app.Get("/activity/heatmap", activity.GetHeatmap)
+	app.Get("/export/archive", NewExportHandler(repo).GetArchive)
+	app.Patch("/activity/:hour_start", corrections.PatchRow)
+	app.Delete("/activity/:hour_start", corrections.DeleteRow)
+	graphql := NewGraphQLHandler(repo)
+	app.Get("/graphql", graphql)
+	app.Post("/graphql", graphql)
+	return app
+}
+
+func do(t *testing.T, app *fiber.App, method, target, body string) (*http.Response, []byte) {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading body: %v", method, target, err)
+	}
+	return resp, b
+}
+
+func TestErrorReplies(t *testing.T) {
+	app := newTestApp(NewMemActivityRepo(testRows...))
+	tests := []struct {
+		name, method, target, body string
+		status                     int
+		code                       string
+	}{
+		{"missing from", "GET", "/activity/compare?a_to=2026-02-03&b_from=2026-02-02&b_to=2026-02-03", "", 400, "bad_request"},
+		{"malformed date", "GET", "/activity/heatmap?from=02/02/2026&to=2026-02-03", "", 400, "bad_request"},
+		{"reversed range", "GET", "/activity/heatmap?from=2026-02-03&to=2026-02-02", "", 400, "bad_request"},
+		{"range too long", "GET", "/export/archive?from=2020-01-01&to=2026-01-01", "", 400, "bad_request"},
+		{"hour_start not RFC3339", "PATCH", "/activity/yesterday?host=PC-001", `{"note":"x"}`, 400, "bad_request"},
+		{"hour_start off the hour", "PATCH", "/activity/2026-02-02T09:30:00Z?host=PC-001", `{"note":"x"}`, 400, "bad_request"},
+		{"missing host", "DELETE", "/activity/2026-02-02T09:00:00Z", "", 400, "bad_request"},
+		{"bad JSON", "PATCH", "/activity/2026-02-02T09:00:00Z?host=PC-001", `{"note":`, 400, "bad_request"},
+		{"no such row", "PATCH", "/activity/2026-02-02T12:00:00Z?host=PC-001", `{"note":"x"}`, 404, "not_found"},
+		{"other host's hour", "DELETE", "/activity/2026-02-02T10:00:00Z?host=PC-002", "", 404, "not_found"},
+		{"shared hour without user", "PATCH", "/activity/2026-02-02T09:00:00Z?host=PC-003", `{"note":"x"}`, 409, "conflict"},
+		{"activity_pct out of range", "PATCH", "/activity/2026-02-02T09:00:00Z?host=PC-001", `{"activity_pct":150}`, 422, "invalid_value"},
+		{"negative samples", "PATCH", "/activity/2026-02-02T09:00:00Z?host=PC-001", `{"samples":-1}`, 422, "invalid_value"},
+		{"unknown status", "PATCH", "/activity/2026-02-02T09:00:00Z?host=PC-001", `{"status":"ASLEEP"}`, 422, "invalid_value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, app, tt.method, tt.target, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", resp.StatusCode, tt.status, body)
+			}
+			var ae APIError
+			if err := json.Unmarshal(body, &ae); err != nil {
+				t.Fatalf("body %s is not an APIError: %v", body, err)
+			}
+			if ae.Code != tt.code {
+				t.Errorf("code = %q, want %q", ae.Code, tt.code)
+			}
+			if ae.RequestID == "" || ae.RequestID != resp.Header.Get(fiber.HeaderXRequestID) {
+				t.Errorf("request_id = %q, X-Request-ID = %q", ae.RequestID, resp.Header.Get(fiber.HeaderXRequestID))
+			}
+		})
+	}
+}
+
+func TestRepoErrorMapping(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{context.DeadlineExceeded, 504, "deadline_exceeded"},
+		{context.Canceled, 408, "canceled"},
+		{errors.New("UNIQUE constraint failed: activity_hourly.host"), 409, "conflict"},
+		{errors.New("no such table: activity_hourly"), 502, "db_error"},
+	}
+	for _, tt := range tests {
+		app := newTestApp(failingRepo{NewMemActivityRepo(), tt.err})
+		for _, target := range []string{
+			"/activity/compare?a_from=2026-02-01&a_to=2026-02-02&b_from=2026-02-02&b_to=2026-02-03",
+			"/export/archive?from=2026-02-01&to=2026-02-03",
+		} {
+			resp, body := do(t, app, "GET", target, "")
+			var ae APIError
+			_ = json.Unmarshal(body, &ae)
+			if resp.StatusCode != tt.status || ae.Code != tt.code {
+				t.Errorf("%v on %s: got %d %q, want %d %q", tt.err, target, resp.StatusCode, ae.Code, tt.status, tt.code)
+			}
+		}
+		resp, _ := do(t, app, "DELETE", "/activity/2026-02-02T09:00:00Z?host=PC-001", "")
+		if resp.StatusCode != tt.status {
+			t.Errorf("%v on DELETE: got %d, want %d", tt.err, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestCompareFiltersByHost(t *testing.T) {
+	app := newTestApp(NewMemActivityRepo(testRows...))
+	var got struct {
+		A, B PeriodStats
+	}
+	get := func(target string) {
+		t.Helper()
+		resp, body := do(t, app, "GET", target, "")
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET %s: %d %s", target, resp.StatusCode, body)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get("/activity/compare?a_from=2026-02-01&a_to=2026-02-02&b_from=2026-02-02&b_to=2026-02-03&host=PC-002")
+	if got.A.Hours != 0 || got.B.Hours != 2 {
+		t.Fatalf("hours = %d, %d, want 0, 2", got.A.Hours, got.B.Hours)
+	}
+	// the AGENT_DOWN gap is counted but not averaged
+	if got.B.ActiveHours != 1 || got.B.AvgActivityPct != 60 || got.B.StatusCounts["AGENT_DOWN"] != 1 {
+		t.Errorf("b = %+v", got.B)
+	}
+
+	get("/activity/compare?a_from=2026-02-01&a_to=2026-02-02&b_from=2026-02-02&b_to=2026-02-03")
+	if got.B.Hours != len(testRows) {
+		t.Errorf("all hosts: hours = %d, want %d", got.B.Hours, len(testRows))
+	}
+}
+
+func TestCorrectAndDelete(t *testing.T) {
+	repo := NewMemActivityRepo(testRows...)
+	app := newTestApp(repo)
+	hour := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+
+	resp, body := do(t, app, "PATCH", "/activity/2026-02-02T09:00:00Z?host=PC-003&user=dave",
+		`{"activity_pct":55,"status":"HIGH_PRODUCTION","note":"badge reader logs"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("PATCH: %d %s", resp.StatusCode, body)
+	}
+	rows, _ := repo.GetHour(context.Background(), hour, "PC-003", "dave")
+	if len(rows) != 1 || rows[0].ActivityPct != 55 || rows[0].Status != "HIGH_PRODUCTION" || rows[0].Note != "badge reader logs" {
+		t.Fatalf("after PATCH: %+v", rows)
+	}
+	if rows[0].Samples != 360 {
+		t.Errorf("absent field changed: samples = %d", rows[0].Samples)
+	}
+	if rows, _ := repo.GetHour(context.Background(), hour, "PC-003", "carol"); len(rows) != 1 || rows[0].ActivityPct != 40 {
+		t.Errorf("other user's share changed: %+v", rows)
+	}
+
+	resp, body = do(t, app, "DELETE", "/activity/2026-02-02T09:00:00Z?host=PC-001", "")
+	if resp.StatusCode != 204 {
+		t.Fatalf("DELETE: %d %s", resp.StatusCode, body)
+	}
+	if rows, _ := repo.GetHour(context.Background(), hour, "PC-001", ""); len(rows) != 0 {
+		t.Errorf("tombstoned row still read: %+v", rows)
+	}
+	resp, _ = do(t, app, "DELETE", "/activity/2026-02-02T09:00:00Z?host=PC-001", "")
+	if resp.StatusCode != 404 {
+		t.Errorf("second DELETE: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestArchiveSplitsHosts(t *testing.T) {
+	app := newTestApp(NewMemActivityRepo(testRows...))
+	resp, body := do(t, app, "GET", "/export/archive?from=2026-02-02&to=2026-02-03", "")
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET: %d %s", resp.StatusCode, body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := "hosts/PC-001.csv hosts/PC-002.csv hosts/PC-003.csv daily_summary.csv manifest.json"
+	if strings.Join(names, " ") != want {
+		t.Errorf("files = %v, want %s", names, want)
+	}
+}
+
+// Two tenants each have a PC-001; neither sees or overwrites the other's.
+func TestTenantsShareHostNames(t *testing.T) {
+	repo := NewMemActivityRepo(testRows...)
+	acme := withTenant(context.Background(), "acme")
+	hour := HourlyIngest{HourStart: "2026-02-02T09:00:00Z", Host: "PC-001", UserName: "alice", ActivityPct: 10, Samples: 720, Status: "LOW"}
+	if err := repo.Upsert(acme, []HourlyIngest{hour}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		ctx  context.Context
+		want float64
+	}{{context.Background(), 80}, {acme, 10}} {
+		rows, err := repo.GetHour(tc.ctx, time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC), "PC-001", "alice")
+		if err != nil || len(rows) != 1 || rows[0].ActivityPct != tc.want {
+			t.Errorf("%s: %v %v, want one row at %v%%", tenantOf(tc.ctx), rows, err, tc.want)
+		}
+	}
+
+	live := NewLiveToday()
+	today := time.Now().UTC().Format("2006-01-02") + "T09:00:00Z"
+	live.Apply(defaultTenant, []HourlyIngest{{HourStart: today, Host: "PC-001", UserName: "alice", ActivityPct: 80, Samples: 720, Status: "ACTIVE"}})
+	live.Apply("acme", []HourlyIngest{{HourStart: today, Host: "PC-001", UserName: "zoe", ActivityPct: 10, Samples: 720, Status: "LOW"}})
+	for tenant, user := range map[string]string{defaultTenant: "alice", "acme": "zoe"} {
+		if got := live.Get(tenant, "PC-001"); len(got) != 1 || got[0].UserName != user {
+			t.Errorf("%s: live %+v, want %s's day", tenant, got, user)
+		}
+	}
+}
+
+func TestDailySummaryRecords(t *testing.T) {
+	rows := append(testRows[:len(testRows):len(testRows)],
+		ActivityRow{HourStart: "2026-02-02T12:00:00Z", Host: "PC-001", UserName: "alice", ActivityPct: 0, Samples: 720, Status: string(StatusOff)},
+		// a day gap-fill wrote for a host that never reported
+		ActivityRow{HourStart: "2026-02-03T09:00:00Z", Host: "PC-004", Status: string(StatusAgentDown)},
+		ActivityRow{HourStart: "2026-02-03T10:00:00Z", Host: "PC-004", Status: string(StatusNoData)},
+	)
+	want := [][]string{
+		{"date", "host", "hours", "active_hours", "avg_activity_pct", "idle_seconds", "samples"},
+		{"2026-02-02", "PC-001", "3", "2", "33.33", "0", "2160"},
+		{"2026-02-02", "PC-002", "1", "1", "60.00", "0", "720"},
+		{"2026-02-02", "PC-003", "2", "2", "45.00", "0", "720"},
+		{"2026-02-03", "PC-004", "0", "0", "", "0", "0"},
+	}
+	got := dailySummaryRecords(rows)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	app := newTestApp(NewMemActivityRepo(testRows...))
+	query := `{"query":"query($host: String!) { member(host: $host, from: \"2026-02-02\", to: \"2026-02-03\") { host userName days { date activeHours avgActivityPct hours { hourStart samples status batteryPct } } } }","variables":{"host":"PC-001"}}`
+	resp, body := do(t, app, "POST", "/graphql", query)
+	if resp.StatusCode != 200 {
+		t.Fatalf("POST: %d %s", resp.StatusCode, body)
+	}
+	want := `{"data":{"member":{"host":"PC-001","userName":"alice","days":[{"date":"2026-02-02","activeHours":2,"avgActivityPct":50,` +
+		`"hours":[{"hourStart":"2026-02-02T09:00:00Z","samples":720,"status":"ACTIVE","batteryPct":null},` +
+		`{"hourStart":"2026-02-02T10:00:00Z","samples":720,"status":"LOW","batteryPct":null}]}]}}}`
+	if string(body) != want {
+		t.Errorf("body:\n got %s\nwant %s", body, want)
+	}
+
+	// a bad range is a GraphQL error, not a transport one
+	resp, body = do(t, app, "GET", "/graphql?query="+url.QueryEscape(`{ teams(from: "2026-02-03", to: "2026-02-02") { name } }`), "")
+	var reply struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string   `json:"message"`
+			Path    []string `json:"path"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("GET: %d %s", resp.StatusCode, body)
+	}
+	if len(reply.Errors) != 1 || strings.Join(reply.Errors[0].Path, ".") != "teams" {
+		t.Errorf("errors = %+v", reply.Errors)
+	}
+
+	if resp, _ := do(t, app, "POST", "/graphql", `{"query":""}`); resp.StatusCode != 400 {
+		t.Errorf("empty query: %d, want 400", resp.StatusCode)
+	}
+}
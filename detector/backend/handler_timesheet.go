@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type TimesheetHandler struct {
+	pushes *TimesheetRepo
+}
+
+func NewTimesheetHandler(pushes *TimesheetRepo) *TimesheetHandler {
+	return &TimesheetHandler{pushes: pushes}
+}
+
+// GET /admin/timesheet/pushes?limit=100
+// The latest timesheet pushes, newest first; failed ones carry the error
+// and are retried by the timesheet job. Connectors are configured through
+// the "timesheet" setting.
+func (h *TimesheetHandler) ListPushes(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit", 100, 1, 1000)
+	if err != nil {
+		return err
+	}
+	pushes, err := h.pushes.Recent(c.UserContext(), limit)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(pushes), "pushes": pushes})
+}
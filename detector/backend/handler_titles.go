@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TitleHandler serves the window titles agents sample with WindowTitles
+// on, to explain low-activity hours without screenshots.
+type TitleHandler struct {
+	titles   *TitleRepo
+	settings *SettingsRepo
+}
+
+func NewTitleHandler(titles *TitleRepo, settings *SettingsRepo) *TitleHandler {
+	return &TitleHandler{titles: titles, settings: settings}
+}
+
+// GET /activity/titles?host=PC-042&hour=2026-03-02T10:00:00Z
+// GET /activity/titles?host=PC-042&date=2026-03-02&start=07:00&end=16:00&tz=Europe/Paris
+// Titles grouped by host-hour; hour selects a single hour, otherwise the
+// day window of /activity/today applies. Admin only: titles can name
+// documents and customers even after redaction.
+func (h *TitleHandler) GetTitles(c *fiber.Ctx) error {
+	var start, end string
+	if v := c.Query("hour"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !t.Equal(t.Truncate(time.Hour)) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid hour (use an RFC3339 hour start)")
+		}
+		start, end = t.UTC().Format(time.RFC3339), t.Add(time.Hour).UTC().Format(time.RFC3339)
+	} else {
+		sched, err := globalSchedule(c.UserContext(), h.settings)
+		if err != nil {
+			return err
+		}
+		s, e, err := dayWindow(c, sched)
+		if err != nil {
+			return err
+		}
+		// hour_start is stored in UTC, compare like with like
+		st, _ := time.Parse(time.RFC3339, s)
+		et, _ := time.Parse(time.RFC3339, e)
+		start, end = st.UTC().Format(time.RFC3339), et.UTC().Format(time.RFC3339)
+	}
+
+	hours, err := h.titles.Between(c.UserContext(), start, end, c.Query("host", ""))
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{
+		"start": start,
+		"end":   end,
+		"count": len(hours),
+		"hours": hours,
+	})
+}
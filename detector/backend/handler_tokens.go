@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TokenHandler issues the role-bearing API tokens, so that managers and
+// employees get their own access instead of sharing ADMIN_TOKEN.
+type TokenHandler struct {
+	tokens *TokenRepo
+}
+
+func NewTokenHandler(tokens *TokenRepo) *TokenHandler {
+	return &TokenHandler{tokens: tokens}
+}
+
+// POST /admin/tokens
+// Body: {"role": "self-view", "user_name": "jdoe", "label": "jdoe's laptop"}
+// Answers 201 with the token's fields plus "token", shown only this once.
+// role is admin, manager, self-view or agent; user_name is required for
+// self-view and refused otherwise. The token is bound to the caller's
+// tenant (X-Tenant for ADMIN_TOKEN) and only ever sees its data.
+func (h *TokenHandler) PostToken(c *fiber.Ctx) error {
+	var req struct {
+		Role     string `json:"role"`
+		UserName string `json:"user_name"`
+		Label    string `json:"label"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid JSON body")
+	}
+	if !validRoles[req.Role] {
+		return badParam("role must be admin, manager, self-view or agent, got %q", req.Role)
+	}
+	if req.Role == roleSelfView && req.UserName == "" {
+		return badParam("user_name is required for a self-view token")
+	}
+	if req.Role != roleSelfView && req.UserName != "" {
+		return badParam("user_name only applies to self-view tokens")
+	}
+	t, secret, err := h.tokens.Create(c.UserContext(), req.Role, req.UserName, req.Label)
+	if err != nil {
+		return dbError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":         t.ID,
+		"tenant":     t.Tenant,
+		"role":       t.Role,
+		"user_name":  t.UserName,
+		"label":      t.Label,
+		"created_at": t.CreatedAt,
+		"token":      secret,
+	})
+}
+
+// GET /admin/tokens
+func (h *TokenHandler) ListTokens(c *fiber.Ctx) error {
+	list, err := h.tokens.List(c.UserContext())
+	if err != nil {
+		return dbError(err)
+	}
+	return c.JSON(fiber.Map{"count": len(list), "tokens": list})
+}
+
+// DELETE /admin/tokens/:id
+// Revokes a token; backends honor the revocation within tokenCacheTTL.
+func (h *TokenHandler) DeleteToken(c *fiber.Ctx) error {
+	ok, err := h.tokens.Revoke(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return dbError(err)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "no live token with that id")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rqlite/gorqlite"
+)
+
+// Probes for orchestrators. Liveness only says the process serves HTTP, so
+// an rqlite outage never gets replicas restarted in a loop; readiness also
+// needs rqlite to answer and turns false as soon as shutdown starts, so
+// traffic moves elsewhere before the drain.
+type Health struct {
+	db       *DB
+	draining atomic.Bool
+}
+
+func NewHealth(db *DB) *Health {
+	return &Health{db: db}
+}
+
+// Drain marks the replica as not ready.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// GET /health/live (and /health, kept for existing checks)
+func (h *Health) GetLive(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"ok": true})
+}
+
+// GET /health/ready
+// 503 while shutting down or when rqlite does not answer within 2s.
+func (h *Health) GetReady(c *fiber.Ctx) error {
+	if h.draining.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"ok": false, "reason": "shutting down"})
+	}
+	ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+	defer cancel()
+	if _, err := h.db.QueryOne(ctx, ConsistencyNone, gorqlite.ParameterizedStatement{Query: "SELECT 1"}); err != nil {
+		logger.Warn("readiness: database unreachable", "err", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"ok": false, "reason": "database unreachable"})
+	}
+	return c.JSON(fiber.Map{"ok": true})
+}
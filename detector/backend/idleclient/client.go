@@ -0,0 +1,228 @@
+// Package idleclient is a typed Go client for the detector API, so tools
+// stop hand-rolling HTTP calls and JSON structs. Its types (types.go) are
+// the ones the backend itself serves, so the two cannot drift apart.
+//
+//	c := idleclient.New("http://192.168.1.15:8080")
+//	today, err := c.Today(ctx, idleclient.TodayOptions{Host: "PC-042"})
+package idleclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls one backend. AdminToken (the backend's ADMIN_TOKEN, or an
+// API token from POST /admin/tokens) is sent on every call; it is needed
+// for the admin methods, and for reads when the backend sets
+// READ_AUTH=required. Tenant, sent as X-Tenant, picks the subsidiary the
+// backend's ADMIN_TOKEN acts on; tokens from POST /admin/tokens are bound
+// to theirs already.
+type Client struct {
+	BaseURL    string
+	AdminToken string
+	Tenant     string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the backend at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is a non-2xx reply. Code, Message, Details and RequestID come
+// from the backend's error body (GET /errors lists the codes); Message is
+// the raw body when it is not one.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]any
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("idle API: HTTP %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("idle API: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// TodayOptions select the window and rows of Today; empty fields use the
+// backend's defaults (today, the schedule setting, every host).
+type TodayOptions struct {
+	Date        string // YYYY-MM-DD
+	Start, End  string // HH:MM
+	TZ          string // IANA zone
+	Host        string
+	User        string // also applies the user's work-hours profile
+	Consistency string // none, weak or strong
+}
+
+// Today returns the hourly rows of one day (GET /activity/today).
+func (c *Client) Today(ctx context.Context, opts TodayOptions) (*Today, error) {
+	q := query("date", opts.Date, "start", opts.Start, "end", opts.End, "tz", opts.TZ,
+		"host", opts.Host, "user", opts.User, "consistency", opts.Consistency)
+	var out Today
+	return &out, c.do(ctx, http.MethodGet, "/activity/today", q, nil, &out)
+}
+
+// FleetOptions select the window and hosts of Fleet.
+type FleetOptions struct {
+	Date       string
+	Start, End string
+	TZ         string
+	Hosts      []string // empty for every host
+}
+
+// Fleet returns one summary per host (GET /activity/fleet).
+func (c *Client) Fleet(ctx context.Context, opts FleetOptions) (*Fleet, error) {
+	q := query("date", opts.Date, "start", opts.Start, "end", opts.End, "tz", opts.TZ,
+		"hosts", strings.Join(opts.Hosts, ","))
+	var out Fleet
+	return &out, c.do(ctx, http.MethodGet, "/activity/fleet", q, nil, &out)
+}
+
+// Scorecard returns user's KPIs over the week or month ending on date
+// (GET /activity/scorecard); period and date may be empty.
+func (c *Client) Scorecard(ctx context.Context, user, period, date string) (*Scorecard, error) {
+	var out Scorecard
+	return &out, c.do(ctx, http.MethodGet, "/activity/scorecard", query("user", user, "period", period, "date", date), nil, &out)
+}
+
+// Agents returns the fleet inventory (GET /agents); state is "online",
+// "offline" or empty, outdated keeps only agents below the minimum version.
+func (c *Client) Agents(ctx context.Context, state string, outdated bool) (*Inventory, error) {
+	q := query("state", state)
+	if outdated {
+		q.Set("outdated", "true")
+	}
+	var out Inventory
+	return &out, c.do(ctx, http.MethodGet, "/agents", q, nil, &out)
+}
+
+// Now returns who is at their desk right now (GET /activity/now); host
+// limits the reply to one machine.
+func (c *Client) Now(ctx context.Context, host string) (*Now, error) {
+	var out Now
+	return &out, c.do(ctx, http.MethodGet, "/activity/now", query("host", host), nil, &out)
+}
+
+// PutSetting stores one setting (PUT /admin/settings/:key) and returns
+// the value as stored.
+func (c *Client) PutSetting(ctx context.Context, key string, value interface{}) (json.RawMessage, error) {
+	var out json.RawMessage
+	return out, c.do(ctx, http.MethodPut, "/admin/settings/"+url.PathEscape(key), nil, value, &out)
+}
+
+// SendCommand queues "flush", "rotate-log", "reload-config" or
+// "send-logs" for host (POST /admin/agents/:host/commands).
+func (c *Client) SendCommand(ctx context.Context, host, command string) (*AgentCommand, error) {
+	var out AgentCommand
+	body := map[string]string{"command": command}
+	return &out, c.do(ctx, http.MethodPost, "/admin/agents/"+url.PathEscape(host)+"/commands", nil, body, &out)
+}
+
+// Commands returns host's last limit commands with the agent's replies.
+func (c *Client) Commands(ctx context.Context, host string, limit int) ([]AgentCommand, error) {
+	var out struct {
+		Commands []AgentCommand `json:"commands"`
+	}
+	err := c.do(ctx, http.MethodGet, "/admin/agents/"+url.PathEscape(host)+"/commands",
+		query("limit", strconv.Itoa(limit)), nil, &out)
+	return out.Commands, err
+}
+
+// AgentLogs returns host's last limit shipped log lines, or the ones
+// after line ID after when it is positive.
+func (c *Client) AgentLogs(ctx context.Context, host string, after int64, limit int) ([]AgentLogLine, error) {
+	q := query("limit", strconv.Itoa(limit))
+	if after > 0 {
+		q.Set("after", strconv.FormatInt(after, 10))
+	}
+	var out struct {
+		Lines []AgentLogLine `json:"lines"`
+	}
+	err := c.do(ctx, http.MethodGet, "/admin/agents/"+url.PathEscape(host)+"/logs", q, nil, &out)
+	return out.Lines, err
+}
+
+// query builds URL values from key, value pairs, leaving out empty values.
+func query(kv ...string) url.Values {
+	q := url.Values{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" && kv[i+1] != "0" {
+			q.Set(kv[i], kv[i+1])
+		}
+	}
+	return q
+}
+
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, in, out interface{}) error {
+	u := c.BaseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+	if c.Tenant != "" {
+		req.Header.Set("X-Tenant", c.Tenant)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var body struct {
+			Code      string         `json:"code"`
+			Message   string         `json:"message"`
+			Details   map[string]any `json:"details"`
+			RequestID string         `json:"request_id"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Code != "" {
+			apiErr.Code, apiErr.Message, apiErr.Details, apiErr.RequestID = body.Code, body.Message, body.Details, body.RequestID
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("idle API: %s %s: %v", method, path, err)
+	}
+	return nil
+}
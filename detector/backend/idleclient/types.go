@@ -0,0 +1,186 @@
+package idleclient
+
+// APIVersion is the version of the HTTP API these types describe. Fields
+// are only ever added within a version; a rename or removal bumps it.
+const APIVersion = 1
+
+// ActivityRow is one host-hour, as returned by GET /activity/today and the
+// export endpoints.
+type ActivityRow struct {
+	HourStart   string            `json:"hour_start"`
+	Host        string            `json:"host"`
+	UserName    string            `json:"user_name"`
+	DisplayName string            `json:"display_name,omitempty"`
+	Team        string            `json:"team,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	ActivityPct float64           `json:"activity_pct"`
+	IdleSeconds float64           `json:"idle_seconds"`
+	Samples     int64             `json:"samples"`
+	Status      string            `json:"status"`
+	Note        string            `json:"note,omitempty"`
+	CreatedAt   string            `json:"created_at"`
+	// seconds on battery power and charge at the end of the hour
+	// (nil without a battery)
+	BatterySeconds float64 `json:"battery_seconds"`
+	BatteryPct     *int64  `json:"battery_pct,omitempty"`
+	// active seconds per display (device name, e.g. "DISPLAY2")
+	MonitorSeconds map[string]float64 `json:"monitor_seconds,omitempty"`
+	// input events by source: clicks and wheel notches, key presses,
+	// touch contacts
+	MouseEvents int64 `json:"mouse_events"`
+	KeyEvents   int64 `json:"key_events"`
+	TouchEvents int64 `json:"touch_events"`
+	// hour_start in the agent's zone, e.g. "2024-03-31T03:00:00+02:00";
+	// empty from agents that predate it
+	LocalHour string `json:"local_hour,omitempty"`
+	// exponentially weighted activity at the end of the hour, 0-100;
+	// reacts within minutes where activity_pct averages the whole hour
+	EWMAPct *float64 `json:"ewma_pct,omitempty"`
+	// seconds the agent measured from cursor movement alone because
+	// GetLastInputInfo kept failing; activity in them is a lower bound
+	DegradedSeconds float64 `json:"degraded_seconds,omitempty"`
+	// active foreground seconds per application category, e.g.
+	// "development", from agents with TrackAppCategories on
+	CategorySeconds map[string]float64 `json:"category_seconds,omitempty"`
+	// active browser seconds per web domain, from agents with
+	// DomainTracking on; filtered domains are "other"
+	DomainSeconds map[string]float64 `json:"domain_seconds,omitempty"`
+	// first and last keyboard/mouse input within the hour, RFC3339;
+	// empty without input or from agents that predate them
+	FirstInput string `json:"first_input,omitempty"`
+	LastInput  string `json:"last_input,omitempty"`
+	// idle periods of break length (the agent's BreakMin to BreakMax)
+	// that ended in the hour, and their total duration
+	Breaks       int64   `json:"breaks,omitempty"`
+	BreakSeconds float64 `json:"break_seconds,omitempty"`
+	// input in the hour looked machine-made (a mouse jiggler nudging the
+	// cursor, keys pressed on a fixed beat); confidence is 0-1
+	SuspectedSynthetic  bool    `json:"suspected_synthetic,omitempty"`
+	SyntheticConfidence float64 `json:"synthetic_confidence,omitempty"`
+	// an application kept the user's session from going idle during the
+	// hour (a video or a call holding an idle inhibitor), so idle time in
+	// it may be undercounted; from agents that can see inhibitors
+	MediaInhibit bool `json:"media_inhibit,omitempty"`
+	// whether the agent's signature matched: valid, invalid, unsigned or
+	// unchecked; empty until the backend looked at the row
+	SignatureStatus string `json:"signature_status,omitempty"`
+}
+
+// Today is the reply of GET /activity/today.
+type Today struct {
+	Start string        `json:"start"`
+	End   string        `json:"end"`
+	Count int           `json:"count"`
+	Rows  []ActivityRow `json:"rows"`
+}
+
+// HostSummary rolls one host's hourly rows up over a window.
+type HostSummary struct {
+	Host           string  `json:"host"`
+	UserName       string  `json:"user_name"`
+	DisplayName    string  `json:"display_name,omitempty"`
+	Team           string  `json:"team,omitempty"`
+	Hours          int     `json:"hours"`
+	ActiveHours    int     `json:"active_hours"`
+	AvgActivityPct float64 `json:"avg_activity_pct"`
+	IdleSeconds    float64 `json:"idle_seconds"`
+	LastHour       string  `json:"last_hour,omitempty"`
+	LastStatus     string  `json:"last_status,omitempty"`
+}
+
+// Fleet is the reply of GET /activity/fleet.
+type Fleet struct {
+	Start string        `json:"start"`
+	End   string        `json:"end"`
+	Count int           `json:"count"`
+	Hosts []HostSummary `json:"hosts"`
+}
+
+// ScorecardDay is one local day of a user's scorecard.
+type ScorecardDay struct {
+	Day             string  `json:"day"`
+	FirstActiveHour *int    `json:"first_active_hour"` // local hour, nil when never active
+	ActiveHours     float64 `json:"active_hours"`
+	IdleSeconds     float64 `json:"idle_seconds"`
+	TrackedHours    int     `json:"tracked_hours"`
+	FocusStreak     int     `json:"focus_streak"` // longest run of consecutive HIGH_PRODUCTION hours
+}
+
+// Scorecard is the manager dashboard's KPI summary for one user, the
+// reply of GET /activity/scorecard.
+type Scorecard struct {
+	User               string         `json:"user"`
+	Period             string         `json:"period"`
+	From               string         `json:"from"`
+	To                 string         `json:"to"`
+	ActiveHours        float64        `json:"active_hours"`
+	WorkDays           int            `json:"work_days"`
+	OnTimeDays         int            `json:"on_time_days"`
+	AvgLatenessMinutes *float64       `json:"avg_lateness_minutes"` // first activity vs schedule start; negative is early
+	AvgFocusStreak     float64        `json:"avg_focus_streak_hours"`
+	IdleRatio          float64        `json:"idle_ratio"`
+	Days               []ScorecardDay `json:"days"`
+}
+
+// AgentInventory is one host's line in GET /agents: what it runs and
+// when it was last heard from. Hosts that upload hours but never
+// heartbeat are listed too, always offline.
+type AgentInventory struct {
+	Host           string `json:"host"`
+	UserName       string `json:"user_name"`
+	AgentVersion   string `json:"agent_version,omitempty"`
+	AgentCommit    string `json:"agent_commit,omitempty"`
+	AgentBuildDate string `json:"agent_build_date,omitempty"`
+	LastSeen       string `json:"last_seen,omitempty"` // last heartbeat
+	LastHour       string `json:"last_hour,omitempty"` // last ingested, measured hour
+	State          string `json:"state"`
+	Outdated       bool   `json:"outdated"`
+}
+
+// Inventory is the reply of GET /agents.
+type Inventory struct {
+	Count    int              `json:"count"`
+	States   map[string]int   `json:"states"`
+	Versions map[string]int   `json:"versions"`
+	Agents   []AgentInventory `json:"agents"`
+}
+
+// Presence is one host's line in GET /activity/now: whether its user is
+// at the desk right now, from the latest heartbeat or raw sample.
+type Presence struct {
+	Host        string  `json:"host"`
+	UserName    string  `json:"user_name"`
+	State       string  `json:"state"` // present, away or offline
+	Mode        string  `json:"mode"`  // HIGH_PRODUCTION, ACTIVE, LOW or OFF
+	LastInput   string  `json:"last_input,omitempty"`
+	IdleMinutes float64 `json:"idle_minutes"`
+	LastSeen    string  `json:"last_seen,omitempty"`
+	Source      string  `json:"source"` // heartbeat or samples
+}
+
+// Now is the reply of GET /activity/now.
+type Now struct {
+	At     string         `json:"at"`
+	Count  int            `json:"count"`
+	States map[string]int `json:"states"`
+	Hosts  []Presence     `json:"hosts"`
+}
+
+// AgentCommand is an admin request for one agent, delivered through the
+// agent's long poll on /agent/commands.
+type AgentCommand struct {
+	ID          int64  `json:"id"`
+	Host        string `json:"host"`
+	Command     string `json:"command"`
+	CreatedAt   string `json:"created_at"`
+	DeliveredAt string `json:"delivered_at,omitempty"`
+	DoneAt      string `json:"done_at,omitempty"`
+	Result      string `json:"result,omitempty"` // the agent's reply line
+}
+
+// AgentLogLine is one line of an agent's log as shipped to POST /logs.
+type AgentLogLine struct {
+	ID         int64  `json:"id"`
+	Line       string `json:"line"`
+	ReceivedAt string `json:"received_at"`
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"detector-api/logimport"
+)
+
+// hourlyFromLog turns reconstructed log hours into rows: percentages are
+// over monitored time, with one sample per monitored second like the
+// agent's default SampleEvery.
+func hourlyFromLog(hours []logimport.Hour, thresholds StatusThresholds) []HourlyIngest {
+	rows := make([]HourlyIngest, 0, len(hours))
+	for _, h := range hours {
+		samples := int64(h.Monitored)
+		pct := h.ActivityPct()
+		rows = append(rows, HourlyIngest{
+			HourStart:   h.Start.Format("2006-01-02T15:00:00Z"),
+			ActivityPct: pct,
+			IdleSeconds: h.IdleSeconds,
+			Samples:     samples,
+			Status:      string(Classify(pct, samples, thresholds)),
+		})
+	}
+	return rows
+}
+
+// parseHourlyCSV reads rows in the /export/archive column layout. Columns
+// are matched by header name; hour_start and activity_pct are required,
+// the rest default (status is derived from activity_pct when absent).
+func parseHourlyCSV(r io.Reader, thresholds StatusThresholds) ([]HourlyIngest, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"hour_start", "activity_pct"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+
+	_, hasSamples := col["samples"]
+
+	var rows []HourlyIngest
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		row := HourlyIngest{
+			HourStart:   get("hour_start"),
+			Host:        get("host"),
+			UserName:    get("user_name"),
+			DisplayName: get("display_name"),
+			Team:        get("team"),
+			Status:      get("status"),
+		}
+		if row.ActivityPct, err = strconv.ParseFloat(get("activity_pct"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid activity_pct", line)
+		}
+		if v := get("idle_seconds"); v != "" {
+			if row.IdleSeconds, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid idle_seconds", line)
+			}
+		}
+		if v := get("samples"); v != "" {
+			if row.Samples, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid samples", line)
+			}
+		}
+		if row.Status == "" {
+			samples := row.Samples
+			if !hasSamples {
+				samples = 1 // the row exists, so the agent was running
+			}
+			row.Status = string(Classify(row.ActivityPct, samples, thresholds))
+		}
+		rows = append(rows, row)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AlertJob evaluates enabled alert rules per host and notifies the rule's
+// webhook when a condition starts to hold. It keeps firing state in
+// memory, so a condition that stays true alerts once, not every run.
+type AlertJob struct {
+	rules    *AlertRuleRepo
+	repo     *ActivityRepo
+	settings *SettingsRepo
+	client   *http.Client
+
+	mu     sync.Mutex
+	firing map[string]bool // "ruleID|host"
+}
+
+// NewAlertJobFromEnv returns nil when ALERTS=off.
+func NewAlertJobFromEnv(rules *AlertRuleRepo, repo *ActivityRepo, settings *SettingsRepo) *AlertJob {
+	if os.Getenv("ALERTS") == "off" {
+		return nil
+	}
+	return &AlertJob{
+		rules:    rules,
+		repo:     repo,
+		settings: settings,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		firing:   make(map[string]bool),
+	}
+}
+
+func (j *AlertJob) Run(ctx context.Context) error {
+	rules, err := j.rules.List(ctx)
+	if err != nil {
+		return err
+	}
+	var sched Schedule
+	if err := j.settings.Get(ctx, SettingSchedule, &sched); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		cond, err := rule.Condition()
+		if err != nil {
+			log.Printf("alerts: rule %d (%s): %v", rule.ID, rule.Name, err)
+			continue
+		}
+		byHost, err := j.load(ctx, rule.Host, now.Add(-cond.MaxWindow-time.Hour), now)
+		if err != nil {
+			return err
+		}
+		for host, rows := range byHost {
+			holds := cond.Eval(newAlertEnv(now, sched, rows))
+			key := fmt.Sprintf("%d|%s", rule.ID, host)
+			j.mu.Lock()
+			rising := holds && !j.firing[key]
+			j.firing[key] = holds
+			j.mu.Unlock()
+			if rising {
+				j.notify(ctx, rule, host, now)
+			}
+		}
+	}
+	return nil
+}
+
+// load fetches [from, to) for one host, or every host when host is empty,
+// grouped by host.
+func (j *AlertJob) load(ctx context.Context, host string, from, to time.Time) (map[string][]ActivityRow, error) {
+	rows, err := j.repo.GetBetween(ctx, from.Truncate(time.Hour).Format(time.RFC3339), to.Format(time.RFC3339), host, "")
+	if err != nil {
+		return nil, err
+	}
+	byHost := make(map[string][]ActivityRow)
+	for _, r := range rows {
+		byHost[r.Host] = append(byHost[r.Host], r)
+	}
+	return byHost, nil
+}
+
+func (j *AlertJob) notify(ctx context.Context, rule AlertRule, host string, at time.Time) {
+	log.Printf("alerts: rule %d (%s) fired for %s", rule.ID, rule.Name, host)
+	if rule.Webhook == "" {
+		return
+	}
+	cond := rule.Expr
+	if cond == "" {
+		cond = fmt.Sprintf("avg(%s, %s) %s %g", rule.Metric, rule.Window, rule.Op, rule.Threshold)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"rule_id":   rule.ID,
+		"rule":      rule.Name,
+		"condition": cond,
+		"host":      host,
+		"at":        at.Format(time.RFC3339),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.Webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("alerts: rule %d webhook: %v", rule.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := j.client.Do(req)
+	if err != nil {
+		log.Printf("alerts: rule %d webhook: %v", rule.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("alerts: rule %d webhook: HTTP %d", rule.ID, resp.StatusCode)
+	}
+}
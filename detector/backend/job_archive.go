@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// ArchiveJob exports every completed month not yet archived to S3 and,
+// when Prune is set, deletes the archived hourly rows afterwards. Progress
+// is recorded in archive_runs so a month is uploaded exactly once. It runs
+// per tenant; tenants other than the default one get their own folder
+// under the prefix.
+type ArchiveJob struct {
+	db     *DB
+	repo   *ActivityRepo
+	s3     *S3Client
+	prefix string
+	prune  bool
+}
+
+// NewArchiveJobFromEnv returns nil when ARCHIVE_S3_BUCKET is not set.
+func NewArchiveJobFromEnv(db *DB, repo *ActivityRepo) *ArchiveJob {
+	bucket := os.Getenv("ARCHIVE_S3_BUCKET")
+	if bucket == "" {
+		return nil
+	}
+	s3 := NewS3Client(
+		os.Getenv("ARCHIVE_S3_ENDPOINT"),
+		os.Getenv("ARCHIVE_S3_REGION"),
+		bucket,
+		os.Getenv("ARCHIVE_S3_ACCESS_KEY"),
+		os.Getenv("ARCHIVE_S3_SECRET_KEY"),
+	)
+	return &ArchiveJob{
+		db:     db,
+		repo:   repo,
+		s3:     s3,
+		prefix: strings.Trim(os.Getenv("ARCHIVE_S3_PREFIX"), "/"),
+		prune:  os.Getenv("ARCHIVE_PRUNE") == "true",
+	}
+}
+
+// Run archives the oldest completed month that has data but no archive_runs
+// entry. One month per run keeps each run short.
+func (j *ArchiveJob) Run(ctx context.Context) error {
+	month, ok, err := j.nextMonth(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	from := month
+	to := month.AddDate(0, 1, 0)
+
+	rows, err := j.repo.GetBetween(ctx, from.Format(time.RFC3339), to.Format(time.RFC3339), "", ConsistencyStrong)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, from, to, rows); err != nil {
+		return err
+	}
+
+	tenant := tenantOf(ctx)
+	key := fmt.Sprintf("activity-%s.zip", from.Format("2006-01"))
+	if tenant != defaultTenant {
+		key = tenant + "/" + key
+	}
+	if j.prefix != "" {
+		key = j.prefix + "/" + key
+	}
+	if err := j.s3.PutObject(ctx, key, "application/zip", buf.Bytes()); err != nil {
+		return err
+	}
+
+	stmts := []gorqlite.ParameterizedStatement{{
+		Query: `INSERT INTO archive_runs (tenant, month, object_key, rows, bytes, pruned, archived_at)
+		        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		Arguments: []interface{}{tenant, from.Format("2006-01"), key, len(rows), buf.Len(), j.prune, time.Now().UTC().Format(time.RFC3339)},
+	}}
+	if j.prune {
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query:     `DELETE FROM activity_hourly WHERE tenant = ? AND month = ?`,
+			Arguments: []interface{}{tenant, from.Format("2006-01")},
+		})
+	}
+	if _, err := j.db.Write(ctx, stmts); err != nil {
+		return fmt.Errorf("archived %s but could not record it: %w", key, err)
+	}
+	if j.prune {
+		j.repo.InvalidateRange(from, to)
+	}
+	log.Printf("archive: uploaded %s (%d rows, %d bytes, pruned=%v)", key, len(rows), buf.Len(), j.prune)
+	return nil
+}
+
+// nextMonth finds the oldest month before the current one with hourly
+// rows and no completed archive run.
+func (j *ArchiveJob) nextMonth(ctx context.Context) (time.Time, bool, error) {
+	now := time.Now().UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	qr, err := j.db.QueryOne(ctx, ConsistencyStrong, gorqlite.ParameterizedStatement{
+		Query: `SELECT DISTINCT month
+		        FROM activity_hourly
+		        WHERE tenant = ? AND month < ?
+		          AND month NOT IN (SELECT month FROM archive_runs WHERE tenant = ?)
+		        ORDER BY month
+		        LIMIT 1`,
+		Arguments: []interface{}{tenantOf(ctx), current.Format("2006-01"), tenantOf(ctx)},
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if qr.Err != nil {
+		return time.Time{}, false, qr.Err
+	}
+	if !qr.Next() {
+		return time.Time{}, false, nil
+	}
+	var month string
+	if err := qr.Scan(&month); err != nil {
+		return time.Time{}, false, err
+	}
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("unexpected hour_start month %q", month)
+	}
+	return t, true, nil
+}
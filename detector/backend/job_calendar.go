@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// CalendarJob syncs each linked calendar's accepted meetings over the
+// last lookback and relabels the hours they overlap, so time in meetings
+// no longer reads as LOW activity. Rows agents write straight to rqlite
+// are caught up on the next run; /ingest labels them on arrival.
+type CalendarJob struct {
+	calendars *CalendarRepo
+	repo      *ActivityRepo
+	providers map[string]*calendarProvider
+	lookback  time.Duration
+}
+
+// NewCalendarJobFromEnv returns nil when CALENDAR_SYNC=off or no provider
+// has client credentials.
+func NewCalendarJobFromEnv(calendars *CalendarRepo, repo *ActivityRepo) *CalendarJob {
+	providers := calendarProvidersFromEnv()
+	if os.Getenv("CALENDAR_SYNC") == "off" || len(providers) == 0 {
+		return nil
+	}
+	return &CalendarJob{
+		calendars: calendars,
+		repo:      repo,
+		providers: providers,
+		lookback:  envDuration("CALENDAR_LOOKBACK", 48*time.Hour),
+	}
+}
+
+func (j *CalendarJob) Run(ctx context.Context) error {
+	accounts, err := j.calendars.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	from, to := now.Add(-j.lookback).Truncate(time.Hour), now.Truncate(time.Hour).Add(time.Hour)
+
+	for _, a := range accounts {
+		if err := j.sync(ctx, a, from, to); err != nil {
+			log.Printf("calendar: %s (%s): %v", a.UserName, a.Provider, err)
+			if ferr := j.calendars.Failed(ctx, a.UserName, err); ferr != nil {
+				return ferr
+			}
+		}
+	}
+
+	n, err := j.calendars.Relabel(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		j.repo.InvalidateRange(from, to)
+		log.Printf("calendar: relabeled %d hours between %s and %s", n, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (j *CalendarJob) sync(ctx context.Context, a CalendarAccount, from, to time.Time) error {
+	p := j.providers[a.Provider]
+	if p == nil {
+		return fmt.Errorf("provider not configured on this backend")
+	}
+	access, next, err := p.refresh(ctx, a.RefreshToken)
+	if err != nil {
+		return err
+	}
+	ms, err := p.meetings(ctx, p, access, a.CalendarID, from, to)
+	if err != nil {
+		return err
+	}
+	return j.calendars.Synced(ctx, a.UserName, next, from, to, ms)
+}
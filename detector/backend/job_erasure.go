@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ErasureJob carries out the DELETE /users/:user/data requests, so the
+// request returns at once however much data the user has.
+type ErasureJob struct {
+	erasures *ErasureRepo
+	repo     ActivityRepository
+}
+
+func NewErasureJob(erasures *ErasureRepo, repo ActivityRepository) *ErasureJob {
+	return &ErasureJob{erasures: erasures, repo: repo}
+}
+
+func (j *ErasureJob) Run(ctx context.Context) error {
+	queued, err := j.erasures.Queued(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range queued {
+		e := &queued[i]
+		ok, err := j.erasures.Claim(ctx, e)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := j.erasures.Erase(ctx, e); err != nil && e.Status == erasureDone {
+			// erased, only the row counts were lost
+			log.Printf("erasure: %s done, counts not saved: %v", e.ID, err)
+		} else if err != nil {
+			log.Printf("erasure: %s failed: %v", e.ID, err)
+			if ferr := j.erasures.Fail(ctx, e, err); ferr != nil {
+				return ferr
+			}
+			continue
+		}
+		// cached reads must not serve the erased rows until they expire
+		j.repo.InvalidateRange(time.Time{}, time.Now().Add(24*time.Hour))
+		log.Printf("erasure: %s done (%s)", e.ID, e.Mode)
+	}
+	return nil
+}
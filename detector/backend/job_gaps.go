@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// GapFillJob writes NO_DATA / AGENT_DOWN rows for scheduled hours an agent
+// left empty. Without them a missing hour reads as OFF in reports, which
+// blames the user for a crashed or uninstalled agent. Hours are only
+// filled once they are grace past their end, so late uploads are not
+// pre-empted, and a real row arriving later replaces the placeholder.
+type GapFillJob struct {
+	repo     *ActivityRepo
+	agents   *AgentRepo
+	profiles *ProfileRepo
+	settings *SettingsRepo
+
+	lookback time.Duration // how far back hours are checked
+	grace    time.Duration // wait after an hour ends before filling it
+	stale    time.Duration // agents silent longer than this are retired
+}
+
+// NewGapFillJobFromEnv returns nil when GAP_FILL=off.
+func NewGapFillJobFromEnv(repo *ActivityRepo, agents *AgentRepo, profiles *ProfileRepo, settings *SettingsRepo) *GapFillJob {
+	if os.Getenv("GAP_FILL") == "off" {
+		return nil
+	}
+	return &GapFillJob{
+		repo:     repo,
+		agents:   agents,
+		profiles: profiles,
+		settings: settings,
+		lookback: envDuration("GAP_FILL_LOOKBACK", 48*time.Hour),
+		grace:    envDuration("GAP_FILL_GRACE", 30*time.Minute),
+		stale:    envDuration("GAP_FILL_STALE", 7*24*time.Hour),
+	}
+}
+
+func (j *GapFillJob) Run(ctx context.Context) error {
+	now := time.Now().UTC()
+	var global Schedule
+	if err := j.settings.Get(ctx, SettingSchedule, &global); err != nil {
+		return err
+	}
+	agents, err := j.agents.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	// last hour that ended at least grace ago
+	to := now.Add(-j.grace).Truncate(time.Hour)
+	filled := 0
+	for _, a := range agents {
+		first, err1 := time.Parse(time.RFC3339, a.FirstSeen)
+		last, err2 := time.Parse(time.RFC3339, a.LastSeen)
+		if err1 != nil || err2 != nil || now.Sub(last) > j.stale {
+			continue
+		}
+		from := now.Add(-j.lookback).Truncate(time.Hour)
+		if f := first.Truncate(time.Hour); f.After(from) {
+			from = f
+		}
+		if !from.Before(to) {
+			continue
+		}
+
+		sched := global
+		if a.UserName != "" {
+			if p, ok, err := j.profiles.Get(ctx, a.UserName); err != nil {
+				return err
+			} else if ok {
+				sched = p.Schedule
+			}
+		}
+		rows, err := j.gapsFor(ctx, a, sched, from, to)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if _, err := j.repo.InsertMissing(ctx, rows); err != nil {
+			return err
+		}
+		filled += len(rows)
+	}
+	if filled > 0 {
+		log.Printf("gap-fill: wrote %d NO_DATA/AGENT_DOWN hours", filled)
+	}
+	return j.agents.PruneHeartbeatHours(ctx, now.Add(-j.lookback-time.Hour).Format(time.RFC3339))
+}
+
+// gapsFor builds the placeholder rows for a's scheduled hours in
+// [from, to) that have no row.
+func (j *GapFillJob) gapsFor(ctx context.Context, a Agent, sched Schedule, from, to time.Time) ([]HourlyIngest, error) {
+	start, end := from.Format(time.RFC3339), to.Format(time.RFC3339)
+	existing, err := j.repo.GetBetween(ctx, start, end, a.Host, "")
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		have[r.HourStart] = true
+	}
+	up, err := j.agents.HeartbeatHours(ctx, a.Host, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []HourlyIngest
+	for h := from; h.Before(to); h = h.Add(time.Hour) {
+		key := h.Format(time.RFC3339)
+		if have[key] || !sched.covers(h) {
+			continue
+		}
+		status := StatusAgentDown
+		if up[key] {
+			status = StatusNoData
+		}
+		rows = append(rows, HourlyIngest{
+			HourStart: key,
+			Host:      a.Host,
+			UserName:  a.UserName,
+			Status:    string(status),
+		})
+	}
+	return rows, nil
+}
+
+// covers reports whether the hour starting at t overlaps the schedule's
+// work hours on one of its weekdays, in its timezone.
+func (s Schedule) covers(t time.Time) bool {
+	loc := time.UTC
+	if s.TZ != "" {
+		if l, err := time.LoadLocation(s.TZ); err == nil {
+			loc = l
+		}
+	}
+	lt := t.In(loc)
+	workday := false
+	for _, d := range s.Weekdays {
+		if time.Weekday(d) == lt.Weekday() {
+			workday = true
+			break
+		}
+	}
+	sh, sm, ok1 := parseHHMM(s.Start)
+	eh, em, ok2 := parseHHMM(s.End)
+	if !workday || !ok1 || !ok2 {
+		return false
+	}
+	m := lt.Hour()*60 + lt.Minute()
+	return m+60 > sh*60+sm && m < eh*60+em
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// RetentionJob enforces the "retention" setting: raw samples (window
+// titles and 5-minute sample roll-ups included) and daily
+// roll-ups past their age are deleted, hourly rows past theirs are first
+// rolled up into activity_daily. Hourly sample roll-ups go with hourly
+// rows, daily ones with daily rows. Shipped agent logs are kept for
+// logRetention. In dry-run mode it only logs how many rows each step
+// would touch.
+type RetentionJob struct {
+	db           *DB
+	repo         *ActivityRepo
+	settings     *SettingsRepo
+	dryRun       bool
+	logRetention time.Duration
+}
+
+// NewRetentionJobFromEnv returns nil when RETENTION=off.
+// AGENT_LOG_RETENTION (default 14 days, 0 keeps forever) bounds agent_logs.
+func NewRetentionJobFromEnv(db *DB, repo *ActivityRepo, settings *SettingsRepo) *RetentionJob {
+	if os.Getenv("RETENTION") == "off" {
+		return nil
+	}
+	return &RetentionJob{
+		db:       db,
+		repo:     repo,
+		settings: settings,
+		dryRun:   os.Getenv("RETENTION_DRY_RUN") == "true",
+
+		logRetention: envDuration("AGENT_LOG_RETENTION", 14*24*time.Hour),
+	}
+}
+
+func (j *RetentionJob) Run(ctx context.Context) error {
+	var ret Retention
+	if err := j.settings.Get(ctx, SettingRetention, &ret); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if ret.RawDays > 0 {
+		cutoff := now.AddDate(0, 0, -ret.RawDays).Format(time.RFC3339)
+		if err := j.prune(ctx, "activity_samples", `ts < ?`, cutoff); err != nil {
+			return err
+		}
+		if err := j.prune(ctx, "window_titles", `sampled_at < ?`, cutoff); err != nil {
+			return err
+		}
+		if err := j.prune(ctx, "sample_rollup_5m", `bucket_start < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+
+	if ret.HourlyDays > 0 {
+		// whole days only, so each roll-up sees every hour of its day
+		cutoff := today.AddDate(0, 0, -ret.HourlyDays)
+		if err := j.rollUpHourly(ctx, cutoff); err != nil {
+			return err
+		}
+		if err := j.prune(ctx, "sample_rollup_hourly", `bucket_start < ?`, cutoff.Format(time.RFC3339)); err != nil {
+			return err
+		}
+		if err := j.prune(ctx, "focus_sessions", `started_at < ?`, cutoff.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	if ret.DailyDays > 0 {
+		cutoff := today.AddDate(0, 0, -ret.DailyDays).Format("2006-01-02")
+		if err := j.prune(ctx, "activity_daily", `day < ?`, cutoff); err != nil {
+			return err
+		}
+		if err := j.prune(ctx, "sample_rollup_daily", `bucket_start < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+
+	if j.logRetention > 0 {
+		cutoff := now.Add(-j.logRetention).Format(time.RFC3339)
+		if err := j.prune(ctx, "agent_logs", `received_at < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollUpHourly folds hourly rows before cutoff into activity_daily, one
+// row per host and user a day, and deletes them in the same transaction.
+func (j *RetentionJob) rollUpHourly(ctx context.Context, cutoff time.Time) error {
+	bound := cutoff.Format(time.RFC3339)
+	if j.dryRun {
+		n, err := j.count(ctx, "activity_hourly", `hour_start < ?`, bound)
+		if err != nil {
+			return err
+		}
+		log.Printf("retention (dry-run): would roll up and delete %d rows from activity_hourly before %s", n, bound)
+		return nil
+	}
+
+	results, err := j.db.Write(ctx, []gorqlite.ParameterizedStatement{
+		{
+			Query: `INSERT OR REPLACE INTO activity_daily
+			        (tenant, day, host, user_name, activity_pct, idle_seconds, samples, hours)
+			        SELECT tenant, substr(hour_start, 1, 10) AS day, host, user_name,
+			               AVG(activity_pct), SUM(idle_seconds), SUM(samples), COUNT(*)
+			        FROM activity_hourly
+			        WHERE tenant = ? AND hour_start < ? AND deleted_at IS NULL AND ` + measuredSQL + `
+			        GROUP BY day, host, user_name`,
+			Arguments: tenantArgs(ctx, bound),
+		},
+		{
+			Query:     `DELETE FROM activity_hourly WHERE tenant = ? AND hour_start < ?`,
+			Arguments: tenantArgs(ctx, bound),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	j.repo.InvalidateRange(time.Time{}, cutoff)
+	log.Printf("retention: rolled up %d daily rows and deleted %d rows from activity_hourly before %s",
+		results[0].RowsAffected, results[1].RowsAffected, bound)
+	return nil
+}
+
+// prune deletes the tenant's rows of table matching where (with a single
+// bound argument), or only counts them in dry-run mode.
+func (j *RetentionJob) prune(ctx context.Context, table, where, bound string) error {
+	if j.dryRun {
+		n, err := j.count(ctx, table, where, bound)
+		if err != nil {
+			return err
+		}
+		log.Printf("retention (dry-run): would delete %d rows from %s before %s", n, table, bound)
+		return nil
+	}
+	results, err := j.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `DELETE FROM ` + table + ` WHERE tenant = ? AND ` + where,
+		Arguments: tenantArgs(ctx, bound),
+	}})
+	if err != nil {
+		return err
+	}
+	log.Printf("retention: deleted %d rows from %s before %s", results[0].RowsAffected, table, bound)
+	return nil
+}
+
+func (j *RetentionJob) count(ctx context.Context, table, where, bound string) (int64, error) {
+	qr, err := j.db.QueryOne(ctx, ConsistencyStrong, gorqlite.ParameterizedStatement{
+		Query:     `SELECT COUNT(*) FROM ` + table + ` WHERE tenant = ? AND ` + where,
+		Arguments: tenantArgs(ctx, bound),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if qr.Err != nil {
+		return 0, qr.Err
+	}
+	var n int64
+	if qr.Next() {
+		if err := qr.Scan(&n); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
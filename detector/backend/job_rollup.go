@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// rollupThresholds are the idle thresholds the sample roll-ups keep idle
+// time for; recomputing with one of them reads the roll-ups instead of
+// the raw samples.
+var rollupThresholds = []time.Duration{
+	5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second, 45 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 5 * time.Minute,
+	10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+}
+
+// rollupKey is the idle_seconds JSON key of a threshold, or "" when the
+// roll-ups do not keep it.
+func rollupKey(threshold time.Duration) string {
+	for _, t := range rollupThresholds {
+		if t == threshold {
+			return fmt.Sprint(int(t.Seconds()))
+		}
+	}
+	return ""
+}
+
+// rollupIdleSQL builds the idle_seconds JSON object of a roll-up SELECT,
+// with each threshold's value from term(millis, key).
+func rollupIdleSQL(term func(ms int64, key string) string) string {
+	parts := make([]string, 0, 2*len(rollupThresholds))
+	for _, t := range rollupThresholds {
+		key := rollupKey(t)
+		parts = append(parts, "'"+key+"'", term(t.Milliseconds(), key))
+	}
+	return "json_object(" + strings.Join(parts, ", ") + ")"
+}
+
+// Roll-up statements for one tenant's host and range, bound as (tenant,
+// month, host, start, end), with one bucket per user of the host. Each
+// level is derived from the one below it, so a run reads the raw samples
+// of a dirty hour once.
+var (
+	rollup5mSQL = `INSERT OR REPLACE INTO sample_rollup_5m
+	        (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+	        SELECT tenant, substr(ts, 1, 14) || printf('%02d', CAST(substr(ts, 15, 2) AS INTEGER) / 5 * 5) || ':00Z' AS bucket,
+	               host, user_name, COUNT(*), SUM(interval_ms) / 1000.0, ` +
+		rollupIdleSQL(func(ms int64, _ string) string {
+			return fmt.Sprintf("SUM(CASE WHEN idle_ms >= %d THEN interval_ms ELSE 0 END) / 1000.0", ms)
+		}) + `
+	        FROM activity_samples
+	        WHERE tenant = ? AND month = ? AND host = ? AND ts >= ? AND ts < ?
+	        GROUP BY bucket, host, user_name`
+	rollupHourlySQL = rollupMergeSQL("sample_rollup_hourly", "sample_rollup_5m", `substr(bucket_start, 1, 13) || ':00:00Z'`)
+	rollupDailySQL  = rollupMergeSQL("sample_rollup_daily", "sample_rollup_hourly", `substr(bucket_start, 1, 10) || 'T00:00:00Z'`)
+)
+
+// rollupMergeSQL rolls the buckets of from up into the coarser buckets of
+// into.
+func rollupMergeSQL(into, from, bucket string) string {
+	return `INSERT OR REPLACE INTO ` + into + `
+	        (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+	        SELECT tenant, ` + bucket + ` AS bucket, host, user_name, SUM(samples), SUM(measured_seconds), ` +
+		rollupIdleSQL(func(_ int64, key string) string {
+			return `SUM(json_extract(idle_seconds, '$."` + key + `"'))`
+		}) + `
+	        FROM ` + from + `
+	        WHERE tenant = ? AND month = ? AND host = ? AND bucket_start >= ? AND bucket_start < ?
+	        GROUP BY bucket, host, user_name`
+}
+
+// rollupBatch is how many dirty host-hours one transaction rolls up.
+const rollupBatch = 100
+
+// RollupJob keeps the sample roll-ups current: every host-hour that
+// received samples since the last run (see SampleRepo.Insert) is rolled
+// up again into its 5-minute and hourly buckets, and its day recomputed.
+type RollupJob struct {
+	db *DB
+}
+
+// NewRollupJobFromEnv returns nil when ROLLUP=off.
+func NewRollupJobFromEnv(db *DB) *RollupJob {
+	if os.Getenv("ROLLUP") == "off" {
+		return nil
+	}
+	return &RollupJob{db: db}
+}
+
+// Run rolls up dirty host-hours batch by batch until none are left.
+func (j *RollupJob) Run(ctx context.Context) error {
+	// hours marked again after this instant stay dirty for the next run
+	started := time.Now().UnixNano()
+	for ctx.Err() == nil {
+		n, err := j.runBatch(ctx, started)
+		if err != nil || n < rollupBatch {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (j *RollupJob) runBatch(ctx context.Context, started int64) (int, error) {
+	qr, err := j.db.QueryOne(ctx, ConsistencyStrong, gorqlite.ParameterizedStatement{
+		Query: `SELECT tenant, host, hour_start FROM sample_rollup_dirty
+		        WHERE marked_at <= ? ORDER BY hour_start, tenant, host LIMIT ?`,
+		Arguments: []interface{}{started, rollupBatch},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if qr.Err != nil {
+		return 0, qr.Err
+	}
+
+	var stmts []gorqlite.ParameterizedStatement
+	days := make(map[[3]string]bool) // tenant, host, day
+	n := 0
+	for qr.Next() {
+		var tenant, host, hourStart string
+		if err := qr.Scan(&tenant, &host, &hourStart); err != nil {
+			return 0, err
+		}
+		n++
+		hour, err := time.Parse(time.RFC3339, hourStart)
+		if err != nil {
+			return 0, fmt.Errorf("sample_rollup_dirty: bad hour_start %q", hourStart)
+		}
+		args := []interface{}{tenant, hour.Format("2006-01"), host, hourStart, hour.Add(time.Hour).Format(time.RFC3339)}
+		stmts = append(stmts,
+			gorqlite.ParameterizedStatement{Query: rollup5mSQL, Arguments: args},
+			gorqlite.ParameterizedStatement{Query: rollupHourlySQL, Arguments: args},
+			gorqlite.ParameterizedStatement{
+				Query:     `DELETE FROM sample_rollup_dirty WHERE tenant = ? AND host = ? AND hour_start = ? AND marked_at <= ?`,
+				Arguments: []interface{}{tenant, host, hourStart, started},
+			})
+		days[[3]string{tenant, host, hour.Format("2006-01-02")}] = true
+	}
+	for key := range days {
+		day, _ := time.Parse("2006-01-02", key[2])
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query:     rollupDailySQL,
+			Arguments: []interface{}{key[0], day.Format("2006-01"), key[1], day.Format(time.RFC3339), day.AddDate(0, 0, 1).Format(time.RFC3339)},
+		})
+	}
+	if len(stmts) == 0 {
+		return 0, nil
+	}
+	if _, err := j.db.Write(ctx, stmts); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
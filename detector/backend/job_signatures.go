@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SignatureJob checks the signatures of rows agents wrote straight to
+// rqlite, which never pass through POST /ingest/hourly, and stores the
+// outcome in signature_status.
+type SignatureJob struct {
+	repo     *ActivityRepo
+	lookback time.Duration
+	batch    int
+}
+
+// NewSignatureJobFromEnv returns nil without a BUCKET_SIGNING_KEY.
+func NewSignatureJobFromEnv(repo *ActivityRepo) *SignatureJob {
+	if len(signingKey) == 0 {
+		return nil
+	}
+	return &SignatureJob{
+		repo:     repo,
+		lookback: envDuration("SIGNATURE_CHECK_LOOKBACK", 48*time.Hour),
+		batch:    envInt("SIGNATURE_CHECK_BATCH", 500),
+	}
+}
+
+func (j *SignatureJob) Run(ctx context.Context) error {
+	rows, err := j.repo.UncheckedSignatures(ctx, time.Now().UTC().Add(-j.lookback).Truncate(time.Hour).Format(time.RFC3339), j.batch)
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	statuses := make([]string, len(rows))
+	invalid := 0
+	for i, s := range rows {
+		statuses[i] = verifyBucket(s.Host, bucketPayload(s.HourStart, s.Host, s.UserName, s.ActivityPct, s.IdleSeconds,
+			s.Samples, s.Status, s.MouseEvents, s.KeyEvents, s.TouchEvents), s.Signature)
+		// the calendar job relabels signed LOW hours as IN_MEETING
+		if statuses[i] == signatureInvalid && s.Status == string(StatusInMeeting) {
+			statuses[i] = verifyBucket(s.Host, bucketPayload(s.HourStart, s.Host, s.UserName, s.ActivityPct, s.IdleSeconds,
+				s.Samples, string(StatusLow), s.MouseEvents, s.KeyEvents, s.TouchEvents), s.Signature)
+		}
+		if statuses[i] == signatureInvalid {
+			invalid++
+			log.Printf("signatures: invalid signature on %s %s %s", s.HourStart, s.Host, s.UserName)
+		}
+	}
+	if err := j.repo.SetSignatureStatus(ctx, rows, statuses); err != nil {
+		return err
+	}
+	log.Printf("signatures: checked %d rows, %d invalid", len(rows), invalid)
+	return nil
+}
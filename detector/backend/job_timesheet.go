@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TimesheetJob pushes each finished day's active-hour totals to the
+// connectors of the "timesheet" setting, so nobody re-types them into a
+// timesheet or HR tool. Days are local to the schedule setting's zone
+// and pushed once they are grace past their end, for late uploads; the
+// last lookbackDays days are retried until each push has gone through
+// once.
+type TimesheetJob struct {
+	repo         *ActivityRepo
+	settings     *SettingsRepo
+	pushes       *TimesheetRepo
+	client       *http.Client
+	grace        time.Duration
+	lookbackDays int
+}
+
+// NewTimesheetJobFromEnv returns nil when TIMESHEET=off.
+func NewTimesheetJobFromEnv(repo *ActivityRepo, settings *SettingsRepo, pushes *TimesheetRepo) *TimesheetJob {
+	if os.Getenv("TIMESHEET") == "off" {
+		return nil
+	}
+	return &TimesheetJob{
+		repo:         repo,
+		settings:     settings,
+		pushes:       pushes,
+		client:       &http.Client{Timeout: 15 * time.Second},
+		grace:        envDuration("TIMESHEET_GRACE", 2*time.Hour),
+		lookbackDays: int(envDuration("TIMESHEET_LOOKBACK", 72*time.Hour) / (24 * time.Hour)),
+	}
+}
+
+func (j *TimesheetJob) Run(ctx context.Context) error {
+	var ts TimesheetSettings
+	if err := j.settings.Get(ctx, SettingTimesheet, &ts); err != nil {
+		return err
+	}
+	if len(ts.Connectors) == 0 {
+		return nil
+	}
+	var sched Schedule
+	if err := j.settings.Get(ctx, SettingSchedule, &sched); err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(sched.TZ)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// the last day to push ended at least grace ago
+	cutoff := time.Now().Add(-j.grace).In(loc)
+	end := time.Date(cutoff.Year(), cutoff.Month(), cutoff.Day(), 0, 0, 0, 0, loc)
+	first := end.AddDate(0, 0, -max(j.lookbackDays, 1))
+	done, err := j.pushes.Done(ctx, first.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+		dayStr := day.Format("2006-01-02")
+		rows, err := j.repo.GetBetween(ctx, day.UTC().Format(time.RFC3339), day.AddDate(0, 0, 1).UTC().Format(time.RFC3339), "", "")
+		if err != nil {
+			return err
+		}
+		for _, d := range timesheetDays(dayStr, loc, rows) {
+			for _, c := range ts.Connectors {
+				if !c.wants(d.User) || done[c.Name+"|"+d.User+"|"+dayStr] {
+					continue
+				}
+				perr := c.push(ctx, j.client, d)
+				if perr != nil {
+					log.Printf("timesheet: %s: %s %s: %v", c.Name, d.User, dayStr, perr)
+				}
+				if err := j.pushes.Record(ctx, c.Name, d.User, dayStr, perr); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Jobs runs periodic background work (retention, archival, alerting...)
+// and lets shutdown wait for whatever is in flight instead of cutting a
+// job off halfway through a batch.
+type Jobs struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewJobs() *Jobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Jobs{ctx: ctx, cancel: cancel}
+}
+
+// Every runs fn every interval until Stop. When onStop is true fn runs one
+// last time during Stop, for jobs holding pending work (queued alerts,
+// half-built reports) that must be flushed before exit.
+func (j *Jobs) Every(name string, interval time.Duration, onStop bool, fn func(ctx context.Context) error) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-j.ctx.Done():
+				if onStop {
+					// the job's own context is already cancelled; give the
+					// final flush a fresh one with a bound
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					j.run(ctx, name, fn)
+					cancel()
+				}
+				return
+			case <-t.C:
+				j.run(j.ctx, name, fn)
+			}
+		}
+	}()
+}
+
+func (j *Jobs) run(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	start := time.Now()
+	if err := fn(ctx); err != nil {
+		log.Printf("job %s failed after %s: %v", name, time.Since(start), err)
+	}
+}
+
+// Stop cancels all jobs and waits for running ones to finish.
+func (j *Jobs) Stop() {
+	j.cancel()
+	j.wg.Wait()
+}
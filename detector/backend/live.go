@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TodaySoFar is the running UTC-day aggregate for one host.
+type TodaySoFar struct {
+	Day            string  `json:"day"`
+	Host           string  `json:"host"`
+	UserName       string  `json:"user_name"`
+	Hours          int     `json:"hours"`
+	Samples        int64   `json:"samples"`
+	IdleSeconds    float64 `json:"idle_seconds"`
+	AvgActivityPct float64 `json:"avg_activity_pct"`
+	UpdatedAt      string  `json:"updated_at"`
+	Tenant         string  `json:"-"`
+}
+
+// LiveToday keeps today's per-host aggregate up to date incrementally:
+// every ingested hour replaces its previous value in the running sums, so
+// reads never rescan activity_hourly. Rows written straight to rqlite by
+// older agents (or through another replica) are picked up by Reload. A
+// host name used in two tenants is two hosts, as in activity_hourly.
+type LiveToday struct {
+	mu    sync.Mutex
+	day   string
+	hours map[liveHost]map[string]HourlyIngest // liveKey -> row
+	today map[liveHost]*TodaySoFar
+	subs  map[chan TodaySoFar]struct{}
+}
+
+// liveHost is a host of one tenant.
+type liveHost struct {
+	tenant, host string
+}
+
+func NewLiveToday() *LiveToday {
+	return &LiveToday{
+		hours: make(map[liveHost]map[string]HourlyIngest),
+		today: make(map[liveHost]*TodaySoFar),
+		subs:  make(map[chan TodaySoFar]struct{}),
+	}
+}
+
+// Apply folds rows ingested for tenant into the aggregate. Rows from other
+// days are ignored; the first row of a new day starts over.
+func (l *LiveToday) Apply(tenant string, rows []HourlyIngest) {
+	now := time.Now().UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	changed := make(map[liveHost]bool)
+	for _, row := range rows {
+		if len(row.HourStart) < 10 || row.HourStart[:10] != l.day {
+			continue
+		}
+		h := liveHost{tenant, row.Host}
+		byHour := l.hours[h]
+		if byHour == nil {
+			byHour = make(map[string]HourlyIngest)
+			l.hours[h] = byHour
+		}
+		byHour[liveKey(row.HourStart, row.UserName)] = row
+		changed[h] = true
+	}
+	for h := range changed {
+		l.publish(l.recompute(h, now))
+	}
+}
+
+// liveKey keys a host's rows: an hour may be split between users on a
+// shared workstation.
+func liveKey(hourStart, user string) string {
+	return hourStart + "|" + user
+}
+
+// Drop removes one user's hour of tenant's host from the aggregate, e.g.
+// after a tombstone.
+func (l *LiveToday) Drop(tenant, host, hourStart, user string) {
+	now := time.Now().UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	h, key := liveHost{tenant, host}, liveKey(hourStart, user)
+	if _, ok := l.hours[h][key]; !ok {
+		return
+	}
+	delete(l.hours[h], key)
+	l.publish(l.recompute(h, now))
+}
+
+// Reload rebuilds today's aggregate of ctx's tenant from activity_hourly,
+// leaving the other tenants' hosts alone.
+func (l *LiveToday) Reload(ctx context.Context, repo ActivityRepository) error {
+	tenant := tenantOf(ctx)
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	rows, err := repo.GetBetween(ctx, start.Format(time.RFC3339), start.AddDate(0, 0, 1).Format(time.RFC3339), "", ConsistencyStrong)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	fresh := make(map[liveHost]map[string]HourlyIngest)
+	for _, r := range rows {
+		h := liveHost{tenant, r.Host}
+		if fresh[h] == nil {
+			fresh[h] = make(map[string]HourlyIngest)
+		}
+		fresh[h][liveKey(r.HourStart, r.UserName)] = HourlyIngest{
+			HourStart:   r.HourStart,
+			Host:        r.Host,
+			UserName:    r.UserName,
+			ActivityPct: r.ActivityPct,
+			IdleSeconds: r.IdleSeconds,
+			Samples:     r.Samples,
+			Status:      r.Status,
+		}
+	}
+	for h := range l.hours {
+		if h.tenant == tenant && fresh[h] == nil {
+			delete(l.hours, h)
+			delete(l.today, h)
+		}
+	}
+	for h, byHour := range fresh {
+		l.hours[h] = byHour
+	}
+	for h := range fresh {
+		prev := l.today[h]
+		cur := l.recompute(h, now)
+		if prev == nil || prev.Hours != cur.Hours || prev.Samples != cur.Samples || prev.IdleSeconds != cur.IdleSeconds {
+			l.publish(cur)
+		}
+	}
+	return nil
+}
+
+// Get returns today's aggregate for one of tenant's hosts, or for all of
+// them when host is empty.
+func (l *LiveToday) Get(tenant, host string) []TodaySoFar {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(time.Now().UTC())
+	out := make([]TodaySoFar, 0, len(l.today))
+	for h, t := range l.today {
+		if h.tenant == tenant && (host == "" || h.host == host) {
+			out = append(out, *t)
+		}
+	}
+	return out
+}
+
+// Subscribe returns a channel receiving every updated host aggregate, of
+// every tenant. Slow subscribers miss updates rather than block ingest.
+func (l *LiveToday) Subscribe() (<-chan TodaySoFar, func()) {
+	ch := make(chan TodaySoFar, 32)
+	l.mu.Lock()
+	l.subs[ch] = struct{}{}
+	l.mu.Unlock()
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.subs[ch]; ok {
+			delete(l.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription so open streams return before shutdown.
+func (l *LiveToday) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs {
+		delete(l.subs, ch)
+		close(ch)
+	}
+}
+
+// rollover resets the state when the UTC day changes. Caller holds mu.
+func (l *LiveToday) rollover(now time.Time) {
+	day := now.Format("2006-01-02")
+	if l.day == day {
+		return
+	}
+	l.day = day
+	l.hours = make(map[liveHost]map[string]HourlyIngest)
+	l.today = make(map[liveHost]*TodaySoFar)
+}
+
+// recompute sums the hours held for h. Caller holds mu.
+func (l *LiveToday) recompute(h liveHost, now time.Time) TodaySoFar {
+	t := TodaySoFar{Day: l.day, Host: h.host, UpdatedAt: now.Format(time.RFC3339), Tenant: h.tenant}
+	var pctSum float64
+	for _, row := range l.hours[h] {
+		if !Status(row.Status).Measured() {
+			continue
+		}
+		t.Hours++
+		t.Samples += row.Samples
+		t.IdleSeconds += row.IdleSeconds
+		pctSum += row.ActivityPct
+		if row.UserName != "" {
+			t.UserName = row.UserName
+		}
+	}
+	if t.Hours > 0 {
+		t.AvgActivityPct = pctSum / float64(t.Hours)
+	}
+	l.today[h] = &t
+	return t
+}
+
+// publish fans an update out to subscribers. Caller holds mu.
+func (l *LiveToday) publish(t TodaySoFar) {
+	for ch := range l.subs {
+		select {
+		case ch <- t:
+		default:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package logimport rebuilds hourly activity from the agent's daily log
+// files (activity-YYYY-MM-DD.log). It is shared by the backend's
+// POST /import and the cmd/backfill tool.
+package logimport
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxGap is the longest silence between two log lines still counted as
+// the agent running; STATUS lines come every 30s by default, so anything
+// longer means the machine was off or asleep.
+const MaxGap = 5 * time.Minute
+
+var (
+	lineRe        = regexp.MustCompile(`^\[([^\]]+)\] (.*)$`)
+	activeRatioRe = regexp.MustCompile(`activeRatio=([0-9.]+)%`)
+)
+
+// Kind is what a log line says about the agent.
+type Kind int
+
+const (
+	Other Kind = iota // MOUSE MOVE and anything else: the agent was running
+	Start
+	Stop
+	Ratio // STATUS or MODE CHANGE, carries activeRatio
+)
+
+// Point is one understood log line.
+type Point struct {
+	At    time.Time
+	Kind  Kind
+	Ratio float64 // percent, Ratio lines only
+}
+
+// Parse reads the rotating logger's format ("[RFC3339] EVENT...") and
+// returns the lines it understands, in file order. Unparseable lines are
+// counted and skipped so one corrupt line does not lose a day.
+func Parse(r io.Reader) (points []Point, skipped int, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			skipped++
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, m[1])
+		if err != nil {
+			skipped++
+			continue
+		}
+		p := Point{At: at.UTC()}
+		msg := m[2]
+		switch {
+		case strings.HasPrefix(msg, "START"):
+			p.Kind = Start
+		case strings.HasPrefix(msg, "STOP"):
+			p.Kind = Stop
+		case strings.HasPrefix(msg, "STATUS:"), strings.HasPrefix(msg, "MODE CHANGE:"):
+			rm := activeRatioRe.FindStringSubmatch(msg)
+			if rm == nil {
+				skipped++
+				continue
+			}
+			p.Kind = Ratio
+			p.Ratio, _ = strconv.ParseFloat(rm[1], 64)
+			if p.Ratio > 100 {
+				p.Ratio = 100
+			}
+		}
+		points = append(points, p)
+	}
+	return points, skipped, sc.Err()
+}
+
+// Hour is the monitored and idle time reconstructed for one UTC hour.
+type Hour struct {
+	Start       time.Time
+	Monitored   float64 // seconds
+	IdleSeconds float64
+}
+
+// ActivityPct is the active share of the monitored time, in [0, 100].
+func (h Hour) ActivityPct() float64 {
+	if h.Monitored <= 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(100, (1-h.IdleSeconds/h.Monitored)*100))
+}
+
+// Bucket rebuilds hours from points, which may come from several files.
+// Time between two lines at most MaxGap apart (and not across a STOP)
+// counts as monitored, at the last activeRatio seen in the session; time
+// before the first ratio of a session is not counted. Hours come back in
+// order.
+func Bucket(points []Point) []Hour {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].At.Before(points[j].At) })
+
+	byStart := make(map[time.Time]*Hour)
+	add := func(from, to time.Time, ratio float64) {
+		for from.Before(to) {
+			start := from.Truncate(time.Hour)
+			end := start.Add(time.Hour)
+			if end.After(to) {
+				end = to
+			}
+			h := byStart[start]
+			if h == nil {
+				h = &Hour{Start: start}
+				byStart[start] = h
+			}
+			secs := end.Sub(from).Seconds()
+			h.Monitored += secs
+			h.IdleSeconds += secs * (1 - ratio/100)
+			from = end
+		}
+	}
+
+	ratio := -1.0 // unknown until the session's first STATUS
+	for i, p := range points {
+		switch p.Kind {
+		case Start, Stop:
+			ratio = -1
+		case Ratio:
+			ratio = p.Ratio
+		}
+		if i+1 == len(points) || p.Kind == Stop || ratio < 0 {
+			continue
+		}
+		next := points[i+1].At
+		if gap := next.Sub(p.At); gap > 0 && gap <= MaxGap {
+			add(p.At, next, ratio)
+		}
+	}
+
+	hours := make([]Hour, 0, len(byStart))
+	for _, h := range byStart {
+		if h.Monitored >= 1 {
+			hours = append(hours, *h)
+		}
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Start.Before(hours[j].Start) })
+	return hours
+}
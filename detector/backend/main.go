@@ -1,29 +1,305 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
+	// route the standard logger through the JSON handler too
+	slog.SetDefault(logger)
+	parseFlags()
+	flushTraces, err := InitTracing(context.Background())
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+
 	// DB
-	conn := OpenRqliteFromEnv()
-	repo := NewActivityRepo(conn)
+	db := OpenRqliteFromEnv()
+	if err := Migrate(db); err != nil {
+		log.Fatal(err)
+	}
+	cacheTTL := 15 * time.Second
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid CACHE_TTL %q: %v", v, err)
+		}
+		cacheTTL = d
+	}
+	repo := NewActivityRepo(db, cacheTTL)
+	tenants := NewTenantRepo(db)
+	settings := NewSettingsRepo(db)
+	if err := settings.Load(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	alertRules := NewAlertRuleRepo(db)
+	samples := NewSampleRepo(db)
+	audit := NewAuditRepo(db)
+	profiles := NewProfileRepo(db)
+	agents := NewAgentRepo(db)
+	identities := NewIdentityRepo(db)
+	calendars := NewCalendarRepo(db)
+	timesheets := NewTimesheetRepo(db)
+	ingestKeys := NewIngestKeyRepoFromEnv(db)
+	enrollments := NewEnrollmentRepo(db)
+	tokens := NewTokenRepo(db)
+	consents := NewConsentRepo(db)
+	focus := NewFocusRepo(db)
+	erasures := NewErasureRepo(db)
+	// site key agents pseudonymize identities with; empty disables it
+	pseudonymKey := os.Getenv("PSEUDONYM_KEY")
+
+	live := NewLiveToday()
+	liveReload := perTenant(tenants, func(ctx context.Context) error {
+		return live.Reload(ctx, repo)
+	})
+	if err := liveReload(context.Background()); err != nil {
+		log.Printf("live: initial load failed: %v", err)
+	}
+
+	// Background jobs; the ones working on tenant data run once per tenant.
+	// Alerts, timesheet pushes and roll-ups run once more at shutdown, so
+	// what they have pending goes out before the backend stops.
+	jobs := NewJobs()
+	// catch up with rows that did not come through /ingest
+	jobs.Every("live-reload", envDuration("LIVE_RELOAD_INTERVAL", time.Minute), false, liveReload)
+	// pick up admin edits made through other backend replicas
+	jobs.Every("settings-reload", time.Minute, false, settings.Load)
+	jobs.Every("ingest-keys", time.Hour, false, ingestKeys.Prune)
+	if archive := NewArchiveJobFromEnv(db, repo); archive != nil {
+		jobs.Every("archive", envDuration("ARCHIVE_INTERVAL", 6*time.Hour), false, perTenant(tenants, archive.Run))
+	}
+	if alerts := NewAlertJobFromEnv(alertRules, repo, settings); alerts != nil {
+		jobs.Every("alerts", envDuration("ALERT_INTERVAL", 5*time.Minute), true, perTenant(tenants, alerts.Run))
+	}
+	if retention := NewRetentionJobFromEnv(db, repo, settings); retention != nil {
+		jobs.Every("retention", envDuration("RETENTION_INTERVAL", time.Hour), false, perTenant(tenants, retention.Run))
+	}
+	if gaps := NewGapFillJobFromEnv(repo, agents, profiles, settings); gaps != nil {
+		jobs.Every("gap-fill", envDuration("GAP_FILL_INTERVAL", 15*time.Minute), false, perTenant(tenants, gaps.Run))
+	}
+	if cal := NewCalendarJobFromEnv(calendars, repo); cal != nil {
+		jobs.Every("calendar", envDuration("CALENDAR_SYNC_INTERVAL", 15*time.Minute), false, perTenant(tenants, cal.Run))
+	}
+	if rollup := NewRollupJobFromEnv(db); rollup != nil {
+		jobs.Every("rollup", envDuration("ROLLUP_INTERVAL", time.Minute), true, rollup.Run)
+	}
+	if ts := NewTimesheetJobFromEnv(repo, settings, timesheets); ts != nil {
+		jobs.Every("timesheet", envDuration("TIMESHEET_INTERVAL", time.Hour), true, perTenant(tenants, ts.Run))
+	}
+	jobs.Every("erasure", envDuration("ERASURE_INTERVAL", 30*time.Second), false, perTenant(tenants, NewErasureJob(erasures, repo).Run))
+	if sigs := NewSignatureJobFromEnv(repo); sigs != nil {
+		jobs.Every("signatures", envDuration("SIGNATURE_CHECK_INTERVAL", 5*time.Minute), false, perTenant(tenants, sigs.Run))
+	}
 
 	// HTTP
-	handler := NewActivityHandler(repo)
+	handler := NewActivityHandler(repo, settings, profiles, calendars)
+	exportHandler := NewExportHandler(repo)
+	fleetHandler := NewFleetHandler(repo, settings)
+	ingestHandler := NewIngestHandler(repo, live, calendars, ingestKeys)
+	liveHandler := NewLiveHandler(live)
+	correctionHandler := NewCorrectionHandler(repo, live)
+	auditHandler := NewAuditHandler(audit)
+	profileHandler := NewProfileHandler(profiles)
+	agentHandler := NewAgentHandlerFromEnv(agents, settings, repo, samples, consents)
+	commandHandler := NewCommandHandler(NewCommandRepo(db))
+	logHandler := NewLogHandler(NewLogRepo(db))
+	titleHandler := NewTitleHandler(NewTitleRepo(db), settings)
+	focusHandler := NewFocusHandler(focus)
+	importHandler := NewImportHandler(repo, settings, pseudonymKey)
+	identityHandler := NewIdentityHandler(identities, pseudonymKey)
+	recomputeHandler := NewRecomputeHandler(samples, repo, settings)
+	sampleHandler := NewSampleHandler(samples)
+	calendarHandler := NewCalendarHandler(calendars)
+	timesheetHandler := NewTimesheetHandler(timesheets)
+	adminHandler := NewAdminHandler(settings, alertRules, repo)
+	enrollHandler := NewEnrollHandlerFromEnv(enrollments, tenants)
+	tokenHandler := NewTokenHandler(tokens)
+	meHandler := NewMeHandler(repo, focus, settings, consents)
+	erasureHandler := NewErasureHandler(erasures)
+	tenantHandler := NewTenantHandlerFromEnv(tenants)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(RequestLogger())
+	app.Use(CORSFromEnv())
+	app.Use(Deadline(envDuration("REQUEST_TIMEOUT", 10*time.Second), envDuration("REQUEST_TIMEOUT_MAX", 30*time.Second)))
 
-	app := fiber.New()
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"ok": true})
+	limiter := NewRateLimiterFromEnv(func(c *fiber.Ctx, key string) bool {
+		return knownKey(c, key, enrollments, tokens)
 	})
-	app.Get("/activity/today", handler.GetToday)
+	jobs.Every("ratelimit-sweep", 5*time.Minute, false, func(context.Context) error {
+		limiter.Sweep(10 * time.Minute)
+		return nil
+	})
+	app.Use("/activity", limiter.Handler("query"))
+	app.Use("/export", limiter.Handler("query"))
+	app.Use("/ingest", limiter.Handler("ingest"))
+	app.Use("/graphql", limiter.Handler("query"))
+	app.Use("/agents", limiter.Handler("query"))
+	app.Use("/import", limiter.Handler("ingest"))
+	app.Use("/enroll", limiter.Handler("ingest"))
+	for _, prefix := range []string{"/activity", "/ingest", "/import", "/admin"} {
+		app.Use(prefix, AuditWrites(audit))
+	}
+	health := NewHealth(db)
+	app.Get("/health", health.GetLive)
+	app.Get("/health/live", health.GetLive)
+	app.Get("/health/ready", health.GetReady)
+	app.Get("/statuses", handler.GetStatuses)
+	app.Get("/errors", GetErrorCodes)
+
+	// reads: self-scoped routes are the ones filtering on ?user=, open to
+	// self-view tokens pinned to their own user
+	adminAuth := RequireAdmin(tokens, tenants)
+	read, self := RequireReader(tokens, tenants, false), RequireReader(tokens, tenants, true)
+	app.Get("/activity/today", self, handler.GetToday)
+	app.Get("/activity/fleet", read, fleetHandler.GetFleet)
+	app.Get("/activity/compare", read, handler.GetCompare)
+	app.Get("/activity/heatmap", read, handler.GetHeatmap)
+	app.Get("/activity/scorecard", self, handler.GetScorecard)
+	app.Get("/activity/stats", read, handler.GetStats)
+	app.Get("/activity/breaks", self, handler.GetBreaks)
+	app.Get("/activity/focus", self, focusHandler.GetFocus)
+	app.Get("/activity/categories", self, handler.GetCategories)
+	app.Get("/activity/domains", self, handler.GetDomains)
+	app.Post("/activity/query", read, handler.PostQuery)
+	app.Get("/activity/rollups", read, sampleHandler.GetRollups)
+	app.Get("/activity/live", read, liveHandler.GetLive)
+	app.Get("/activity/now", read, agentHandler.GetNow)
+	app.Get("/activity/titles", adminAuth, titleHandler.GetTitles)
+	app.Get("/activity/stream", read, liveHandler.GetStream)
+	app.Get("/agents", read, agentHandler.ListInventory)
+	app.Post("/activity/recompute", adminAuth, recomputeHandler.PostRecompute)
+	app.Patch("/activity/:hour_start", adminAuth, correctionHandler.PatchRow)
+	app.Delete("/activity/:hour_start", adminAuth, correctionHandler.DeleteRow)
+	app.Get("/export/archive", read, exportHandler.GetArchive)
+	app.Post("/import", adminAuth, importHandler.PostImport)
+	graphqlHandler := NewGraphQLHandler(repo)
+	app.Get("/graphql", read, graphqlHandler)
+	app.Post("/graphql", read, graphqlHandler)
+	app.Get("/audit", adminAuth, auditHandler.GetAudit)
+	app.Delete("/users/:user/data", adminAuth, erasureHandler.DeleteUserData)
+
+	// monitored users' own view, through a self-view token
+	me := app.Group("/me", limiter.Handler("query"), self)
+	me.Get("/activity", meHandler.GetActivity)
+	me.Get("/collection-policy", meHandler.GetCollectionPolicy)
+	me.Post("/consent", meHandler.PostConsent)
+
+	app.Post("/enroll", enrollHandler.PostEnroll)
+	ingest := app.Group("/ingest", RequireIngestToken(enrollments, tokens, tenants))
+	ingest.Post("/hourly", ingestHandler.PostHourly)
+	ingest.Post("/samples", sampleHandler.PostSamples)
+
+	// agent control plane; heartbeats are not audited, they would drown
+	// the audit log. Middleware goes on each route because a "/agent"
+	// prefix would also match GET /agents.
+	agentLimit, agentAuth := limiter.Handler("ingest"), RequireIngestToken(enrollments, tokens, tenants)
+	agent := app.Group("/agent")
+	agent.Post("/heartbeat", agentLimit, agentAuth, agentHandler.PostHeartbeat)
+	agent.Get("/commands", agentLimit, agentAuth, commandHandler.PollCommands)
+	agent.Post("/commands/:id/result", agentLimit, agentAuth, commandHandler.PostResult)
+	app.Post("/logs", agentLimit, agentAuth, logHandler.PostLogs)
+
+	admin := app.Group("/admin", adminAuth)
+	admin.Get("/settings", adminHandler.ListSettings)
+	admin.Get("/settings/:key", adminHandler.GetSetting)
+	admin.Put("/settings/:key", adminHandler.PutSetting)
+	admin.Delete("/settings/:key", adminHandler.DeleteSetting)
+	admin.Get("/agents", agentHandler.ListAgents)
+	admin.Get("/ingest/sizes", GetBodySizes)
+	admin.Get("/db/queries", GetQueryStats)
+	admin.Put("/agents/:host/intervals", agentHandler.PutIntervals)
+	admin.Get("/agents/:host/signing-key", agentHandler.GetSigningKey)
+	admin.Get("/enrollments", enrollHandler.ListEnrollments)
+	admin.Delete("/enrollments/:agent_id", enrollHandler.DeleteEnrollment)
+	admin.Get("/tokens", tokenHandler.ListTokens)
+	admin.Post("/tokens", tokenHandler.PostToken)
+	admin.Delete("/tokens/:id", tokenHandler.DeleteToken)
+	admin.Get("/consents", meHandler.ListConsents)
+	admin.Get("/erasures", erasureHandler.ListErasures)
+	admin.Get("/erasures/:id", erasureHandler.GetErasure)
+	admin.Get("/agents/:host/commands", commandHandler.ListCommands)
+	admin.Post("/agents/:host/commands", commandHandler.PostCommand)
+	admin.Get("/agents/:host/logs", logHandler.GetLogs)
+	admin.Get("/profiles", profileHandler.ListProfiles)
+	admin.Get("/profiles/:user", profileHandler.GetProfile)
+	admin.Put("/profiles/:user", profileHandler.PutProfile)
+	admin.Delete("/profiles/:user", profileHandler.DeleteProfile)
+	admin.Get("/calendars", calendarHandler.ListCalendars)
+	admin.Put("/calendars/:user", calendarHandler.PutCalendar)
+	admin.Delete("/calendars/:user", calendarHandler.DeleteCalendar)
+	admin.Get("/timesheet/pushes", timesheetHandler.ListPushes)
+	admin.Post("/identities", identityHandler.PostIdentities)
+	admin.Post("/identities/reveal", identityHandler.PostReveal)
+	operator := RequireOperator()
+	admin.Get("/tenants", operator, tenantHandler.ListTenants)
+	admin.Post("/tenants", operator, tenantHandler.PostTenant)
+	admin.Get("/tenants/:id/enrollment-secret", operator, tenantHandler.GetEnrollmentSecret)
+	admin.Get("/alert-rules", adminHandler.ListAlertRules)
+	admin.Post("/alert-rules", adminHandler.CreateAlertRule)
+	admin.Post("/alert-rules/backtest", adminHandler.BacktestAlertRule)
+	admin.Get("/alert-rules/:id", adminHandler.GetAlertRule)
+	admin.Put("/alert-rules/:id", adminHandler.UpdateAlertRule)
+	admin.Delete("/alert-rules/:id", adminHandler.DeleteAlertRule)
+
+	// Embedded dashboard for deployments without a separate frontend.
+	if os.Getenv("DASHBOARD") != "off" {
+		app.Use("/", Dashboard())
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	addr := listenAddr()
+	shutdownTimeout := 15 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid SHUTDOWN_TIMEOUT %q: %v", v, err)
+		}
+		shutdownTimeout = d
+	}
+	// time for load balancers to see /health/ready fail before the drain
+	shutdownDelay := envDuration("SHUTDOWN_DELAY", 0)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(addr)
+	}()
+
+	select {
+	case err := <-listenErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	// Drain: stop accepting, let in-flight requests finish, then flush
+	// background jobs before the database goes away.
+	health.Drain()
+	if shutdownDelay > 0 {
+		log.Printf("shutting down: not ready, waiting %s", shutdownDelay)
+		time.Sleep(shutdownDelay)
+	}
+	log.Printf("shutting down (draining for up to %s)", shutdownTimeout)
+	live.Close() // end SSE streams, which would otherwise hold the drain open
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	jobs.Stop()
+	db.Close()
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := flushTraces(flushCtx); err != nil {
+		log.Printf("tracing: flush: %v", err)
 	}
-	log.Fatal(app.Listen(":" + port))
+	cancel()
+	log.Print("shutdown complete")
 }
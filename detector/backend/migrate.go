@@ -0,0 +1,1158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// migrations are applied in order and recorded in schema_migrations; append
+// new steps at the end and never edit one that has shipped.
+var migrations = []struct {
+	name  string
+	stmts []string
+}{
+	{
+		// Agents used to create activity_hourly by hand with only
+		// hour_start as key; bring it in line with the identity columns
+		// (host, user, display name, team, labels) so several machines can share it.
+		name: "activity_hourly_identity",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS activity_hourly (
+				hour_start   TEXT PRIMARY KEY,
+				activity_pct REAL,
+				idle_seconds REAL,
+				samples      INTEGER,
+				status       TEXT,
+				created_at   TEXT
+			)`,
+			`CREATE TABLE activity_hourly_new (
+				hour_start   TEXT NOT NULL,
+				host         TEXT NOT NULL DEFAULT '',
+				user_name    TEXT NOT NULL DEFAULT '',
+				display_name TEXT NOT NULL DEFAULT '',
+				team         TEXT NOT NULL DEFAULT '',
+				labels       TEXT NOT NULL DEFAULT '{}',
+				activity_pct REAL,
+				idle_seconds REAL,
+				samples      INTEGER,
+				status       TEXT,
+				created_at   TEXT,
+				PRIMARY KEY (hour_start, host)
+			)`,
+			`INSERT INTO activity_hourly_new (hour_start, activity_pct, idle_seconds, samples, status, created_at)
+			 SELECT hour_start, activity_pct, idle_seconds, samples, status, created_at FROM activity_hourly`,
+			`DROP TABLE activity_hourly`,
+			`ALTER TABLE activity_hourly_new RENAME TO activity_hourly`,
+			`CREATE INDEX IF NOT EXISTS idx_activity_hourly_host ON activity_hourly (host, hour_start)`,
+		},
+	},
+	{
+		name: "archive_runs",
+		stmts: []string{
+			`CREATE TABLE archive_runs (
+				month       TEXT PRIMARY KEY,
+				object_key  TEXT NOT NULL,
+				rows        INTEGER NOT NULL,
+				bytes       INTEGER NOT NULL,
+				pruned      INTEGER NOT NULL,
+				archived_at TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		name: "settings_and_alert_rules",
+		stmts: []string{
+			`CREATE TABLE settings (
+				key        TEXT PRIMARY KEY,
+				value      TEXT NOT NULL,
+				updated_at TEXT NOT NULL
+			)`,
+			`CREATE TABLE alert_rules (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				name       TEXT NOT NULL,
+				metric     TEXT NOT NULL,
+				op         TEXT NOT NULL,
+				threshold  REAL NOT NULL,
+				time_window TEXT NOT NULL,
+				host       TEXT NOT NULL DEFAULT '',
+				webhook    TEXT NOT NULL DEFAULT '',
+				enabled    INTEGER NOT NULL DEFAULT 1,
+				updated_at TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// rows written by older agents before statuses were validated
+		name: "normalize_legacy_statuses",
+		stmts: []string{
+			`UPDATE activity_hourly SET status = 'HIGH_PRODUCTION' WHERE status = 'HIGH_PRODUCTIVE'`,
+			`UPDATE activity_hourly SET status = 'ACTIVE' WHERE status = 'SIMPLE_PRODUCTIVE'`,
+			`UPDATE activity_hourly SET status = 'LOW' WHERE status = 'IDLE'`,
+		},
+	},
+	{
+		// one row per agent sample; ts is second-aligned UTC RFC3339
+		name: "activity_samples",
+		stmts: []string{
+			`CREATE TABLE activity_samples (
+				ts          TEXT NOT NULL,
+				host        TEXT NOT NULL,
+				user_name   TEXT NOT NULL DEFAULT '',
+				idle_ms     INTEGER NOT NULL,
+				interval_ms INTEGER NOT NULL,
+				PRIMARY KEY (host, ts)
+			)`,
+			`CREATE INDEX idx_activity_samples_ts ON activity_samples (ts)`,
+		},
+	},
+	{
+		// generated month partition keys: retention deletes and long
+		// scans prune whole months through the (month, host) indexes
+		// instead of walking hour_start/ts ranges. See partition.go.
+		name: "month_partition_keys",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN month TEXT GENERATED ALWAYS AS (substr(hour_start, 1, 7)) VIRTUAL`,
+			`CREATE INDEX idx_activity_hourly_month ON activity_hourly (month, host)`,
+			`ALTER TABLE activity_samples ADD COLUMN month TEXT GENERATED ALWAYS AS (substr(ts, 1, 7)) VIRTUAL`,
+			`CREATE INDEX idx_activity_samples_month ON activity_samples (month, host)`,
+		},
+	},
+	{
+		// per-day roll-up of activity_hourly, filled by the retention job
+		// before it drops expired hourly rows
+		name: "activity_daily",
+		stmts: []string{
+			`CREATE TABLE activity_daily (
+				day          TEXT NOT NULL,
+				host         TEXT NOT NULL,
+				user_name    TEXT NOT NULL DEFAULT '',
+				activity_pct REAL NOT NULL,
+				idle_seconds REAL NOT NULL,
+				samples      INTEGER NOT NULL,
+				hours        INTEGER NOT NULL,
+				month        TEXT GENERATED ALWAYS AS (substr(day, 1, 7)) VIRTUAL,
+				PRIMARY KEY (day, host)
+			)`,
+			`CREATE INDEX idx_activity_daily_month ON activity_daily (month, host)`,
+		},
+	},
+	{
+		// admin corrections: free-text note, tombstones instead of hard
+		// deletes, and who changed what
+		name: "corrections_and_audit",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN note TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE activity_hourly ADD COLUMN deleted_at TEXT`,
+			`CREATE TABLE audit_log (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				at          TEXT NOT NULL,
+				actor       TEXT NOT NULL,
+				action      TEXT NOT NULL,
+				target      TEXT NOT NULL,
+				before_json TEXT NOT NULL DEFAULT '',
+				after_json  TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_audit_log_at ON audit_log (at)`,
+		},
+	},
+	{
+		name: "alert_rule_expr",
+		stmts: []string{
+			`ALTER TABLE alert_rules ADD COLUMN expr TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		name: "audit_payload_hash",
+		stmts: []string{
+			`ALTER TABLE audit_log ADD COLUMN payload_hash TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE audit_log ADD COLUMN request_id TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX idx_audit_log_actor ON audit_log (actor, id)`,
+			`CREATE INDEX idx_audit_log_action ON audit_log (action, id)`,
+		},
+	},
+	{
+		name: "user_profiles",
+		stmts: []string{
+			`CREATE TABLE user_profiles (
+				user_name  TEXT PRIMARY KEY,
+				start_time TEXT NOT NULL,
+				end_time   TEXT NOT NULL,
+				weekdays   TEXT NOT NULL DEFAULT '[]',
+				tz         TEXT NOT NULL DEFAULT 'UTC',
+				updated_at TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// one row per agent, refreshed by every heartbeat
+		name: "agents",
+		stmts: []string{
+			`CREATE TABLE agents (
+				host             TEXT PRIMARY KEY,
+				user_name        TEXT NOT NULL DEFAULT '',
+				agent_version    TEXT NOT NULL DEFAULT '',
+				protocol_version INTEGER NOT NULL DEFAULT 0,
+				os               TEXT NOT NULL DEFAULT '',
+				remote_addr      TEXT NOT NULL DEFAULT '',
+				first_seen       TEXT NOT NULL,
+				last_seen        TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// per-agent overrides of the agent_intervals setting; '' falls
+		// back to the global value
+		name: "agent_intervals",
+		stmts: []string{
+			`ALTER TABLE agents ADD COLUMN heartbeat_interval TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE agents ADD COLUMN config_poll_interval TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// agent footprint as of its last heartbeat
+		name: "agent_resources",
+		stmts: []string{
+			`ALTER TABLE agents ADD COLUMN cpu_seconds REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE agents ADD COLUMN rss_bytes INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE agents ADD COLUMN goroutines INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE agents ADD COLUMN uptime_seconds REAL NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// power source per bucket; battery_pct is NULL on machines
+		// without a battery
+		name: "activity_power",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN battery_seconds REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE activity_hourly ADD COLUMN battery_pct INTEGER`,
+		},
+	},
+	{
+		// active seconds per display, JSON keyed by device name
+		name: "activity_monitors",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN monitor_seconds TEXT NOT NULL DEFAULT '{}'`,
+		},
+	},
+	{
+		// raw input counts per bucket: clicks and wheel notches, key
+		// presses, touch contacts
+		name: "activity_input_sources",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN mouse_events INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE activity_hourly ADD COLUMN key_events INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE activity_hourly ADD COLUMN touch_events INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// pseudonym -> clear name, for admin de-anonymization only
+		name: "identity_map",
+		stmts: []string{
+			`CREATE TABLE identity_map (
+				pseudonym  TEXT PRIMARY KEY,
+				kind       TEXT NOT NULL,
+				value      TEXT NOT NULL,
+				created_at TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// hours in which each agent sent at least one heartbeat; the
+		// gap-fill job tells NO_DATA from AGENT_DOWN with it
+		name: "agent_heartbeat_hours",
+		stmts: []string{
+			`CREATE TABLE agent_heartbeat_hours (
+				host       TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				PRIMARY KEY (host, hour_start)
+			)`,
+		},
+	},
+	{
+		// hour_start in the agent's configured zone, with its offset, for
+		// reports that must show local hours; hour_start stays the UTC key
+		name: "activity_local_hour",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN local_hour TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// agent's EWMA activity score at the end of the hour; NULL from
+		// agents that predate it or have it off
+		name: "activity_ewma",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN ewma_pct REAL`,
+		},
+	},
+	{
+		// build metadata reported in heartbeats, next to agent_version
+		name: "agent_build",
+		stmts: []string{
+			`ALTER TABLE agents ADD COLUMN agent_commit TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE agents ADD COLUMN agent_build_date TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// admin-issued commands waiting for (or answered by) an agent's
+		// long poll; '' timestamps mean not yet
+		name: "agent_commands",
+		stmts: []string{
+			`CREATE TABLE agent_commands (
+				id           INTEGER PRIMARY KEY AUTOINCREMENT,
+				host         TEXT NOT NULL,
+				command      TEXT NOT NULL,
+				created_at   TEXT NOT NULL,
+				delivered_at TEXT NOT NULL DEFAULT '',
+				done_at      TEXT NOT NULL DEFAULT '',
+				result       TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_agent_commands_host ON agent_commands (host, delivered_at)`,
+		},
+	},
+	{
+		// agent log lines shipped to POST /logs, pruned by the retention
+		// job after AGENT_LOG_RETENTION
+		name: "agent_logs",
+		stmts: []string{
+			`CREATE TABLE agent_logs (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				host        TEXT NOT NULL,
+				line        TEXT NOT NULL,
+				received_at TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_agent_logs_host ON agent_logs (host, id)`,
+			`CREATE INDEX idx_agent_logs_received ON agent_logs (received_at)`,
+		},
+	},
+	{
+		// foreground window titles sampled by agents with WindowTitles
+		// on, already redacted agent-side; pruned with the raw samples
+		name: "window_titles",
+		stmts: []string{
+			`CREATE TABLE window_titles (
+				host       TEXT NOT NULL,
+				sampled_at TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				title      TEXT NOT NULL,
+				process    TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (host, sampled_at)
+			)`,
+			`CREATE INDEX idx_window_titles_hour ON window_titles (hour_start, host)`,
+		},
+	},
+	{
+		// per-user calendar links and the accepted meetings synced from
+		// them, which turn LOW hours into IN_MEETING
+		name: "calendar",
+		stmts: []string{
+			`CREATE TABLE calendar_accounts (
+				user_name     TEXT PRIMARY KEY,
+				provider      TEXT NOT NULL,
+				calendar_id   TEXT NOT NULL DEFAULT '',
+				refresh_token TEXT NOT NULL,
+				synced_at     TEXT NOT NULL DEFAULT '',
+				last_error    TEXT NOT NULL DEFAULT '',
+				updated_at    TEXT NOT NULL
+			)`,
+			`CREATE TABLE calendar_meetings (
+				user_name TEXT NOT NULL,
+				event_id  TEXT NOT NULL,
+				start_at  TEXT NOT NULL,
+				end_at    TEXT NOT NULL,
+				PRIMARY KEY (user_name, event_id)
+			)`,
+			`CREATE INDEX idx_calendar_meetings_start ON calendar_meetings (user_name, start_at)`,
+		},
+	},
+	{
+		// one row per connector and user-day pushed to a timesheet
+		// system; error is empty once the push went through
+		name: "timesheet_pushes",
+		stmts: []string{
+			`CREATE TABLE timesheet_pushes (
+				connector TEXT NOT NULL,
+				user_name TEXT NOT NULL,
+				day       TEXT NOT NULL,
+				pushed_at TEXT NOT NULL,
+				error     TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (connector, user_name, day)
+			)`,
+		},
+	},
+	{
+		// idempotency keys of recently ingested hourly rows, so a retried
+		// upload is not written twice (see IngestKeyRepo)
+		name: "ingest_keys",
+		stmts: []string{
+			`CREATE TABLE ingest_keys (
+				key     TEXT PRIMARY KEY,
+				seen_at TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_ingest_keys_seen ON ingest_keys (seen_at)`,
+		},
+	},
+	{
+		// time the agent measured in degraded mode (cursor movement only)
+		name: "activity_degraded",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN degraded_seconds REAL NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// active foreground seconds per application category, JSON
+		name: "activity_categories",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN category_seconds TEXT NOT NULL DEFAULT '{}'`,
+		},
+	},
+	{
+		// active browser seconds per web domain, JSON
+		name: "activity_domains",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN domain_seconds TEXT NOT NULL DEFAULT '{}'`,
+		},
+	},
+	{
+		// 5-minute, hourly and daily roll-ups of activity_samples, kept
+		// current by the rollup job from the host-hours marked dirty on
+		// ingest. idle_seconds maps each rollupThresholds entry (seconds)
+		// to the idle time counted under it. Samples already stored are
+		// marked so the first run rolls them up.
+		name: "sample_rollups",
+		stmts: []string{
+			`CREATE TABLE sample_rollup_5m (
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (bucket_start, host)
+			)`,
+			`CREATE INDEX idx_sample_rollup_5m_month ON sample_rollup_5m (month, host)`,
+			`CREATE TABLE sample_rollup_hourly (
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (bucket_start, host)
+			)`,
+			`CREATE INDEX idx_sample_rollup_hourly_month ON sample_rollup_hourly (month, host)`,
+			`CREATE TABLE sample_rollup_daily (
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (bucket_start, host)
+			)`,
+			`CREATE INDEX idx_sample_rollup_daily_month ON sample_rollup_daily (month, host)`,
+			`CREATE TABLE sample_rollup_dirty (
+				host       TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				marked_at  INTEGER NOT NULL, -- unix nanoseconds
+				PRIMARY KEY (host, hour_start)
+			)`,
+			`INSERT INTO sample_rollup_dirty (host, hour_start, marked_at)
+			 SELECT DISTINCT host, substr(ts, 1, 13) || ':00:00Z', 0 FROM activity_samples`,
+		},
+	},
+	{
+		// first and last keyboard/mouse input within the hour, RFC3339;
+		// empty without input or from older agents
+		name: "activity_input_span",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN first_input TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE activity_hourly ADD COLUMN last_input TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// idle periods of break length (5-60 min by default) that ended in
+		// the hour, and their total duration
+		name: "activity_breaks",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN breaks INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE activity_hourly ADD COLUMN break_seconds REAL NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// sustained single-application work detected by agents with
+		// FocusSessions on; pruned with the hourly rows
+		name: "focus_sessions",
+		stmts: []string{
+			`CREATE TABLE focus_sessions (
+				host         TEXT NOT NULL,
+				user_name    TEXT NOT NULL DEFAULT '',
+				started_at   TEXT NOT NULL,
+				ended_at     TEXT NOT NULL,
+				app          TEXT NOT NULL DEFAULT '',
+				activity_pct REAL NOT NULL,
+				PRIMARY KEY (host, started_at)
+			)`,
+			`CREATE INDEX idx_focus_sessions_start ON focus_sessions (started_at, host)`,
+		},
+	},
+	{
+		// shared workstations: agents split an hour between the users
+		// logged on to the console, so the user joins the key
+		name: "activity_hourly_per_user",
+		stmts: []string{
+			`CREATE TABLE activity_hourly_new (
+				hour_start       TEXT NOT NULL,
+				host             TEXT NOT NULL DEFAULT '',
+				user_name        TEXT NOT NULL DEFAULT '',
+				display_name     TEXT NOT NULL DEFAULT '',
+				team             TEXT NOT NULL DEFAULT '',
+				labels           TEXT NOT NULL DEFAULT '{}',
+				activity_pct     REAL,
+				idle_seconds     REAL,
+				samples          INTEGER,
+				status           TEXT,
+				created_at       TEXT,
+				month            TEXT GENERATED ALWAYS AS (substr(hour_start, 1, 7)) VIRTUAL,
+				note             TEXT NOT NULL DEFAULT '',
+				deleted_at       TEXT,
+				battery_seconds  REAL NOT NULL DEFAULT 0,
+				battery_pct      INTEGER,
+				monitor_seconds  TEXT NOT NULL DEFAULT '{}',
+				mouse_events     INTEGER NOT NULL DEFAULT 0,
+				key_events       INTEGER NOT NULL DEFAULT 0,
+				touch_events     INTEGER NOT NULL DEFAULT 0,
+				local_hour       TEXT NOT NULL DEFAULT '',
+				ewma_pct         REAL,
+				degraded_seconds REAL NOT NULL DEFAULT 0,
+				category_seconds TEXT NOT NULL DEFAULT '{}',
+				domain_seconds   TEXT NOT NULL DEFAULT '{}',
+				first_input      TEXT NOT NULL DEFAULT '',
+				last_input       TEXT NOT NULL DEFAULT '',
+				breaks           INTEGER NOT NULL DEFAULT 0,
+				break_seconds    REAL NOT NULL DEFAULT 0,
+				PRIMARY KEY (hour_start, host, user_name)
+			)`,
+			`INSERT INTO activity_hourly_new
+			        (hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at,
+			         note, deleted_at, battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour,
+			         ewma_pct, degraded_seconds, category_seconds, domain_seconds, first_input, last_input, breaks, break_seconds)
+			 SELECT hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at,
+			        note, deleted_at, battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour,
+			        ewma_pct, degraded_seconds, category_seconds, domain_seconds, first_input, last_input, breaks, break_seconds
+			 FROM activity_hourly`,
+			`DROP TABLE activity_hourly`,
+			`ALTER TABLE activity_hourly_new RENAME TO activity_hourly`,
+			`CREATE INDEX idx_activity_hourly_host ON activity_hourly (host, hour_start)`,
+			`CREATE INDEX idx_activity_hourly_month ON activity_hourly (month, host)`,
+		},
+	},
+	{
+		// the user's latest input and windowed mode from each heartbeat,
+		// see GET /activity/now
+		name: "agent_presence",
+		stmts: []string{
+			`ALTER TABLE agents ADD COLUMN last_input TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE agents ADD COLUMN mode TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// HMAC signature of each row from agents with a SigningKey, and
+		// whether it matched; see signing.go
+		name: "activity_signatures",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN signature TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE activity_hourly ADD COLUMN signature_status TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// the agent's verdict on jiggler-like input in the hour
+		name: "activity_synthetic_input",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN suspected_synthetic INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE activity_hourly ADD COLUMN synthetic_confidence REAL NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// per-agent tokens handed out by POST /enroll, stored hashed
+		name: "agent_enrollments",
+		stmts: []string{
+			`CREATE TABLE agent_enrollments (
+				agent_id    TEXT PRIMARY KEY,
+				host        TEXT NOT NULL,
+				token_hash  TEXT NOT NULL UNIQUE,
+				remote_addr TEXT NOT NULL DEFAULT '',
+				created_at  TEXT NOT NULL,
+				revoked_at  TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_agent_enrollments_host ON agent_enrollments (host)`,
+		},
+	},
+	{
+		// role-bearing API tokens issued through POST /admin/tokens
+		name: "api_tokens",
+		stmts: []string{
+			`CREATE TABLE api_tokens (
+				id         TEXT PRIMARY KEY,
+				token_hash TEXT NOT NULL UNIQUE,
+				role       TEXT NOT NULL,
+				user_name  TEXT NOT NULL DEFAULT '',
+				label      TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL,
+				revoked_at TEXT NOT NULL DEFAULT ''
+			)`,
+		},
+	},
+	{
+		// each user's answer to each version of the collection policy
+		name: "user_consents",
+		stmts: []string{
+			`CREATE TABLE user_consents (
+				user_name      TEXT NOT NULL,
+				policy_version TEXT NOT NULL,
+				granted        INTEGER NOT NULL,
+				at             TEXT NOT NULL,
+				remote_addr    TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (user_name, policy_version)
+			)`,
+		},
+	},
+	{
+		// DELETE /users/:user/data requests, run by the erasure job
+		name: "erasure_jobs",
+		stmts: []string{
+			`CREATE TABLE erasure_jobs (
+				id           TEXT PRIMARY KEY,
+				user_name    TEXT NOT NULL,
+				mode         TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				requested_by TEXT NOT NULL,
+				request_id   TEXT NOT NULL DEFAULT '',
+				created_at   TEXT NOT NULL,
+				started_at   TEXT NOT NULL DEFAULT '',
+				finished_at  TEXT NOT NULL DEFAULT '',
+				error        TEXT NOT NULL DEFAULT '',
+				rows_json    TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_erasure_jobs_status ON erasure_jobs (status, created_at)`,
+		},
+	},
+	{
+		// several subsidiaries on one backend, see tenant.go. Tables keyed
+		// by user, setting or month get the tenant in their key; host-keyed
+		// tables only gain the column here and are rebuilt with the tenant
+		// in their key by tenant_keys, below.
+		name: "tenants",
+		stmts: []string{
+			`CREATE TABLE tenants (
+				id         TEXT PRIMARY KEY,
+				name       TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL
+			)`,
+			`INSERT INTO tenants (id, name, created_at) VALUES ('default', 'Default', strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))`,
+			`ALTER TABLE activity_hourly ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE activity_daily ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE activity_samples ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE sample_rollup_5m ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE sample_rollup_hourly ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE sample_rollup_daily ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE focus_sessions ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE window_titles ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE agents ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE agent_heartbeat_hours ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE agent_commands ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE agent_logs ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE agent_enrollments ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE alert_rules ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE audit_log ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE api_tokens ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE erasure_jobs ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`CREATE INDEX idx_activity_hourly_tenant ON activity_hourly (tenant, month, host)`,
+			`CREATE INDEX idx_audit_log_tenant ON audit_log (tenant, id)`,
+			`CREATE TABLE settings_new (
+				tenant     TEXT NOT NULL DEFAULT 'default',
+				key        TEXT NOT NULL,
+				value      TEXT NOT NULL,
+				updated_at TEXT NOT NULL,
+				PRIMARY KEY (tenant, key)
+			)`,
+			`INSERT INTO settings_new (key, value, updated_at) SELECT key, value, updated_at FROM settings`,
+			`DROP TABLE settings`,
+			`ALTER TABLE settings_new RENAME TO settings`,
+			`CREATE TABLE user_profiles_new (
+				tenant     TEXT NOT NULL DEFAULT 'default',
+				user_name  TEXT NOT NULL,
+				start_time TEXT NOT NULL,
+				end_time   TEXT NOT NULL,
+				weekdays   TEXT NOT NULL DEFAULT '[]',
+				tz         TEXT NOT NULL DEFAULT 'UTC',
+				updated_at TEXT NOT NULL,
+				PRIMARY KEY (tenant, user_name)
+			)`,
+			`INSERT INTO user_profiles_new (user_name, start_time, end_time, weekdays, tz, updated_at)
+			 SELECT user_name, start_time, end_time, weekdays, tz, updated_at FROM user_profiles`,
+			`DROP TABLE user_profiles`,
+			`ALTER TABLE user_profiles_new RENAME TO user_profiles`,
+			`CREATE TABLE calendar_accounts_new (
+				tenant        TEXT NOT NULL DEFAULT 'default',
+				user_name     TEXT NOT NULL,
+				provider      TEXT NOT NULL,
+				calendar_id   TEXT NOT NULL DEFAULT '',
+				refresh_token TEXT NOT NULL,
+				synced_at     TEXT NOT NULL DEFAULT '',
+				last_error    TEXT NOT NULL DEFAULT '',
+				updated_at    TEXT NOT NULL,
+				PRIMARY KEY (tenant, user_name)
+			)`,
+			`INSERT INTO calendar_accounts_new (user_name, provider, calendar_id, refresh_token, synced_at, last_error, updated_at)
+			 SELECT user_name, provider, calendar_id, refresh_token, synced_at, last_error, updated_at FROM calendar_accounts`,
+			`DROP TABLE calendar_accounts`,
+			`ALTER TABLE calendar_accounts_new RENAME TO calendar_accounts`,
+			`CREATE TABLE calendar_meetings_new (
+				tenant    TEXT NOT NULL DEFAULT 'default',
+				user_name TEXT NOT NULL,
+				event_id  TEXT NOT NULL,
+				start_at  TEXT NOT NULL,
+				end_at    TEXT NOT NULL,
+				PRIMARY KEY (tenant, user_name, event_id)
+			)`,
+			`INSERT INTO calendar_meetings_new (user_name, event_id, start_at, end_at)
+			 SELECT user_name, event_id, start_at, end_at FROM calendar_meetings`,
+			`DROP TABLE calendar_meetings`,
+			`ALTER TABLE calendar_meetings_new RENAME TO calendar_meetings`,
+			`CREATE INDEX idx_calendar_meetings_start ON calendar_meetings (tenant, user_name, start_at)`,
+			`CREATE TABLE timesheet_pushes_new (
+				tenant    TEXT NOT NULL DEFAULT 'default',
+				connector TEXT NOT NULL,
+				user_name TEXT NOT NULL,
+				day       TEXT NOT NULL,
+				pushed_at TEXT NOT NULL,
+				error     TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (tenant, connector, user_name, day)
+			)`,
+			`INSERT INTO timesheet_pushes_new (connector, user_name, day, pushed_at, error)
+			 SELECT connector, user_name, day, pushed_at, error FROM timesheet_pushes`,
+			`DROP TABLE timesheet_pushes`,
+			`ALTER TABLE timesheet_pushes_new RENAME TO timesheet_pushes`,
+			`CREATE TABLE user_consents_new (
+				tenant         TEXT NOT NULL DEFAULT 'default',
+				user_name      TEXT NOT NULL,
+				policy_version TEXT NOT NULL,
+				granted        INTEGER NOT NULL,
+				at             TEXT NOT NULL,
+				remote_addr    TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (tenant, user_name, policy_version)
+			)`,
+			`INSERT INTO user_consents_new (user_name, policy_version, granted, at, remote_addr)
+			 SELECT user_name, policy_version, granted, at, remote_addr FROM user_consents`,
+			`DROP TABLE user_consents`,
+			`ALTER TABLE user_consents_new RENAME TO user_consents`,
+			`CREATE TABLE identity_map_new (
+				tenant     TEXT NOT NULL DEFAULT 'default',
+				pseudonym  TEXT NOT NULL,
+				kind       TEXT NOT NULL,
+				value      TEXT NOT NULL,
+				created_at TEXT NOT NULL,
+				PRIMARY KEY (tenant, pseudonym)
+			)`,
+			`INSERT INTO identity_map_new (pseudonym, kind, value, created_at)
+			 SELECT pseudonym, kind, value, created_at FROM identity_map`,
+			`DROP TABLE identity_map`,
+			`ALTER TABLE identity_map_new RENAME TO identity_map`,
+			`CREATE TABLE archive_runs_new (
+				tenant      TEXT NOT NULL DEFAULT 'default',
+				month       TEXT NOT NULL,
+				object_key  TEXT NOT NULL,
+				rows        INTEGER NOT NULL,
+				bytes       INTEGER NOT NULL,
+				pruned      INTEGER NOT NULL,
+				archived_at TEXT NOT NULL,
+				PRIMARY KEY (tenant, month)
+			)`,
+			`INSERT INTO archive_runs_new (month, object_key, rows, bytes, pruned, archived_at)
+			 SELECT month, object_key, rows, bytes, pruned, archived_at FROM archive_runs`,
+			`DROP TABLE archive_runs`,
+			`ALTER TABLE archive_runs_new RENAME TO archive_runs`,
+		},
+	},
+	{
+		// the tenant each host belonged to, claimed by its first write;
+		// dropped by tenant_keys
+		name: "host_tenants",
+		stmts: []string{
+			`CREATE TABLE host_tenants (
+				host       TEXT PRIMARY KEY,
+				tenant     TEXT NOT NULL,
+				claimed_at TEXT NOT NULL
+			)`,
+			`INSERT OR IGNORE INTO host_tenants (host, tenant, claimed_at)
+			 SELECT host, tenant, first_seen FROM agents`,
+			`INSERT OR IGNORE INTO host_tenants (host, tenant, claimed_at)
+			 SELECT host, MIN(tenant), MIN(hour_start) FROM activity_hourly GROUP BY host`,
+		},
+	},
+	{
+		// roll-ups split per user like activity_hourly, so a shared
+		// workstation's hours can be recomputed user by user. Buckets
+		// rolled up per host keep their last user until the hours with
+		// raw samples left are rolled up again.
+		name: "sample_rollups_per_user",
+		stmts: []string{
+			`CREATE TABLE sample_rollup_5m_new (
+				tenant           TEXT NOT NULL DEFAULT 'default',
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (bucket_start, host, user_name)
+			)`,
+			`INSERT INTO sample_rollup_5m_new (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+			 SELECT tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds FROM sample_rollup_5m`,
+			`DROP TABLE sample_rollup_5m`,
+			`ALTER TABLE sample_rollup_5m_new RENAME TO sample_rollup_5m`,
+			`CREATE INDEX idx_sample_rollup_5m_month ON sample_rollup_5m (month, host)`,
+			`CREATE TABLE sample_rollup_hourly_new (
+				tenant           TEXT NOT NULL DEFAULT 'default',
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (bucket_start, host, user_name)
+			)`,
+			`INSERT INTO sample_rollup_hourly_new (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+			 SELECT tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds FROM sample_rollup_hourly`,
+			`DROP TABLE sample_rollup_hourly`,
+			`ALTER TABLE sample_rollup_hourly_new RENAME TO sample_rollup_hourly`,
+			`CREATE INDEX idx_sample_rollup_hourly_month ON sample_rollup_hourly (month, host)`,
+			`CREATE TABLE sample_rollup_daily_new (
+				tenant           TEXT NOT NULL DEFAULT 'default',
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (bucket_start, host, user_name)
+			)`,
+			`INSERT INTO sample_rollup_daily_new (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+			 SELECT tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds FROM sample_rollup_daily`,
+			`DROP TABLE sample_rollup_daily`,
+			`ALTER TABLE sample_rollup_daily_new RENAME TO sample_rollup_daily`,
+			`CREATE INDEX idx_sample_rollup_daily_month ON sample_rollup_daily (month, host)`,
+			`INSERT OR REPLACE INTO sample_rollup_dirty (host, hour_start, marked_at)
+			 SELECT DISTINCT host, substr(ts, 1, 13) || ':00:00Z', 0 FROM activity_samples`,
+		},
+	},
+	{
+		// an idle inhibitor was held during the hour, see ttyagent
+		name: "activity_media_inhibit",
+		stmts: []string{
+			`ALTER TABLE activity_hourly ADD COLUMN media_inhibit INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// daily roll-ups split per user like activity_hourly; days rolled
+		// up per host keep the user they were filed under
+		name: "activity_daily_per_user",
+		stmts: []string{
+			`CREATE TABLE activity_daily_new (
+				tenant       TEXT NOT NULL DEFAULT 'default',
+				day          TEXT NOT NULL,
+				host         TEXT NOT NULL,
+				user_name    TEXT NOT NULL DEFAULT '',
+				activity_pct REAL NOT NULL,
+				idle_seconds REAL NOT NULL,
+				samples      INTEGER NOT NULL,
+				hours        INTEGER NOT NULL,
+				month        TEXT GENERATED ALWAYS AS (substr(day, 1, 7)) VIRTUAL,
+				PRIMARY KEY (tenant, day, host, user_name)
+			)`,
+			`INSERT INTO activity_daily_new (tenant, day, host, user_name, activity_pct, idle_seconds, samples, hours)
+			 SELECT tenant, day, host, user_name, activity_pct, idle_seconds, samples, hours FROM activity_daily`,
+			`DROP TABLE activity_daily`,
+			`ALTER TABLE activity_daily_new RENAME TO activity_daily`,
+			`CREATE INDEX idx_activity_daily_month ON activity_daily (tenant, month, host)`,
+		},
+	},
+	{
+		// tenants own their host names: every host-keyed table gets the
+		// tenant in front of its key, so two tenants may each have a PC-001
+		// and no write of one can land on the other's row. This retires
+		// host_tenants. Pending roll-ups keep the tenant their host was
+		// claimed by; the idempotency keys of the last day are dropped, a
+		// retried upload being written again instead, which Upsert makes
+		// harmless.
+		name: "tenant_keys",
+		stmts: []string{
+			`CREATE TABLE activity_hourly_new (
+				tenant               TEXT NOT NULL DEFAULT 'default',
+				hour_start           TEXT NOT NULL,
+				host                 TEXT NOT NULL DEFAULT '',
+				user_name            TEXT NOT NULL DEFAULT '',
+				display_name         TEXT NOT NULL DEFAULT '',
+				team                 TEXT NOT NULL DEFAULT '',
+				labels               TEXT NOT NULL DEFAULT '{}',
+				activity_pct         REAL,
+				idle_seconds         REAL,
+				samples              INTEGER,
+				status               TEXT,
+				created_at           TEXT,
+				month                TEXT GENERATED ALWAYS AS (substr(hour_start, 1, 7)) VIRTUAL,
+				note                 TEXT NOT NULL DEFAULT '',
+				deleted_at           TEXT,
+				battery_seconds      REAL NOT NULL DEFAULT 0,
+				battery_pct          INTEGER,
+				monitor_seconds      TEXT NOT NULL DEFAULT '{}',
+				mouse_events         INTEGER NOT NULL DEFAULT 0,
+				key_events           INTEGER NOT NULL DEFAULT 0,
+				touch_events         INTEGER NOT NULL DEFAULT 0,
+				local_hour           TEXT NOT NULL DEFAULT '',
+				ewma_pct             REAL,
+				degraded_seconds     REAL NOT NULL DEFAULT 0,
+				category_seconds     TEXT NOT NULL DEFAULT '{}',
+				domain_seconds       TEXT NOT NULL DEFAULT '{}',
+				first_input          TEXT NOT NULL DEFAULT '',
+				last_input           TEXT NOT NULL DEFAULT '',
+				breaks               INTEGER NOT NULL DEFAULT 0,
+				break_seconds        REAL NOT NULL DEFAULT 0,
+				signature            TEXT NOT NULL DEFAULT '',
+				signature_status     TEXT NOT NULL DEFAULT '',
+				suspected_synthetic  INTEGER NOT NULL DEFAULT 0,
+				synthetic_confidence REAL NOT NULL DEFAULT 0,
+				media_inhibit        INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (tenant, hour_start, host, user_name)
+			)`,
+			`INSERT INTO activity_hourly_new
+			        (tenant, hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at,
+			         note, deleted_at, battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour,
+			         ewma_pct, degraded_seconds, category_seconds, domain_seconds, first_input, last_input, breaks, break_seconds,
+			         signature, signature_status, suspected_synthetic, synthetic_confidence, media_inhibit)
+			 SELECT tenant, hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at,
+			         note, deleted_at, battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour,
+			         ewma_pct, degraded_seconds, category_seconds, domain_seconds, first_input, last_input, breaks, break_seconds,
+			         signature, signature_status, suspected_synthetic, synthetic_confidence, media_inhibit
+			 FROM activity_hourly`,
+			`DROP TABLE activity_hourly`,
+			`ALTER TABLE activity_hourly_new RENAME TO activity_hourly`,
+			`CREATE INDEX idx_activity_hourly_host ON activity_hourly (tenant, host, hour_start)`,
+			`CREATE INDEX idx_activity_hourly_month ON activity_hourly (tenant, month, host)`,
+			`CREATE TABLE activity_samples_new (
+				tenant      TEXT NOT NULL DEFAULT 'default',
+				ts          TEXT NOT NULL,
+				host        TEXT NOT NULL,
+				user_name   TEXT NOT NULL DEFAULT '',
+				idle_ms     INTEGER NOT NULL,
+				interval_ms INTEGER NOT NULL,
+				month       TEXT GENERATED ALWAYS AS (substr(ts, 1, 7)) VIRTUAL,
+				PRIMARY KEY (tenant, host, ts)
+			)`,
+			`INSERT INTO activity_samples_new (tenant, ts, host, user_name, idle_ms, interval_ms)
+			 SELECT tenant, ts, host, user_name, idle_ms, interval_ms FROM activity_samples`,
+			`DROP TABLE activity_samples`,
+			`ALTER TABLE activity_samples_new RENAME TO activity_samples`,
+			`CREATE INDEX idx_activity_samples_ts ON activity_samples (tenant, ts)`,
+			`CREATE INDEX idx_activity_samples_month ON activity_samples (tenant, month, host)`,
+			`CREATE TABLE sample_rollup_5m_new (
+				tenant           TEXT NOT NULL DEFAULT 'default',
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (tenant, bucket_start, host, user_name)
+			)`,
+			`INSERT INTO sample_rollup_5m_new (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+			 SELECT tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds FROM sample_rollup_5m`,
+			`DROP TABLE sample_rollup_5m`,
+			`ALTER TABLE sample_rollup_5m_new RENAME TO sample_rollup_5m`,
+			`CREATE INDEX idx_sample_rollup_5m_month ON sample_rollup_5m (tenant, month, host)`,
+			`CREATE TABLE sample_rollup_hourly_new (
+				tenant           TEXT NOT NULL DEFAULT 'default',
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (tenant, bucket_start, host, user_name)
+			)`,
+			`INSERT INTO sample_rollup_hourly_new (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+			 SELECT tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds FROM sample_rollup_hourly`,
+			`DROP TABLE sample_rollup_hourly`,
+			`ALTER TABLE sample_rollup_hourly_new RENAME TO sample_rollup_hourly`,
+			`CREATE INDEX idx_sample_rollup_hourly_month ON sample_rollup_hourly (tenant, month, host)`,
+			`CREATE TABLE sample_rollup_daily_new (
+				tenant           TEXT NOT NULL DEFAULT 'default',
+				bucket_start     TEXT NOT NULL,
+				host             TEXT NOT NULL,
+				user_name        TEXT NOT NULL DEFAULT '',
+				samples          INTEGER NOT NULL,
+				measured_seconds REAL NOT NULL,
+				idle_seconds     TEXT NOT NULL DEFAULT '{}',
+				month            TEXT GENERATED ALWAYS AS (substr(bucket_start, 1, 7)) VIRTUAL,
+				PRIMARY KEY (tenant, bucket_start, host, user_name)
+			)`,
+			`INSERT INTO sample_rollup_daily_new (tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds)
+			 SELECT tenant, bucket_start, host, user_name, samples, measured_seconds, idle_seconds FROM sample_rollup_daily`,
+			`DROP TABLE sample_rollup_daily`,
+			`ALTER TABLE sample_rollup_daily_new RENAME TO sample_rollup_daily`,
+			`CREATE INDEX idx_sample_rollup_daily_month ON sample_rollup_daily (tenant, month, host)`,
+			`CREATE TABLE sample_rollup_dirty_new (
+				tenant     TEXT NOT NULL DEFAULT 'default',
+				host       TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				marked_at  INTEGER NOT NULL, -- unix nanoseconds
+				PRIMARY KEY (tenant, host, hour_start)
+			)`,
+			`INSERT INTO sample_rollup_dirty_new (tenant, host, hour_start, marked_at)
+			 SELECT COALESCE((SELECT tenant FROM host_tenants t WHERE t.host = d.host), 'default'), host, hour_start, marked_at
+			 FROM sample_rollup_dirty d`,
+			`DROP TABLE sample_rollup_dirty`,
+			`ALTER TABLE sample_rollup_dirty_new RENAME TO sample_rollup_dirty`,
+			`DROP TABLE ingest_keys`,
+			`CREATE TABLE ingest_keys (
+				tenant  TEXT NOT NULL DEFAULT 'default',
+				key     TEXT NOT NULL,
+				seen_at TEXT NOT NULL,
+				PRIMARY KEY (tenant, key)
+			)`,
+			`CREATE INDEX idx_ingest_keys_seen ON ingest_keys (seen_at)`,
+			`CREATE TABLE agents_new (
+				tenant               TEXT NOT NULL DEFAULT 'default',
+				host                 TEXT NOT NULL,
+				user_name            TEXT NOT NULL DEFAULT '',
+				agent_version        TEXT NOT NULL DEFAULT '',
+				protocol_version     INTEGER NOT NULL DEFAULT 0,
+				os                   TEXT NOT NULL DEFAULT '',
+				remote_addr          TEXT NOT NULL DEFAULT '',
+				first_seen           TEXT NOT NULL,
+				last_seen            TEXT NOT NULL,
+				heartbeat_interval   TEXT NOT NULL DEFAULT '',
+				config_poll_interval TEXT NOT NULL DEFAULT '',
+				cpu_seconds          REAL NOT NULL DEFAULT 0,
+				rss_bytes            INTEGER NOT NULL DEFAULT 0,
+				goroutines           INTEGER NOT NULL DEFAULT 0,
+				uptime_seconds       REAL NOT NULL DEFAULT 0,
+				agent_commit         TEXT NOT NULL DEFAULT '',
+				agent_build_date     TEXT NOT NULL DEFAULT '',
+				last_input           TEXT NOT NULL DEFAULT '',
+				mode                 TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (tenant, host)
+			)`,
+			`INSERT INTO agents_new
+			        (tenant, host, user_name, agent_version, protocol_version, os, remote_addr, first_seen, last_seen,
+			         heartbeat_interval, config_poll_interval, cpu_seconds, rss_bytes, goroutines, uptime_seconds,
+			         agent_commit, agent_build_date, last_input, mode)
+			 SELECT tenant, host, user_name, agent_version, protocol_version, os, remote_addr, first_seen, last_seen,
+			        heartbeat_interval, config_poll_interval, cpu_seconds, rss_bytes, goroutines, uptime_seconds,
+			        agent_commit, agent_build_date, last_input, mode
+			 FROM agents`,
+			`DROP TABLE agents`,
+			`ALTER TABLE agents_new RENAME TO agents`,
+			`CREATE TABLE agent_heartbeat_hours_new (
+				tenant     TEXT NOT NULL DEFAULT 'default',
+				host       TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				PRIMARY KEY (tenant, host, hour_start)
+			)`,
+			`INSERT INTO agent_heartbeat_hours_new (tenant, host, hour_start)
+			 SELECT tenant, host, hour_start FROM agent_heartbeat_hours`,
+			`DROP TABLE agent_heartbeat_hours`,
+			`ALTER TABLE agent_heartbeat_hours_new RENAME TO agent_heartbeat_hours`,
+			`CREATE TABLE focus_sessions_new (
+				tenant       TEXT NOT NULL DEFAULT 'default',
+				host         TEXT NOT NULL,
+				user_name    TEXT NOT NULL DEFAULT '',
+				started_at   TEXT NOT NULL,
+				ended_at     TEXT NOT NULL,
+				app          TEXT NOT NULL DEFAULT '',
+				activity_pct REAL NOT NULL,
+				PRIMARY KEY (tenant, host, started_at)
+			)`,
+			`INSERT INTO focus_sessions_new (tenant, host, user_name, started_at, ended_at, app, activity_pct)
+			 SELECT tenant, host, user_name, started_at, ended_at, app, activity_pct FROM focus_sessions`,
+			`DROP TABLE focus_sessions`,
+			`ALTER TABLE focus_sessions_new RENAME TO focus_sessions`,
+			`CREATE INDEX idx_focus_sessions_start ON focus_sessions (tenant, started_at, host)`,
+			`CREATE TABLE window_titles_new (
+				tenant     TEXT NOT NULL DEFAULT 'default',
+				host       TEXT NOT NULL,
+				sampled_at TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				title      TEXT NOT NULL,
+				process    TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (tenant, host, sampled_at)
+			)`,
+			`INSERT INTO window_titles_new (tenant, host, sampled_at, hour_start, title, process)
+			 SELECT tenant, host, sampled_at, hour_start, title, process FROM window_titles`,
+			`DROP TABLE window_titles`,
+			`ALTER TABLE window_titles_new RENAME TO window_titles`,
+			`CREATE INDEX idx_window_titles_hour ON window_titles (tenant, hour_start, host)`,
+			`DROP TABLE host_tenants`,
+		},
+	},
+}
+
+// Migrate brings the rqlite schema up to date. Each migration runs in a
+// single transaction together with its bookkeeping row.
+func Migrate(db *DB) error {
+	ctx := context.Background()
+
+	if _, err := db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `CREATE TABLE IF NOT EXISTS schema_migrations (name TEXT PRIMARY KEY, applied_at TEXT NOT NULL)`,
+	}}); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	qr, err := db.QueryOne(ctx, ConsistencyStrong, gorqlite.ParameterizedStatement{
+		Query: `SELECT name FROM schema_migrations`,
+	})
+	if err != nil {
+		return err
+	}
+	if qr.Err != nil {
+		return qr.Err
+	}
+	applied := make(map[string]bool)
+	for qr.Next() {
+		var name string
+		if err := qr.Scan(&name); err != nil {
+			return err
+		}
+		applied[name] = true
+	}
+
+	for _, m := range migrations {
+		if applied[m.name] {
+			continue
+		}
+		stmts := make([]gorqlite.ParameterizedStatement, 0, len(m.stmts)+1)
+		for _, q := range m.stmts {
+			stmts = append(stmts, gorqlite.ParameterizedStatement{Query: q})
+		}
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query:     `INSERT INTO schema_migrations (name, applied_at) VALUES (?, datetime('now'))`,
+			Arguments: []interface{}{m.name},
+		})
+		if _, err := db.Write(ctx, stmts); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		log.Printf("migration %s applied", m.name)
+	}
+	return nil
+}
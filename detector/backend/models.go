@@ -1,10 +1,436 @@
 package main
 
-type ActivityRow struct {
-	HourStart   string  `json:"hour_start"`
-	ActivityPct float64 `json:"activity_pct"`
-	IdleSeconds float64 `json:"idle_seconds"`
-	Samples     int64   `json:"samples"`
-	Status      string  `json:"status"`
-	CreatedAt   string  `json:"created_at"`
+import (
+	"encoding/json"
+
+	"detector-api/idleclient"
+	"taxonomy"
+)
+
+// ActivityRow and the other API reply types live in idleclient, so the
+// Go client and the backend share one definition.
+type (
+	ActivityRow  = idleclient.ActivityRow
+	HostSummary  = idleclient.HostSummary
+	ScorecardDay = idleclient.ScorecardDay
+	AgentCommand = idleclient.AgentCommand
+	AgentLogLine = idleclient.AgentLogLine
+)
+
+// StatusThresholds are the status_thresholds setting: below LowBelow is
+// LOW, below ActiveBelow is ACTIVE, anything else HIGH_PRODUCTION.
+type StatusThresholds = taxonomy.Thresholds
+
+// Schedule is the expected working window used as the default range of
+// the day-level endpoints.
+type Schedule struct {
+	Start    string `json:"start"` // HH:MM
+	End      string `json:"end"`   // HH:MM
+	Weekdays []int  `json:"weekdays"`
+	TZ       string `json:"tz"`
+}
+
+// UserProfile is one user's expected schedule, overriding the global
+// schedule setting for that user.
+type UserProfile struct {
+	UserName string `json:"user_name"`
+	Schedule
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Retention is how long each kind of data is kept; 0 means forever.
+type Retention struct {
+	RawDays    int `json:"raw_days"`
+	HourlyDays int `json:"hourly_days"`
+	DailyDays  int `json:"daily_days"`
+}
+
+// CollectionPolicy is the notice monitored users read on GET
+// /me/collection-policy. Bumping Version asks everyone to consent again;
+// with RequireConsent, agents stop sampling users who have not consented
+// to the current version.
+type CollectionPolicy struct {
+	Version        string `json:"version"`
+	Notice         string `json:"notice,omitempty"`
+	Contact        string `json:"contact,omitempty"`
+	RequireConsent bool   `json:"require_consent"`
+}
+
+// Consent is a user's answer to one version of the collection policy.
+type Consent struct {
+	UserName      string `json:"user_name"`
+	PolicyVersion string `json:"policy_version"`
+	Granted       bool   `json:"granted"`
+	At            string `json:"at"`
+	RemoteAddr    string `json:"remote_addr,omitempty"`
+}
+
+// Erasure is one DELETE /users/:user/data request. Status goes queued,
+// running, then done or failed; Rows counts the rows deleted or
+// anonymized per table.
+type Erasure struct {
+	ID          string           `json:"id"`
+	UserName    string           `json:"user_name"`
+	Mode        string           `json:"mode"`
+	Status      string           `json:"status"`
+	RequestedBy string           `json:"requested_by"`
+	CreatedAt   string           `json:"created_at"`
+	StartedAt   string           `json:"started_at,omitempty"`
+	FinishedAt  string           `json:"finished_at,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Rows        map[string]int64 `json:"rows,omitempty"`
+	RequestID   string           `json:"-"`
+}
+
+// AgentIntervals are how often agents heartbeat and re-read their config,
+// as Go duration strings. Empty fields in a per-agent override fall back to
+// the global setting.
+type AgentIntervals struct {
+	Heartbeat  string `json:"heartbeat,omitempty"`
+	ConfigPoll string `json:"config_poll,omitempty"`
+}
+
+// TimesheetSettings lists the timesheet systems daily active-hour totals
+// are pushed to (see job_timesheet.go).
+type TimesheetSettings struct {
+	Connectors []TimesheetConnector `json:"connectors"`
+}
+
+// TimesheetConnector is one push target. Kind "json" renders Body (a Go
+// text/template over a TimesheetDay) and sends it to URL, itself a
+// template; "toggl" creates a Toggl Track time entry per user-day. Header
+// values and TokenEnv keep secrets out of settings: "${NAME}" in a header
+// is replaced with the backend's environment variable NAME.
+type TimesheetConnector struct {
+	Name    string            `json:"name"`
+	Kind    string            `json:"kind"` // "json" or "toggl"
+	Users   []string          `json:"users,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Method  string            `json:"method,omitempty"` // default POST
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// toggl
+	WorkspaceID int64  `json:"workspace_id,omitempty"`
+	ProjectID   int64  `json:"project_id,omitempty"`
+	TokenEnv    string `json:"token_env,omitempty"` // default TOGGL_API_TOKEN
+}
+
+// TimesheetDay is one user's day as pushed to timesheet connectors, and
+// the data their templates see.
+type TimesheetDay struct {
+	User         string  `json:"user"`
+	DisplayName  string  `json:"display_name,omitempty"`
+	Team         string  `json:"team,omitempty"`
+	Day          string  `json:"day"`          // YYYY-MM-DD in the schedule's zone
+	ActiveHours  float64 `json:"active_hours"` // sum of activity_pct / 100
+	TrackedHours int     `json:"tracked_hours"`
+	FirstActive  string  `json:"first_active"` // first input of the day, else start of the first active hour; RFC3339 local
+	LastActive   string  `json:"last_active"`  // last input of the day, else end of the last active hour
+}
+
+// TimesheetPush records one connector delivery of one user-day.
+type TimesheetPush struct {
+	Connector string `json:"connector"`
+	UserName  string `json:"user_name"`
+	Day       string `json:"day"`
+	PushedAt  string `json:"pushed_at"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AuditEntry is one recorded write. Before/After hold row snapshots for
+// changes that have them (corrections, deletes).
+type AuditEntry struct {
+	ID          int64           `json:"id"`
+	At          string          `json:"at"`
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	Target      string          `json:"target"`
+	PayloadHash string          `json:"payload_sha256,omitempty"`
+	RequestID   string          `json:"request_id,omitempty"`
+	Before      json.RawMessage `json:"before,omitempty"`
+	After       json.RawMessage `json:"after,omitempty"`
+}
+
+// AlertRule fires when its condition holds for a host: either Expr (see
+// alertexpr.go) or, for simple rules, Metric/Op/Threshold over Window.
+type AlertRule struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Expr      string  `json:"expr,omitempty"`
+	Metric    string  `json:"metric,omitempty"` // activity_pct or idle_seconds
+	Op        string  `json:"op,omitempty"`     // <, <=, >, >=
+	Threshold float64 `json:"threshold,omitempty"`
+	Window    string  `json:"window,omitempty"` // Go duration, e.g. "3h"
+	Host      string  `json:"host,omitempty"`
+	Webhook   string  `json:"webhook,omitempty"`
+	Enabled   bool    `json:"enabled"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// summarizeHost rolls rows (all for host, ordered by hour) into a HostSummary.
+func summarizeHost(host string, rows []ActivityRow) HostSummary {
+	s := HostSummary{Host: host, Hours: len(rows)}
+	pctSum := 0.0
+	measured := 0
+	for _, row := range rows {
+		if !Status(row.Status).Measured() {
+			continue
+		}
+		measured++
+		pctSum += row.ActivityPct
+		s.IdleSeconds += row.IdleSeconds
+		if row.Status != "OFF" {
+			s.ActiveHours++
+		}
+	}
+	if measured > 0 {
+		s.AvgActivityPct = pctSum / float64(measured)
+	}
+	if n := len(rows); n > 0 {
+		last := rows[n-1]
+		s.UserName, s.DisplayName, s.Team = last.UserName, last.DisplayName, last.Team
+		s.LastHour, s.LastStatus = last.HourStart, last.Status
+	}
+	return s
+}
+
+// QueryBucket is one host's totals over one time bucket (and group, when
+// grouped) in a POST /activity/query reply.
+type QueryBucket struct {
+	Host           string  `json:"-"`
+	Bucket         string  `json:"bucket"`
+	Group          string  `json:"group,omitempty"`
+	Hours          int     `json:"hours"`
+	ActiveHours    int     `json:"active_hours"`
+	AvgActivityPct float64 `json:"avg_activity_pct"`
+	IdleSeconds    float64 `json:"idle_seconds"`
+	Samples        int64   `json:"samples"`
+}
+
+// ActivityStats is the distribution of hourly activity_pct over a range,
+// for choosing status thresholds from data. Percentiles are nearest-rank;
+// StdDev is the population standard deviation.
+type ActivityStats struct {
+	Hours     int               `json:"hours"`
+	Mean      float64           `json:"mean"`
+	StdDev    float64           `json:"stddev"`
+	Min       float64           `json:"min"`
+	Max       float64           `json:"max"`
+	P50       float64           `json:"p50"`
+	P90       float64           `json:"p90"`
+	P99       float64           `json:"p99"`
+	Histogram []HistogramBucket `json:"histogram"`
+}
+
+// HistogramBucket counts hours with From <= activity_pct < To (the last
+// bucket includes 100).
+type HistogramBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Hours int     `json:"hours"`
+}
+
+// SecondsTotal is the active time spent in one application category or
+// web domain over a range, and its share of all of them.
+type SecondsTotal struct {
+	Name     string  `json:"name"`
+	Seconds  float64 `json:"seconds"`
+	SharePct float64 `json:"share_pct"`
+}
+
+// RawSample is one agent sample as uploaded to POST /ingest/samples: at
+// ts the user had been idle idle_ms, and the sample stands for the
+// interval_ms before it.
+type RawSample struct {
+	TS         string `json:"ts"`
+	IdleMs     int64  `json:"idle_ms"`
+	IntervalMs int64  `json:"interval_ms"`
+}
+
+// SampleBucket is one host and user's raw samples over a roll-up bucket;
+// see the sample_rollups migration. ActivityPct is the non-idle share of the
+// measured time.
+type SampleBucket struct {
+	BucketStart     string  `json:"bucket_start"`
+	Host            string  `json:"host"`
+	UserName        string  `json:"user_name"`
+	Samples         int64   `json:"samples"`
+	MeasuredSeconds float64 `json:"measured_seconds"`
+	IdleSeconds     float64 `json:"idle_seconds"`
+	ActivityPct     float64 `json:"activity_pct"`
+}
+
+// BreakDay is one host's breaks over one local day, as returned by GET
+// /activity/breaks.
+type BreakDay struct {
+	Day             string  `json:"day"`
+	Host            string  `json:"host"`
+	UserName        string  `json:"user_name"`
+	Breaks          int64   `json:"breaks"`
+	BreakSeconds    float64 `json:"break_seconds"`
+	AvgBreakSeconds float64 `json:"avg_break_seconds"`
+}
+
+// Heatmap is a weekday × hour pivot of average activity. Rows are weekdays
+// 0 (Sunday) to 6, columns UTC hours 0-23; cells without data are null.
+type Heatmap struct {
+	AvgActivityPct [7][24]*float64 `json:"avg_activity_pct"`
+	Samples        [7][24]int      `json:"hours"`
+}
+
+// Agent is the last heartbeat seen from one machine.
+type Agent struct {
+	Host            string `json:"host"`
+	UserName        string `json:"user_name"`
+	AgentVersion    string `json:"agent_version"`
+	AgentCommit     string `json:"agent_commit,omitempty"`
+	AgentBuildDate  string `json:"agent_build_date,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+	OS              string `json:"os,omitempty"`
+	RemoteAddr      string `json:"remote_addr,omitempty"`
+	FirstSeen       string `json:"first_seen"`
+	LastSeen        string `json:"last_seen"`
+	Outdated        bool   `json:"outdated"`
+	// per-agent override of the agent_intervals setting
+	Intervals AgentIntervals `json:"intervals"`
+	Resources AgentResources `json:"resources"`
+	// from the last heartbeat: the user's latest input and the agent's
+	// windowed mode, empty from agents that predate them
+	LastInput string `json:"last_input,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+}
+
+// Enrollment is an agent registered through POST /enroll; its token is
+// only shown to the agent.
+type Enrollment struct {
+	AgentID    string `json:"agent_id"`
+	Tenant     string `json:"tenant"`
+	Host       string `json:"host"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+}
+
+// Tenant is one subsidiary sharing the backend, see tenant.go.
+type Tenant struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+// APIToken is a token issued through POST /admin/tokens. Role is admin,
+// manager, self-view or agent; UserName is the only user a self-view
+// token can see.
+type APIToken struct {
+	ID        string `json:"id"`
+	Tenant    string `json:"tenant"`
+	Role      string `json:"role"`
+	UserName  string `json:"user_name,omitempty"`
+	Label     string `json:"label,omitempty"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+// CalendarAccount links a user (as in activity_hourly.user_name) to their
+// Microsoft 365 or Google calendar. The refresh token never leaves the
+// backend.
+type CalendarAccount struct {
+	UserName     string `json:"user_name"`
+	Provider     string `json:"provider"`              // "microsoft" or "google"
+	CalendarID   string `json:"calendar_id,omitempty"` // Google only; empty is "primary"
+	RefreshToken string `json:"-"`
+	SyncedAt     string `json:"synced_at,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// WindowTitle is one foreground window sample, see the agent's
+// WindowTitles option.
+type WindowTitle struct {
+	SampledAt string `json:"sampled_at"`
+	Title     string `json:"title"`
+	Process   string `json:"process"`
+}
+
+// FocusSession is one stretch of sustained work in a single foreground
+// application, see the agent's FocusSessions option.
+type FocusSession struct {
+	Host            string  `json:"host"`
+	UserName        string  `json:"user_name"`
+	StartedAt       string  `json:"started_at"`
+	EndedAt         string  `json:"ended_at"`
+	App             string  `json:"app"`
+	ActivityPct     float64 `json:"activity_pct"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// TitleHour is one host-hour of window titles.
+type TitleHour struct {
+	HourStart string        `json:"hour_start"`
+	Host      string        `json:"host"`
+	Titles    []WindowTitle `json:"titles"`
+}
+
+// AgentResources is the agent's own footprint from its last heartbeat.
+type AgentResources struct {
+	CPUSeconds    float64 `json:"cpu_seconds"`
+	RSSBytes      int64   `json:"rss_bytes"`
+	Goroutines    int     `json:"goroutines"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	// CPUPct is average CPU use since the agent started, 100 = one core
+	CPUPct float64 `json:"cpu_pct"`
+}
+
+// HourlyIngest is one hourly bucket as posted by an agent.
+type HourlyIngest struct {
+	HourStart   string            `json:"hour_start"`
+	Host        string            `json:"host"`
+	UserName    string            `json:"user_name"`
+	DisplayName string            `json:"display_name"`
+	Team        string            `json:"team"`
+	Labels      map[string]string `json:"labels"`
+	ActivityPct float64           `json:"activity_pct"`
+	IdleSeconds float64           `json:"idle_seconds"`
+	Samples     int64             `json:"samples"`
+	Status      string            `json:"status"`
+
+	BatterySeconds float64            `json:"battery_seconds"`
+	BatteryPct     *int64             `json:"battery_pct,omitempty"`
+	MonitorSeconds map[string]float64 `json:"monitor_seconds,omitempty"`
+
+	MouseEvents int64 `json:"mouse_events"`
+	KeyEvents   int64 `json:"key_events"`
+	TouchEvents int64 `json:"touch_events"`
+
+	LocalHour string   `json:"local_hour,omitempty"`
+	EWMAPct   *float64 `json:"ewma_pct,omitempty"`
+
+	DegradedSeconds float64            `json:"degraded_seconds,omitempty"`
+	CategorySeconds map[string]float64 `json:"category_seconds,omitempty"`
+	DomainSeconds   map[string]float64 `json:"domain_seconds,omitempty"`
+
+	FirstInput string `json:"first_input,omitempty"`
+	LastInput  string `json:"last_input,omitempty"`
+
+	Breaks       int64   `json:"breaks,omitempty"`
+	BreakSeconds float64 `json:"break_seconds,omitempty"`
+
+	SuspectedSynthetic  bool    `json:"suspected_synthetic,omitempty"`
+	SyntheticConfidence float64 `json:"synthetic_confidence,omitempty"`
+
+	MediaInhibit bool `json:"media_inhibit,omitempty"`
+
+	// hex HMAC-SHA256 of bucketPayload under the host's signing key,
+	// from agents with a SigningKey; the status is set on ingest
+	Signature       string `json:"signature,omitempty"`
+	SignatureStatus string `json:"-"`
+}
+
+// Identity maps a pseudonym back to the clear name it stands for; see
+// package pseudonym.
+type Identity struct {
+	Pseudonym string `json:"pseudonym"`
+	Kind      string `json:"kind"` // host or user
+	Value     string `json:"value"`
+	CreatedAt string `json:"created_at"`
 }
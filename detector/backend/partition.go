@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// Hourly and sample tables carry a generated "month" column (YYYY-MM, see
+// the month_partition_keys migration). Range queries add a month BETWEEN
+// predicate so SQLite can skip whole months via the (month, host) index,
+// and retention works month by month with a single equality delete.
+
+// monthBounds returns the first and last month touched by the half-open
+// range [startRFC3339, endRFC3339). Unparseable bounds fall back to the
+// widest possible range so the query stays correct, only slower.
+func monthBounds(startRFC3339, endRFC3339 string) (first, last string) {
+	first, last = "0000-00", "9999-99"
+	if t, err := time.Parse(time.RFC3339, startRFC3339); err == nil {
+		first = t.UTC().Format("2006-01")
+	}
+	if t, err := time.Parse(time.RFC3339, endRFC3339); err == nil {
+		last = t.UTC().Add(-time.Second).Format("2006-01")
+	}
+	return first, last
+}
+
+// monthArgs prepends the month bounds of [startRFC3339, endRFC3339) to the
+// remaining query arguments.
+func monthArgs(startRFC3339, endRFC3339 string, rest ...interface{}) []interface{} {
+	first, last := monthBounds(startRFC3339, endRFC3339)
+	return append([]interface{}{first, last}, rest...)
+}
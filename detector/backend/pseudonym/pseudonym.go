@@ -0,0 +1,35 @@
+// Package pseudonym turns host and user names into the stable tokens the
+// agent stores when its PseudonymKey is set, so the backend (PSEUDONYM_KEY)
+// and cmd/backfill produce the same ones.
+package pseudonym
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Kinds of identity; the first letter prefixes the token.
+const (
+	Host = "host"
+	User = "user"
+)
+
+var tokenRe = regexp.MustCompile(`^[hu]-[0-9a-f]{16}$`)
+
+// Token is "h-" or "u-" and the first 16 hex digits of
+// HMAC-SHA256(key, kind + NUL + lower-cased value). It must match the
+// agent's pseudonym().
+func Token(key, kind, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(kind + "\x00" + strings.ToLower(strings.TrimSpace(value))))
+	return kind[:1] + "-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// IsToken reports whether s already is a pseudonym, so data coming back
+// from an export is not hashed twice.
+func IsToken(s string) bool {
+	return tokenRe.MatchString(s)
+}
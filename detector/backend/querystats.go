@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// queryBuckets are the upper bounds of the latency histogram. Percentiles
+// are reported as the bound of the bucket they fall in.
+var queryBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// QueryStat totals the rqlite calls of one operation and statement since
+// the backend started. Latencies are in milliseconds and include failover
+// retries.
+type QueryStat struct {
+	Op      string  `json:"op"` // query or write
+	SQL     string  `json:"sql"`
+	Calls   int64   `json:"calls"`
+	Errors  int64   `json:"errors"`
+	TotalMS float64 `json:"total_ms"`
+	AvgMS   float64 `json:"avg_ms"`
+	P50MS   float64 `json:"p50_ms"`
+	P95MS   float64 `json:"p95_ms"`
+	P99MS   float64 `json:"p99_ms"`
+	MaxMS   float64 `json:"max_ms"`
+
+	counts []int64 // per queryBuckets entry, then one past the last
+}
+
+type queryMeter struct {
+	mu     sync.Mutex
+	totals map[[2]string]*QueryStat
+}
+
+var queryStats = &queryMeter{totals: make(map[[2]string]*QueryStat)}
+
+func (m *queryMeter) add(op, sql string, took time.Duration, err error) {
+	ms := float64(took.Microseconds()) / 1000
+	b := sort.Search(len(queryBuckets), func(i int) bool { return took <= queryBuckets[i] })
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.totals[[2]string{op, sql}]
+	if t == nil {
+		t = &QueryStat{Op: op, SQL: sql, counts: make([]int64, len(queryBuckets)+1)}
+		m.totals[[2]string{op, sql}] = t
+	}
+	t.Calls++
+	if err != nil {
+		t.Errors++
+	}
+	t.TotalMS += ms
+	if ms > t.MaxMS {
+		t.MaxMS = ms
+	}
+	t.counts[b]++
+}
+
+// percentile returns the bucket bound holding the p-th percentile of t,
+// or its max past the last bucket.
+func (t *QueryStat) percentile(p float64) float64 {
+	rank := int64(p/100*float64(t.Calls-1)) + 1
+	var seen int64
+	for i, n := range t.counts {
+		seen += n
+		if seen >= rank {
+			if i == len(queryBuckets) {
+				return t.MaxMS
+			}
+			return float64(queryBuckets[i].Microseconds()) / 1000
+		}
+	}
+	return t.MaxMS
+}
+
+// Snapshot returns the totals, the statements taking the most time first.
+func (m *queryMeter) Snapshot() []QueryStat {
+	m.mu.Lock()
+	out := make([]QueryStat, 0, len(m.totals))
+	for _, t := range m.totals {
+		s := *t
+		s.AvgMS = s.TotalMS / float64(s.Calls)
+		s.P50MS, s.P95MS, s.P99MS = t.percentile(50), t.percentile(95), t.percentile(99)
+		s.counts = nil
+		out = append(out, s)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TotalMS != out[j].TotalMS {
+			return out[i].TotalMS > out[j].TotalMS
+		}
+		return out[i].SQL < out[j].SQL
+	})
+	return out
+}
+
+// GET /admin/db/queries
+// Latency of the rqlite calls made by this replica since it started, by
+// operation and statement, the slowest in total first.
+func GetQueryStats(c *fiber.Ctx) error {
+	return c.JSON(queryStats.Snapshot())
+}
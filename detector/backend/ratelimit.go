@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// quota is a token bucket refilled at Rate tokens per second up to Burst.
+type quota struct {
+	Rate  float64
+	Burst float64
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// verifiedKeyTTL is how long a key stays known to the limiter after
+// verify accepted it.
+const verifiedKeyTTL = time.Minute
+
+// RateLimiter applies token buckets per API key (X-API-Key or bearer
+// token) and per client IP for everyone else. A key only gets its own
+// bucket once verify has accepted it as one the backend issued; until
+// then, and for made-up keys, the request counts against its IP, so
+// rotating keys buys no extra budget. Keys listed in RATE_LIMIT_KEYS get
+// their own quota; all others share the defaults.
+type RateLimiter struct {
+	ipQuota  quota
+	keyQuota quota
+	perKey   map[string]quota // by sha256 of the key
+	verify   func(c *fiber.Ctx, key string) bool
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	verified map[string]time.Time // key hash -> until
+}
+
+// NewRateLimiterFromEnv reads:
+//
+//	RATE_LIMIT_IP      "rps/burst" per client IP (default 10/20)
+//	RATE_LIMIT_KEY     "rps/burst" per API key  (default 20/40)
+//	RATE_LIMIT_KEYS    "key1=rps/burst,key2=rps/burst" per-key overrides
+//
+// A rate of 0 disables limiting for that class. verify tells whether a
+// key is a live token; keys from RATE_LIMIT_KEYS are taken as known.
+func NewRateLimiterFromEnv(verify func(c *fiber.Ctx, key string) bool) *RateLimiter {
+	rl := &RateLimiter{
+		ipQuota:  parseQuota(os.Getenv("RATE_LIMIT_IP"), quota{Rate: 10, Burst: 20}),
+		keyQuota: parseQuota(os.Getenv("RATE_LIMIT_KEY"), quota{Rate: 20, Burst: 40}),
+		perKey:   make(map[string]quota),
+		verify:   verify,
+		buckets:  make(map[string]*bucket),
+		verified: make(map[string]time.Time),
+	}
+	for _, entry := range strings.Split(os.Getenv("RATE_LIMIT_KEYS"), ",") {
+		key, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || key == "" {
+			continue
+		}
+		rl.perKey[hashKey(key)] = parseQuota(spec, rl.keyQuota)
+	}
+	return rl
+}
+
+// parseQuota reads "rps/burst"; a bare "rps" uses twice the rate as burst.
+func parseQuota(spec string, def quota) quota {
+	if spec == "" {
+		return def
+	}
+	rateStr, burstStr, hasBurst := strings.Cut(spec, "/")
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate < 0 {
+		log.Printf("ratelimit: invalid quota %q, using default", spec)
+		return def
+	}
+	burst := math.Max(1, rate*2)
+	if hasBurst {
+		if burst, err = strconv.ParseFloat(burstStr, 64); err != nil || burst < 1 {
+			log.Printf("ratelimit: invalid burst in %q, using default", spec)
+			return def
+		}
+	}
+	return quota{Rate: rate, Burst: burst}
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// apiKey returns the caller's API key, if any.
+func apiKey(c *fiber.Ctx) string {
+	if k := c.Get("X-API-Key"); k != "" {
+		return k
+	}
+	return bearerToken(c)
+}
+
+// known reports whether the key hashed to h was verified recently.
+func (rl *RateLimiter) known(h string, now time.Time) bool {
+	if _, ok := rl.perKey[h]; ok {
+		return true
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return now.Before(rl.verified[h])
+}
+
+// take consumes one token from the bucket id; it returns the tokens left
+// and, when refused, how long until the next token.
+func (rl *RateLimiter) take(id string, q quota, now time.Time) (float64, time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b, ok := rl.buckets[id]
+	if !ok {
+		b = &bucket{tokens: q.Burst, last: now}
+		rl.buckets[id] = b
+	}
+	b.tokens = math.Min(q.Burst, b.tokens+now.Sub(b.last).Seconds()*q.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / q.Rate * float64(time.Second))
+		return b.tokens, wait, false
+	}
+	b.tokens--
+	return b.tokens, 0, true
+}
+
+// Sweep forgets buckets idle long enough to be full again, and expired
+// key verifications.
+func (rl *RateLimiter) Sweep(idle time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	cutoff := now.Add(-idle)
+	for id, b := range rl.buckets {
+		if b.last.Before(cutoff) {
+			delete(rl.buckets, id)
+		}
+	}
+	for h, until := range rl.verified {
+		if now.After(until) {
+			delete(rl.verified, h)
+		}
+	}
+}
+
+// Handler returns the middleware; class separates the budgets of route
+// groups (e.g. "query" and "ingest") so one cannot starve the other. A
+// key not yet known is verified after its request passed the IP bucket,
+// so floods of made-up keys are refused before they reach the database.
+func (rl *RateLimiter) Handler(class string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		now := time.Now()
+		key := apiKey(c)
+		var h string
+		if key != "" {
+			h = hashKey(key)
+		}
+		id, q := class+"|ip:"+c.IP(), rl.ipQuota
+		if h != "" && rl.known(h, now) {
+			id, q = class+"|key:"+h, rl.keyQuota
+			if kq, ok := rl.perKey[h]; ok {
+				q = kq
+			}
+		}
+		if q.Rate == 0 {
+			return c.Next()
+		}
+
+		left, wait, ok := rl.take(id, q, now)
+		c.Set("X-RateLimit-Limit", strconv.FormatFloat(q.Rate, 'f', -1, 64))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(int(left)))
+		if !ok {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return fiber.NewError(fiber.StatusTooManyRequests, "rate limit exceeded")
+		}
+		if h != "" && !rl.known(h, now) && rl.verify != nil && rl.verify(c, key) {
+			rl.mu.Lock()
+			rl.verified[h] = now.Add(verifiedKeyTTL)
+			rl.mu.Unlock()
+		}
+		return c.Next()
+	}
+}
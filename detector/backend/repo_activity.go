@@ -1,23 +1,100 @@
 package main
 
-import "github.com/rqlite/gorqlite"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// ActivityRepository is what handlers need from activity_hourly.
+// ActivityRepo implements it over rqlite; MemActivityRepo keeps rows in
+// memory so handler behavior can be exercised without a database.
+// Statements passed along (Upsert's extra, Correct's and Tombstone's
+// audit) only run against rqlite.
+type ActivityRepository interface {
+	InvalidateHour(hourStart time.Time)
+	InvalidateRange(from, to time.Time)
+	GetBetween(ctx context.Context, startRFC3339, endRFC3339, host, level string) ([]ActivityRow, error)
+	Hosts(ctx context.Context, startRFC3339, endRFC3339 string) ([]string, error)
+	LastHours(ctx context.Context, startRFC3339, endRFC3339 string) ([]HostLastHour, error)
+	Heatmap(ctx context.Context, startRFC3339, endRFC3339, host string) (Heatmap, error)
+	Upsert(ctx context.Context, rows []HourlyIngest, extra ...gorqlite.ParameterizedStatement) error
+	InsertMissing(ctx context.Context, rows []HourlyIngest) (int64, error)
+	GetHour(ctx context.Context, hourStart time.Time, host, user string) ([]ActivityRow, error)
+	Correct(ctx context.Context, row ActivityRow, audit gorqlite.ParameterizedStatement) error
+	Tombstone(ctx context.Context, hourStart time.Time, host, user string, audit gorqlite.ParameterizedStatement) error
+	ScorecardDays(ctx context.Context, user, startRFC3339, endRFC3339, tzModifier string, focusPct float64) ([]ScorecardDay, error)
+	QueryBuckets(ctx context.Context, hosts []string, startRFC3339, endRFC3339, granularity, groupBy, tzModifier string) ([]QueryBucket, error)
+	Stats(ctx context.Context, startRFC3339, endRFC3339, host string, bucketWidth int) (ActivityStats, error)
+	BreakDays(ctx context.Context, startRFC3339, endRFC3339, host, user, tzModifier string) ([]BreakDay, error)
+	SecondsTotals(ctx context.Context, column, startRFC3339, endRFC3339, host, user string) ([]SecondsTotal, error)
+}
+
+var _ ActivityRepository = (*ActivityRepo)(nil)
 
 type ActivityRepo struct {
-	conn *gorqlite.Connection
+	db     *DB
+	cache  *activityCache
+	flight flightGroup[[]ActivityRow]
+}
+
+// NewActivityRepo builds the repo; cacheTTL <= 0 disables the query cache.
+func NewActivityRepo(db *DB, cacheTTL time.Duration) *ActivityRepo {
+	return &ActivityRepo{db: db, cache: newActivityCache(cacheTTL)}
+}
+
+// InvalidateHour drops cached ranges covering the given hour. Write paths
+// call it after a new row for that hour lands so dashboards see it at once.
+func (r *ActivityRepo) InvalidateHour(hourStart time.Time) {
+	r.InvalidateRange(hourStart, hourStart.Add(time.Hour))
 }
 
-func NewActivityRepo(conn *gorqlite.Connection) *ActivityRepo {
-	return &ActivityRepo{conn: conn}
+// InvalidateRange drops cached ranges overlapping [from, to).
+func (r *ActivityRepo) InvalidateRange(from, to time.Time) {
+	r.cache.invalidateRange(from, to)
 }
 
-// GetBetween returns rows in [startRFC3339, endRFC3339)
-func (r *ActivityRepo) GetBetween(startRFC3339, endRFC3339 string) ([]ActivityRow, error) {
-	qr, err := r.conn.QueryOneParameterized(gorqlite.ParameterizedStatement{
-		Query: `SELECT hour_start, activity_pct, idle_seconds, samples, status, created_at
+// GetBetween returns rows in [startRFC3339, endRFC3339), optionally for a
+// single host, read at the given consistency level ("" for the default).
+// Strong reads bypass the cache.
+func (r *ActivityRepo) GetBetween(ctx context.Context, startRFC3339, endRFC3339, host, level string) ([]ActivityRow, error) {
+	useCache := level != ConsistencyStrong
+	tenant := tenantOf(ctx)
+	if useCache {
+		if rows, ok := r.cache.get(tenant, startRFC3339, endRFC3339, host); ok {
+			return rows, nil
+		}
+	}
+
+	key := level + "|" + cacheKey(tenant, startRFC3339, endRFC3339, host)
+	rows, err := r.flight.do(ctx, key, func(ctx context.Context) ([]ActivityRow, error) {
+		return r.queryBetween(ctx, startRFC3339, endRFC3339, host, level)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if useCache {
+		r.cache.put(tenant, startRFC3339, endRFC3339, host, rows)
+	}
+	return rows, nil
+}
+
+// queryBetween is the uncached, uncoalesced query behind GetBetween.
+func (r *ActivityRepo) queryBetween(ctx context.Context, startRFC3339, endRFC3339, host, level string) ([]ActivityRow, error) {
+	qr, err := r.db.QueryOne(ctx, level, gorqlite.ParameterizedStatement{
+		Query: `SELECT hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, note, created_at,
+		               battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour, ewma_pct, degraded_seconds, category_seconds, domain_seconds,
+		               first_input, last_input, breaks, break_seconds, suspected_synthetic, synthetic_confidence, media_inhibit, signature_status
 		        FROM activity_hourly
-		        WHERE hour_start >= ? AND hour_start < ?
-		        ORDER BY hour_start;`,
-		Arguments: []interface{}{startRFC3339, endRFC3339},
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ? AND (? = '' OR host = ?)
+		          AND deleted_at IS NULL
+		        ORDER BY hour_start, host;`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...),
 	})
 	if err != nil {
 		return nil, err
@@ -28,11 +105,715 @@ func (r *ActivityRepo) GetBetween(startRFC3339, endRFC3339 string) ([]ActivityRo
 
 	rows := make([]ActivityRow, 0, 16)
 	for qr.Next() {
-		var row ActivityRow
-		if err := qr.Scan(&row.HourStart, &row.ActivityPct, &row.IdleSeconds, &row.Samples, &row.Status, &row.CreatedAt); err != nil {
+		var (
+			row        ActivityRow
+			labels     string
+			batteryPct gorqlite.NullInt64
+			monitors   string
+			ewmaPct    gorqlite.NullFloat64
+			categories string
+			domains    string
+		)
+		if err := qr.Scan(&row.HourStart, &row.Host, &row.UserName, &row.DisplayName, &row.Team, &labels, &row.ActivityPct, &row.IdleSeconds, &row.Samples, &row.Status, &row.Note, &row.CreatedAt,
+			&row.BatterySeconds, &batteryPct, &monitors, &row.MouseEvents, &row.KeyEvents, &row.TouchEvents, &row.LocalHour, &ewmaPct, &row.DegradedSeconds, &categories, &domains,
+			&row.FirstInput, &row.LastInput, &row.Breaks, &row.BreakSeconds,
+			&row.SuspectedSynthetic, &row.SyntheticConfidence, &row.MediaInhibit, &row.SignatureStatus); err != nil {
 			return nil, err
 		}
+		if batteryPct.Valid {
+			row.BatteryPct = &batteryPct.Int64
+		}
+		if ewmaPct.Valid {
+			row.EWMAPct = &ewmaPct.Float64
+		}
+		if labels != "" && labels != "{}" {
+			_ = json.Unmarshal([]byte(labels), &row.Labels)
+		}
+		if monitors != "" && monitors != "{}" {
+			_ = json.Unmarshal([]byte(monitors), &row.MonitorSeconds)
+		}
+		if categories != "" && categories != "{}" {
+			_ = json.Unmarshal([]byte(categories), &row.CategorySeconds)
+		}
+		if domains != "" && domains != "{}" {
+			_ = json.Unmarshal([]byte(domains), &row.DomainSeconds)
+		}
 		rows = append(rows, row)
 	}
 	return rows, nil
 }
+
+// Hosts returns every host with rows in [startRFC3339, endRFC3339).
+func (r *ActivityRepo) Hosts(ctx context.Context, startRFC3339, endRFC3339 string) ([]string, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT DISTINCT host FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ? AND deleted_at IS NULL
+		        ORDER BY host;`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	hosts := make([]string, 0, 16)
+	for qr.Next() {
+		var host string
+		if err := qr.Scan(&host); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// HostLastHour is the latest measured hour stored for one host.
+type HostLastHour struct {
+	Host      string
+	UserName  string // user of that hour
+	HourStart string
+}
+
+// LastHours returns, per host with measured rows in [startRFC3339,
+// endRFC3339), its latest hour and that hour's user.
+func (r *ActivityRepo) LastHours(ctx context.Context, startRFC3339, endRFC3339 string) ([]HostLastHour, error) {
+	// SQLite fills bare columns from the row that holds the MAX()
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT host, user_name, MAX(hour_start) FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ? AND deleted_at IS NULL AND ` + measuredSQL + `
+		        GROUP BY host ORDER BY host;`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]HostLastHour, 0, 16)
+	for qr.Next() {
+		var h HostLastHour
+		if err := qr.Scan(&h.Host, &h.UserName, &h.HourStart); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+// Heatmap averages activity_pct per UTC weekday and hour over
+// [startRFC3339, endRFC3339), optionally for one host, in a single query.
+func (r *ActivityRepo) Heatmap(ctx context.Context, startRFC3339, endRFC3339, host string) (Heatmap, error) {
+	var hm Heatmap
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT CAST(strftime('%w', hour_start) AS INTEGER) AS weekday,
+		               CAST(strftime('%H', hour_start) AS INTEGER) AS hour,
+		               AVG(activity_pct), COUNT(*)
+		        FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ? AND (? = '' OR host = ?)
+		          AND deleted_at IS NULL AND ` + measuredSQL + `
+		        GROUP BY weekday, hour;`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...),
+	})
+	if err != nil {
+		return hm, err
+	}
+	if qr.Err != nil {
+		return hm, qr.Err
+	}
+	for qr.Next() {
+		var (
+			weekday, hour, count int64
+			avg                  float64
+		)
+		if err := qr.Scan(&weekday, &hour, &avg, &count); err != nil {
+			return hm, err
+		}
+		if weekday < 0 || weekday > 6 || hour < 0 || hour > 23 {
+			continue
+		}
+		hm.AvgActivityPct[weekday][hour] = &avg
+		hm.Samples[weekday][hour] = int(count)
+	}
+	return hm, nil
+}
+
+// Upsert writes hourly rows into ctx's tenant in one transaction
+// (replacing any row for the same hour, host and user, and other users'
+// gap placeholders) and invalidates cached ranges covering them. Notes
+// survive a re-send and tombstoned hours stay deleted. extra statements
+// are written in the same transaction.
+func (r *ActivityRepo) Upsert(ctx context.Context, rows []HourlyIngest, extra ...gorqlite.ParameterizedStatement) error {
+	now, tenant := time.Now().UTC().Format(time.RFC3339), tenantOf(ctx)
+	stmts := make([]gorqlite.ParameterizedStatement, 0, len(rows))
+	for _, row := range rows {
+		labels := "{}"
+		if len(row.Labels) > 0 {
+			b, err := json.Marshal(row.Labels)
+			if err != nil {
+				return err
+			}
+			labels = string(b)
+		}
+		monitors := "{}"
+		if len(row.MonitorSeconds) > 0 {
+			b, err := json.Marshal(row.MonitorSeconds)
+			if err != nil {
+				return err
+			}
+			monitors = string(b)
+		}
+		categories := "{}"
+		if len(row.CategorySeconds) > 0 {
+			b, err := json.Marshal(row.CategorySeconds)
+			if err != nil {
+				return err
+			}
+			categories = string(b)
+		}
+		domains := "{}"
+		if len(row.DomainSeconds) > 0 {
+			b, err := json.Marshal(row.DomainSeconds)
+			if err != nil {
+				return err
+			}
+			domains = string(b)
+		}
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query: `INSERT INTO activity_hourly
+			        (tenant, hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at,
+			         battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour, ewma_pct, degraded_seconds, category_seconds, domain_seconds,
+			         first_input, last_input, breaks, break_seconds, suspected_synthetic, synthetic_confidence, media_inhibit, signature, signature_status)
+			        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			        ON CONFLICT (tenant, hour_start, host, user_name) DO UPDATE SET ` + hourlyUpdateSet + `
+			        WHERE activity_hourly.deleted_at IS NULL`,
+			Arguments: []interface{}{tenant, row.HourStart, row.Host, row.UserName, row.DisplayName, row.Team, labels,
+				row.ActivityPct, row.IdleSeconds, row.Samples, row.Status, now, row.BatterySeconds, row.BatteryPct, monitors,
+				row.MouseEvents, row.KeyEvents, row.TouchEvents, row.LocalHour, row.EWMAPct, row.DegradedSeconds, categories, domains,
+				row.FirstInput, row.LastInput, row.Breaks, row.BreakSeconds, row.SuspectedSynthetic, row.SyntheticConfidence, row.MediaInhibit, row.Signature, row.SignatureStatus},
+		})
+		if Status(row.Status).Measured() {
+			stmts = append(stmts, clearGapsStmt(tenant, row))
+		}
+	}
+	if _, err := r.db.Write(ctx, append(stmts, extra...)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if t, err := time.Parse(time.RFC3339, row.HourStart); err == nil {
+			r.InvalidateHour(t)
+		}
+	}
+	return nil
+}
+
+// clearGapsStmt deletes the NO_DATA / AGENT_DOWN placeholders other users
+// of tenant hold for row's host-hour, which a measured row replaces.
+func clearGapsStmt(tenant string, row HourlyIngest) gorqlite.ParameterizedStatement {
+	return gorqlite.ParameterizedStatement{
+		Query: `DELETE FROM activity_hourly
+		        WHERE tenant = ? AND hour_start = ? AND host = ? AND user_name != ? AND deleted_at IS NULL AND ` + gapSQL,
+		Arguments: []interface{}{tenant, row.HourStart, row.Host, row.UserName},
+	}
+}
+
+// hourlyUpdateSet is the ON CONFLICT update shared by Upsert and
+// InsertMissing: everything but the note and the tombstone.
+const hourlyUpdateSet = `
+			          user_name = excluded.user_name, display_name = excluded.display_name,
+			          team = excluded.team, labels = excluded.labels,
+			          activity_pct = excluded.activity_pct, idle_seconds = excluded.idle_seconds,
+			          samples = excluded.samples, status = excluded.status, created_at = excluded.created_at,
+			          battery_seconds = excluded.battery_seconds, battery_pct = excluded.battery_pct,
+			          monitor_seconds = excluded.monitor_seconds,
+			          mouse_events = excluded.mouse_events, key_events = excluded.key_events, touch_events = excluded.touch_events,
+			          local_hour = excluded.local_hour, ewma_pct = excluded.ewma_pct,
+			          degraded_seconds = excluded.degraded_seconds, category_seconds = excluded.category_seconds,
+			          domain_seconds = excluded.domain_seconds,
+			          first_input = excluded.first_input, last_input = excluded.last_input,
+			          breaks = excluded.breaks, break_seconds = excluded.break_seconds,
+			          suspected_synthetic = excluded.suspected_synthetic, synthetic_confidence = excluded.synthetic_confidence,
+			          media_inhibit = excluded.media_inhibit,
+			          signature = excluded.signature, signature_status = excluded.signature_status`
+
+// InsertMissing writes only the rows whose hour and host are not stored
+// yet in ctx's tenant, tombstoned or not, or hold a gap status, and reports how many were
+// written. Another user's row counts as stored unless it is a live gap.
+// Importing the same history twice is therefore a no-op, imports never
+// overwrite what an agent uploaded, and recovered history replaces
+// NO_DATA / AGENT_DOWN placeholders.
+func (r *ActivityRepo) InsertMissing(ctx context.Context, rows []HourlyIngest) (int64, error) {
+	now, tenant := time.Now().UTC().Format(time.RFC3339), tenantOf(ctx)
+	stmts := make([]gorqlite.ParameterizedStatement, 0, len(rows))
+	inserts := make([]int, 0, len(rows)) // stmts indexes of the inserts
+	for _, row := range rows {
+		labels := "{}"
+		if len(row.Labels) > 0 {
+			b, err := json.Marshal(row.Labels)
+			if err != nil {
+				return 0, err
+			}
+			labels = string(b)
+		}
+		monitors := "{}"
+		if len(row.MonitorSeconds) > 0 {
+			b, err := json.Marshal(row.MonitorSeconds)
+			if err != nil {
+				return 0, err
+			}
+			monitors = string(b)
+		}
+		categories := "{}"
+		if len(row.CategorySeconds) > 0 {
+			b, err := json.Marshal(row.CategorySeconds)
+			if err != nil {
+				return 0, err
+			}
+			categories = string(b)
+		}
+		domains := "{}"
+		if len(row.DomainSeconds) > 0 {
+			b, err := json.Marshal(row.DomainSeconds)
+			if err != nil {
+				return 0, err
+			}
+			domains = string(b)
+		}
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query: `INSERT INTO activity_hourly
+			        (tenant, hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at,
+			         battery_seconds, battery_pct, monitor_seconds, mouse_events, key_events, touch_events, local_hour, ewma_pct, degraded_seconds, category_seconds, domain_seconds,
+			         first_input, last_input, breaks, break_seconds, suspected_synthetic, synthetic_confidence, media_inhibit, signature, signature_status)
+			        SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+			        WHERE NOT EXISTS (SELECT 1 FROM activity_hourly
+			                          WHERE tenant = ? AND hour_start = ? AND host = ? AND user_name != ?
+			                            AND NOT (deleted_at IS NULL AND ` + gapSQL + `))
+			        ON CONFLICT (tenant, hour_start, host, user_name) DO UPDATE SET ` + hourlyUpdateSet + `
+			        WHERE activity_hourly.deleted_at IS NULL AND activity_hourly.` + gapSQL,
+			Arguments: []interface{}{tenant, row.HourStart, row.Host, row.UserName, row.DisplayName, row.Team, labels,
+				row.ActivityPct, row.IdleSeconds, row.Samples, row.Status, now, row.BatterySeconds, row.BatteryPct, monitors,
+				row.MouseEvents, row.KeyEvents, row.TouchEvents, row.LocalHour, row.EWMAPct, row.DegradedSeconds, categories, domains,
+				row.FirstInput, row.LastInput, row.Breaks, row.BreakSeconds, row.SuspectedSynthetic, row.SyntheticConfidence, row.MediaInhibit, row.Signature, row.SignatureStatus,
+				tenant, row.HourStart, row.Host, row.UserName},
+		})
+		inserts = append(inserts, len(stmts)-1)
+		if Status(row.Status).Measured() {
+			stmts = append(stmts, clearGapsStmt(tenant, row))
+		}
+	}
+	res, err := r.db.Write(ctx, stmts)
+	if err != nil {
+		return 0, err
+	}
+	var inserted int64
+	for _, i := range inserts {
+		if i < len(res) {
+			inserted += res[i].RowsAffected
+		}
+	}
+	for _, row := range rows {
+		if t, err := time.Parse(time.RFC3339, row.HourStart); err == nil {
+			r.InvalidateHour(t)
+		}
+	}
+	return inserted, nil
+}
+
+// GetHour returns the live (not tombstoned) rows for one hour and host,
+// one per user, or only user's when user is not empty.
+func (r *ActivityRepo) GetHour(ctx context.Context, hourStart time.Time, host, user string) ([]ActivityRow, error) {
+	rows, err := r.queryBetween(ctx, hourStart.Format(time.RFC3339), hourStart.Add(time.Hour).Format(time.RFC3339), host, ConsistencyStrong)
+	if err != nil || user == "" {
+		return rows, err
+	}
+	out := rows[:0]
+	for _, row := range rows {
+		if row.UserName == user {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// Correct overwrites the measured values and note of an existing row and
+// records audit in the same transaction.
+func (r *ActivityRepo) Correct(ctx context.Context, row ActivityRow, audit gorqlite.ParameterizedStatement) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{
+		{
+			Query: `UPDATE activity_hourly
+			        SET activity_pct = ?, idle_seconds = ?, samples = ?, status = ?, note = ?
+			        WHERE tenant = ? AND hour_start = ? AND host = ? AND user_name = ? AND deleted_at IS NULL`,
+			Arguments: []interface{}{row.ActivityPct, row.IdleSeconds, row.Samples, row.Status, row.Note, tenantOf(ctx), row.HourStart, row.Host, row.UserName},
+		},
+		audit,
+	})
+	if err != nil {
+		return err
+	}
+	if t, err := time.Parse(time.RFC3339, row.HourStart); err == nil {
+		r.InvalidateHour(t)
+	}
+	return nil
+}
+
+// Tombstone hides a row from every read path without losing it, and
+// records audit in the same transaction.
+func (r *ActivityRepo) Tombstone(ctx context.Context, hourStart time.Time, host, user string, audit gorqlite.ParameterizedStatement) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{
+		{
+			Query:     `UPDATE activity_hourly SET deleted_at = ? WHERE tenant = ? AND hour_start = ? AND host = ? AND user_name = ? AND deleted_at IS NULL`,
+			Arguments: []interface{}{time.Now().UTC().Format(time.RFC3339), tenantOf(ctx), hourStart.Format(time.RFC3339), host, user},
+		},
+		audit,
+	})
+	if err != nil {
+		return err
+	}
+	r.InvalidateHour(hourStart)
+	return nil
+}
+
+// ScorecardDays computes a user's per-day scorecard inputs over
+// [startRFC3339, endRFC3339) in a single query. Days are local to
+// tzModifier (an SQLite modifier such as "+60 minutes"); an hour counts
+// toward the focus streak when activity_pct >= focusPct, and streaks break
+// on missing hours.
+func (r *ActivityRepo) ScorecardDays(ctx context.Context, user, startRFC3339, endRFC3339, tzModifier string, focusPct float64) ([]ScorecardDay, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `WITH h AS (
+		          SELECT date(hour_start, ?) AS day,
+		                 CAST(strftime('%H', hour_start, ?) AS INTEGER) AS hr,
+		                 CAST(strftime('%s', hour_start) AS INTEGER) / 3600 AS epoch_hour,
+		                 activity_pct, idle_seconds, samples,
+		                 activity_pct >= ? AS focused
+		          FROM activity_hourly
+		          WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ?
+		            AND user_name = ? AND deleted_at IS NULL
+		        ),
+		        islands AS (
+		          SELECT day, epoch_hour - ROW_NUMBER() OVER (PARTITION BY day ORDER BY epoch_hour) AS island
+		          FROM h WHERE focused
+		        ),
+		        streaks AS (
+		          SELECT day, MAX(n) AS streak
+		          FROM (SELECT day, island, COUNT(*) AS n FROM islands GROUP BY day, island)
+		          GROUP BY day
+		        )
+		        SELECT h.day,
+		               MIN(CASE WHEN samples > 0 AND activity_pct > 0 THEN hr END),
+		               SUM(activity_pct) / 100.0,
+		               SUM(idle_seconds),
+		               SUM(CASE WHEN samples > 0 THEN 1 ELSE 0 END),
+		               COALESCE(MAX(streaks.streak), 0)
+		        FROM h LEFT JOIN streaks ON streaks.day = h.day
+		        GROUP BY h.day
+		        ORDER BY h.day;`,
+		Arguments: append([]interface{}{tzModifier, tzModifier, focusPct},
+			tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, user)...)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	days := make([]ScorecardDay, 0, 8)
+	for qr.Next() {
+		var (
+			d        ScorecardDay
+			firstHr  gorqlite.NullInt64
+			trackedH int64
+			streak   int64
+		)
+		if err := qr.Scan(&d.Day, &firstHr, &d.ActiveHours, &d.IdleSeconds, &trackedH, &streak); err != nil {
+			return nil, err
+		}
+		if firstHr.Valid {
+			h := int(firstHr.Int64)
+			d.FirstActiveHour = &h
+		}
+		d.TrackedHours, d.FocusStreak = int(trackedH), int(streak)
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// queryBucketSQL and queryGroupSQL are the SQL expressions behind
+// POST /activity/query's granularity and group_by; bucket expressions
+// take the time-zone modifier as their only argument.
+var (
+	queryBucketSQL = map[string]string{
+		"hour":  `strftime('%Y-%m-%dT%H:00:00', hour_start, ?)`,
+		"day":   `date(hour_start, ?)`,
+		"week":  `date(hour_start, ?, '-6 days', 'weekday 1')`,
+		"month": `strftime('%Y-%m', hour_start, ?)`,
+	}
+	queryGroupSQL = map[string]string{
+		"":       `''`,
+		"user":   `user_name`,
+		"team":   `team`,
+		"status": `status`,
+	}
+)
+
+// QueryBuckets aggregates the rows of hosts over [startRFC3339,
+// endRFC3339) per host, bucket and group in a single query. granularity
+// and groupBy are keys of queryBucketSQL and queryGroupSQL; buckets are
+// local to tzModifier (see ScorecardDays). Averages and idle time skip
+// gap rows, as in summarizeHost.
+func (r *ActivityRepo) QueryBuckets(ctx context.Context, hosts []string, startRFC3339, endRFC3339, granularity, groupBy, tzModifier string) ([]QueryBucket, error) {
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	args := append([]interface{}{tzModifier}, tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339)...)...)
+	for _, h := range hosts {
+		args = append(args, h)
+	}
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT host, ` + queryBucketSQL[granularity] + ` AS bucket, ` + queryGroupSQL[groupBy] + ` AS grp,
+		               COUNT(*),
+		               SUM(CASE WHEN ` + measuredSQL + ` AND status != 'OFF' THEN 1 ELSE 0 END),
+		               COALESCE(AVG(CASE WHEN ` + measuredSQL + ` THEN activity_pct END), 0),
+		               COALESCE(SUM(CASE WHEN ` + measuredSQL + ` THEN idle_seconds END), 0),
+		               SUM(samples)
+		        FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ?
+		          AND host IN (?` + strings.Repeat(", ?", len(hosts)-1) + `) AND deleted_at IS NULL
+		        GROUP BY host, bucket, grp
+		        ORDER BY host, bucket, grp;`,
+		Arguments: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]QueryBucket, 0, 16)
+	for qr.Next() {
+		var (
+			b            QueryBucket
+			hours, activ int64
+		)
+		if err := qr.Scan(&b.Host, &b.Bucket, &b.Group, &hours, &activ, &b.AvgActivityPct, &b.IdleSeconds, &b.Samples); err != nil {
+			return nil, err
+		}
+		b.Hours, b.ActiveHours = int(hours), int(activ)
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// Stats computes the distribution of activity_pct over the measured rows
+// in [startRFC3339, endRFC3339), optionally for one host: moments and
+// nearest-rank percentiles in one query, the histogram (bucketWidth wide,
+// a divisor of 100) in a second.
+func (r *ActivityRepo) Stats(ctx context.Context, startRFC3339, endRFC3339, host string, bucketWidth int) (ActivityStats, error) {
+	st := ActivityStats{Histogram: make([]HistogramBucket, 0, 100/bucketWidth)}
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `WITH v AS (
+		          SELECT activity_pct AS x,
+		                 ROW_NUMBER() OVER (ORDER BY activity_pct) AS rn,
+		                 COUNT(*) OVER () AS n
+		          FROM activity_hourly
+		          WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ? AND (? = '' OR host = ?)
+		            AND deleted_at IS NULL AND ` + measuredSQL + `
+		        )
+		        SELECT COUNT(*), COALESCE(AVG(x), 0), COALESCE(AVG(x * x), 0),
+		               COALESCE(MIN(x), 0), COALESCE(MAX(x), 0),
+		               COALESCE(MAX(CASE WHEN rn = (n * 50 + 99) / 100 THEN x END), 0),
+		               COALESCE(MAX(CASE WHEN rn = (n * 90 + 99) / 100 THEN x END), 0),
+		               COALESCE(MAX(CASE WHEN rn = (n * 99 + 99) / 100 THEN x END), 0)
+		        FROM v;`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...),
+	})
+	if err != nil {
+		return st, err
+	}
+	if qr.Err != nil {
+		return st, qr.Err
+	}
+	var (
+		n      int64
+		meanSq float64
+	)
+	if qr.Next() {
+		if err := qr.Scan(&n, &st.Mean, &meanSq, &st.Min, &st.Max, &st.P50, &st.P90, &st.P99); err != nil {
+			return st, err
+		}
+	}
+	st.Hours = int(n)
+	if v := meanSq - st.Mean*st.Mean; v > 0 {
+		st.StdDev = math.Sqrt(v)
+	}
+
+	counts := make(map[int64]int)
+	qr, err = r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT MIN(CAST(activity_pct / ? AS INTEGER), ?) AS bucket, COUNT(*)
+		        FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ? AND (? = '' OR host = ?)
+		          AND deleted_at IS NULL AND ` + measuredSQL + `
+		        GROUP BY bucket;`,
+		Arguments: append([]interface{}{bucketWidth, 100/bucketWidth - 1},
+			tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...)...),
+	})
+	if err != nil {
+		return st, err
+	}
+	if qr.Err != nil {
+		return st, qr.Err
+	}
+	for qr.Next() {
+		var bucket, count int64
+		if err := qr.Scan(&bucket, &count); err != nil {
+			return st, err
+		}
+		counts[bucket] = int(count)
+	}
+	for i := 0; i < 100/bucketWidth; i++ {
+		st.Histogram = append(st.Histogram, HistogramBucket{
+			From:  float64(i * bucketWidth),
+			To:    float64((i + 1) * bucketWidth),
+			Hours: counts[int64(i)],
+		})
+	}
+	return st, nil
+}
+
+// BreakDays totals breaks per host and local day (shifted by tzModifier,
+// e.g. "+60 minutes") over [startRFC3339, endRFC3339), optionally for one
+// host and one user.
+func (r *ActivityRepo) BreakDays(ctx context.Context, startRFC3339, endRFC3339, host, user, tzModifier string) ([]BreakDay, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT date(hour_start, ?) AS day, host, MAX(user_name), SUM(breaks), SUM(break_seconds)
+		        FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ?
+		          AND (? = '' OR host = ?) AND (? = '' OR user_name = ?)
+		          AND deleted_at IS NULL AND ` + measuredSQL + `
+		        GROUP BY day, host
+		        ORDER BY day, host;`,
+		Arguments: append([]interface{}{tzModifier},
+			tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host, user, user)...)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	days := make([]BreakDay, 0, 8)
+	for qr.Next() {
+		var d BreakDay
+		if err := qr.Scan(&d.Day, &d.Host, &d.UserName, &d.Breaks, &d.BreakSeconds); err != nil {
+			return nil, err
+		}
+		if d.Breaks > 0 {
+			d.AvgBreakSeconds = d.BreakSeconds / float64(d.Breaks)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// SecondsTotals sums a JSON seconds-per-key column (category_seconds or
+// domain_seconds) per key over [startRFC3339, endRFC3339), optionally for
+// one host and one user, largest first.
+func (r *ActivityRepo) SecondsTotals(ctx context.Context, column, startRFC3339, endRFC3339, host, user string) ([]SecondsTotal, error) {
+	if column != "category_seconds" && column != "domain_seconds" {
+		return nil, fmt.Errorf("no seconds breakdown in column %q", column)
+	}
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT c.key, SUM(c.value)
+		        FROM activity_hourly, json_each(activity_hourly.` + column + `) AS c
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND hour_start < ?
+		          AND (? = '' OR host = ?) AND (? = '' OR user_name = ?) AND deleted_at IS NULL
+		        GROUP BY c.key
+		        ORDER BY 2 DESC, 1;`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host, user, user)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]SecondsTotal, 0, 8)
+	total := 0.0
+	for qr.Next() {
+		var t SecondsTotal
+		if err := qr.Scan(&t.Name, &t.Seconds); err != nil {
+			return nil, err
+		}
+		total += t.Seconds
+		out = append(out, t)
+	}
+	for i := range out {
+		if total > 0 {
+			out[i].SharePct = out[i].Seconds * 100 / total
+		}
+	}
+	return out, nil
+}
+
+// SignedRow is a row an agent signed and wrote straight to rqlite, with
+// the fields of bucketPayload.
+type SignedRow struct {
+	HourStart   string
+	Host        string
+	UserName    string
+	ActivityPct float64
+	IdleSeconds float64
+	Samples     int64
+	Status      string
+	MouseEvents int64
+	KeyEvents   int64
+	TouchEvents int64
+	Signature   string
+}
+
+// UncheckedSignatures returns up to limit signed rows from startRFC3339 on
+// whose signature_status is still empty.
+func (r *ActivityRepo) UncheckedSignatures(ctx context.Context, startRFC3339 string, limit int) ([]SignedRow, error) {
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT hour_start, host, user_name, activity_pct, idle_seconds, samples, status,
+		               mouse_events, key_events, touch_events, signature
+		        FROM activity_hourly
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND hour_start >= ? AND signature != '' AND signature_status = ''
+		        LIMIT ?`,
+		Arguments: tenantArgs(ctx, monthArgs(startRFC3339, end, startRFC3339, limit)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]SignedRow, 0, 16)
+	for qr.Next() {
+		var s SignedRow
+		if err := qr.Scan(&s.HourStart, &s.Host, &s.UserName, &s.ActivityPct, &s.IdleSeconds, &s.Samples, &s.Status,
+			&s.MouseEvents, &s.KeyEvents, &s.TouchEvents, &s.Signature); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// SetSignatureStatus stores the signature_status of checked rows, keyed
+// by hour_start, host and user_name. A row re-uploaded meanwhile carries
+// a new signature and is left for the next check.
+func (r *ActivityRepo) SetSignatureStatus(ctx context.Context, rows []SignedRow, statuses []string) error {
+	stmts := make([]gorqlite.ParameterizedStatement, len(rows))
+	for i, s := range rows {
+		stmts[i] = gorqlite.ParameterizedStatement{
+			Query: `UPDATE activity_hourly SET signature_status = ?
+			        WHERE tenant = ? AND hour_start = ? AND host = ? AND user_name = ? AND signature = ?`,
+			Arguments: []interface{}{statuses[i], tenantOf(ctx), s.HourStart, s.Host, s.UserName, s.Signature},
+		}
+	}
+	_, err := r.db.Write(ctx, stmts)
+	return err
+}
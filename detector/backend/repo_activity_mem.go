@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// MemActivityRepo is an in-memory ActivityRepository following the same
+// rules as the SQL behind ActivityRepo: ranges compare hour_start as text,
+// tombstoned rows are kept but never read, gap rows stay out of the
+// aggregates, (tenant, hour, host, user) is the key and only ctx's
+// tenant's rows are seen or written. It has no cache, so consistency levels make no
+// difference.
+type MemActivityRepo struct {
+	mu   sync.Mutex
+	rows map[[4]string]*memActivityRow
+}
+
+type memActivityRow struct {
+	ActivityRow
+	tenant  string
+	deleted bool
+}
+
+var _ ActivityRepository = (*MemActivityRepo)(nil)
+
+// NewMemActivityRepo returns a repo holding rows, in the default tenant.
+func NewMemActivityRepo(rows ...ActivityRow) *MemActivityRepo {
+	r := &MemActivityRepo{rows: make(map[[4]string]*memActivityRow)}
+	for _, row := range rows {
+		r.rows[[4]string{defaultTenant, row.HourStart, row.Host, row.UserName}] = &memActivityRow{ActivityRow: row, tenant: defaultTenant}
+	}
+	return r
+}
+
+func (r *MemActivityRepo) InvalidateHour(time.Time) {}
+
+func (r *MemActivityRepo) InvalidateRange(time.Time, time.Time) {}
+
+// live returns tenant's live rows in [startRFC3339, endRFC3339), optionally
+// for one host and one user, ordered by hour, host and user. r.mu must be
+// held.
+func (r *MemActivityRepo) live(tenant, startRFC3339, endRFC3339, host, user string) []ActivityRow {
+	out := make([]ActivityRow, 0, 16)
+	for _, row := range r.rows {
+		if row.deleted || row.tenant != tenant || row.HourStart < startRFC3339 || row.HourStart >= endRFC3339 ||
+			(host != "" && row.Host != host) || (user != "" && row.UserName != user) {
+			continue
+		}
+		out = append(out, row.ActivityRow)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].HourStart != out[j].HourStart {
+			return out[i].HourStart < out[j].HourStart
+		}
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].UserName < out[j].UserName
+	})
+	return out
+}
+
+// measured drops gap rows from rows in place.
+func measured(rows []ActivityRow) []ActivityRow {
+	out := rows[:0]
+	for _, row := range rows {
+		if Status(row.Status).Measured() {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func (r *MemActivityRepo) GetBetween(ctx context.Context, startRFC3339, endRFC3339, host, _ string) ([]ActivityRow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.live(tenantOf(ctx), startRFC3339, endRFC3339, host, ""), nil
+}
+
+func (r *MemActivityRepo) Hosts(ctx context.Context, startRFC3339, endRFC3339 string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	hosts := make([]string, 0, 16)
+	for _, row := range r.live(tenantOf(ctx), startRFC3339, endRFC3339, "", "") {
+		if !seen[row.Host] {
+			seen[row.Host] = true
+			hosts = append(hosts, row.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+func (r *MemActivityRepo) LastHours(ctx context.Context, startRFC3339, endRFC3339 string) ([]HostLastHour, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := make(map[string]HostLastHour)
+	for _, row := range measured(r.live(tenantOf(ctx), startRFC3339, endRFC3339, "", "")) {
+		if row.HourStart >= last[row.Host].HourStart {
+			last[row.Host] = HostLastHour{Host: row.Host, UserName: row.UserName, HourStart: row.HourStart}
+		}
+	}
+	out := make([]HostLastHour, 0, len(last))
+	for _, h := range last {
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out, nil
+}
+
+func (r *MemActivityRepo) Heatmap(ctx context.Context, startRFC3339, endRFC3339, host string) (Heatmap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		hm   Heatmap
+		sums [7][24]float64
+	)
+	for _, row := range measured(r.live(tenantOf(ctx), startRFC3339, endRFC3339, host, "")) {
+		t, err := time.Parse(time.RFC3339, row.HourStart)
+		if err != nil {
+			continue
+		}
+		t = t.UTC()
+		sums[t.Weekday()][t.Hour()] += row.ActivityPct
+		hm.Samples[t.Weekday()][t.Hour()]++
+	}
+	for d := range sums {
+		for h := range sums[d] {
+			if n := hm.Samples[d][h]; n > 0 {
+				avg := sums[d][h] / float64(n)
+				hm.AvgActivityPct[d][h] = &avg
+			}
+		}
+	}
+	return hm, nil
+}
+
+func (r *MemActivityRepo) Upsert(ctx context.Context, rows []HourlyIngest, _ ...gorqlite.ParameterizedStatement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now, tenant := time.Now().UTC().Format(time.RFC3339), tenantOf(ctx)
+	for _, in := range rows {
+		key := [4]string{tenant, in.HourStart, in.Host, in.UserName}
+		switch old := r.rows[key]; {
+		case old == nil:
+			r.rows[key] = &memActivityRow{ActivityRow: ingestedRow(in, "", now), tenant: tenant}
+		case !old.deleted:
+			old.ActivityRow = ingestedRow(in, old.Note, now)
+		}
+		if Status(in.Status).Measured() {
+			r.clearGaps(tenant, in)
+		}
+	}
+	return nil
+}
+
+func (r *MemActivityRepo) InsertMissing(ctx context.Context, rows []HourlyIngest) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now, tenant := time.Now().UTC().Format(time.RFC3339), tenantOf(ctx)
+	var inserted int64
+	for _, in := range rows {
+		if !r.heldByOther(tenant, in) {
+			key := [4]string{tenant, in.HourStart, in.Host, in.UserName}
+			switch old := r.rows[key]; {
+			case old == nil:
+				r.rows[key] = &memActivityRow{ActivityRow: ingestedRow(in, "", now), tenant: tenant}
+				inserted++
+			case !old.deleted && !Status(old.Status).Measured():
+				old.ActivityRow = ingestedRow(in, old.Note, now)
+				inserted++
+			}
+		}
+		if Status(in.Status).Measured() {
+			r.clearGaps(tenant, in)
+		}
+	}
+	return inserted, nil
+}
+
+// heldByOther reports whether another user of tenant stores in's
+// host-hour with anything but a live gap row. r.mu must be held.
+func (r *MemActivityRepo) heldByOther(tenant string, in HourlyIngest) bool {
+	for _, row := range r.rows {
+		if row.tenant == tenant && row.HourStart == in.HourStart && row.Host == in.Host && row.UserName != in.UserName &&
+			(row.deleted || Status(row.Status).Measured()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearGaps is clearGapsStmt. r.mu must be held.
+func (r *MemActivityRepo) clearGaps(tenant string, in HourlyIngest) {
+	for key, row := range r.rows {
+		if row.tenant == tenant && row.HourStart == in.HourStart && row.Host == in.Host && row.UserName != in.UserName &&
+			!row.deleted && !Status(row.Status).Measured() {
+			delete(r.rows, key)
+		}
+	}
+}
+
+// ingestedRow is the stored form of in, as Upsert writes it.
+func ingestedRow(in HourlyIngest, note, createdAt string) ActivityRow {
+	return ActivityRow{
+		HourStart: in.HourStart, Host: in.Host, UserName: in.UserName, DisplayName: in.DisplayName,
+		Team: in.Team, Labels: in.Labels, ActivityPct: in.ActivityPct, IdleSeconds: in.IdleSeconds,
+		Samples: in.Samples, Status: in.Status, Note: note, CreatedAt: createdAt,
+		BatterySeconds: in.BatterySeconds, BatteryPct: in.BatteryPct, MonitorSeconds: in.MonitorSeconds,
+		MouseEvents: in.MouseEvents, KeyEvents: in.KeyEvents, TouchEvents: in.TouchEvents,
+		LocalHour: in.LocalHour, EWMAPct: in.EWMAPct, DegradedSeconds: in.DegradedSeconds,
+		CategorySeconds: in.CategorySeconds, DomainSeconds: in.DomainSeconds,
+		FirstInput: in.FirstInput, LastInput: in.LastInput, Breaks: in.Breaks, BreakSeconds: in.BreakSeconds,
+		SuspectedSynthetic: in.SuspectedSynthetic, SyntheticConfidence: in.SyntheticConfidence,
+		MediaInhibit: in.MediaInhibit, SignatureStatus: in.SignatureStatus,
+	}
+}
+
+func (r *MemActivityRepo) GetHour(ctx context.Context, hourStart time.Time, host, user string) ([]ActivityRow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.live(tenantOf(ctx), hourStart.Format(time.RFC3339), hourStart.Add(time.Hour).Format(time.RFC3339), host, user), nil
+}
+
+func (r *MemActivityRepo) Correct(ctx context.Context, row ActivityRow, _ gorqlite.ParameterizedStatement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old := r.rows[[4]string{tenantOf(ctx), row.HourStart, row.Host, row.UserName}]; old != nil && !old.deleted {
+		old.ActivityPct, old.IdleSeconds, old.Samples, old.Status, old.Note = row.ActivityPct, row.IdleSeconds, row.Samples, row.Status, row.Note
+	}
+	return nil
+}
+
+func (r *MemActivityRepo) Tombstone(ctx context.Context, hourStart time.Time, host, user string, _ gorqlite.ParameterizedStatement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old := r.rows[[4]string{tenantOf(ctx), hourStart.Format(time.RFC3339), host, user}]; old != nil {
+		old.deleted = true
+	}
+	return nil
+}
+
+// shiftHour parses hourStart and applies a "+60 minutes" style time-zone
+// modifier, as SQLite's date functions do.
+func shiftHour(hourStart, tzModifier string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, hourStart)
+	if err != nil {
+		return t, false
+	}
+	var minutes int
+	fmt.Sscanf(tzModifier, "%d minutes", &minutes)
+	return t.UTC().Add(time.Duration(minutes) * time.Minute), true
+}
+
+func (r *MemActivityRepo) ScorecardDays(ctx context.Context, user, startRFC3339, endRFC3339, tzModifier string, focusPct float64) ([]ScorecardDay, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byDay := make(map[string]*ScorecardDay)
+	focused := make(map[string][]int64) // epoch hours per day
+	var order []string
+	for _, row := range r.live(tenantOf(ctx), startRFC3339, endRFC3339, "", user) {
+		t, ok := shiftHour(row.HourStart, tzModifier)
+		if !ok {
+			continue
+		}
+		day := t.Format("2006-01-02")
+		d := byDay[day]
+		if d == nil {
+			d = &ScorecardDay{Day: day}
+			byDay[day] = d
+			order = append(order, day)
+		}
+		if row.Samples > 0 && row.ActivityPct > 0 && (d.FirstActiveHour == nil || t.Hour() < *d.FirstActiveHour) {
+			h := t.Hour()
+			d.FirstActiveHour = &h
+		}
+		d.ActiveHours += row.ActivityPct / 100
+		d.IdleSeconds += row.IdleSeconds
+		if row.Samples > 0 {
+			d.TrackedHours++
+		}
+		if row.ActivityPct >= focusPct {
+			focused[day] = append(focused[day], t.Unix()/3600)
+		}
+	}
+	sort.Strings(order)
+	days := make([]ScorecardDay, 0, len(order))
+	for _, day := range order {
+		// consecutive hours share epoch hour minus rank, as in the SQL
+		hours := focused[day]
+		sort.Slice(hours, func(i, j int) bool { return hours[i] < hours[j] })
+		islands := make(map[int64]int)
+		for i, h := range hours {
+			islands[h-int64(i)]++
+		}
+		for _, n := range islands {
+			if n > byDay[day].FocusStreak {
+				byDay[day].FocusStreak = n
+			}
+		}
+		days = append(days, *byDay[day])
+	}
+	return days, nil
+}
+
+// bucketOf is queryBucketSQL in Go.
+func bucketOf(t time.Time, granularity string) string {
+	switch granularity {
+	case "hour":
+		return t.Format("2006-01-02T15:00:00")
+	case "week":
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7).Format("2006-01-02")
+	case "month":
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// groupOf is queryGroupSQL in Go.
+func groupOf(row ActivityRow, groupBy string) string {
+	switch groupBy {
+	case "user":
+		return row.UserName
+	case "team":
+		return row.Team
+	case "status":
+		return row.Status
+	}
+	return ""
+}
+
+func (r *MemActivityRepo) QueryBuckets(ctx context.Context, hosts []string, startRFC3339, endRFC3339, granularity, groupBy, tzModifier string) ([]QueryBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	type acc struct {
+		b        QueryBucket
+		measured int
+		pctSum   float64
+	}
+	accs := make(map[[3]string]*acc)
+	for _, host := range hosts {
+		for _, row := range r.live(tenantOf(ctx), startRFC3339, endRFC3339, host, "") {
+			t, ok := shiftHour(row.HourStart, tzModifier)
+			if !ok {
+				continue
+			}
+			key := [3]string{host, bucketOf(t, granularity), groupOf(row, groupBy)}
+			a := accs[key]
+			if a == nil {
+				a = &acc{b: QueryBucket{Host: key[0], Bucket: key[1], Group: key[2]}}
+				accs[key] = a
+			}
+			a.b.Hours++
+			a.b.Samples += row.Samples
+			if Status(row.Status).Measured() {
+				a.measured++
+				a.pctSum += row.ActivityPct
+				a.b.IdleSeconds += row.IdleSeconds
+				if row.Status != "OFF" {
+					a.b.ActiveHours++
+				}
+			}
+		}
+	}
+	out := make([]QueryBucket, 0, len(accs))
+	for _, a := range accs {
+		if a.measured > 0 {
+			a.b.AvgActivityPct = a.pctSum / float64(a.measured)
+		}
+		out = append(out, a.b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		if out[i].Bucket != out[j].Bucket {
+			return out[i].Bucket < out[j].Bucket
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out, nil
+}
+
+func (r *MemActivityRepo) Stats(ctx context.Context, startRFC3339, endRFC3339, host string, bucketWidth int) (ActivityStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buckets := 100 / bucketWidth
+	st := ActivityStats{Histogram: make([]HistogramBucket, buckets)}
+	for i := range st.Histogram {
+		st.Histogram[i] = HistogramBucket{From: float64(i * bucketWidth), To: float64((i + 1) * bucketWidth)}
+	}
+	rows := measured(r.live(tenantOf(ctx), startRFC3339, endRFC3339, host, ""))
+	if len(rows) == 0 {
+		return st, nil
+	}
+	xs := make([]float64, len(rows))
+	var sum, sumSq float64
+	for i, row := range rows {
+		xs[i] = row.ActivityPct
+		sum += row.ActivityPct
+		sumSq += row.ActivityPct * row.ActivityPct
+		st.Histogram[min(int(row.ActivityPct/float64(bucketWidth)), buckets-1)].Hours++
+	}
+	sort.Float64s(xs)
+	n := len(xs)
+	st.Hours = n
+	st.Mean = sum / float64(n)
+	if v := sumSq/float64(n) - st.Mean*st.Mean; v > 0 {
+		st.StdDev = math.Sqrt(v)
+	}
+	st.Min, st.Max = xs[0], xs[n-1]
+	// nearest rank, as in the SQL
+	st.P50, st.P90, st.P99 = xs[(n*50+99)/100-1], xs[(n*90+99)/100-1], xs[(n*99+99)/100-1]
+	return st, nil
+}
+
+func (r *MemActivityRepo) BreakDays(ctx context.Context, startRFC3339, endRFC3339, host, user, tzModifier string) ([]BreakDay, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byKey := make(map[[2]string]*BreakDay)
+	for _, row := range measured(r.live(tenantOf(ctx), startRFC3339, endRFC3339, host, user)) {
+		t, ok := shiftHour(row.HourStart, tzModifier)
+		if !ok {
+			continue
+		}
+		key := [2]string{t.Format("2006-01-02"), row.Host}
+		d := byKey[key]
+		if d == nil {
+			d = &BreakDay{Day: key[0], Host: key[1]}
+			byKey[key] = d
+		}
+		if row.UserName > d.UserName {
+			d.UserName = row.UserName
+		}
+		d.Breaks += row.Breaks
+		d.BreakSeconds += row.BreakSeconds
+	}
+	days := make([]BreakDay, 0, len(byKey))
+	for _, d := range byKey {
+		if d.Breaks > 0 {
+			d.AvgBreakSeconds = d.BreakSeconds / float64(d.Breaks)
+		}
+		days = append(days, *d)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Day != days[j].Day {
+			return days[i].Day < days[j].Day
+		}
+		return days[i].Host < days[j].Host
+	})
+	return days, nil
+}
+
+func (r *MemActivityRepo) SecondsTotals(ctx context.Context, column, startRFC3339, endRFC3339, host, user string) ([]SecondsTotal, error) {
+	if column != "category_seconds" && column != "domain_seconds" {
+		return nil, fmt.Errorf("no seconds breakdown in column %q", column)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sums := make(map[string]float64)
+	for _, row := range r.live(tenantOf(ctx), startRFC3339, endRFC3339, host, user) {
+		m := row.CategorySeconds
+		if column == "domain_seconds" {
+			m = row.DomainSeconds
+		}
+		for k, v := range m {
+			sums[k] += v
+		}
+	}
+	out := make([]SecondsTotal, 0, len(sums))
+	total := 0.0
+	for k, v := range sums {
+		out = append(out, SecondsTotal{Name: k, Seconds: v})
+		total += v
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Seconds != out[j].Seconds {
+			return out[i].Seconds > out[j].Seconds
+		}
+		return out[i].Name < out[j].Name
+	})
+	for i := range out {
+		if total > 0 {
+			out[i].SharePct = out[i].Seconds * 100 / total
+		}
+	}
+	return out, nil
+}
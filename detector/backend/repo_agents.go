@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// AgentRepo tracks agents from their heartbeats (agents table).
+type AgentRepo struct {
+	db *DB
+}
+
+func NewAgentRepo(db *DB) *AgentRepo {
+	return &AgentRepo{db: db}
+}
+
+// Seen records a heartbeat in ctx's tenant, keeping first_seen from the
+// first one, and marks the current hour as one the agent was up in.
+func (r *AgentRepo) Seen(ctx context.Context, a Agent) error {
+	t := time.Now().UTC()
+	now, tenant := t.Format(time.RFC3339), tenantOf(ctx)
+	res := a.Resources
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `INSERT INTO agents (tenant, host, user_name, agent_version, protocol_version, os, remote_addr, first_seen, last_seen,
+		                            cpu_seconds, rss_bytes, goroutines, uptime_seconds, agent_commit, agent_build_date,
+		                            last_input, mode)
+		        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		        ON CONFLICT (tenant, host) DO UPDATE SET
+		          user_name = excluded.user_name, agent_version = excluded.agent_version,
+		          agent_commit = excluded.agent_commit, agent_build_date = excluded.agent_build_date,
+		          protocol_version = excluded.protocol_version, os = excluded.os,
+		          remote_addr = excluded.remote_addr, last_seen = excluded.last_seen,
+		          cpu_seconds = excluded.cpu_seconds, rss_bytes = excluded.rss_bytes,
+		          goroutines = excluded.goroutines, uptime_seconds = excluded.uptime_seconds,
+		          last_input = excluded.last_input, mode = excluded.mode`,
+		Arguments: []interface{}{tenant, a.Host, a.UserName, a.AgentVersion, a.ProtocolVersion, a.OS, a.RemoteAddr, now, now,
+			res.CPUSeconds, res.RSSBytes, res.Goroutines, res.UptimeSeconds, a.AgentCommit, a.AgentBuildDate,
+			a.LastInput, a.Mode},
+	}, {
+		Query: `INSERT INTO agent_heartbeat_hours (tenant, host, hour_start)
+		        VALUES (?, ?, ?)
+		        ON CONFLICT DO NOTHING`,
+		Arguments: []interface{}{tenant, a.Host, t.Truncate(time.Hour).Format(time.RFC3339)},
+	}})
+	return err
+}
+
+// HeartbeatHours returns the hours in [fromRFC3339, toRFC3339) in which
+// host sent a heartbeat.
+func (r *AgentRepo) HeartbeatHours(ctx context.Context, host, fromRFC3339, toRFC3339 string) (map[string]bool, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT hour_start FROM agent_heartbeat_hours
+		        WHERE tenant = ? AND host = ? AND hour_start >= ? AND hour_start < ?`,
+		Arguments: tenantArgs(ctx, host, fromRFC3339, toRFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	hours := make(map[string]bool)
+	for qr.Next() {
+		var h string
+		if err := qr.Scan(&h); err != nil {
+			return nil, err
+		}
+		hours[h] = true
+	}
+	return hours, nil
+}
+
+// PruneHeartbeatHours drops the tenant's heartbeat hours before
+// beforeRFC3339.
+func (r *AgentRepo) PruneHeartbeatHours(ctx context.Context, beforeRFC3339 string) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `DELETE FROM agent_heartbeat_hours WHERE tenant = ? AND hour_start < ?`,
+		Arguments: tenantArgs(ctx, beforeRFC3339),
+	}})
+	return err
+}
+
+func (r *AgentRepo) List(ctx context.Context) ([]Agent, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT host, user_name, agent_version, protocol_version, os, remote_addr, first_seen, last_seen,
+		               heartbeat_interval, config_poll_interval,
+		               cpu_seconds, rss_bytes, goroutines, uptime_seconds, agent_commit, agent_build_date,
+		               last_input, mode
+		        FROM agents WHERE tenant = ? ORDER BY host`,
+		Arguments: tenantArgs(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	agents := make([]Agent, 0, 16)
+	for qr.Next() {
+		var (
+			a                 Agent
+			proto, goroutines int64
+		)
+		if err := qr.Scan(&a.Host, &a.UserName, &a.AgentVersion, &proto, &a.OS, &a.RemoteAddr, &a.FirstSeen, &a.LastSeen,
+			&a.Intervals.Heartbeat, &a.Intervals.ConfigPoll,
+			&a.Resources.CPUSeconds, &a.Resources.RSSBytes, &goroutines, &a.Resources.UptimeSeconds,
+			&a.AgentCommit, &a.AgentBuildDate, &a.LastInput, &a.Mode); err != nil {
+			return nil, err
+		}
+		a.ProtocolVersion = int(proto)
+		a.Resources.Goroutines = int(goroutines)
+		if a.Resources.UptimeSeconds > 0 {
+			a.Resources.CPUPct = a.Resources.CPUSeconds / a.Resources.UptimeSeconds * 100
+		}
+		agents = append(agents, a)
+	}
+	return agents, nil
+}
+
+// Intervals returns host's interval override; unknown hosts have none.
+func (r *AgentRepo) Intervals(ctx context.Context, host string) (AgentIntervals, error) {
+	var i AgentIntervals
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT heartbeat_interval, config_poll_interval FROM agents WHERE tenant = ? AND host = ?`,
+		Arguments: tenantArgs(ctx, host),
+	})
+	if err != nil {
+		return i, err
+	}
+	if qr.Err != nil {
+		return i, qr.Err
+	}
+	if qr.Next() {
+		if err := qr.Scan(&i.Heartbeat, &i.ConfigPoll); err != nil {
+			return i, err
+		}
+	}
+	return i, nil
+}
+
+// SetIntervals stores host's interval override. It reports false when the
+// agent has never sent a heartbeat.
+func (r *AgentRepo) SetIntervals(ctx context.Context, host string, i AgentIntervals) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE agents SET heartbeat_interval = ?, config_poll_interval = ? WHERE tenant = ? AND host = ?`,
+		Arguments: []interface{}{i.Heartbeat, i.ConfigPoll, tenantOf(ctx), host},
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
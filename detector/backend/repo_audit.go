@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rqlite/gorqlite"
+)
+
+type AuditRepo struct {
+	db *DB
+}
+
+func NewAuditRepo(db *DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// Record writes a standalone audit entry (see auditStmt).
+func (r *AuditRepo) Record(ctx context.Context, stmt gorqlite.ParameterizedStatement) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{stmt})
+	return err
+}
+
+// AuditFilter narrows List; empty fields match everything. BeforeID pages
+// backwards from a previous page's last ID.
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	Target   string
+	From     string // RFC3339, inclusive
+	To       string // RFC3339, exclusive
+	BeforeID int64
+	Limit    int
+}
+
+// List returns the tenant's matching entries, newest first.
+func (r *AuditRepo) List(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT id, at, actor, action, target, payload_hash, request_id, before_json, after_json
+		        FROM audit_log
+		        WHERE tenant = ? AND (? = '' OR actor = ?) AND (? = '' OR action = ?) AND (? = '' OR target = ?)
+		          AND (? = '' OR at >= ?) AND (? = '' OR at < ?) AND (? = 0 OR id < ?)
+		        ORDER BY id DESC
+		        LIMIT ?`,
+		Arguments: tenantArgs(ctx, f.Actor, f.Actor, f.Action, f.Action, f.Target, f.Target,
+			f.From, f.From, f.To, f.To, f.BeforeID, f.BeforeID, f.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	entries := make([]AuditEntry, 0, 16)
+	for qr.Next() {
+		var (
+			e             AuditEntry
+			before, after string
+		)
+		if err := qr.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Target, &e.PayloadHash, &e.RequestID, &before, &after); err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
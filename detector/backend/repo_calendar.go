@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// CalendarRepo stores calendar links (calendar_accounts) and the meetings
+// synced from them (calendar_meetings).
+type CalendarRepo struct {
+	db *DB
+}
+
+func NewCalendarRepo(db *DB) *CalendarRepo {
+	return &CalendarRepo{db: db}
+}
+
+const calendarAccountColumns = `user_name, provider, calendar_id, refresh_token, synced_at, last_error, updated_at`
+
+// Accounts returns the tenant's linked calendars, tokens included.
+func (r *CalendarRepo) Accounts(ctx context.Context) ([]CalendarAccount, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT ` + calendarAccountColumns + ` FROM calendar_accounts WHERE tenant = ? ORDER BY user_name`,
+		Arguments: tenantArgs(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	accounts := make([]CalendarAccount, 0, 16)
+	for qr.Next() {
+		var a CalendarAccount
+		if err := qr.Scan(&a.UserName, &a.Provider, &a.CalendarID, &a.RefreshToken, &a.SyncedAt, &a.LastError, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+// Put links a.UserName's calendar, replacing any previous link.
+func (r *CalendarRepo) Put(ctx context.Context, a CalendarAccount) (CalendarAccount, error) {
+	a.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	a.SyncedAt, a.LastError = "", ""
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `INSERT OR REPLACE INTO calendar_accounts (tenant, ` + calendarAccountColumns + `)
+		        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		Arguments: tenantArgs(ctx, a.UserName, a.Provider, a.CalendarID, a.RefreshToken, a.SyncedAt, a.LastError, a.UpdatedAt),
+	}})
+	return a, err
+}
+
+// Delete unlinks user's calendar and forgets their meetings; ok is false
+// when there was no link.
+func (r *CalendarRepo) Delete(ctx context.Context, user string) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{
+		{Query: `DELETE FROM calendar_accounts WHERE tenant = ? AND user_name = ?`, Arguments: tenantArgs(ctx, user)},
+		{Query: `DELETE FROM calendar_meetings WHERE tenant = ? AND user_name = ?`, Arguments: tenantArgs(ctx, user)},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
+
+// Synced replaces user's meetings starting in [from, to) with ms and
+// records the sync, with the refresh token to use next time.
+func (r *CalendarRepo) Synced(ctx context.Context, user, refreshToken string, from, to time.Time, ms []meeting) error {
+	stmts := []gorqlite.ParameterizedStatement{
+		{
+			Query:     `DELETE FROM calendar_meetings WHERE tenant = ? AND user_name = ? AND start_at >= ? AND start_at < ?`,
+			Arguments: tenantArgs(ctx, user, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)),
+		},
+		{
+			Query:     `UPDATE calendar_accounts SET refresh_token = ?, synced_at = ?, last_error = '' WHERE tenant = ? AND user_name = ?`,
+			Arguments: []interface{}{refreshToken, time.Now().UTC().Format(time.RFC3339), tenantOf(ctx), user},
+		},
+	}
+	for _, m := range ms {
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query:     `INSERT OR REPLACE INTO calendar_meetings (tenant, user_name, event_id, start_at, end_at) VALUES (?, ?, ?, ?, ?)`,
+			Arguments: tenantArgs(ctx, user, m.eventID, m.start.UTC().Format(time.RFC3339), m.end.UTC().Format(time.RFC3339)),
+		})
+	}
+	_, err := r.db.Write(ctx, stmts)
+	return err
+}
+
+// Failed records why user's last sync failed.
+func (r *CalendarRepo) Failed(ctx context.Context, user string, syncErr error) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE calendar_accounts SET last_error = ? WHERE tenant = ? AND user_name = ?`,
+		Arguments: []interface{}{syncErr.Error(), tenantOf(ctx), user},
+	}})
+	return err
+}
+
+// MeetingHours returns the user-hours in [from, to) that overlap a
+// meeting.
+func (r *CalendarRepo) MeetingHours(ctx context.Context, from, to time.Time) (meetingHours, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT user_name, start_at, end_at FROM calendar_meetings WHERE tenant = ? AND start_at < ? AND end_at > ?`,
+		Arguments: tenantArgs(ctx, to.UTC().Format(time.RFC3339), from.UTC().Format(time.RFC3339)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	hours := make(meetingHours)
+	for qr.Next() {
+		var user, s, e string
+		if err := qr.Scan(&user, &s, &e); err != nil {
+			return nil, err
+		}
+		start, err1 := time.Parse(time.RFC3339, s)
+		end, err2 := time.Parse(time.RFC3339, e)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for h := start.Truncate(time.Hour); h.Before(end); h = h.Add(time.Hour) {
+			hours[user+"|"+h.Format("2006-01-02T15:00:00Z")] = true
+		}
+	}
+	return hours, nil
+}
+
+// Relabel sets LOW hours in [from, to) that overlap a meeting of their
+// user to IN_MEETING, and IN_MEETING hours that no longer do (meeting
+// declined or cancelled since) back to LOW. It returns the rows changed.
+func (r *CalendarRepo) Relabel(ctx context.Context, from, to time.Time) (int64, error) {
+	const overlaps = `EXISTS (SELECT 1 FROM calendar_meetings m
+	                          WHERE m.tenant = activity_hourly.tenant AND m.user_name = activity_hourly.user_name
+	                            AND m.start_at < strftime('%Y-%m-%dT%H:%M:%SZ', activity_hourly.hour_start, '+1 hour')
+	                            AND m.end_at > activity_hourly.hour_start)`
+	bounds := tenantArgs(ctx, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{
+		{
+			Query: `UPDATE activity_hourly SET status = 'IN_MEETING'
+			        WHERE tenant = ? AND hour_start >= ? AND hour_start < ? AND status = 'LOW' AND deleted_at IS NULL AND ` + overlaps,
+			Arguments: bounds,
+		},
+		{
+			Query: `UPDATE activity_hourly SET status = 'LOW'
+			        WHERE tenant = ? AND hour_start >= ? AND hour_start < ? AND status = 'IN_MEETING' AND NOT ` + overlaps,
+			Arguments: bounds,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res[0].RowsAffected + res[1].RowsAffected, nil
+}
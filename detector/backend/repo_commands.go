@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// CommandRepo stores agent commands (agent_commands table).
+type CommandRepo struct {
+	db *DB
+}
+
+func NewCommandRepo(db *DB) *CommandRepo {
+	return &CommandRepo{db: db}
+}
+
+// Queue stores a command for host and returns it with its ID.
+func (r *CommandRepo) Queue(ctx context.Context, host, command string) (AgentCommand, error) {
+	cmd := AgentCommand{Host: host, Command: command, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `INSERT INTO agent_commands (tenant, host, command, created_at) VALUES (?, ?, ?, ?)`,
+		Arguments: tenantArgs(ctx, cmd.Host, cmd.Command, cmd.CreatedAt),
+	}})
+	if err != nil {
+		return AgentCommand{}, err
+	}
+	cmd.ID = res[0].LastInsertID
+	return cmd, nil
+}
+
+// Take returns host's undelivered commands, oldest first, and marks them
+// delivered. Two replicas polling at once may both hand out a command;
+// commands are idempotent, so that only costs a second flush.
+func (r *CommandRepo) Take(ctx context.Context, host string) ([]AgentCommand, error) {
+	cmds, err := r.list(ctx, ConsistencyStrong, `AND host = ? AND delivered_at = '' ORDER BY id`, host)
+	if err != nil || len(cmds) == 0 {
+		return cmds, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	args := []interface{}{now}
+	for i := range cmds {
+		cmds[i].DeliveredAt = now
+		args = append(args, cmds[i].ID)
+	}
+	_, err = r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE agent_commands SET delivered_at = ? WHERE id IN (?` + strings.Repeat(", ?", len(cmds)-1) + `)`,
+		Arguments: args,
+	}})
+	return cmds, err
+}
+
+// Complete records the agent's reply; ok is false when host has no
+// delivered command with that ID.
+func (r *CommandRepo) Complete(ctx context.Context, id int64, host, result string) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `UPDATE agent_commands SET done_at = ?, result = ?
+		        WHERE tenant = ? AND id = ? AND host = ? AND delivered_at != ''`,
+		Arguments: []interface{}{time.Now().UTC().Format(time.RFC3339), result, tenantOf(ctx), id, host},
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
+
+// Recent returns host's last limit commands, newest first.
+func (r *CommandRepo) Recent(ctx context.Context, host string, limit int) ([]AgentCommand, error) {
+	return r.list(ctx, "", `AND host = ? ORDER BY id DESC LIMIT ?`, host, limit)
+}
+
+// list runs a query over the tenant's commands; where goes after its
+// "WHERE tenant = ?" and starts with AND.
+func (r *CommandRepo) list(ctx context.Context, level, where string, args ...interface{}) ([]AgentCommand, error) {
+	qr, err := r.db.QueryOne(ctx, level, gorqlite.ParameterizedStatement{
+		Query:     `SELECT id, host, command, created_at, delivered_at, done_at, result FROM agent_commands WHERE tenant = ? ` + where,
+		Arguments: tenantArgs(ctx, args...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	cmds := make([]AgentCommand, 0, 4)
+	for qr.Next() {
+		var c AgentCommand
+		if err := qr.Scan(&c.ID, &c.Host, &c.Command, &c.CreatedAt, &c.DeliveredAt, &c.DoneAt, &c.Result); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c)
+	}
+	return cmds, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// ConsentRepo stores users' answers to the collection policy
+// (user_consents table), one per user and policy version.
+type ConsentRepo struct {
+	db *DB
+}
+
+func NewConsentRepo(db *DB) *ConsentRepo {
+	return &ConsentRepo{db: db}
+}
+
+// Record stores c, replacing the user's earlier answer to the same
+// version, together with its audit entry.
+func (r *ConsentRepo) Record(ctx context.Context, c Consent, audit gorqlite.ParameterizedStatement) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{audit, {
+		Query: `INSERT INTO user_consents (tenant, user_name, policy_version, granted, at, remote_addr)
+		        VALUES (?, ?, ?, ?, ?, ?)
+		        ON CONFLICT (tenant, user_name, policy_version) DO UPDATE SET
+		          granted = excluded.granted, at = excluded.at, remote_addr = excluded.remote_addr`,
+		Arguments: tenantArgs(ctx, c.UserName, c.PolicyVersion, c.Granted, c.At, c.RemoteAddr),
+	}})
+	return err
+}
+
+// Get returns user's answer to version; ok is false when there is none.
+func (r *ConsentRepo) Get(ctx context.Context, user, version string) (Consent, bool, error) {
+	list, err := r.query(ctx, `AND user_name = ? AND policy_version = ?`, user, version)
+	if err != nil || len(list) == 0 {
+		return Consent{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// Granted reports whether user consented to version.
+func (r *ConsentRepo) Granted(ctx context.Context, user, version string) (bool, error) {
+	c, ok, err := r.Get(ctx, user, version)
+	return ok && c.Granted, err
+}
+
+// List returns every answer to version (all versions when empty), newest
+// first.
+func (r *ConsentRepo) List(ctx context.Context, version string) ([]Consent, error) {
+	if version == "" {
+		return r.query(ctx, ``)
+	}
+	return r.query(ctx, `AND policy_version = ?`, version)
+}
+
+// query lists the tenant's answers; where goes after its "WHERE tenant = ?"
+// and starts with AND.
+func (r *ConsentRepo) query(ctx context.Context, where string, args ...interface{}) ([]Consent, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT user_name, policy_version, granted, at, remote_addr FROM user_consents WHERE tenant = ? ` +
+			where + ` ORDER BY at DESC, user_name`,
+		Arguments: tenantArgs(ctx, args...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]Consent, 0, 16)
+	for qr.Next() {
+		var c Consent
+		var granted int64
+		if err := qr.Scan(&c.UserName, &c.PolicyVersion, &granted, &c.At, &c.RemoteAddr); err != nil {
+			return nil, err
+		}
+		c.Granted = granted != 0
+		out = append(out, c)
+	}
+	return out, nil
+}
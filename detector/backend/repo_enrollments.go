@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// enrollmentCacheTTL is how long a checked agent token is trusted without
+// asking rqlite again, and so how long a revoked token keeps working.
+const enrollmentCacheTTL = time.Minute
+
+// EnrollmentRepo stores the agents enrolled through POST /enroll
+// (agent_enrollments table). Only a SHA-256 of each token is kept.
+type EnrollmentRepo struct {
+	db *DB
+
+	mu    sync.Mutex
+	cache map[string]cachedEnrollment // by token hash
+}
+
+type cachedEnrollment struct {
+	e     Enrollment
+	ok    bool
+	until time.Time
+}
+
+func NewEnrollmentRepo(db *DB) *EnrollmentRepo {
+	return &EnrollmentRepo{db: db, cache: make(map[string]cachedEnrollment)}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Enroll creates an agent ID and token for host in ctx's tenant and
+// revokes the ones issued to it before, so a reinstalled machine holds a
+// single live token. The token is returned once and never stored in clear.
+func (r *EnrollmentRepo) Enroll(ctx context.Context, host, remoteAddr string) (Enrollment, string, error) {
+	e := Enrollment{
+		AgentID:    "a-" + randomHex(8),
+		Tenant:     tenantOf(ctx),
+		Host:       host,
+		RemoteAddr: remoteAddr,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	token := randomHex(32)
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE agent_enrollments SET revoked_at = ? WHERE tenant = ? AND host = ? AND revoked_at = ''`,
+		Arguments: []interface{}{e.CreatedAt, e.Tenant, host},
+	}, {
+		Query: `INSERT INTO agent_enrollments (agent_id, tenant, host, token_hash, remote_addr, created_at)
+		        VALUES (?, ?, ?, ?, ?, ?)`,
+		Arguments: []interface{}{e.AgentID, e.Tenant, e.Host, hashToken(token), e.RemoteAddr, e.CreatedAt},
+	}})
+	if err != nil {
+		return Enrollment{}, "", err
+	}
+	return e, token, nil
+}
+
+// Check returns the enrollment (agent ID, tenant and host) a live token
+// was issued for.
+func (r *EnrollmentRepo) Check(ctx context.Context, token string) (Enrollment, bool, error) {
+	h := hashToken(token)
+	now := time.Now()
+	r.mu.Lock()
+	c, hit := r.cache[h]
+	r.mu.Unlock()
+	if hit && now.Before(c.until) {
+		return c.e, c.ok, nil
+	}
+
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT agent_id, tenant, host FROM agent_enrollments WHERE token_hash = ? AND revoked_at = ''`,
+		Arguments: []interface{}{h},
+	})
+	if err != nil {
+		return Enrollment{}, false, err
+	}
+	if qr.Err != nil {
+		return Enrollment{}, false, qr.Err
+	}
+	c = cachedEnrollment{until: now.Add(enrollmentCacheTTL)}
+	if qr.Next() {
+		if err := qr.Scan(&c.e.AgentID, &c.e.Tenant, &c.e.Host); err != nil {
+			return Enrollment{}, false, err
+		}
+		c.ok = true
+	}
+	r.mu.Lock()
+	for k, v := range r.cache {
+		if now.After(v.until) {
+			delete(r.cache, k)
+		}
+	}
+	r.cache[h] = c
+	r.mu.Unlock()
+	return c.e, c.ok, nil
+}
+
+// List returns every enrollment, newest first.
+func (r *EnrollmentRepo) List(ctx context.Context) ([]Enrollment, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT agent_id, tenant, host, remote_addr, created_at, revoked_at
+		        FROM agent_enrollments WHERE tenant = ? ORDER BY created_at DESC, agent_id`,
+		Arguments: tenantArgs(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]Enrollment, 0, 16)
+	for qr.Next() {
+		var e Enrollment
+		if err := qr.Scan(&e.AgentID, &e.Tenant, &e.Host, &e.RemoteAddr, &e.CreatedAt, &e.RevokedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Revoke ends an agent's token; ok is false when agentID is unknown or
+// already revoked.
+func (r *EnrollmentRepo) Revoke(ctx context.Context, agentID string) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE agent_enrollments SET revoked_at = ? WHERE tenant = ? AND agent_id = ? AND revoked_at = ''`,
+		Arguments: []interface{}{time.Now().UTC().Format(time.RFC3339), tenantOf(ctx), agentID},
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// Erasure modes and statuses.
+const (
+	erasureDelete    = "delete"    // remove the user's rows
+	erasureAnonymize = "anonymize" // keep the figures under a random name
+
+	erasureQueued  = "queued"
+	erasureRunning = "running"
+	erasureDone    = "done"
+	erasureFailed  = "failed"
+)
+
+// erasureStmt is one statement of an erasure, counted under table.
+type erasureStmt struct {
+	table string
+	query string
+	args  []interface{}
+}
+
+// eraseStmts lists what erasing user takes. Activity tables are deleted
+// or moved to alias; anything that only makes sense for a known person
+// (profiles, calendars, timesheet pushes, tokens, consents, identity
+// mapping) is deleted either way, and so are window titles and agent log
+// lines, which cannot be anonymized. Titles are found through the user's
+// hours, so they go first. Only tenant's rows are touched: the same user
+// name in another tenant is another person.
+func eraseStmts(tenant, user, mode, alias string) []erasureStmt {
+	stmts := []erasureStmt{
+		{"window_titles", `DELETE FROM window_titles WHERE tenant = ? AND EXISTS (SELECT 1 FROM activity_hourly h
+		  WHERE h.tenant = window_titles.tenant AND h.host = window_titles.host AND h.hour_start = window_titles.hour_start AND h.user_name = ?)`, []interface{}{tenant, user}},
+		{"agent_logs", `DELETE FROM agent_logs WHERE tenant = ? AND instr(line, ?) > 0`, []interface{}{tenant, user}},
+	}
+	for _, table := range []string{"activity_hourly", "activity_daily", "activity_samples",
+		"sample_rollup_5m", "sample_rollup_hourly", "sample_rollup_daily", "focus_sessions"} {
+		switch {
+		case mode == erasureDelete:
+			stmts = append(stmts, erasureStmt{table, `DELETE FROM ` + table + ` WHERE tenant = ? AND user_name = ?`, []interface{}{tenant, user}})
+		case table == "activity_hourly":
+			stmts = append(stmts, erasureStmt{table, `UPDATE activity_hourly SET user_name = ?, display_name = '', note = '' WHERE tenant = ? AND user_name = ?`, []interface{}{alias, tenant, user}})
+		default:
+			stmts = append(stmts, erasureStmt{table, `UPDATE ` + table + ` SET user_name = ? WHERE tenant = ? AND user_name = ?`, []interface{}{alias, tenant, user}})
+		}
+	}
+	agentName := ""
+	if mode == erasureAnonymize {
+		agentName = alias
+	}
+	stmts = append(stmts, erasureStmt{"agents", `UPDATE agents SET user_name = ? WHERE tenant = ? AND user_name = ?`, []interface{}{agentName, tenant, user}})
+	for _, table := range []string{"user_profiles", "calendar_accounts", "calendar_meetings", "timesheet_pushes", "api_tokens", "user_consents"} {
+		stmts = append(stmts, erasureStmt{table, `DELETE FROM ` + table + ` WHERE tenant = ? AND user_name = ?`, []interface{}{tenant, user}})
+	}
+	return append(stmts, erasureStmt{"identity_map", `DELETE FROM identity_map WHERE tenant = ? AND (pseudonym = ? OR value = ?)`, []interface{}{tenant, user, user}})
+}
+
+// ErasureRepo stores erasure requests (erasure_jobs table) and carries
+// them out.
+type ErasureRepo struct {
+	db *DB
+}
+
+func NewErasureRepo(db *DB) *ErasureRepo {
+	return &ErasureRepo{db: db}
+}
+
+// Queue stores a new request together with its audit entry.
+func (r *ErasureRepo) Queue(ctx context.Context, e Erasure, audit gorqlite.ParameterizedStatement) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{audit, {
+		Query: `INSERT INTO erasure_jobs (tenant, id, user_name, mode, status, requested_by, request_id, created_at)
+		        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		Arguments: tenantArgs(ctx, e.ID, e.UserName, e.Mode, e.Status, e.RequestedBy, e.RequestID, e.CreatedAt),
+	}})
+	return err
+}
+
+const erasureColumns = `id, user_name, mode, status, requested_by, request_id, created_at, started_at, finished_at, error, rows_json`
+
+// query lists the tenant's requests; tail goes after its
+// "WHERE tenant = ?".
+func (r *ErasureRepo) query(ctx context.Context, tail string, args ...interface{}) ([]Erasure, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT ` + erasureColumns + ` FROM erasure_jobs WHERE tenant = ? ` + tail,
+		Arguments: tenantArgs(ctx, args...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]Erasure, 0, 8)
+	for qr.Next() {
+		var (
+			e    Erasure
+			rows string
+		)
+		if err := qr.Scan(&e.ID, &e.UserName, &e.Mode, &e.Status, &e.RequestedBy, &e.RequestID,
+			&e.CreatedAt, &e.StartedAt, &e.FinishedAt, &e.Error, &rows); err != nil {
+			return nil, err
+		}
+		if rows != "" {
+			if err := json.Unmarshal([]byte(rows), &e.Rows); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Get returns one request; ok is false when id is unknown.
+func (r *ErasureRepo) Get(ctx context.Context, id string) (Erasure, bool, error) {
+	list, err := r.query(ctx, `AND id = ?`, id)
+	if err != nil || len(list) == 0 {
+		return Erasure{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// Recent returns the latest limit requests, newest first.
+func (r *ErasureRepo) Recent(ctx context.Context, limit int) ([]Erasure, error) {
+	return r.query(ctx, `ORDER BY created_at DESC, id LIMIT ?`, limit)
+}
+
+// Queued returns the requests waiting to run, oldest first.
+func (r *ErasureRepo) Queued(ctx context.Context) ([]Erasure, error) {
+	return r.query(ctx, `AND status = ? ORDER BY created_at, id`, erasureQueued)
+}
+
+// Claim marks e running; ok is false when another replica got it first.
+func (r *ErasureRepo) Claim(ctx context.Context, e *Erasure) (bool, error) {
+	e.StartedAt = time.Now().UTC().Format(time.RFC3339)
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE erasure_jobs SET status = ?, started_at = ? WHERE tenant = ? AND id = ? AND status = ?`,
+		Arguments: []interface{}{erasureRunning, e.StartedAt, tenantOf(ctx), e.ID, erasureQueued},
+	}})
+	if err != nil {
+		return false, err
+	}
+	e.Status = erasureRunning
+	return res[0].RowsAffected > 0, nil
+}
+
+// Erase runs e's statements, its completion and its audit entry in one
+// transaction, then saves e.Rows. An error with e.Status done means only
+// saving the counts failed.
+func (r *ErasureRepo) Erase(ctx context.Context, e *Erasure) error {
+	alias := "erased-" + randomHex(6)
+	tenant := tenantOf(ctx)
+	work := eraseStmts(tenant, e.UserName, e.Mode, alias)
+	stmts := make([]gorqlite.ParameterizedStatement, 0, len(work)+2)
+	for _, w := range work {
+		stmts = append(stmts, gorqlite.ParameterizedStatement{Query: w.query, Arguments: w.args})
+	}
+	e.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	// the audit entry names the erasure, not the data: only its job ID
+	// and mode are kept
+	after, err := json.Marshal(map[string]string{"erasure_id": e.ID, "mode": e.Mode})
+	if err != nil {
+		return err
+	}
+	stmts = append(stmts, gorqlite.ParameterizedStatement{
+		Query:     `UPDATE erasure_jobs SET status = ?, finished_at = ? WHERE tenant = ? AND id = ?`,
+		Arguments: []interface{}{erasureDone, e.FinishedAt, tenant, e.ID},
+	}, gorqlite.ParameterizedStatement{
+		Query: `INSERT INTO audit_log (tenant, at, actor, action, target, payload_hash, request_id, before_json, after_json)
+		        VALUES (?, ?, ?, 'user.erase', ?, '', ?, '', ?)`,
+		Arguments: []interface{}{tenant, e.FinishedAt, e.RequestedBy, e.UserName, e.RequestID, string(after)},
+	})
+	res, err := r.db.Write(ctx, stmts)
+	if err != nil {
+		return err
+	}
+	e.Status = erasureDone
+	e.Rows = make(map[string]int64, len(work))
+	for i, w := range work {
+		e.Rows[w.table] += res[i].RowsAffected
+	}
+	rows, err := json.Marshal(e.Rows)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE erasure_jobs SET rows_json = ? WHERE tenant = ? AND id = ?`,
+		Arguments: []interface{}{string(rows), tenant, e.ID},
+	}})
+	return err
+}
+
+// Fail records why e could not run; the erased data is untouched since
+// Erase is a single transaction.
+func (r *ErasureRepo) Fail(ctx context.Context, e *Erasure, cause error) error {
+	e.Status, e.Error = erasureFailed, cause.Error()
+	e.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE erasure_jobs SET status = ?, finished_at = ?, error = ? WHERE tenant = ? AND id = ?`,
+		Arguments: []interface{}{e.Status, e.FinishedAt, e.Error, tenantOf(ctx), e.ID},
+	}})
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// FocusRepo reads the focus_sessions table, which agents write directly.
+type FocusRepo struct {
+	db *DB
+}
+
+func NewFocusRepo(db *DB) *FocusRepo {
+	return &FocusRepo{db: db}
+}
+
+// Between returns the sessions started in [start, end), in order. host
+// and user may be empty for all.
+func (r *FocusRepo) Between(ctx context.Context, start, end, host, user string) ([]FocusSession, error) {
+	query := `SELECT host, user_name, started_at, ended_at, app, activity_pct FROM focus_sessions
+	          WHERE tenant = ? AND started_at >= ? AND started_at < ?`
+	args := tenantArgs(ctx, start, end)
+	if host != "" {
+		query += ` AND host = ?`
+		args = append(args, host)
+	}
+	if user != "" {
+		query += ` AND user_name = ?`
+		args = append(args, user)
+	}
+	query += ` ORDER BY started_at, host`
+
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{Query: query, Arguments: args})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	sessions := make([]FocusSession, 0, 8)
+	for qr.Next() {
+		var s FocusSession
+		if err := qr.Scan(&s.Host, &s.UserName, &s.StartedAt, &s.EndedAt, &s.App, &s.ActivityPct); err != nil {
+			return nil, err
+		}
+		st, err1 := time.Parse(time.RFC3339, s.StartedAt)
+		et, err2 := time.Parse(time.RFC3339, s.EndedAt)
+		if err1 == nil && err2 == nil {
+			s.DurationSeconds = et.Sub(st).Seconds()
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
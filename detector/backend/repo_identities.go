@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// IdentityRepo is the de-anonymization mapping (identity_map). It is only
+// reachable through the admin API; activity tables never hold clear names
+// once agents pseudonymize.
+type IdentityRepo struct {
+	db *DB
+}
+
+func NewIdentityRepo(db *DB) *IdentityRepo {
+	return &IdentityRepo{db: db}
+}
+
+// Put records the mappings; re-registering a name keeps its first
+// created_at.
+func (r *IdentityRepo) Put(ctx context.Context, ids []Identity) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	stmts := make([]gorqlite.ParameterizedStatement, 0, len(ids))
+	for _, id := range ids {
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query: `INSERT INTO identity_map (tenant, pseudonym, kind, value, created_at) VALUES (?, ?, ?, ?, ?)
+			        ON CONFLICT (tenant, pseudonym) DO UPDATE SET value = excluded.value`,
+			Arguments: tenantArgs(ctx, id.Pseudonym, id.Kind, id.Value, now),
+		})
+	}
+	_, err := r.db.Write(ctx, stmts)
+	return err
+}
+
+// Lookup returns the mappings known for pseudonyms; unknown ones are
+// simply absent.
+func (r *IdentityRepo) Lookup(ctx context.Context, pseudonyms []string) ([]Identity, error) {
+	if len(pseudonyms) == 0 {
+		return []Identity{}, nil
+	}
+	args := tenantArgs(ctx)
+	for _, p := range pseudonyms {
+		args = append(args, p)
+	}
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT pseudonym, kind, value, created_at FROM identity_map
+		        WHERE tenant = ? AND pseudonym IN (?` + strings.Repeat(", ?", len(pseudonyms)-1) + `) ORDER BY pseudonym`,
+		Arguments: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	ids := make([]Identity, 0, len(pseudonyms))
+	for qr.Next() {
+		var id Identity
+		if err := qr.Scan(&id.Pseudonym, &id.Kind, &id.Value, &id.CreatedAt); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
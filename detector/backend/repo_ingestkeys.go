@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// IngestKeyRepo remembers the idempotency keys of hourly rows ingested
+// within the dedupe window (ingest_keys), per tenant. An agent that retries after a
+// timeout resends rows that were in fact stored; their keys match, so the
+// rows are skipped instead of rewritten with a new created_at.
+type IngestKeyRepo struct {
+	db     *DB
+	window time.Duration
+}
+
+// NewIngestKeyRepoFromEnv reads INGEST_DEDUPE_WINDOW (default 24h, 0
+// turns deduplication off).
+func NewIngestKeyRepoFromEnv(db *DB) *IngestKeyRepo {
+	return &IngestKeyRepo{db: db, window: envDuration("INGEST_DEDUPE_WINDOW", 24*time.Hour)}
+}
+
+// ingestKey is the idempotency key of a validated row: a SHA-256 of its
+// host, hour and normalized payload, so a corrected re-send of the same
+// hour still goes through.
+func ingestKey(row HourlyIngest) (string, error) {
+	payload, err := json.Marshal(row)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(row.Host + "\x00" + row.HourStart + "\x00" + string(payload)))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Seen returns which of keys ctx's tenant recorded within the dedupe
+// window.
+func (r *IngestKeyRepo) Seen(ctx context.Context, keys []string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	if len(keys) == 0 {
+		return seen, nil
+	}
+	args := make([]interface{}, 0, len(keys)+2)
+	args = append(args, tenantOf(ctx), time.Now().UTC().Add(-r.window).Format(time.RFC3339))
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT key FROM ingest_keys WHERE tenant = ? AND seen_at >= ? AND key IN (?` +
+			strings.Repeat(", ?", len(keys)-1) + `)`,
+		Arguments: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	for qr.Next() {
+		var k string
+		if err := qr.Scan(&k); err != nil {
+			return nil, err
+		}
+		seen[k] = true
+	}
+	return seen, nil
+}
+
+// recordStmt stores keys as seen now by ctx's tenant, for writing in the
+// same transaction as the rows they stand for.
+func (r *IngestKeyRepo) recordStmt(ctx context.Context, keys []string) gorqlite.ParameterizedStatement {
+	args := make([]interface{}, 0, 3*len(keys))
+	now, tenant := time.Now().UTC().Format(time.RFC3339), tenantOf(ctx)
+	for _, k := range keys {
+		args = append(args, tenant, k, now)
+	}
+	return gorqlite.ParameterizedStatement{
+		Query:     `INSERT OR REPLACE INTO ingest_keys (tenant, key, seen_at) VALUES (?, ?, ?)` + strings.Repeat(", (?, ?, ?)", len(keys)-1),
+		Arguments: args,
+	}
+}
+
+// Prune deletes keys that fell out of the dedupe window.
+func (r *IngestKeyRepo) Prune(ctx context.Context) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `DELETE FROM ingest_keys WHERE seen_at < ?`,
+		Arguments: []interface{}{time.Now().UTC().Add(-r.window).Format(time.RFC3339)},
+	}})
+	return err
+}
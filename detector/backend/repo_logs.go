@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// logInsertChunk is how many lines go in one multi-row INSERT.
+const logInsertChunk = 200
+
+// LogRepo stores shipped agent log lines (agent_logs table).
+type LogRepo struct {
+	db *DB
+}
+
+func NewLogRepo(db *DB) *LogRepo {
+	return &LogRepo{db: db}
+}
+
+// Append stores lines for host in order, in one transaction.
+func (r *LogRepo) Append(ctx context.Context, host string, lines []string) error {
+	now, tenant := time.Now().UTC().Format(time.RFC3339), tenantOf(ctx)
+	stmts := make([]gorqlite.ParameterizedStatement, 0, len(lines)/logInsertChunk+1)
+	for start := 0; start < len(lines); start += logInsertChunk {
+		chunk := lines[start:min(start+logInsertChunk, len(lines))]
+		args := make([]interface{}, 0, 4*len(chunk))
+		for _, l := range chunk {
+			args = append(args, tenant, host, l, now)
+		}
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query:     `INSERT INTO agent_logs (tenant, host, line, received_at) VALUES (?, ?, ?, ?)` + strings.Repeat(", (?, ?, ?, ?)", len(chunk)-1),
+			Arguments: args,
+		})
+	}
+	_, err := r.db.Write(ctx, stmts)
+	return err
+}
+
+// Tail returns up to limit of host's lines after afterID, oldest first;
+// afterID 0 means the last limit lines.
+func (r *LogRepo) Tail(ctx context.Context, host string, afterID int64, limit int) ([]AgentLogLine, error) {
+	stmt := gorqlite.ParameterizedStatement{
+		Query: `SELECT id, line, received_at FROM (
+		          SELECT id, line, received_at FROM agent_logs WHERE tenant = ? AND host = ? ORDER BY id DESC LIMIT ?
+		        ) ORDER BY id`,
+		Arguments: tenantArgs(ctx, host, limit),
+	}
+	if afterID > 0 {
+		stmt = gorqlite.ParameterizedStatement{
+			Query:     `SELECT id, line, received_at FROM agent_logs WHERE tenant = ? AND host = ? AND id > ? ORDER BY id LIMIT ?`,
+			Arguments: tenantArgs(ctx, host, afterID, limit),
+		}
+	}
+	qr, err := r.db.QueryOne(ctx, "", stmt)
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	lines := make([]AgentLogLine, 0, limit)
+	for qr.Next() {
+		var l AgentLogLine
+		if err := qr.Scan(&l.ID, &l.Line, &l.ReceivedAt); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
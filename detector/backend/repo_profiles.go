@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// ProfileRepo stores per-user work-hours profiles (user_profiles).
+type ProfileRepo struct {
+	db *DB
+}
+
+func NewProfileRepo(db *DB) *ProfileRepo {
+	return &ProfileRepo{db: db}
+}
+
+const profileColumns = `user_name, start_time, end_time, weekdays, tz, updated_at`
+
+func scanProfile(qr *gorqlite.QueryResult) (UserProfile, error) {
+	var (
+		p        UserProfile
+		weekdays string
+	)
+	if err := qr.Scan(&p.UserName, &p.Start, &p.End, &weekdays, &p.TZ, &p.UpdatedAt); err != nil {
+		return p, err
+	}
+	err := json.Unmarshal([]byte(weekdays), &p.Weekdays)
+	return p, err
+}
+
+func (r *ProfileRepo) List(ctx context.Context) ([]UserProfile, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT ` + profileColumns + ` FROM user_profiles WHERE tenant = ? ORDER BY user_name`,
+		Arguments: tenantArgs(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	profiles := make([]UserProfile, 0, 16)
+	for qr.Next() {
+		p, err := scanProfile(&qr)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// Get returns the profile for user; ok is false when there is none.
+func (r *ProfileRepo) Get(ctx context.Context, user string) (UserProfile, bool, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT ` + profileColumns + ` FROM user_profiles WHERE tenant = ? AND user_name = ?`,
+		Arguments: tenantArgs(ctx, user),
+	})
+	if err != nil {
+		return UserProfile{}, false, err
+	}
+	if qr.Err != nil {
+		return UserProfile{}, false, qr.Err
+	}
+	if !qr.Next() {
+		return UserProfile{}, false, nil
+	}
+	p, err := scanProfile(&qr)
+	return p, err == nil, err
+}
+
+// Put creates or replaces the profile for p.UserName.
+func (r *ProfileRepo) Put(ctx context.Context, p UserProfile) (UserProfile, error) {
+	p.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if p.Weekdays == nil {
+		p.Weekdays = []int{}
+	}
+	weekdays, err := json.Marshal(p.Weekdays)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	_, err = r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `INSERT OR REPLACE INTO user_profiles (tenant, ` + profileColumns + `)
+		        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		Arguments: tenantArgs(ctx, p.UserName, p.Start, p.End, string(weekdays), p.TZ, p.UpdatedAt),
+	}})
+	return p, err
+}
+
+// Delete removes the profile; ok is false when there was none.
+func (r *ProfileRepo) Delete(ctx context.Context, user string) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `DELETE FROM user_profiles WHERE tenant = ? AND user_name = ?`,
+		Arguments: tenantArgs(ctx, user),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// SampleRepo reads and writes raw agent samples (activity_samples).
+type SampleRepo struct {
+	db *DB
+}
+
+func NewSampleRepo(db *DB) *SampleRepo {
+	return &SampleRepo{db: db}
+}
+
+// sampleInsertChunk is how many samples go in one multi-row INSERT.
+const sampleInsertChunk = 200
+
+// Insert stores samples of host in ctx's tenant in one transaction.
+// Samples already stored (same host and ts) are kept, so a retried upload
+// is harmless.
+// The hours they fall in are marked for the rollup job.
+func (r *SampleRepo) Insert(ctx context.Context, host, user string, samples []RawSample) error {
+	stmts := make([]gorqlite.ParameterizedStatement, 0, len(samples)/sampleInsertChunk+2)
+	marked, tenant := time.Now().UnixNano(), tenantOf(ctx)
+	hours := make(map[string]bool)
+	for start := 0; start < len(samples); start += sampleInsertChunk {
+		chunk := samples[start:min(start+sampleInsertChunk, len(samples))]
+		args := make([]interface{}, 0, 6*len(chunk))
+		for _, s := range chunk {
+			args = append(args, tenant, s.TS, host, user, s.IdleMs, s.IntervalMs)
+			hours[s.TS[:13]+":00:00Z"] = true
+		}
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query: `INSERT OR IGNORE INTO activity_samples (tenant, ts, host, user_name, idle_ms, interval_ms) VALUES (?, ?, ?, ?, ?, ?)` +
+				strings.Repeat(", (?, ?, ?, ?, ?, ?)", len(chunk)-1),
+			Arguments: args,
+		})
+	}
+	for hour := range hours {
+		stmts = append(stmts, gorqlite.ParameterizedStatement{
+			Query:     `INSERT OR REPLACE INTO sample_rollup_dirty (tenant, host, hour_start, marked_at) VALUES (?, ?, ?, ?)`,
+			Arguments: []interface{}{tenant, host, hour, marked},
+		})
+	}
+	_, err := r.db.Write(ctx, stmts)
+	return err
+}
+
+// RecomputeHourly re-derives hourly buckets from raw samples in
+// [startRFC3339, endRFC3339) the way the agent does: a sample counts its
+// interval as idle when idle time >= activeIfIdleLessThan, and activity is
+// the non-idle share of the hour. Thresholds in rollupThresholds are read
+// from sample_rollup_hourly; any other one scans the raw samples. Each
+// user of a shared host gets their own row, scored over the part of the
+// hour their samples cover, as the agent splits it.
+func (r *SampleRepo) RecomputeHourly(ctx context.Context, startRFC3339, endRFC3339, host string, activeIfIdleLessThan time.Duration, t StatusThresholds) ([]HourlyIngest, error) {
+	stmt := gorqlite.ParameterizedStatement{
+		Query: `SELECT host, user_name, substr(ts, 1, 13) || ':00:00Z' AS hour,
+		               COUNT(*), SUM(interval_ms) / 1000.0,
+		               SUM(CASE WHEN idle_ms >= ? THEN interval_ms ELSE 0 END) / 1000.0
+		        FROM activity_samples
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND ts >= ? AND ts < ? AND (? = '' OR host = ?)
+		        GROUP BY host, user_name, hour
+		        ORDER BY hour, host, user_name;`,
+		Arguments: append([]interface{}{activeIfIdleLessThan.Milliseconds()},
+			tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...)...),
+	}
+	if key := rollupKey(activeIfIdleLessThan); key != "" {
+		stmt = gorqlite.ParameterizedStatement{
+			Query: `SELECT host, user_name, bucket_start, samples, measured_seconds,
+			               COALESCE(json_extract(idle_seconds, ?), 0)
+			        FROM sample_rollup_hourly
+			        WHERE tenant = ? AND month BETWEEN ? AND ? AND bucket_start >= ? AND bucket_start < ? AND (? = '' OR host = ?)
+			        ORDER BY bucket_start, host, user_name;`,
+			Arguments: append([]interface{}{`$."` + key + `"`},
+				tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...)...),
+		}
+	}
+	qr, err := r.db.QueryOne(ctx, "", stmt)
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+
+	rows := make([]HourlyIngest, 0, 16)
+	var measured []float64
+	users := make(map[string]int) // by hour|host
+	for qr.Next() {
+		var (
+			row HourlyIngest
+			m   float64
+		)
+		if err := qr.Scan(&row.Host, &row.UserName, &row.HourStart, &row.Samples, &m, &row.IdleSeconds); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+		measured = append(measured, m)
+		users[row.HourStart+"|"+row.Host]++
+	}
+	for i := range rows {
+		row := &rows[i]
+		span := 3600.0
+		if users[row.HourStart+"|"+row.Host] > 1 {
+			span = math.Min(measured[i], 3600)
+		}
+		if row.Samples > 0 {
+			row.ActivityPct = activityPctFor(row.IdleSeconds, span)
+		}
+		row.Status = string(Classify(row.ActivityPct, row.Samples, t))
+	}
+	return rows, nil
+}
+
+// rollupTables maps the resolutions of GET /activity/rollups to their
+// roll-up table.
+var rollupTables = map[string]string{
+	"5m":   "sample_rollup_5m",
+	"hour": "sample_rollup_hourly",
+	"day":  "sample_rollup_daily",
+}
+
+// Rollups reads the roll-up buckets of resolution in [startRFC3339,
+// endRFC3339), scoring idle time under threshold, which must be one of
+// rollupThresholds.
+func (r *SampleRepo) Rollups(ctx context.Context, resolution, startRFC3339, endRFC3339, host string, threshold time.Duration) ([]SampleBucket, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT bucket_start, host, user_name, samples, measured_seconds,
+		               COALESCE(json_extract(idle_seconds, ?), 0)
+		        FROM ` + rollupTables[resolution] + `
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND bucket_start >= ? AND bucket_start < ? AND (? = '' OR host = ?)
+		        ORDER BY bucket_start, host, user_name;`,
+		Arguments: append([]interface{}{`$."` + rollupKey(threshold) + `"`},
+			tenantArgs(ctx, monthArgs(startRFC3339, endRFC3339, startRFC3339, endRFC3339, host, host)...)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+
+	out := make([]SampleBucket, 0, 16)
+	for qr.Next() {
+		var b SampleBucket
+		if err := qr.Scan(&b.BucketStart, &b.Host, &b.UserName, &b.Samples, &b.MeasuredSeconds, &b.IdleSeconds); err != nil {
+			return nil, err
+		}
+		b.ActivityPct = activityPctFor(b.IdleSeconds, b.MeasuredSeconds)
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// SampleInput is a host's newest raw sample and the input it implies.
+type SampleInput struct {
+	Host      string
+	UserName  string
+	TS        string
+	LastInput time.Time
+}
+
+// LastInputs returns, for each host (or just host when set) with samples
+// at or after sinceRFC3339, its newest sample; the user's last input is
+// the sample time minus its idle time.
+func (r *SampleRepo) LastInputs(ctx context.Context, sinceRFC3339, host string) ([]SampleInput, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT host, user_name, MAX(ts), idle_ms
+		        FROM activity_samples
+		        WHERE tenant = ? AND month BETWEEN ? AND ? AND ts >= ? AND (? = '' OR host = ?)
+		        GROUP BY host`,
+		Arguments: tenantArgs(ctx, monthArgs(sinceRFC3339, now, sinceRFC3339, host, host)...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]SampleInput, 0, 16)
+	for qr.Next() {
+		var (
+			s      SampleInput
+			idleMs int64
+		)
+		if err := qr.Scan(&s.Host, &s.UserName, &s.TS, &idleMs); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, s.TS)
+		if err != nil {
+			continue
+		}
+		s.LastInput = t.Add(-time.Duration(idleMs) * time.Millisecond)
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// activityPctFor converts idle seconds over a span into a percentage
+// clamped to [0, 100], matching the agent.
+func activityPctFor(idleSeconds, spanSeconds float64) float64 {
+	if spanSeconds <= 0 {
+		return 0
+	}
+	idleRatio := idleSeconds / spanSeconds
+	if idleRatio < 0 {
+		idleRatio = 0
+	}
+	if idleRatio > 1 {
+		idleRatio = 1
+	}
+	return (1.0 - idleRatio) * 100.0
+}
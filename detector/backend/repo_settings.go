@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"taxonomy"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// Setting keys editable through /admin/settings.
+const (
+	SettingStatusThresholds = "status_thresholds"
+	SettingSchedule         = "schedule"
+	SettingRetention        = "retention"
+	SettingAgentIntervals   = "agent_intervals"
+	SettingTimesheet        = "timesheet"
+	SettingCollectionPolicy = "collection_policy"
+)
+
+// defaultSettings are used until an admin stores an override.
+var defaultSettings = map[string]interface{}{
+	SettingStatusThresholds: taxonomy.DefaultThresholds,
+	SettingSchedule:         Schedule{Start: "07:00", End: "16:00", Weekdays: []int{1, 2, 3, 4, 5}, TZ: "UTC"},
+	SettingRetention:        Retention{RawDays: 30, HourlyDays: 365, DailyDays: 0},
+	SettingAgentIntervals:   AgentIntervals{Heartbeat: "5m", ConfigPoll: "15m"},
+	SettingTimesheet:        TimesheetSettings{Connectors: []TimesheetConnector{}},
+	SettingCollectionPolicy: CollectionPolicy{Version: "1"},
+}
+
+// SettingsRepo stores server-side tunables as JSON in the settings table and
+// keeps them in memory, so readers on the request path never hit rqlite.
+// Each tenant has its own overrides (work hours, thresholds, retention...),
+// falling back to the built-in defaults.
+type SettingsRepo struct {
+	db *DB
+
+	mu     sync.RWMutex
+	values map[string]map[string]json.RawMessage // by tenant, then key
+}
+
+func NewSettingsRepo(db *DB) *SettingsRepo {
+	return &SettingsRepo{db: db, values: make(map[string]map[string]json.RawMessage)}
+}
+
+// Load reads every tenant's stored settings into memory.
+func (r *SettingsRepo) Load(ctx context.Context) error {
+	qr, err := r.db.QueryOne(ctx, ConsistencyStrong, gorqlite.ParameterizedStatement{
+		Query: `SELECT tenant, key, value FROM settings`,
+	})
+	if err != nil {
+		return err
+	}
+	if qr.Err != nil {
+		return qr.Err
+	}
+	values := make(map[string]map[string]json.RawMessage)
+	for qr.Next() {
+		var tenant, key, value string
+		if err := qr.Scan(&tenant, &key, &value); err != nil {
+			return err
+		}
+		if values[tenant] == nil {
+			values[tenant] = make(map[string]json.RawMessage)
+		}
+		values[tenant][key] = json.RawMessage(value)
+	}
+
+	r.mu.Lock()
+	r.values = values
+	r.mu.Unlock()
+	return nil
+}
+
+// Get decodes ctx's tenant's setting into out, falling back to the default.
+func (r *SettingsRepo) Get(ctx context.Context, key string, out interface{}) error {
+	r.mu.RLock()
+	raw, ok := r.values[tenantOf(ctx)][key]
+	r.mu.RUnlock()
+	if !ok {
+		def, known := defaultSettings[key]
+		if !known {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		var err error
+		if raw, err = json.Marshal(def); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// All returns every known setting of ctx's tenant with defaults filled in.
+func (r *SettingsRepo) All(ctx context.Context) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(defaultSettings))
+	for key := range defaultSettings {
+		var v json.RawMessage
+		if err := r.Get(ctx, key, &v); err == nil {
+			out[key] = v
+		}
+	}
+	return out
+}
+
+// Put stores a validated value for key in ctx's tenant.
+func (r *SettingsRepo) Put(ctx context.Context, key string, value json.RawMessage) error {
+	tenant := tenantOf(ctx)
+	if _, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `INSERT OR REPLACE INTO settings (tenant, key, value, updated_at) VALUES (?, ?, ?, ?)`,
+		Arguments: []interface{}{tenant, key, string(value), time.Now().UTC().Format(time.RFC3339)},
+	}}); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.values[tenant] == nil {
+		r.values[tenant] = make(map[string]json.RawMessage)
+	}
+	r.values[tenant][key] = value
+	r.mu.Unlock()
+	return nil
+}
+
+// Delete reverts key to its default in ctx's tenant.
+func (r *SettingsRepo) Delete(ctx context.Context, key string) error {
+	tenant := tenantOf(ctx)
+	if _, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `DELETE FROM settings WHERE tenant = ? AND key = ?`,
+		Arguments: []interface{}{tenant, key},
+	}}); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	delete(r.values[tenant], key)
+	r.mu.Unlock()
+	return nil
+}
+
+type AlertRuleRepo struct {
+	db *DB
+}
+
+func NewAlertRuleRepo(db *DB) *AlertRuleRepo {
+	return &AlertRuleRepo{db: db}
+}
+
+const alertRuleColumns = `id, name, expr, metric, op, threshold, time_window, host, webhook, enabled, updated_at`
+
+func scanAlertRule(qr *gorqlite.QueryResult) (AlertRule, error) {
+	var (
+		rule    AlertRule
+		enabled int64
+	)
+	err := qr.Scan(&rule.ID, &rule.Name, &rule.Expr, &rule.Metric, &rule.Op, &rule.Threshold, &rule.Window, &rule.Host, &rule.Webhook, &enabled, &rule.UpdatedAt)
+	rule.Enabled = enabled != 0
+	return rule, err
+}
+
+func (r *AlertRuleRepo) List(ctx context.Context) ([]AlertRule, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE tenant = ? ORDER BY id`,
+		Arguments: tenantArgs(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	rules := make([]AlertRule, 0, 8)
+	for qr.Next() {
+		rule, err := scanAlertRule(&qr)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Get returns the rule with id; ok is false when it doesn't exist.
+func (r *AlertRuleRepo) Get(ctx context.Context, id int64) (AlertRule, bool, error) {
+	qr, err := r.db.QueryOne(ctx, ConsistencyStrong, gorqlite.ParameterizedStatement{
+		Query:     `SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE tenant = ? AND id = ?`,
+		Arguments: tenantArgs(ctx, id),
+	})
+	if err != nil {
+		return AlertRule{}, false, err
+	}
+	if qr.Err != nil {
+		return AlertRule{}, false, qr.Err
+	}
+	if !qr.Next() {
+		return AlertRule{}, false, nil
+	}
+	rule, err := scanAlertRule(&qr)
+	return rule, err == nil, err
+}
+
+// Create inserts rule and returns it with its new ID.
+func (r *AlertRuleRepo) Create(ctx context.Context, rule AlertRule) (AlertRule, error) {
+	rule.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `INSERT INTO alert_rules (tenant, name, expr, metric, op, threshold, time_window, host, webhook, enabled, updated_at)
+		        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		Arguments: tenantArgs(ctx, rule.Name, rule.Expr, rule.Metric, rule.Op, rule.Threshold, rule.Window, rule.Host, rule.Webhook, rule.Enabled, rule.UpdatedAt),
+	}})
+	if err != nil {
+		return AlertRule{}, err
+	}
+	rule.ID = res[0].LastInsertID
+	return rule, nil
+}
+
+// Update replaces rule; ok is false when no row has that ID.
+func (r *AlertRuleRepo) Update(ctx context.Context, rule AlertRule) (AlertRule, bool, error) {
+	rule.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `UPDATE alert_rules SET name = ?, expr = ?, metric = ?, op = ?, threshold = ?, time_window = ?, host = ?, webhook = ?, enabled = ?, updated_at = ?
+		        WHERE id = ? AND tenant = ?`,
+		Arguments: []interface{}{rule.Name, rule.Expr, rule.Metric, rule.Op, rule.Threshold, rule.Window, rule.Host, rule.Webhook, rule.Enabled, rule.UpdatedAt, rule.ID, tenantOf(ctx)},
+	}})
+	if err != nil {
+		return AlertRule{}, false, err
+	}
+	return rule, res[0].RowsAffected > 0, nil
+}
+
+// Delete removes the rule; ok is false when no row has that ID.
+func (r *AlertRuleRepo) Delete(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `DELETE FROM alert_rules WHERE tenant = ? AND id = ?`,
+		Arguments: tenantArgs(ctx, id),
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
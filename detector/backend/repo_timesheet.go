@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// TimesheetRepo remembers which user-days each connector has received
+// (timesheet_pushes), so a day is pushed once and failures are retried.
+type TimesheetRepo struct {
+	db *DB
+}
+
+func NewTimesheetRepo(db *DB) *TimesheetRepo {
+	return &TimesheetRepo{db: db}
+}
+
+// Done returns the "connector|user|day" keys pushed successfully for days
+// in [fromDay, toDay].
+func (r *TimesheetRepo) Done(ctx context.Context, fromDay, toDay string) (map[string]bool, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT connector, user_name, day FROM timesheet_pushes WHERE tenant = ? AND day BETWEEN ? AND ? AND error = ''`,
+		Arguments: tenantArgs(ctx, fromDay, toDay),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	done := make(map[string]bool)
+	for qr.Next() {
+		var c, u, d string
+		if err := qr.Scan(&c, &u, &d); err != nil {
+			return nil, err
+		}
+		done[c+"|"+u+"|"+d] = true
+	}
+	return done, nil
+}
+
+// Record stores the outcome of one push; pushErr nil marks it done.
+func (r *TimesheetRepo) Record(ctx context.Context, connector, user, day string, pushErr error) error {
+	msg := ""
+	if pushErr != nil {
+		msg = pushErr.Error()
+	}
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `INSERT OR REPLACE INTO timesheet_pushes (tenant, connector, user_name, day, pushed_at, error)
+		        VALUES (?, ?, ?, ?, ?, ?)`,
+		Arguments: tenantArgs(ctx, connector, user, day, time.Now().UTC().Format(time.RFC3339), msg),
+	}})
+	return err
+}
+
+// Recent returns the last limit pushes, newest first.
+func (r *TimesheetRepo) Recent(ctx context.Context, limit int) ([]TimesheetPush, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT connector, user_name, day, pushed_at, error FROM timesheet_pushes
+		        WHERE tenant = ? ORDER BY pushed_at DESC, connector, user_name LIMIT ?`,
+		Arguments: tenantArgs(ctx, limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	pushes := make([]TimesheetPush, 0, 16)
+	for qr.Next() {
+		var p TimesheetPush
+		if err := qr.Scan(&p.Connector, &p.UserName, &p.Day, &p.PushedAt, &p.Error); err != nil {
+			return nil, err
+		}
+		pushes = append(pushes, p)
+	}
+	return pushes, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// TitleRepo reads the window_titles table, which agents write directly.
+type TitleRepo struct {
+	db *DB
+}
+
+func NewTitleRepo(db *DB) *TitleRepo {
+	return &TitleRepo{db: db}
+}
+
+// Between returns the titles sampled in [start, end), grouped by hour and
+// host, hours in order. host may be empty for every host.
+func (r *TitleRepo) Between(ctx context.Context, start, end, host string) ([]TitleHour, error) {
+	query := `SELECT hour_start, host, sampled_at, title, process FROM window_titles
+	          WHERE tenant = ? AND hour_start >= ? AND hour_start < ?`
+	args := tenantArgs(ctx, start, end)
+	if host != "" {
+		query += ` AND host = ?`
+		args = append(args, host)
+	}
+	query += ` ORDER BY hour_start, host, sampled_at`
+
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{Query: query, Arguments: args})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	hours := make([]TitleHour, 0, 8)
+	for qr.Next() {
+		var hourStart, h string
+		var t WindowTitle
+		if err := qr.Scan(&hourStart, &h, &t.SampledAt, &t.Title, &t.Process); err != nil {
+			return nil, err
+		}
+		if n := len(hours); n == 0 || hours[n-1].HourStart != hourStart || hours[n-1].Host != h {
+			hours = append(hours, TitleHour{HourStart: hourStart, Host: h})
+		}
+		last := &hours[len(hours)-1]
+		last.Titles = append(last.Titles, t)
+	}
+	return hours, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// tokenCacheTTL is how long a checked API token is trusted without asking
+// rqlite again, and so how long a revoked token keeps working.
+const tokenCacheTTL = time.Minute
+
+// TokenRepo stores the role-bearing API tokens (api_tokens table). Like
+// agent tokens, only a SHA-256 of each is kept.
+type TokenRepo struct {
+	db *DB
+
+	mu    sync.Mutex
+	cache map[string]cachedToken // by token hash
+}
+
+type cachedToken struct {
+	token APIToken
+	ok    bool
+	until time.Time
+}
+
+func NewTokenRepo(db *DB) *TokenRepo {
+	return &TokenRepo{db: db, cache: make(map[string]cachedToken)}
+}
+
+// Create issues a token bound to ctx's tenant; the secret is returned once
+// and never stored in clear.
+func (r *TokenRepo) Create(ctx context.Context, role, userName, label string) (APIToken, string, error) {
+	t := APIToken{
+		ID:        "t-" + randomHex(8),
+		Tenant:    tenantOf(ctx),
+		Role:      role,
+		UserName:  userName,
+		Label:     label,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	secret := randomHex(32)
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query: `INSERT INTO api_tokens (id, tenant, token_hash, role, user_name, label, created_at)
+		        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		Arguments: []interface{}{t.ID, t.Tenant, hashToken(secret), t.Role, t.UserName, t.Label, t.CreatedAt},
+	}})
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	return t, secret, nil
+}
+
+// Check returns the live token matching secret.
+func (r *TokenRepo) Check(ctx context.Context, secret string) (APIToken, bool, error) {
+	h := hashToken(secret)
+	now := time.Now()
+	r.mu.Lock()
+	c, hit := r.cache[h]
+	r.mu.Unlock()
+	if hit && now.Before(c.until) {
+		return c.token, c.ok, nil
+	}
+
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query:     `SELECT id, tenant, role, user_name, label, created_at FROM api_tokens WHERE token_hash = ? AND revoked_at = ''`,
+		Arguments: []interface{}{h},
+	})
+	if err != nil {
+		return APIToken{}, false, err
+	}
+	if qr.Err != nil {
+		return APIToken{}, false, qr.Err
+	}
+	c = cachedToken{until: now.Add(tokenCacheTTL)}
+	if qr.Next() {
+		t := &c.token
+		if err := qr.Scan(&t.ID, &t.Tenant, &t.Role, &t.UserName, &t.Label, &t.CreatedAt); err != nil {
+			return APIToken{}, false, err
+		}
+		c.ok = true
+	}
+	r.mu.Lock()
+	for k, v := range r.cache {
+		if now.After(v.until) {
+			delete(r.cache, k)
+		}
+	}
+	r.cache[h] = c
+	r.mu.Unlock()
+	return c.token, c.ok, nil
+}
+
+// List returns the tenant's tokens, newest first.
+func (r *TokenRepo) List(ctx context.Context) ([]APIToken, error) {
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT id, tenant, role, user_name, label, created_at, revoked_at
+		        FROM api_tokens WHERE tenant = ? ORDER BY created_at DESC, id`,
+		Arguments: tenantArgs(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	out := make([]APIToken, 0, 16)
+	for qr.Next() {
+		var t APIToken
+		if err := qr.Scan(&t.ID, &t.Tenant, &t.Role, &t.UserName, &t.Label, &t.CreatedAt, &t.RevokedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Revoke ends a token; ok is false when id is unknown or already revoked.
+func (r *TokenRepo) Revoke(ctx context.Context, id string) (bool, error) {
+	res, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `UPDATE api_tokens SET revoked_at = ? WHERE tenant = ? AND id = ? AND revoked_at = ''`,
+		Arguments: []interface{}{time.Now().UTC().Format(time.RFC3339), tenantOf(ctx), id},
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res[0].RowsAffected > 0, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// Agents with a SigningKey sign each hourly row with HMAC-SHA256 so that
+// rows edited in rqlite, or forged by something other than the agent, can
+// be told apart. Each agent's key is derived from BUCKET_SIGNING_KEY and
+// its host name, so the backend keeps a single secret and one leaked agent
+// key cannot sign for another host. Rows are never rejected over their
+// signature: the outcome is stored in signature_status for reports.
+
+// signingKey is BUCKET_SIGNING_KEY; empty disables verification.
+var signingKey = []byte(os.Getenv("BUCKET_SIGNING_KEY"))
+
+// Values of activity_hourly.signature_status.
+const (
+	signatureUnsigned  = "unsigned"  // no signature sent
+	signatureValid     = "valid"     // matches the host's key
+	signatureInvalid   = "invalid"   // row changed after signing, or wrong key
+	signatureUnchecked = "unchecked" // signed, but BUCKET_SIGNING_KEY is unset
+)
+
+// agentSigningKey is host's key, hex-encoded as the agent's SigningKey.
+func agentSigningKey(host string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte("bucket\x00" + host))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bucketPayload is the text signed for one row: the fields a tamperer
+// would touch, formatted as the agent writes them. It must match the
+// agent's bucketPayload.
+func bucketPayload(hourStart, host, user string, activityPct, idleSeconds float64, samples int64, status string, mouse, key, touch int64) string {
+	return fmt.Sprintf("%s\n%s\n%s\n%.4f\n%.0f\n%d\n%s\n%d\n%d\n%d",
+		hourStart, host, user, activityPct, idleSeconds, samples, status, mouse, key, touch)
+}
+
+// verifyBucket returns the signature_status of a row of host signed with
+// signature over payload.
+func verifyBucket(host, payload, signature string) string {
+	switch {
+	case signature == "":
+		return signatureUnsigned
+	case len(signingKey) == 0:
+		return signatureUnchecked
+	}
+	key, _ := hex.DecodeString(agentSigningKey(host))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return signatureInvalid
+	}
+	return signatureValid
+}
+
+// verifyIngest sets the signature status of a row posted to /ingest/hourly.
+func verifyIngest(row *HourlyIngest) {
+	row.SignatureStatus = verifyBucket(row.Host, bucketPayload(row.HourStart, row.Host, row.UserName,
+		row.ActivityPct, row.IdleSeconds, row.Samples, row.Status, row.MouseEvents, row.KeyEvents, row.TouchEvents), row.Signature)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// flightGroup coalesces identical concurrent calls: while one call for a
+// key is running, later callers wait for its result instead of issuing
+// their own query. Fifty dashboards refreshing in the same second cost
+// one rqlite round trip.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// do runs fn once per in-flight key. The shared call is detached from the
+// first caller's cancellation (keeping its deadline and trace), so one
+// client disconnecting doesn't fail everybody else; each caller still
+// stops waiting when its own ctx ends.
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight[T])
+	}
+	f, ok := g.calls[key]
+	if !ok {
+		f = &flight[T]{done: make(chan struct{})}
+		g.calls[key] = f
+		g.mu.Unlock()
+
+		go func() {
+			callCtx := context.WithoutCancel(ctx)
+			if dl, ok := ctx.Deadline(); ok {
+				var cancel context.CancelFunc
+				callCtx, cancel = context.WithDeadline(callCtx, dl)
+				defer cancel()
+			}
+			f.val, f.err = fn(callCtx)
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	} else {
+		g.mu.Unlock()
+	}
+
+	select {
+	case <-f.done:
+		if errors.Is(f.err, context.DeadlineExceeded) {
+			// the shared call carried the first caller's request flag
+			markQueryTimedOut(ctx)
+		}
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+// webFS holds the build of the React dashboard (detector/frontend, whose
+// vite config writes it to web/dist). web/README.md keeps the pattern
+// valid when dist has not been built.
+//
+//go:embed web
+var webFS embed.FS
+
+// Dashboard serves the embedded single-page dashboard from /. Register it
+// after the API routes so they take precedence. When the binary was built
+// without the dashboard, / answers 404 with a hint.
+func Dashboard() fiber.Handler {
+	sub, err := fs.Sub(webFS, "web/dist")
+	if err != nil {
+		panic(err)
+	}
+	if _, err := fs.Stat(sub, "index.html"); err != nil {
+		log.Print("dashboard: not embedded (run npm run build in detector/frontend before go build)")
+		return func(c *fiber.Ctx) error {
+			if c.Path() != "/" {
+				return c.Next()
+			}
+			return fiber.NewError(fiber.StatusNotFound, "dashboard not built into this binary")
+		}
+	}
+	return filesystem.New(filesystem.Config{
+		Root:   http.FS(sub),
+		Index:  "index.html",
+		MaxAge: 300,
+	})
+}
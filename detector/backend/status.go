@@ -0,0 +1,38 @@
+package main
+
+import "taxonomy"
+
+// Status is the hourly classification written by agents; the vocabulary
+// lives in package taxonomy, shared with the agent.
+type Status = taxonomy.Status
+
+const (
+	StatusOff            = taxonomy.Off
+	StatusLow            = taxonomy.Low
+	StatusActive         = taxonomy.Active
+	StatusHighProduction = taxonomy.HighProduction
+
+	// set for LOW hours that overlap a meeting, see job_calendar.go
+	StatusInMeeting = taxonomy.InMeeting
+
+	// written by the gap-fill job, see job_gaps.go
+	StatusNoData    = taxonomy.NoData
+	StatusAgentDown = taxonomy.AgentDown
+)
+
+// measuredSQL keeps gap rows out of SQL aggregates; gapSQL selects them.
+const (
+	measuredSQL = `status NOT IN ('NO_DATA', 'AGENT_DOWN')`
+	gapSQL      = `status IN ('NO_DATA', 'AGENT_DOWN')`
+)
+
+// ParseStatus normalizes s (case and surrounding spaces ignored, legacy
+// spellings mapped) and rejects unknown statuses.
+func ParseStatus(s string) (Status, error) {
+	return taxonomy.Parse(s)
+}
+
+// Classify mirrors the agent's statusFor using the configured thresholds.
+func Classify(activityPct float64, samples int64, t StatusThresholds) Status {
+	return taxonomy.Classify(activityPct, samples, t)
+}
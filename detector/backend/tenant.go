@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rqlite/gorqlite"
+)
+
+// One backend can serve several subsidiaries, each a tenant. Every data
+// table carries a tenant column and repos scope each statement to
+// tenantOf(ctx); requests are bound to the tenant of their token (see
+// auth.go) and background jobs run once per tenant through perTenant.
+// Rows from before tenants existed, agents writing straight to rqlite and
+// callers without a tenant-bound token belong to defaultTenant, so a
+// single-tenant deployment works as before.
+//
+// The tenant leads the key of every table, so neither host names nor user
+// names need be unique across tenants: each tenant's PC-001 is its own.
+const defaultTenant = "default"
+
+// tenantHeader picks the tenant the shared ADMIN_TOKEN acts on.
+const tenantHeader = "X-Tenant"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+type tenantKey struct{}
+
+// withTenant scopes ctx to tenant.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantOf returns the tenant ctx is scoped to, defaultTenant if none.
+func tenantOf(ctx context.Context) string {
+	if t, ok := ctx.Value(tenantKey{}).(string); ok && t != "" {
+		return t
+	}
+	return defaultTenant
+}
+
+// tenantArgs prepends ctx's tenant to the remaining query arguments, for
+// statements starting with "tenant = ?".
+func tenantArgs(ctx context.Context, rest ...interface{}) []interface{} {
+	return append([]interface{}{tenantOf(ctx)}, rest...)
+}
+
+// bindTenant scopes the rest of request c to tenant. X-Tenant switches
+// tenants for the shared ADMIN_TOKEN (operator) only; a token bound to a
+// tenant may repeat its own but not name another.
+func bindTenant(c *fiber.Ctx, tenants *TenantRepo, tenant string, operator bool) error {
+	if want := strings.TrimSpace(c.Get(tenantHeader)); want != "" && want != tenant {
+		if !operator {
+			return fiber.NewError(fiber.StatusForbidden, "X-Tenant is for ADMIN_TOKEN; this request is bound to tenant "+tenant)
+		}
+		ok, err := tenants.Exists(c.UserContext(), want)
+		if err != nil {
+			return dbError(err)
+		}
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("unknown tenant %q", want))
+		}
+		tenant = want
+	}
+	c.SetUserContext(withTenant(c.UserContext(), tenant))
+	return nil
+}
+
+// tenantEnrollmentSecret is the secret agents of tenant enroll with: the
+// site's ENROLLMENT_SECRET for the default tenant, and for the others
+// "<tenant>.<key>" with key derived from it, so the backend keeps a single
+// secret and one subsidiary's cannot enroll machines into another.
+func tenantEnrollmentSecret(secret, tenant string) string {
+	if tenant == defaultTenant {
+		return secret
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("enroll\x00" + tenant))
+	return tenant + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enrollmentTenant is the tenant an enrollment secret claims to be for.
+func enrollmentTenant(secret string) string {
+	if i := strings.IndexByte(secret, '.'); i > 0 && tenantIDPattern.MatchString(secret[:i]) {
+		return secret[:i]
+	}
+	return defaultTenant
+}
+
+// perTenant wraps a job so each run goes over every tenant in turn. One
+// tenant failing does not keep the others from running.
+func perTenant(tenants *TenantRepo, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		list, err := tenants.List(ctx)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, t := range list {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := fn(withTenant(ctx, t.ID)); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", t.ID, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// tenantCacheTTL is how long the tenant list is trusted without asking
+// rqlite again.
+const tenantCacheTTL = time.Minute
+
+// TenantRepo stores the tenants (tenants table), which only the operator
+// creates.
+type TenantRepo struct {
+	db *DB
+
+	mu    sync.Mutex
+	list  []Tenant
+	until time.Time
+}
+
+func NewTenantRepo(db *DB) *TenantRepo {
+	return &TenantRepo{db: db}
+}
+
+// List returns every tenant, the default one included, by ID.
+func (r *TenantRepo) List(ctx context.Context) ([]Tenant, error) {
+	now := time.Now()
+	r.mu.Lock()
+	list, fresh := r.list, now.Before(r.until)
+	r.mu.Unlock()
+	if fresh {
+		return list, nil
+	}
+
+	qr, err := r.db.QueryOne(ctx, "", gorqlite.ParameterizedStatement{
+		Query: `SELECT id, name, created_at FROM tenants ORDER BY id`,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qr.Err != nil {
+		return nil, qr.Err
+	}
+	list = make([]Tenant, 0, 4)
+	for qr.Next() {
+		var t Tenant
+		if err := qr.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	r.mu.Lock()
+	r.list, r.until = list, now.Add(tenantCacheTTL)
+	r.mu.Unlock()
+	return list, nil
+}
+
+// Exists reports whether id is a tenant.
+func (r *TenantRepo) Exists(ctx context.Context, id string) (bool, error) {
+	list, err := r.List(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range list {
+		if t.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Create stores t together with its audit entry.
+func (r *TenantRepo) Create(ctx context.Context, t Tenant, audit gorqlite.ParameterizedStatement) error {
+	_, err := r.db.Write(ctx, []gorqlite.ParameterizedStatement{{
+		Query:     `INSERT INTO tenants (id, name, created_at) VALUES (?, ?, ?)`,
+		Arguments: []interface{}{t.ID, t.Name, t.CreatedAt},
+	}, audit})
+	r.mu.Lock()
+	r.until = time.Time{}
+	r.mu.Unlock()
+	return err
+}
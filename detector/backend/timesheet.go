@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultTimesheetBody is the "json" connector body when none is set.
+const defaultTimesheetBody = `{"user": {{json .User}}, "date": {{json .Day}}, "active_hours": {{printf "%.2f" .ActiveHours}}, "tracked_hours": {{.TrackedHours}}}`
+
+var timesheetFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"urlquery": url.QueryEscape,
+}
+
+// validateTimesheet checks connector names, kinds and templates, so a
+// typo fails the settings PUT rather than the nightly push.
+func validateTimesheet(t TimesheetSettings) error {
+	seen := make(map[string]bool)
+	for i, c := range t.Connectors {
+		if c.Name == "" || seen[c.Name] {
+			return fmt.Errorf("connectors[%d]: name is required and must be unique", i)
+		}
+		seen[c.Name] = true
+		switch c.Kind {
+		case "json":
+			if c.URL == "" {
+				return fmt.Errorf("connector %q: url is required", c.Name)
+			}
+			if _, _, err := c.templates(); err != nil {
+				return fmt.Errorf("connector %q: %v", c.Name, err)
+			}
+		case "toggl":
+			if c.WorkspaceID <= 0 {
+				return fmt.Errorf("connector %q: workspace_id is required", c.Name)
+			}
+		default:
+			return fmt.Errorf("connector %q: kind must be json or toggl", c.Name)
+		}
+	}
+	return nil
+}
+
+func (c TimesheetConnector) templates() (u, body *template.Template, err error) {
+	if u, err = template.New("url").Funcs(timesheetFuncs).Parse(c.URL); err != nil {
+		return nil, nil, fmt.Errorf("url: %v", err)
+	}
+	src := c.Body
+	if src == "" {
+		src = defaultTimesheetBody
+	}
+	if body, err = template.New("body").Funcs(timesheetFuncs).Parse(src); err != nil {
+		return nil, nil, fmt.Errorf("body: %v", err)
+	}
+	return u, body, nil
+}
+
+// wants reports whether the connector pushes user's days.
+func (c TimesheetConnector) wants(user string) bool {
+	if len(c.Users) == 0 {
+		return true
+	}
+	for _, u := range c.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+// push sends one user-day through the connector.
+func (c TimesheetConnector) push(ctx context.Context, client *http.Client, d TimesheetDay) error {
+	switch c.Kind {
+	case "json":
+		return c.pushJSON(ctx, client, d)
+	case "toggl":
+		return c.pushToggl(ctx, client, d)
+	}
+	return fmt.Errorf("unknown kind %q", c.Kind)
+}
+
+func (c TimesheetConnector) pushJSON(ctx context.Context, client *http.Client, d TimesheetDay) error {
+	ut, bt, err := c.templates()
+	if err != nil {
+		return err
+	}
+	var u, body bytes.Buffer
+	if err := ut.Execute(&u, d); err != nil {
+		return err
+	}
+	if err := bt.Execute(&body, d); err != nil {
+		return err
+	}
+	method := c.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		req.Header.Set(k, os.Expand(v, os.Getenv))
+	}
+	return doTimesheet(client, req)
+}
+
+// pushToggl creates a Toggl Track time entry starting at the first active
+// hour and lasting the active time, tagged with the user name. The entry
+// belongs to the owner of the API token in TokenEnv.
+func (c TimesheetConnector) pushToggl(ctx context.Context, client *http.Client, d TimesheetDay) error {
+	env := c.TokenEnv
+	if env == "" {
+		env = "TOGGL_API_TOKEN"
+	}
+	token := os.Getenv(env)
+	if token == "" {
+		return fmt.Errorf("%s is not set", env)
+	}
+	start, err := time.Parse(time.RFC3339, d.FirstActive)
+	if err != nil {
+		return fmt.Errorf("first_active: %v", err)
+	}
+	entry := map[string]interface{}{
+		"created_with": "idle",
+		"description":  fmt.Sprintf("Activité %s (%s)", d.Day, d.User),
+		"start":        start.UTC().Format(time.RFC3339),
+		"duration":     int64(d.ActiveHours * 3600),
+		"workspace_id": c.WorkspaceID,
+		"tags":         []string{d.User},
+	}
+	if c.ProjectID > 0 {
+		entry["project_id"] = c.ProjectID
+	}
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("https://api.track.toggl.com/api/v9/workspaces/%d/time_entries", c.WorkspaceID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(token, "api_token")
+	return doTimesheet(client, req)
+}
+
+func doTimesheet(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// timesheetDays totals rows (one local day) per user. Users without any
+// active time are left out: there is nothing to enter for them.
+func timesheetDays(day string, loc *time.Location, rows []ActivityRow) []TimesheetDay {
+	byUser := make(map[string]*TimesheetDay)
+	var order []string
+	for _, r := range rows {
+		if r.UserName == "" || !Status(r.Status).Measured() {
+			continue
+		}
+		d := byUser[r.UserName]
+		if d == nil {
+			d = &TimesheetDay{User: r.UserName, Day: day}
+			byUser[r.UserName] = d
+			order = append(order, r.UserName)
+		}
+		d.DisplayName, d.Team = r.DisplayName, r.Team
+		if r.Samples > 0 {
+			d.TrackedHours++
+		}
+		if r.ActivityPct <= 0 {
+			continue
+		}
+		d.ActiveHours += r.ActivityPct / 100
+		// the agent's first and last input of the hour, where reported,
+		// beat the hour boundaries
+		if t, err := time.Parse(time.RFC3339, r.HourStart); err == nil {
+			first, last := t, t.Add(time.Hour)
+			if in, err := time.Parse(time.RFC3339, r.FirstInput); err == nil {
+				first = in
+			}
+			if in, err := time.Parse(time.RFC3339, r.LastInput); err == nil {
+				last = in
+			}
+			if d.FirstActive == "" {
+				d.FirstActive = first.In(loc).Format(time.RFC3339)
+			}
+			d.LastActive = last.In(loc).Format(time.RFC3339)
+		}
+	}
+	days := make([]TimesheetDay, 0, len(order))
+	for _, u := range order {
+		if d := byUser[u]; d.ActiveHours > 0 {
+			days = append(days, *d)
+		}
+	}
+	return days
+}
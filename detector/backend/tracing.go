@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing uses OpenTelemetry: an incoming W3C traceparent header joins the
+// caller's trace, spans are carried in context.Context from the handler
+// down to every rqlite call, and finished spans go to an OTLP collector
+// when OTEL_EXPORTER_OTLP_ENDPOINT (or ..._TRACES_ENDPOINT) is set. The
+// access log and slow or failed spans carry the trace and span IDs, so
+// they can be found in the tracing backend.
+
+// logger writes JSON records to stdout; LOG_LEVEL=debug also prints every span.
+var logger = newLogger()
+
+func newLogger() *slog.Logger {
+	level := slog.LevelInfo
+	if strings.EqualFold(os.Getenv("LOG_LEVEL"), "debug") {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+// slowSpan is the duration above which spans are logged at WARN.
+var slowSpan = envDuration("SLOW_QUERY_THRESHOLD", 500*time.Millisecond)
+
+var tracer = otel.Tracer("detector-api")
+
+// InitTracing installs the W3C propagator and a tracer provider exporting
+// over OTLP/HTTP, configured by the standard OTEL_* variables
+// (OTEL_SERVICE_NAME defaults to detector-api). Without an endpoint spans
+// are still created, for the IDs in logs and responses, but not exported.
+// The returned function flushes pending spans.
+func InitTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "detector-api")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+type requestIDKey struct{}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// span is an OpenTelemetry span that is also logged when it ends.
+type span struct {
+	trace.Span
+	name  string
+	start time.Time
+	attrs []attribute.KeyValue
+}
+
+// startSpan opens a child of the span in ctx, or a new trace if there is none.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, *span) {
+	ctx, s := tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	return ctx, &span{Span: s, name: name, start: time.Now(), attrs: attrs}
+}
+
+// End ends the span, marking it failed on err, and logs it; slow or failed
+// spans are raised to WARN.
+func (s *span) End(err error) {
+	if err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	}
+	s.Span.End()
+
+	d := time.Since(s.start)
+	sc := s.SpanContext()
+	attrs := []any{
+		"span", s.name,
+		"trace_id", sc.TraceID().String(),
+		"span_id", sc.SpanID().String(),
+		"duration_ms", float64(d.Microseconds()) / 1000,
+	}
+	for _, kv := range s.attrs {
+		attrs = append(attrs, string(kv.Key), kv.Value.Emit())
+	}
+	level := slog.LevelDebug
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+		level = slog.LevelWarn
+	} else if d >= slowSpan {
+		level = slog.LevelWarn
+	}
+	logger.Log(context.Background(), level, "span", attrs...)
+}
+
+// requestIDFrom returns the request ID stored by RequestLogger.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// headerCarrier lets the propagator read request headers and write
+// response headers.
+type headerCarrier struct{ c *fiber.Ctx }
+
+func (h headerCarrier) Get(key string) string { return h.c.Get(key) }
+func (h headerCarrier) Set(key, value string) { h.c.Set(key, value) }
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
+
+// RequestLogger assigns a request ID (honouring X-Request-ID), joins or
+// starts a trace, exposes both to handlers through c.UserContext(), and
+// writes one access log line per request.
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		reqID := c.Get(fiber.HeaderXRequestID)
+		if reqID == "" || len(reqID) > 128 {
+			reqID = randomHex(16)
+		}
+
+		prop := otel.GetTextMapPropagator()
+		ctx := context.WithValue(c.UserContext(), requestIDKey{}, reqID)
+		ctx = prop.Extract(ctx, headerCarrier{c})
+		ctx, sp := startSpan(ctx, c.Method()+" "+c.Path(), trace.SpanKindServer,
+			attribute.String("http.request.method", c.Method()),
+			attribute.String("url.path", c.Path()),
+			attribute.String("request_id", reqID),
+		)
+		c.SetUserContext(ctx)
+		c.Set(fiber.HeaderXRequestID, reqID)
+		prop.Inject(ctx, headerCarrier{c})
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			// let the error handler pick the status, but log what it will be
+			status = toAPIError(err).Status
+		}
+		if route := c.Route(); route != nil && route.Path != "" {
+			sp.SetName(c.Method() + " " + route.Path)
+			sp.SetAttributes(attribute.String("http.route", route.Path))
+		}
+		sp.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			sp.SetStatus(codes.Error, "")
+		}
+		sp.Span.End()
+
+		sc := sp.SpanContext()
+		logger.Info("request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"latency_ms", float64(time.Since(sp.start).Microseconds())/1000,
+			"request_id", reqID,
+			"trace_id", sc.TraceID().String(),
+			"span_id", sc.SpanID().String(),
+			"ip", c.IP(),
+		)
+		return err
+	}
+}
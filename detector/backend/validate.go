@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Query and body parameters shared by several endpoints are parsed here so
+// they accept the same spellings and reject bad values with the same
+// message: what was wrong, the value received and what to send instead.
+
+// maxRangeDays bounds the from/to span of one request (MAX_RANGE_DAYS,
+// default 366): a multi-year range over the whole fleet would hold an
+// rqlite node for minutes. Longer exports are split by the caller.
+var maxRangeDays = envInt("MAX_RANGE_DAYS", 366)
+
+func badParam(format string, args ...any) error {
+	return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf(format, args...))
+}
+
+// parseHHMM reads a time of day as HH:MM or H:MM ("7:00").
+func parseHHMM(s string) (h, m int, ok bool) {
+	if len(s) == 4 {
+		s = "0" + s
+	}
+	if len(s) != 5 || s[2] != ':' {
+		return 0, 0, false
+	}
+	for _, i := range []int{0, 1, 3, 4} {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, 0, false
+		}
+	}
+	h = int((s[0]-'0')*10 + (s[1] - '0'))
+	m = int((s[3]-'0')*10 + (s[4] - '0'))
+	if h > 23 || m > 59 {
+		return 0, 0, false
+	}
+	return h, m, true
+}
+
+// queryHHMM reads the time-of-day parameter key, def when absent.
+func queryHHMM(c *fiber.Ctx, key, def string) (h, m int, err error) {
+	v := c.Query(key, def)
+	h, m, ok := parseHHMM(v)
+	if !ok {
+		return 0, 0, badParam("invalid %s %q (use HH:MM, e.g. 07:30)", key, v)
+	}
+	return h, m, nil
+}
+
+// queryTZ reads the time-zone parameter key ("UTC", "Local" or an IANA
+// name), def when absent and UTC when both are empty.
+func queryTZ(c *fiber.Ctx, key, def string) (*time.Location, error) {
+	return parseTZ(key, c.Query(key, def))
+}
+
+func parseTZ(key, name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, badParam("unknown %s %q (use UTC or an IANA name like Europe/Paris)", key, name)
+	}
+	return loc, nil
+}
+
+// parseDay reads a YYYY-MM-DD value as midnight in loc.
+func parseDay(key, v string, loc *time.Location) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, badParam("%s is required (use YYYY-MM-DD)", key)
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, loc)
+	if err != nil {
+		return time.Time{}, badParam("invalid %s %q (use YYYY-MM-DD)", key, v)
+	}
+	return t, nil
+}
+
+// checkRange rejects a [from, to) range that is empty, reversed or longer
+// than maxRangeDays.
+func checkRange(fromKey, toKey string, from, to time.Time) error {
+	if !to.After(from) {
+		return badParam("%s must be after %s (got %s=%s, %s=%s)", toKey, fromKey,
+			fromKey, from.Format(time.RFC3339), toKey, to.Format(time.RFC3339))
+	}
+	if days := to.Sub(from).Hours() / 24; days > float64(maxRangeDays) {
+		return badParam("%s to %s spans %.0f days, more than the %d allowed (MAX_RANGE_DAYS); split the request",
+			fromKey, toKey, days, maxRangeDays)
+	}
+	return nil
+}
+
+// queryInt reads the integer parameter key, def when absent, and requires
+// it within [min, max].
+func queryInt(c *fiber.Ctx, key string, def, min, max int) (int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, badParam("%s must be an integer within %d-%d, got %q", key, min, max, v)
+	}
+	return n, nil
+}
@@ -31,6 +31,7 @@ import {
 } from "@/components/ui/table";
 import { Button } from "@/components/ui/button";
 import { cn } from "@/lib/utils";
+import { getJSON } from "./api";
 
 type Status = "active" | "inactive" | "non_active" | "tres_active";
 
@@ -111,19 +112,12 @@ function DatePicker({
   );
 }
 
-async function fetchRange(
-  startDate: Date,
-  endDate: Date,
-): Promise<ApiResponse> {
-  const start_date = format(startDate, "yyyy-MM-dd");
-  const end_date = format(endDate, "yyyy-MM-dd");
-  const res = await fetch(
-    `/activity/range?start_date=${encodeURIComponent(start_date)}&end_date=${encodeURIComponent(
-      end_date,
-    )}&tz=UTC`,
-  );
-  if (!res.ok) throw new Error((await res.text()) || `HTTP ${res.status}`);
-  return res.json();
+function fetchRange(startDate: Date, endDate: Date): Promise<ApiResponse> {
+  return getJSON<ApiResponse>("/activity/range", {
+    start_date: format(startDate, "yyyy-MM-dd"),
+    end_date: format(endDate, "yyyy-MM-dd"),
+    tz: "UTC",
+  });
 }
 
 export default function ActivityTable() {
@@ -0,0 +1,279 @@
+// Overview.tsx
+// One day at a glance: activity by hour, the last 7 days, every host and
+// the focus sessions, from GET /activity/today and GET /activity/focus.
+// Refreshed every 30 s.
+
+import { useCallback, useEffect, useMemo, useState } from "react";
+import type { ReactNode } from "react";
+import { addDays, format, subDays } from "date-fns";
+
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from "@/components/ui/table";
+import { cn } from "@/lib/utils";
+import { getJSON, getToken, setToken } from "./api";
+
+type HourRow = {
+  hour_start: string;
+  host: string;
+  user_name: string;
+  display_name: string;
+  activity_pct: number;
+  status: string;
+};
+
+type Today = { rows: HourRow[] };
+
+type FocusSession = {
+  host: string;
+  started_at: string;
+  ended_at: string;
+  duration_seconds: number;
+  app: string;
+  activity_pct: number;
+};
+
+type Focus = { count: number; focus_seconds: number; sessions: FocusSession[] };
+
+const statusColor: Record<string, string> = {
+  OFF: "bg-slate-300",
+  LOW: "bg-amber-500",
+  ACTIVE: "bg-green-500",
+  HIGH_PRODUCTION: "bg-sky-500",
+  IN_MEETING: "bg-violet-400",
+  NO_DATA: "bg-slate-200",
+  AGENT_DOWN: "bg-red-200",
+};
+
+const pad = (n: number) => String(n).padStart(2, "0");
+
+function avg(rows: HourRow[]): number {
+  if (!rows.length) return 0;
+  return rows.reduce((s, r) => s + r.activity_pct, 0) / rows.length;
+}
+
+function groupBy<K>(rows: HourRow[], key: (r: HourRow) => K): Map<K, HourRow[]> {
+  const m = new Map<K, HourRow[]>();
+  for (const r of rows) {
+    const k = key(r);
+    m.set(k, [...(m.get(k) ?? []), r]);
+  }
+  return m;
+}
+
+function getDay(date: string, host: string): Promise<Today> {
+  const q: Record<string, string> = { date, start: "00:00", end: "23:59", tz: "UTC" };
+  if (host) q.host = host;
+  return getJSON<Today>("/activity/today", q);
+}
+
+function Bars({ bars }: { bars: { label: string; pct: number; status?: string }[] }) {
+  return (
+    <div className="flex h-40 items-end gap-1">
+      {bars.map((b) => (
+        <div
+          key={b.label}
+          className="flex h-full flex-1 flex-col items-center justify-end text-xs"
+          title={`${b.label} : ${b.pct.toFixed(0)} %`}
+        >
+          <div
+            className={cn("w-full rounded-t", statusColor[b.status ?? ""] ?? "bg-slate-400")}
+            style={{ height: `${Math.max(2, b.pct)}%` }}
+          />
+          <div className="mt-1 text-muted-foreground">{b.label}</div>
+        </div>
+      ))}
+    </div>
+  );
+}
+
+function Section({ title, children }: { title: string; children: ReactNode }) {
+  return (
+    <Card className="rounded-2xl shadow-sm">
+      <CardHeader className="py-3">
+        <CardTitle className="text-base">{title}</CardTitle>
+      </CardHeader>
+      <CardContent>{children}</CardContent>
+    </Card>
+  );
+}
+
+export default function Overview() {
+  const [date, setDate] = useState(() => format(new Date(), "yyyy-MM-dd"));
+  const [host, setHost] = useState("");
+  const [token, setTokenState] = useState(getToken);
+  const [today, setToday] = useState<HourRow[]>([]);
+  const [hosts, setHosts] = useState<string[]>([]);
+  const [week, setWeek] = useState<{ label: string; pct: number }[]>([]);
+  const [focus, setFocus] = useState<Focus | null>(null);
+  const [error, setError] = useState<string | null>(null);
+
+  const refresh = useCallback(async () => {
+    try {
+      const day = await getDay(date, host);
+      setToday(day.rows);
+      if (!host) setHosts([...new Set(day.rows.map((r) => r.host))].sort());
+
+      const end = new Date(`${date}T00:00:00Z`);
+      const days = Array.from({ length: 7 }, (_, i) =>
+        format(subDays(end, 6 - i), "yyyy-MM-dd"),
+      );
+      const results = await Promise.all(days.map((d) => getDay(d, host)));
+      setWeek(results.map((r, i) => ({ label: days[i].slice(5), pct: avg(r.rows) })));
+
+      const q: Record<string, string> = {
+        from: date,
+        to: format(addDays(end, 1), "yyyy-MM-dd"),
+      };
+      if (host) q.host = host;
+      setFocus(await getJSON<Focus>("/activity/focus", q));
+      setError(null);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : String(e));
+    }
+  }, [date, host]);
+
+  useEffect(() => {
+    void refresh();
+    const id = setInterval(() => void refresh(), 30000);
+    return () => clearInterval(id);
+  }, [refresh, token]);
+
+  const hourBars = useMemo(() => {
+    const byHour = groupBy(today, (r) => Number(r.hour_start.slice(11, 13)));
+    return Array.from({ length: 24 }, (_, h) => {
+      const list = byHour.get(h) ?? [];
+      return {
+        label: pad(h),
+        pct: avg(list),
+        status: list.length === 1 ? list[0].status : undefined,
+      };
+    });
+  }, [today]);
+
+  const byHost = useMemo(
+    () => [...groupBy(today, (r) => r.host)].sort(([a], [b]) => a.localeCompare(b)),
+    [today],
+  );
+
+  return (
+    <div className="flex flex-col gap-4">
+      <div className="flex flex-wrap items-end gap-4 rounded-2xl border bg-slate-50/70 p-4 text-sm">
+        <label className="flex flex-col gap-1">
+          Poste
+          <select
+            className="rounded-md border px-2 py-1"
+            value={host}
+            onChange={(e) => setHost(e.target.value)}
+          >
+            <option value="">Tous les postes</option>
+            {hosts.map((h) => (
+              <option key={h} value={h}>
+                {h || "(inconnu)"}
+              </option>
+            ))}
+          </select>
+        </label>
+        <label className="flex flex-col gap-1">
+          Date
+          <input
+            type="date"
+            className="rounded-md border px-2 py-1"
+            value={date}
+            onChange={(e) => e.target.value && setDate(e.target.value)}
+          />
+        </label>
+        <label className="flex flex-col gap-1">
+          Jeton
+          <input
+            type="password"
+            className="rounded-md border px-2 py-1"
+            placeholder="facultatif"
+            value={token}
+            onChange={(e) => {
+              setToken(e.target.value);
+              setTokenState(e.target.value);
+            }}
+          />
+        </label>
+      </div>
+
+      {error && <div className="text-sm text-red-600">{error}</div>}
+
+      <Section title="Activité par heure (UTC)">
+        <Bars bars={hourBars} />
+      </Section>
+
+      <Section title="7 derniers jours">
+        <Bars bars={week} />
+      </Section>
+
+      <Section title="Postes">
+        <Table>
+          <TableHeader>
+            <TableRow>
+              <TableHead>Poste</TableHead>
+              <TableHead>Utilisateur</TableHead>
+              <TableHead>Heures</TableHead>
+              <TableHead>Activité moyenne</TableHead>
+              <TableHead>Dernier statut</TableHead>
+            </TableRow>
+          </TableHeader>
+          <TableBody>
+            {byHost.map(([h, list]) => {
+              const last = list[list.length - 1];
+              return (
+                <TableRow key={h}>
+                  <TableCell className="font-medium">{h || "(inconnu)"}</TableCell>
+                  <TableCell>{last.display_name || last.user_name}</TableCell>
+                  <TableCell>{list.length}</TableCell>
+                  <TableCell>{avg(list).toFixed(0)} %</TableCell>
+                  <TableCell>{last.status}</TableCell>
+                </TableRow>
+              );
+            })}
+          </TableBody>
+        </Table>
+      </Section>
+
+      <Section
+        title={`Sessions de concentration${
+          focus?.count
+            ? ` : ${focus.count}, ${Math.round(focus.focus_seconds / 60)} min`
+            : ""
+        }`}
+      >
+        <Table>
+          <TableHeader>
+            <TableRow>
+              <TableHead>Poste</TableHead>
+              <TableHead>Début (UTC)</TableHead>
+              <TableHead>Fin</TableHead>
+              <TableHead>Durée</TableHead>
+              <TableHead>Application</TableHead>
+              <TableHead>Activité</TableHead>
+            </TableRow>
+          </TableHeader>
+          <TableBody>
+            {(focus?.sessions ?? []).map((s) => (
+              <TableRow key={`${s.host}|${s.started_at}`}>
+                <TableCell>{s.host}</TableCell>
+                <TableCell>{s.started_at.slice(11, 16)}</TableCell>
+                <TableCell>{s.ended_at.slice(11, 16)}</TableCell>
+                <TableCell>{Math.round(s.duration_seconds / 60)} min</TableCell>
+                <TableCell>{s.app}</TableCell>
+                <TableCell>{s.activity_pct.toFixed(0)} %</TableCell>
+              </TableRow>
+            ))}
+          </TableBody>
+        </Table>
+      </Section>
+    </div>
+  );
+}
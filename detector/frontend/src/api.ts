@@ -0,0 +1,44 @@
+// api.ts
+// Calls to the backend, which serves this app from the same origin. The
+// token (optional, needed when the backend sets READ_AUTH=required) is
+// kept in localStorage.
+
+const TOKEN_KEY = "token";
+
+export function getToken(): string {
+  return localStorage.getItem(TOKEN_KEY) ?? "";
+}
+
+export function setToken(token: string) {
+  localStorage.setItem(TOKEN_KEY, token);
+}
+
+// getJSON GETs path with the query q, sending the token if there is one.
+export async function getJSON<T>(
+  path: string,
+  q: Record<string, string>,
+): Promise<T> {
+  const headers: Record<string, string> = {};
+  const token = getToken();
+  if (token) headers.Authorization = `Bearer ${token}`;
+  const res = await fetch(`${path}?${new URLSearchParams(q)}`, { headers });
+  if (!res.ok) throw new Error(await errorMessage(res));
+  return res.json() as Promise<T>;
+}
+
+// errorMessage reads the backend's {code, message, request_id} error body,
+// falling back to the raw text.
+async function errorMessage(res: Response): Promise<string> {
+  const text = await res.text();
+  try {
+    const body = JSON.parse(text) as {
+      code?: string;
+      message?: string;
+      request_id?: string;
+    };
+    if (body.code) return `${body.message} (${body.code}, requête ${body.request_id})`;
+  } catch {
+    // not JSON
+  }
+  return text || `HTTP ${res.status}`;
+}
@@ -2,9 +2,13 @@ import "./index.css";
 import { StrictMode } from "react";
 import { createRoot } from "react-dom/client";
 import ActivityTable from "./App.tsx";
+import Overview from "./Overview.tsx";
 
 createRoot(document.getElementById("root")!).render(
   <StrictMode>
-    <ActivityTable />
+    <main className="mx-auto flex max-w-6xl flex-col gap-6 p-4">
+      <Overview />
+      <ActivityTable />
+    </main>
   </StrictMode>,
 );
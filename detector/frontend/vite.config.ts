@@ -2,6 +2,11 @@ import { defineConfig } from "vite";
 import react from "@vitejs/plugin-react";
 import tsconfigPaths from "vite-tsconfig-paths";
 
+// The build lands in the backend, which embeds it and serves it at /.
 export default defineConfig({
   plugins: [react(), tsconfigPaths()],
+  build: {
+    outDir: "../backend/web/dist",
+    emptyOutDir: true,
+  },
 });
@@ -0,0 +1,71 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// otherCategory is where processes missing from AppCategories go.
+const otherCategory = "other"
+
+// defaultAppCategories maps common executables to the report categories;
+// AppCategories in config.json replaces it as a whole.
+var defaultAppCategories = map[string]string{
+	"code.exe":            "development",
+	"devenv.exe":          "development",
+	"idea64.exe":          "development",
+	"pycharm64.exe":       "development",
+	"windowsterminal.exe": "development",
+	"outlook.exe":         "communication",
+	"olk.exe":             "communication",
+	"teams.exe":           "communication",
+	"ms-teams.exe":        "communication",
+	"slack.exe":           "communication",
+	"zoom.exe":            "communication",
+	"chrome.exe":          "browsing",
+	"msedge.exe":          "browsing",
+	"firefox.exe":         "browsing",
+	"spotify.exe":         "entertainment",
+	"vlc.exe":             "entertainment",
+	"steam.exe":           "entertainment",
+}
+
+// appTracker reads the foreground application for TrackAppCategories and
+// DomainTracking. The process name is cached per process id, so a tick
+// costs one lookup only when the foreground process changes.
+type appTracker struct {
+	pid     uint32
+	process string
+}
+
+// foreground returns the lower-case executable name of the foreground
+// application, or "" without one (desktop, lock screen).
+func (a *appTracker) foreground() string {
+	hwnd := windows.GetForegroundWindow()
+	if hwnd == 0 {
+		return ""
+	}
+	var pid uint32
+	if _, err := windows.GetWindowThreadProcessId(hwnd, &pid); err != nil || pid == 0 {
+		return ""
+	}
+	if pid != a.pid {
+		a.pid, a.process = pid, strings.ToLower(processName(pid))
+	}
+	return a.process
+}
+
+// appCategory maps a foreground process to its category; "" stays "".
+func appCategory(cfg Config, process string) string {
+	if process == "" {
+		return ""
+	}
+	if c, ok := cfg.AppCategories[process]; ok {
+		return c
+	}
+	return otherCategory
+}
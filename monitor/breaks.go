@@ -0,0 +1,28 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "time"
+
+// breakDetector spots the end of idle periods of break length: between
+// BreakMin and BreakMax without input. Shorter ones are pauses in work,
+// longer ones absences.
+type breakDetector struct {
+	lastIdle time.Duration // idle time at the previous measured tick
+}
+
+// observe takes the idle time of a measured tick and returns the length
+// of the break that input just ended, if any. The idle time at the last
+// tick before the input stands for the break, short by less than a tick.
+func (b *breakDetector) observe(cfg Config, idleNow time.Duration) (time.Duration, bool) {
+	prev := b.lastIdle
+	b.lastIdle = idleNow
+	if idleNow >= prev || cfg.BreakMin <= 0 {
+		return 0, false // no input since the last tick
+	}
+	if prev < cfg.BreakMin || prev > cfg.BreakMax {
+		return 0, false
+	}
+	return prev, true
+}
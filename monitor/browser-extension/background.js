@@ -0,0 +1,29 @@
+// Reports the active tab's URL to the agent's DomainListen endpoint; the
+// agent keeps the host name only. Change AGENT if DomainListen differs.
+const AGENT = "http://127.0.0.1:17345/active-tab";
+
+let last = null;
+
+function report(url) {
+  url = url || "";
+  if (url === last) return;
+  last = url;
+  fetch(AGENT, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ url }),
+  }).catch(() => { last = null; }); // agent not running: retry next change
+}
+
+function reportActive() {
+  chrome.tabs.query({ active: true, lastFocusedWindow: true }, (tabs) => {
+    report(tabs.length ? tabs[0].url : "");
+  });
+}
+
+chrome.tabs.onActivated.addListener(reportActive);
+chrome.tabs.onUpdated.addListener((_id, change, tab) => {
+  if (tab.active && change.url) reportActive();
+});
+chrome.windows.onFocusChanged.addListener(reportActive);
+chrome.runtime.onStartup.addListener(reportActive);
@@ -0,0 +1,82 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// chaosConfig injects failures for resilience testing in staging. It is
+// set only through command-line flags that are deliberately left out of
+// any usage output, and is a no-op by default:
+//
+//	idle.exe -chaos-drop-uploads=0.3 -chaos-rqlite-delay=5s -chaos-clock-skew=-10m
+type chaosConfig struct {
+	dropUploads float64       // probability in [0, 1] that an upload fails before reaching rqlite
+	rqliteDelay time.Duration // added before every rqlite request
+	clockSkew   time.Duration // added to the agent's clock
+}
+
+var chaos chaosConfig
+
+// parseChaosFlags reads the hidden -chaos-* flags from args and ignores
+// everything else.
+func parseChaosFlags(args []string) error {
+	fs := flag.NewFlagSet("chaos", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	fs.Float64Var(&chaos.dropUploads, "chaos-drop-uploads", 0, "")
+	fs.DurationVar(&chaos.rqliteDelay, "chaos-rqlite-delay", 0, "")
+	fs.DurationVar(&chaos.clockSkew, "chaos-clock-skew", 0, "")
+
+	// keep only our flags so unrelated arguments don't stop parsing
+	var ours []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if strings.HasPrefix(a, "-chaos-") || strings.HasPrefix(a, "--chaos-") {
+			ours = append(ours, a)
+			if !strings.Contains(a, "=") && i+1 < len(args) {
+				ours = append(ours, args[i+1])
+				i++
+			}
+		}
+	}
+	if err := fs.Parse(ours); err != nil {
+		return err
+	}
+	if chaos.dropUploads < 0 || chaos.dropUploads > 1 {
+		return fmt.Errorf("-chaos-drop-uploads must be within 0-1")
+	}
+	return nil
+}
+
+func (c chaosConfig) enabled() bool {
+	return c.dropUploads > 0 || c.rqliteDelay > 0 || c.clockSkew != 0
+}
+
+func (c chaosConfig) String() string {
+	return fmt.Sprintf("drop_uploads=%.2f rqlite_delay=%s clock_skew=%s", c.dropUploads, c.rqliteDelay, c.clockSkew)
+}
+
+// now is the agent's view of the current time, skewed under chaos.
+func (c chaosConfig) now() time.Time {
+	return time.Now().Add(c.clockSkew)
+}
+
+// beforeRqlite is called ahead of every rqlite request: it may delay it or
+// fail it outright.
+func (c chaosConfig) beforeRqlite() error {
+	if c.rqliteDelay > 0 {
+		time.Sleep(c.rqliteDelay)
+	}
+	if c.dropUploads > 0 && rand.Float64() < c.dropUploads {
+		return fmt.Errorf("chaos: upload dropped")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "time"
+
+// clockJumpTolerance is how far the wall clock may drift from the
+// monotonic clock between two ticks before it counts as a jump.
+const clockJumpTolerance = 2 * time.Second
+
+// tickClock measures ticks on the monotonic clock, like GetTickCount64
+// behind getIdleDuration, so an NTP correction or a manual clock change
+// neither stretches nor shrinks what a tick adds to the hour. The wall
+// clock only decides which hour bucket a tick lands in.
+type tickClock struct {
+	last time.Time // previous tick, with its monotonic reading
+}
+
+// tick returns how long the tick that ended at now lasted, for counting
+// it towards the hour, and how far the wall clock jumped during it
+// (positive forward). A tick far from interval (first tick, suspend,
+// resume) counts as interval.
+func (c *tickClock) tick(now time.Time, interval time.Duration) (step, jump time.Duration) {
+	prev := c.last
+	c.last = now
+	if prev.IsZero() {
+		return interval, 0
+	}
+	step = now.Sub(prev)                   // monotonic
+	jump = now.Round(0).Sub(prev.Round(0)) // wall
+	jump -= step
+	if jump > -clockJumpTolerance && jump < clockJumpTolerance {
+		jump = 0
+	}
+	if step < interval/2 || step > 2*interval {
+		step = interval
+	}
+	return step, jump
+}
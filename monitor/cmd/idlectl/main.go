@@ -0,0 +1,245 @@
+//go:build windows
+// +build windows
+
+// Command idlectl drives the agent through its control pipe and the
+// backend through its HTTP API:
+//
+//	idlectl status                   agent state on this machine
+//	idlectl pause 1h                 also: resume, flush, reload-config, rotate-log, send-logs
+//	idlectl presence                 mode and idle time from the presence pipe
+//	idlectl today [-host PC-01]      today's hourly rows from the backend
+//	idlectl push-config settings.json
+//
+// push-config takes a JSON object of backend settings, e.g.
+// {"agent_intervals": {"heartbeat": "10m"}}, and PUTs each one to
+// /admin/settings/:key with ADMIN_TOKEN. Replies starting with "error:"
+// and HTTP errors exit with status 1, so scripts can check $LASTEXITCODE.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"idle/presence"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeCommands are forwarded to the agent as typed.
+var pipeCommands = map[string]bool{
+	"status": true, "pause": true, "resume": true,
+	"flush": true, "reload-config": true, "rotate-log": true, "send-logs": true,
+}
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+func main() {
+	var (
+		pipe     = flag.String("pipe", "ActivityMonitor", "agent control pipe (the agent's ControlPipe)")
+		presPipe = flag.String("presence-pipe", presence.DefaultPipe, "agent presence pipe (the agent's PresencePipe)")
+		backend  = flag.String("backend", os.Getenv("IDLE_BACKEND_URL"), "backend base URL, e.g. http://192.168.1.15:8080")
+		token    = flag.String("token", os.Getenv("ADMIN_TOKEN"), "backend ADMIN_TOKEN, for push-config")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: idlectl [flags] status|pause [duration]|resume|flush|reload-config|rotate-log|send-logs|presence|today [-host name]|push-config file.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	var err error
+	switch {
+	case pipeCommands[cmd]:
+		var reply string
+		reply, err = callAgent(*pipe, strings.Join(append([]string{cmd}, args...), " "))
+		if err == nil {
+			fmt.Println(reply)
+			if strings.HasPrefix(reply, "error:") {
+				os.Exit(1)
+			}
+		}
+	case cmd == "presence":
+		var s presence.Status
+		if s, err = presence.Query(*presPipe, 5*time.Second); err == nil {
+			fmt.Printf("host=%s user=%s mode=%s idle=%s last_input=%s sampled_at=%s\n", s.Host, s.User, orNone(s.Mode),
+				s.Idle().Truncate(time.Second), s.LastInput.Format(time.RFC3339), s.SampledAt.Format(time.RFC3339))
+		}
+	case cmd == "today":
+		err = today(*backend, args)
+	case cmd == "push-config":
+		if len(args) != 1 {
+			err = errors.New("push-config wants one settings file")
+			break
+		}
+		err = pushConfig(*backend, *token, args[0])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "idlectl:", err)
+		os.Exit(1)
+	}
+}
+
+// callAgent sends one command line on the control pipe and returns the
+// agent's reply line. A busy pipe is retried for a few seconds.
+func callAgent(pipe, line string) (string, error) {
+	path, err := windows.UTF16PtrFromString(`\\.\pipe\` + pipe)
+	if err != nil {
+		return "", err
+	}
+	var h windows.Handle
+	for attempt := 0; ; attempt++ {
+		h, err = windows.CreateFile(path, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, windows.ERROR_PIPE_BUSY) && attempt < 20 {
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			return "", fmt.Errorf("agent not running or ControlPipe disabled (no pipe %s)", pipe)
+		}
+		return "", err
+	}
+	f := os.NewFile(uintptr(h), pipe)
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("no reply from agent: %w", err)
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+type activityRow struct {
+	HourStart   string  `json:"hour_start"`
+	Host        string  `json:"host"`
+	UserName    string  `json:"user_name"`
+	ActivityPct float64 `json:"activity_pct"`
+	IdleSeconds float64 `json:"idle_seconds"`
+	Status      string  `json:"status"`
+}
+
+// today prints GET /activity/today for one host, this machine by default.
+func today(backend string, args []string) error {
+	if backend == "" {
+		return errors.New("set -backend or IDLE_BACKEND_URL")
+	}
+	hn, _ := os.Hostname()
+	fs := flag.NewFlagSet("today", flag.ExitOnError)
+	host := fs.String("host", hn, "host to show, empty for all")
+	_ = fs.Parse(args)
+
+	q := url.Values{}
+	if *host != "" {
+		q.Set("host", *host)
+	}
+	var out struct {
+		Start string        `json:"start"`
+		End   string        `json:"end"`
+		Rows  []activityRow `json:"rows"`
+	}
+	if err := doJSON(http.MethodGet, strings.TrimRight(backend, "/")+"/activity/today?"+q.Encode(), "", nil, &out); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s -> %s\n", out.Start, out.End)
+	for _, r := range out.Rows {
+		fmt.Printf("%s  %-16s %-12s %5.1f%%  idle=%-6.0f %s\n", r.HourStart, r.Host, r.UserName, r.ActivityPct, r.IdleSeconds, r.Status)
+	}
+	if len(out.Rows) == 0 {
+		fmt.Println("no rows yet")
+	}
+	return nil
+}
+
+// pushConfig PUTs every key of the JSON object in path as a backend
+// setting. Keys are sent in order and the first rejection stops the run.
+func pushConfig(backend, token, path string) error {
+	if backend == "" {
+		return errors.New("set -backend or IDLE_BACKEND_URL")
+	}
+	if token == "" {
+		return errors.New("set -token or ADMIN_TOKEN")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var stored json.RawMessage
+		u := strings.TrimRight(backend, "/") + "/admin/settings/" + url.PathEscape(k)
+		if err := doJSON(http.MethodPut, u, token, settings[k], &stored); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		fmt.Printf("%s = %s\n", k, stored)
+	}
+	return nil
+}
+
+// doJSON sends body (if any) and decodes a 2xx JSON reply into out;
+// other statuses come back as errors carrying the backend's message.
+func doJSON(method, u, token string, body []byte, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,116 @@
+//go:build linux
+// +build linux
+
+// Command ttyagent measures admin activity on headless Linux servers (jump
+// hosts, bastions) that have no desktop for the Windows agent to watch.
+// Activity comes from terminal input on remote login sessions: every
+// sample it lists the live USER_PROCESS entries of utmp that have a remote
+// host, and takes each terminal's access time (/dev/pts/N), which the
+// kernel moves on input, as that session's last input. Hours are
+// aggregated per user into the agents' hourly schema and posted to the
+// backend's POST /ingest/hourly, labelled source=tty:
+//
+//	ttyagent -backend http://192.168.1.15:8080 -token "$INGEST_TOKEN"
+//
+// Linux updates terminal times at most every few seconds, so -every below
+// 10s gains nothing. A user with no remote session during an hour gets no
+// row for it.
+//
+// -source logind asks systemd-logind instead, over the system bus, for
+// every user session, local or remote, terminal or desktop: its idle hint
+// and idle-since time decide activity, and a locked session counts idle
+// until it is unlocked. A user holding an idle inhibitor (a video
+// player, a call) during a sample gets media_inhibit on the hour. -dry-run prints the rows instead of posting them. The
+// sampling and aggregation are in package idle/tty.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"idle/tty"
+)
+
+const maxPendingRows = 24 * 50 // a day of hours for 50 users
+
+func main() {
+	hn, _ := os.Hostname()
+	var (
+		backend = flag.String("backend", os.Getenv("IDLE_BACKEND_URL"), "backend base URL, e.g. http://192.168.1.15:8080")
+		token   = flag.String("token", os.Getenv("INGEST_TOKEN"), "backend INGEST_TOKEN or agent API token")
+		host    = flag.String("host", hn, "host name to report")
+		team    = flag.String("team", "", "team to report")
+		source  = flag.String("source", "utmp", "session source: utmp (remote terminals) or logind (all sessions)")
+		utmp    = flag.String("utmp", "/var/run/utmp", "utmp file, with -source utmp")
+		every   = flag.Duration("every", 10*time.Second, "sampling interval")
+		active  = flag.Duration("active", 30*time.Second, "a session idle for less than this is active")
+		dryRun  = flag.Bool("dry-run", false, "print hourly rows instead of posting them")
+	)
+	flag.Parse()
+	if *backend == "" && !*dryRun {
+		log.Fatal("ttyagent: set -backend or IDLE_BACKEND_URL, or use -dry-run")
+	}
+	var input tty.InputProvider
+	switch *source {
+	case "utmp":
+		input = tty.Utmp{Path: *utmp}
+	case "logind":
+		input = &tty.Logind{}
+	default:
+		log.Fatalf("ttyagent: unknown -source %q, want utmp or logind", *source)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+
+	p := &tty.Pipeline{Host: *host, Team: *team, Every: *every, Active: *active, Input: input}
+	p.Rollover(time.Now())
+	var pending []tty.Row
+	flush := func(rows []tty.Row) {
+		pending = append(pending, rows...)
+		if len(pending) == 0 {
+			return
+		}
+		if *dryRun {
+			for _, r := range pending {
+				b, _ := json.Marshal(r)
+				fmt.Println(string(b))
+			}
+			pending = nil
+			return
+		}
+		if err := tty.Post(client, *backend, *token, pending); err != nil {
+			log.Printf("ttyagent: upload of %d rows failed, kept for the next hour: %v", len(pending), err)
+			if len(pending) > maxPendingRows {
+				pending = pending[len(pending)-maxPendingRows:]
+			}
+			return
+		}
+		pending = nil
+	}
+
+	for {
+		select {
+		case <-stop:
+			flush(p.Flush())
+			return
+		case now := <-ticker.C:
+			if rows, ok := p.Rollover(now); ok {
+				flush(rows)
+			}
+			if err := p.Sample(now); err != nil {
+				log.Printf("ttyagent: %v", err)
+			}
+		}
+	}
+}
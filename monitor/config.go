@@ -0,0 +1,97 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+const defaultConfigPath = `C:\ProgramData\ActivityMonitor\config.json`
+
+// configPath returns the JSON config file location; ACTIVITY_MONITOR_CONFIG
+// overrides the default under ProgramData.
+func configPath() string {
+	if p := os.Getenv("ACTIVITY_MONITOR_CONFIG"); p != "" {
+		return p
+	}
+	return defaultConfigPath
+}
+
+// loadConfigFile overlays the JSON object at path onto cfg. Keys are Config
+// field names; durations are written as Go duration strings ("30s", "2m").
+// A missing file is not an error: the built-in defaults apply.
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := setConfigFields(cfg, raw); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := applySecrets(path, cfg); err != nil {
+		return err
+	}
+	if err := validateProfiles(cfg.Profiles); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if !uploadCompressions[cfg.UploadCompression] {
+		return fmt.Errorf("%s: UploadCompression must be gzip, zstd or none", path)
+	}
+	if cfg.FocusMinRatio < 0 || cfg.FocusMinRatio > 1 {
+		return fmt.Errorf("%s: FocusMinRatio must be between 0 and 1", path)
+	}
+	if _, err := hex.DecodeString(cfg.SigningKey); err != nil {
+		return fmt.Errorf("%s: SigningKey must be hex, as returned by the backend", path)
+	}
+	if cfg.FlushOffsetMax < 0 || cfg.FlushOffsetMax > maxFlushOffset {
+		return fmt.Errorf("%s: FlushOffsetMax must be between 0s and %s", path, maxFlushOffset)
+	}
+	return nil
+}
+
+// setConfigFields sets the Config fields named by the keys of raw, as in
+// config.json.
+func setConfigFields(cfg *Config, raw map[string]json.RawMessage) error {
+	v := reflect.ValueOf(cfg).Elem()
+	durationType := reflect.TypeOf(time.Duration(0))
+	for key, msg := range raw {
+		f := v.FieldByName(key)
+		if !f.IsValid() || !f.CanSet() {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if f.Type() == durationType {
+			var s string
+			if err := json.Unmarshal(msg, &s); err != nil {
+				return fmt.Errorf("%s: want a duration string: %w", key, err)
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			f.SetInt(int64(d))
+			continue
+		}
+		// a fresh value, so maps and slices shared with the config this
+		// one was copied from are never written through
+		f.Set(reflect.Zero(f.Type()))
+		if err := json.Unmarshal(msg, f.Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// configPoller re-reads config.json every ConfigPollEvery (or whatever the
+// backend dictates in heartbeat responses) and hands changed configs to the
+// sampling loop, so edits pushed by GPO or a deploy tool apply without a
+// restart.
+type configPoller struct {
+	path    string
+	every   atomic.Int64 // time.Duration
+	updates chan Config
+	force   chan chan error // reload requests from the control pipe
+}
+
+func newConfigPoller(path string, every time.Duration) *configPoller {
+	p := &configPoller{path: path, updates: make(chan Config, 1), force: make(chan chan error)}
+	p.every.Store(int64(every))
+	return p
+}
+
+// setEvery changes the poll period from the next tick on and reports
+// whether it differs from the current one.
+func (p *configPoller) setEvery(d time.Duration) bool {
+	return p.every.Swap(int64(d)) != int64(d)
+}
+
+// loop polls until ctx is done. Unreadable or invalid files are logged and
+// skipped; the running config stays in place.
+func (p *configPoller) loop(ctx context.Context, writeLine func(string)) {
+	lastMod := p.modTime()
+	every := time.Duration(p.every.Load())
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		var forced chan error
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case forced = <-p.force:
+		}
+		if d := time.Duration(p.every.Load()); d != every {
+			every = d
+			t.Reset(every)
+		}
+
+		mod := p.modTime()
+		if mod.Equal(lastMod) && forced == nil {
+			continue
+		}
+		lastMod = mod
+		cfg := defaultConfig()
+		err := loadConfigFile(p.path, &cfg)
+		if forced != nil {
+			forced <- err
+		}
+		if err != nil {
+			writeLine(fmt.Sprintf("[%s] CONFIG reload error: %v", time.Now().Format(time.RFC3339), err))
+			continue
+		}
+		// keep only the latest config if the sampling loop is behind
+		select {
+		case <-p.updates:
+		default:
+		}
+		p.updates <- cfg
+	}
+}
+
+// reload re-reads config.json now, changed or not, and returns the parse
+// error if any; a valid config reaches the sampling loop through updates.
+func (p *configPoller) reload(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case p.force <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// modTime is zero when the file is missing, so deleting it reverts to the
+// built-in defaults like a restart would.
+func (p *configPoller) modTime() time.Time {
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// restartOnlyFields cannot change while run is going: the log file, the
+// heartbeat goroutine and the startup delays are set up once, and a pilot
+// in dry-run mode must not start uploading on a config edit.
+var restartOnlyFields = []string{
+	"LogDir", "LogBaseName",
+	"BackendBaseURL", "IngestToken", "EnrollmentSecret", "HeartbeatEvery", "ConfigPollEvery",
+	"StartupDelayMax", "InitialUploadJitter", "FlushOffsetMax",
+	"ControlPipe", "PresencePipe", "EventLog", "PseudonymKey", "RemoteCommands",
+	"LogShipping", "LogShipEvery", "DryRun", "DomainTracking", "DomainListen",
+	"RawSamples", "RawSampleEvery",
+}
+
+// applyConfig returns next with the restart-only fields of cur kept, plus
+// the names of those that were left unapplied.
+func applyConfig(cur, next Config) (Config, []string) {
+	var skipped []string
+	c, n := reflect.ValueOf(&cur).Elem(), reflect.ValueOf(&next).Elem()
+	for _, name := range restartOnlyFields {
+		if !reflect.DeepEqual(c.FieldByName(name).Interface(), n.FieldByName(name).Interface()) {
+			n.FieldByName(name).Set(c.FieldByName(name))
+			skipped = append(skipped, name)
+		}
+	}
+	return next, skipped
+}
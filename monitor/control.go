@@ -0,0 +1,171 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// maxPause bounds "pause <duration>" so a forgotten pause cannot silence
+// an agent for good; a restart also resumes it.
+const maxPause = 24 * time.Hour
+
+// controlRequest is one command read from the control pipe, answered by
+// the sampling loop on reply with a single line starting with "ok" or
+// "error:".
+type controlRequest struct {
+	cmd   string
+	arg   string
+	reply chan string
+}
+
+// controlCommands is the usage string sent back for unknown commands.
+const controlCommands = "status, pause [duration], resume, flush, reload-config, rotate-log, send-logs"
+
+// pipePath turns ControlPipe into a full pipe path.
+func pipePath(name string) string {
+	return `\\.\pipe\` + name
+}
+
+// pipeSecurity allows SYSTEM, local Administrators and the account the
+// agent runs as, plus the access control entries in extra; anyone else
+// gets access denied on connect.
+func pipeSecurity(extra string) (*windows.SecurityAttributes, error) {
+	owner := "SY"
+	if tu, err := windows.GetCurrentProcessToken().GetTokenUser(); err == nil {
+		owner = tu.User.Sid.String()
+	}
+	sd, err := windows.SecurityDescriptorFromString(
+		fmt.Sprintf("D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GA;;;%s)%s", owner, extra))
+	if err != nil {
+		return nil, err
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	return sa, nil
+}
+
+// serveControl accepts clients on the ControlPipe named pipe until ctx is
+// done. Each client sends one command line and gets one reply line, so
+// helpdesk scripts can drive the agent without killing the process:
+//
+//	echo pause 30m > \\.\pipe\ActivityMonitor
+//
+// Remote clients are rejected; the pipe is local only.
+func serveControl(ctx context.Context, name string, requests chan<- controlRequest, writeLine func(string)) {
+	sa, err := pipeSecurity("")
+	if err != nil {
+		writeLine(fmt.Sprintf("[%s] CONTROL security error: %v", time.Now().Format(time.RFC3339), err))
+		return
+	}
+	servePipe(ctx, "CONTROL", name, windows.PIPE_ACCESS_DUPLEX, sa, writeLine, func(h windows.Handle) {
+		handleControlClient(ctx, h, requests, writeLine)
+	})
+}
+
+// servePipe creates instances of the local named pipe name until ctx is
+// done, handing each connected client to serve on its own goroutine;
+// serve does not close the handle. Errors are logged under tag.
+func servePipe(ctx context.Context, tag, name string, openMode uint32, sa *windows.SecurityAttributes, writeLine func(string), serve func(windows.Handle)) {
+	path, err := windows.UTF16PtrFromString(pipePath(name))
+	if err != nil {
+		writeLine(fmt.Sprintf("[%s] %s error: %v", time.Now().Format(time.RFC3339), tag, err))
+		return
+	}
+
+	// ConnectNamedPipe has no deadline; on shutdown, dial the pipe once to
+	// wake it up.
+	go func() {
+		<-ctx.Done()
+		if h, err := windows.CreateFile(path, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, 0, 0); err == nil {
+			windows.CloseHandle(h)
+		}
+	}()
+
+	for {
+		h, err := windows.CreateNamedPipe(path,
+			openMode,
+			windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+			windows.PIPE_UNLIMITED_INSTANCES, 4096, 4096, 0, sa)
+		if err != nil {
+			writeLine(fmt.Sprintf("[%s] %s CreateNamedPipe error: %v", time.Now().Format(time.RFC3339), tag, err))
+			return
+		}
+		if err := windows.ConnectNamedPipe(h, nil); err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+			windows.CloseHandle(h)
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			windows.CloseHandle(h)
+			return
+		}
+		go serve(h)
+	}
+}
+
+// handleControlClient serves one connected pipe instance.
+func handleControlClient(ctx context.Context, h windows.Handle, requests chan<- controlRequest, writeLine func(string)) {
+	f := os.NewFile(uintptr(h), "control")
+	defer func() {
+		windows.FlushFileBuffers(h)
+		windows.DisconnectNamedPipe(h)
+		f.Close()
+	}()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		fmt.Fprintf(f, "error: empty command (want %s)\n", controlCommands)
+		return
+	}
+	req := controlRequest{
+		cmd:   strings.ToLower(fields[0]),
+		arg:   strings.Join(fields[1:], " "),
+		reply: make(chan string, 1),
+	}
+	writeLine(fmt.Sprintf("[%s] CONTROL %s", time.Now().Format(time.RFC3339), strings.Join(fields, " ")))
+
+	select {
+	case requests <- req:
+	case <-ctx.Done():
+		fmt.Fprintln(f, "error: agent is stopping")
+		return
+	}
+	select {
+	case reply := <-req.reply:
+		fmt.Fprintln(f, reply)
+	case <-ctx.Done():
+		fmt.Fprintln(f, "error: agent is stopping")
+	}
+}
+
+// parsePause reads the optional "pause" argument; no argument means 30m.
+func parsePause(arg string) (time.Duration, error) {
+	if arg == "" {
+		return 30 * time.Minute, nil
+	}
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 || d > maxPause {
+		return 0, fmt.Errorf("pause must be within (0, %s]", maxPause)
+	}
+	return d, nil
+}
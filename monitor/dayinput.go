@@ -0,0 +1,67 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// inputSpan is the first and last keyboard/mouse input seen over a period.
+type inputSpan struct {
+	first, last time.Time
+}
+
+func (s *inputSpan) add(t time.Time) {
+	if s.first.IsZero() || t.Before(s.first) {
+		s.first = t
+	}
+	if t.After(s.last) {
+		s.last = t
+	}
+}
+
+// inputTime formats an input time for activity_hourly: RFC3339 UTC, ""
+// when no input was seen.
+func inputTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// dayInputs tracks the first input after midnight and the last input of
+// each local day, for the DAY_SUMMARY line attendance is read from.
+type dayInputs struct {
+	day  string // local day being tracked
+	span inputSpan
+}
+
+// observe records the last input as of now (both in the agent's zone).
+// summary is the previous day's DAY_SUMMARY body on the first call of a
+// new day.
+func (d *dayInputs) observe(now, input time.Time) (summary string) {
+	if day := now.Format("2006-01-02"); day != d.day {
+		summary = d.summary()
+		d.day, d.span = day, inputSpan{}
+	}
+	// the last input may predate midnight, or the agent's start
+	if input.Format("2006-01-02") == d.day {
+		d.span.add(input.Truncate(time.Second))
+	}
+	return summary
+}
+
+// summary returns the tracked day's DAY_SUMMARY body, or "" before the
+// first observation.
+func (d *dayInputs) summary() string {
+	if d.day == "" {
+		return ""
+	}
+	if d.span.first.IsZero() {
+		return fmt.Sprintf("DAY_SUMMARY day=%s first_input=none last_input=none", d.day)
+	}
+	return fmt.Sprintf("DAY_SUMMARY day=%s first_input=%s last_input=%s span=%s", d.day,
+		d.span.first.Format(time.RFC3339), d.span.last.Format(time.RFC3339), d.span.last.Sub(d.span.first))
+}
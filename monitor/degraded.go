@@ -0,0 +1,60 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// degradedAfter is how many GetLastInputInfo failures in a row switch
+// the agent to degraded mode.
+const degradedAfter = 3
+
+// idleFallback stands in for GetLastInputInfo when it keeps failing (a
+// locked-down session, a broken input stack): idle time is then the time
+// since the cursor last moved, so keyboard-only activity reads as idle
+// and those hours are a lower bound. Hours measured this way carry
+// degraded_seconds.
+type idleFallback struct {
+	failures int
+	active   bool // degraded mode is on
+
+	cursor  POINT
+	movedAt time.Time
+}
+
+// idle turns one GetLastInputInfo result into the idle time to use.
+// ok is false when there is none for this tick; degraded reports that the
+// value came from the cursor. Entering and leaving degraded mode is
+// logged.
+func (f *idleFallback) idle(cfg Config, now time.Time, idleNow time.Duration, idleErr error, writeLine func(string)) (d time.Duration, ok, degraded bool) {
+	ts := now.Format(time.RFC3339)
+	if idleErr == nil {
+		if f.active {
+			writeLine(fmt.Sprintf("[%s] DEGRADED off: GetLastInputInfo works again after %d failures", ts, f.failures))
+		}
+		f.failures, f.active = 0, false
+		return idleNow, true, false
+	}
+
+	f.failures++
+	if f.failures < degradedAfter {
+		return 0, false, false
+	}
+	p, err := getMousePos()
+	if err != nil {
+		return 0, false, false
+	}
+	if !f.active {
+		writeLine(fmt.Sprintf("[%s] DEGRADED on: GetLastInputInfo failed %d times in a row (%v), measuring cursor movement only", ts, f.failures, idleErr))
+		f.active = true
+		// idle until the cursor moves
+		f.cursor, f.movedAt = p, now.Add(-cfg.ActiveIfIdleLessThan)
+	}
+	if p != f.cursor {
+		f.cursor, f.movedAt = p, now
+	}
+	return now.Sub(f.movedAt), true, true
+}
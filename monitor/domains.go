@@ -0,0 +1,127 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDomainsPerHour caps the distinct domains of one hourly row; later
+// ones count as otherCategory.
+const maxDomainsPerHour = 50
+
+// browserProcesses are the executables whose foreground time is credited
+// to the domain reported by the browser extension.
+var browserProcesses = map[string]bool{
+	"chrome.exe":  true,
+	"msedge.exe":  true,
+	"firefox.exe": true,
+	"brave.exe":   true,
+	"opera.exe":   true,
+	"vivaldi.exe": true,
+}
+
+// domainTracker holds the active tab's domain as reported by the
+// companion browser extension, which posts {"url": "..."} to
+// http://<DomainListen>/active-tab whenever the active tab or its URL
+// changes. Only the host name is kept, never the path or query.
+type domainTracker struct {
+	mu     sync.Mutex
+	domain string
+}
+
+// serve accepts tab reports until ctx is done. The listener must be a
+// loopback address: nothing outside the machine may feed it.
+func (d *domainTracker) serve(ctx context.Context, addr string, writeLine func(string)) {
+	ts := time.Now().Format(time.RFC3339)
+	host, _, err := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); err != nil || (host != "localhost" && (ip == nil || !ip.IsLoopback())) {
+		writeLine(fmt.Sprintf("[%s] DOMAINS error: DomainListen %q must be a loopback host:port", ts, addr))
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/active-tab", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		d.set(tabDomain(body.URL))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	writeLine(fmt.Sprintf("[%s] DOMAINS listening on %s", ts, addr))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		writeLine(fmt.Sprintf("[%s] DOMAINS error: %v", time.Now().Format(time.RFC3339), err))
+	}
+}
+
+func (d *domainTracker) set(domain string) {
+	d.mu.Lock()
+	d.domain = domain
+	d.mu.Unlock()
+}
+
+// current returns the domain to credit while process is in the
+// foreground: the last reported tab of a browser, filtered by
+// DomainAllow and DomainDeny, or "" when process is not a browser or no
+// web page is active.
+func (d *domainTracker) current(cfg Config, process string) string {
+	if !browserProcesses[process] {
+		return ""
+	}
+	d.mu.Lock()
+	domain := d.domain
+	d.mu.Unlock()
+	if domain == "" {
+		return ""
+	}
+	if len(cfg.DomainAllow) > 0 && !matchDomain(domain, cfg.DomainAllow) {
+		return otherCategory
+	}
+	if matchDomain(domain, cfg.DomainDeny) {
+		return otherCategory
+	}
+	return domain
+}
+
+// tabDomain returns the host name of an http(s) URL without "www.", ""
+// for anything else (new tab, settings pages, files).
+func tabDomain(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// matchDomain reports whether domain is one of list or a subdomain of one.
+func matchDomain(domain string, list []string) bool {
+	for _, l := range list {
+		l = strings.ToLower(strings.TrimPrefix(l, "www."))
+		if domain == l || strings.HasSuffix(domain, "."+l) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// protectData encrypts plain with DPAPI in machine scope: the agent runs
+// both as a service (LocalSystem) and in the user's session, and both must
+// read it back, while a copy of the file is useless on another machine.
+func protectData(plain []byte) ([]byte, error) {
+	return dpapi(plain, true)
+}
+
+// unprotectData decrypts a protectData blob.
+func unprotectData(blob []byte) ([]byte, error) {
+	return dpapi(blob, false)
+}
+
+func dpapi(in []byte, protect bool) ([]byte, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	inBlob := windows.DataBlob{Size: uint32(len(in)), Data: &in[0]}
+	var out windows.DataBlob
+	flags := uint32(windows.CRYPTPROTECT_UI_FORBIDDEN)
+	var err error
+	if protect {
+		err = windows.CryptProtectData(&inBlob, nil, nil, 0, nil, flags|windows.CRYPTPROTECT_LOCAL_MACHINE, &out)
+	} else {
+		err = windows.CryptUnprotectData(&inBlob, nil, nil, 0, nil, flags, &out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
@@ -0,0 +1,132 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// enrollRetry is how long a failed enrollment waits before trying again.
+const enrollRetry = time.Minute
+
+// enrollment is what the backend's POST /enroll hands this agent. It is
+// kept DPAPI-protected next to config.json and, once present, replaces
+// IngestToken and SigningKey, and hourly rows go through the backend's
+// POST /ingest/hourly instead of straight to rqlite.
+type enrollment struct {
+	AgentID    string `json:"agent_id"`
+	Token      string `json:"token"`
+	SigningKey string `json:"signing_key,omitempty"`
+}
+
+var enrolled atomic.Pointer[enrollment]
+
+func enrollmentPath() string {
+	return filepath.Join(filepath.Dir(configPath()), "enrollment.dat")
+}
+
+func loadEnrollment() (*enrollment, error) {
+	blob, err := os.ReadFile(enrollmentPath())
+	if err != nil {
+		return nil, err
+	}
+	plain, err := unprotectData(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", enrollmentPath(), err)
+	}
+	var e enrollment
+	if err := json.Unmarshal(plain, &e); err != nil || e.Token == "" {
+		return nil, fmt.Errorf("%s: not an enrollment", enrollmentPath())
+	}
+	return &e, nil
+}
+
+func saveEnrollment(e *enrollment) error {
+	plain, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	blob, err := protectData(plain)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(enrollmentPath(), blob, 0o600)
+}
+
+// ingestToken is the bearer token of backend requests: the enrolled one,
+// else the shared IngestToken.
+func ingestToken(cfg Config) string {
+	if e := enrolled.Load(); e != nil {
+		return e.Token
+	}
+	return cfg.IngestToken
+}
+
+// startEnrollment loads a previous enrollment, or, with an
+// EnrollmentSecret, enrolls in the background until the backend accepts.
+// Uploads use the shared credentials until then.
+func startEnrollment(ctx context.Context, cfg Config, client *http.Client, writeLine func(string)) {
+	e, err := loadEnrollment()
+	if err == nil {
+		enrolled.Store(e)
+		writeLine(fmt.Sprintf("[%s] ENROLLED agent_id=%s", time.Now().Format(time.RFC3339), e.AgentID))
+		return
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		writeLine(fmt.Sprintf("[%s] ENROLL error: %v", time.Now().Format(time.RFC3339), err))
+	}
+	if cfg.EnrollmentSecret == "" {
+		return
+	}
+	go func() {
+		for {
+			ts := time.Now().Format(time.RFC3339)
+			e, err := enroll(ctx, client, cfg)
+			if err == nil {
+				if err := saveEnrollment(e); err != nil {
+					// still usable until the agent restarts
+					writeLine(fmt.Sprintf("[%s] ENROLL cannot save %s: %v", ts, enrollmentPath(), err))
+				}
+				enrolled.Store(e)
+				writeLine(fmt.Sprintf("[%s] ENROLLED agent_id=%s", ts, e.AgentID))
+				return
+			}
+			writeLine(fmt.Sprintf("[%s] ENROLL error: %v (retrying in %s)", ts, err, enrollRetry))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(enrollRetry):
+			}
+		}
+	}()
+}
+
+// enroll trades the enrollment secret for this agent's own token.
+func enroll(ctx context.Context, client *http.Client, cfg Config) (*enrollment, error) {
+	body, err := json.Marshal(map[string]string{"host": cfg.HostName, "enrollment_secret": cfg.EnrollmentSecret})
+	if err != nil {
+		return nil, err
+	}
+	req, err := backendRequest(ctx, cfg, http.MethodPost, "/enroll", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Del("Authorization")
+	var e enrollment
+	if err := backendDo(client, req, &e); err != nil {
+		return nil, err
+	}
+	if e.Token == "" {
+		return nil, errors.New("backend sent no token")
+	}
+	return &e, nil
+}
@@ -0,0 +1,97 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs under the ActivityMonitor source. EventCreate.exe, used as
+// the message file, only formats IDs 1-1000.
+const (
+	eventStart   = 1
+	eventStop    = 2
+	eventError   = 100
+	eventWarning = 200
+)
+
+// eventRepeat is how often the same kind of error is repeated in the
+// Event Log; the file log keeps every occurrence.
+const eventRepeat = 10 * time.Minute
+
+// eventSink mirrors the log lines an operator should not miss (start,
+// stop, errors, upgrade warnings) to the Windows Event Log, where SIEM
+// collectors already look. A nil sink drops everything.
+type eventSink struct {
+	log *eventlog.Log
+
+	mu   sync.Mutex
+	last map[string]time.Time // per error kind, for eventRepeat
+}
+
+// openEventSink registers the source on first use and opens it. Only
+// administrators (or the service account) may register a source, so a
+// failed registration is ignored: Open still works, Event Viewer just
+// shows a "description not found" prefix until the source exists.
+func openEventSink() *eventSink {
+	_ = eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info) // already registered, or not allowed to
+	l, err := eventlog.Open(serviceName)
+	if err != nil {
+		return nil
+	}
+	return &eventSink{log: l, last: make(map[string]time.Time)}
+}
+
+func (s *eventSink) Close() {
+	if s != nil {
+		s.log.Close()
+	}
+}
+
+// mirror classifies one "[ts] WHAT ..." log line and reports it if it
+// matters. Error kinds are the text before the first colon.
+func (s *eventSink) mirror(line string) {
+	if s == nil {
+		return
+	}
+	msg := line
+	if i := strings.Index(line, "] "); strings.HasPrefix(line, "[") && i > 0 {
+		msg = line[i+2:]
+	}
+
+	switch {
+	case strings.HasPrefix(msg, "START "):
+		_ = s.log.Info(eventStart, msg)
+	case msg == "STOP":
+		_ = s.log.Info(eventStop, msg)
+	case strings.HasPrefix(msg, "UPGRADE REQUIRED"):
+		if s.due("UPGRADE REQUIRED") {
+			_ = s.log.Warning(eventWarning, msg)
+		}
+	case strings.Contains(strings.ToLower(msg), "error"):
+		kind := msg
+		if i := strings.Index(msg, ":"); i > 0 {
+			kind = msg[:i]
+		}
+		if s.due(kind) {
+			_ = s.log.Error(eventError, msg)
+		}
+	}
+}
+
+// due reports whether kind was not reported in the last eventRepeat.
+func (s *eventSink) due(kind string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if t, ok := s.last[kind]; ok && now.Sub(t) < eventRepeat {
+		return false
+	}
+	s.last[kind] = now
+	return true
+}
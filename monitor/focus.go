@@ -0,0 +1,151 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPendingFocus bounds the sessions waiting for rqlite; the oldest are
+// dropped first.
+const maxPendingFocus = 200
+
+// focusSession is one sustained stretch of work in a single application.
+type focusSession struct {
+	start, end  time.Time
+	app         string // lower-case executable name
+	user        string // the session user it was worked under
+	activityPct float64
+}
+
+// focusTracker finds focus sessions: at least FocusMinDuration in one
+// foreground application with an active share of FocusMinRatio. A
+// candidate ends when another application comes to the foreground,
+// another session user takes the console, or the user is idle for a break (BreakMin, 5 minutes when off); trailing idle
+// time is not part of the session.
+type focusTracker struct {
+	app        string // "" without a candidate
+	user       string
+	start      time.Time
+	lastActive time.Time
+	activeSecs float64 // up to lastActive
+	totalSecs  float64 // up to lastActive
+	idleSecs   float64 // since lastActive
+	pending    []focusSession
+}
+
+// observe takes one measured tick of length step for the session user;
+// app is the foreground executable on active ticks. It returns the
+// session the tick closed, if it qualified.
+func (f *focusTracker) observe(cfg Config, now time.Time, step time.Duration, active bool, app, user string) *focusSession {
+	if f.app == "" {
+		if active && app != "" {
+			f.begin(now, step, app, user)
+		}
+		return nil
+	}
+	if user != f.user {
+		done := f.close(cfg)
+		if active && app != "" {
+			f.begin(now, step, app, user)
+		}
+		return done
+	}
+	if !active {
+		f.idleSecs += step.Seconds()
+		gap := cfg.BreakMin
+		if gap <= 0 {
+			gap = 5 * time.Minute
+		}
+		if f.idleSecs >= gap.Seconds() {
+			return f.close(cfg)
+		}
+		return nil
+	}
+	if app != "" && app != f.app {
+		done := f.close(cfg)
+		f.begin(now, step, app, user)
+		return done
+	}
+	f.totalSecs += f.idleSecs + step.Seconds()
+	f.activeSecs += step.Seconds()
+	f.idleSecs = 0
+	f.lastActive = now
+	return nil
+}
+
+func (f *focusTracker) begin(now time.Time, step time.Duration, app, user string) {
+	f.app, f.user, f.start, f.lastActive = app, user, now.Add(-step), now
+	f.activeSecs, f.totalSecs, f.idleSecs = step.Seconds(), step.Seconds(), 0
+}
+
+// close ends the candidate and queues it when it qualifies.
+func (f *focusTracker) close(cfg Config) *focusSession {
+	if f.app == "" {
+		return nil
+	}
+	s := focusSession{start: f.start, end: f.lastActive, app: f.app, user: f.user}
+	f.app = ""
+	if f.totalSecs <= 0 || s.end.Sub(s.start) < cfg.FocusMinDuration {
+		return nil
+	}
+	s.activityPct = f.activeSecs / f.totalSecs * 100
+	if s.activityPct < cfg.FocusMinRatio*100 {
+		return nil
+	}
+	f.pending = append(f.pending, s)
+	if over := len(f.pending) - maxPendingFocus; over > 0 {
+		f.pending = f.pending[over:]
+	}
+	return &s
+}
+
+// upload inserts the pending sessions with the hourly rows; on failure
+// they wait for the next upload. Replays of a session overwrite it.
+func (f *focusTracker) upload(httpClient *http.Client, cfg Config) (int, error) {
+	n := len(f.pending)
+	if n == 0 {
+		return 0, nil
+	}
+	if err := insertFocusSessions(httpClient, cfg, f.pending); err != nil {
+		return 0, err
+	}
+	f.pending = f.pending[:0]
+	return n, nil
+}
+
+// discard drops the sessions upload would have sent, for dry-run mode,
+// and returns how many there were.
+func (f *focusTracker) discard() int {
+	n := len(f.pending)
+	f.pending = f.pending[:0]
+	return n
+}
+
+func (s focusSession) String() string {
+	return fmt.Sprintf("FOCUS %s -> %s (%s) app=%s activity=%.0f%%",
+		s.start.Format(time.RFC3339), s.end.Format(time.RFC3339), s.end.Sub(s.start).Truncate(time.Second), s.app, s.activityPct)
+}
+
+// insertFocusSessions writes sessions to the focus_sessions table created
+// by the backend migrations.
+func insertFocusSessions(httpClient *http.Client, cfg Config, sessions []focusSession) error {
+	values := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		values = append(values, fmt.Sprintf(`("%s", "%s", "%s", "%s", "%s", %.2f)`,
+			escapeSQLString(cfg.HostName),
+			escapeSQLString(s.user),
+			s.start.UTC().Format(time.RFC3339),
+			s.end.UTC().Format(time.RFC3339),
+			escapeSQLString(s.app),
+			s.activityPct,
+		))
+	}
+	stmt := `INSERT OR REPLACE INTO focus_sessions(host, user_name, started_at, ended_at, app, activity_pct) VALUES ` +
+		strings.Join(values, ", ") + `;`
+	return rqliteExec(httpClient, cfg, []string{stmt})
+}
@@ -3,6 +3,12 @@ module idle
 go 1.25.3
 
 require (
+	github.com/godbus/dbus/v5 v5.2.2
+	github.com/klauspost/compress v1.18.0
 	github.com/rqlite/gorqlite v0.0.0-20250609141355-ac86a4a1c9a8
 	golang.org/x/sys v0.40.0
+	taxonomy v0.0.0
 )
+
+// shared with the backend, see ../taxonomy
+replace taxonomy => ../taxonomy
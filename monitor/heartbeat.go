@@ -0,0 +1,233 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Build metadata, stamped at build time:
+//
+//	go build -ldflags "-X main.agentVersion=1.4.0 -X main.agentCommit=3f2c1ab -X main.agentBuildDate=2026-03-02T10:00:00Z"
+//
+// Commit and date fall back to what the Go toolchain recorded from git.
+var (
+	agentVersion   = "dev"
+	agentCommit    = ""
+	agentBuildDate = ""
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && agentCommit == "":
+			agentCommit = s.Value
+		case s.Key == "vcs.time" && agentBuildDate == "":
+			agentBuildDate = s.Value
+		}
+	}
+	if len(agentCommit) > 12 {
+		agentCommit = agentCommit[:12]
+	}
+}
+
+// buildLabel is the version as printed on START lines.
+func buildLabel() string {
+	return fmt.Sprintf("version=%s commit=%s built=%s", agentVersion, orUnknown(agentCommit), orUnknown(agentBuildDate))
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// protocolVersion is the agent<->backend protocol this agent speaks; the
+// backend answers with the range it accepts.
+const protocolVersion = 1
+
+type heartbeatResponse struct {
+	ProtocolVersion    int    `json:"protocol_version"`
+	MinProtocolVersion int    `json:"min_protocol_version"`
+	MinAgentVersion    string `json:"min_agent_version"`
+	UpgradeRequired    bool   `json:"upgrade_required"`
+	Message            string `json:"message"`
+	HeartbeatInterval  string `json:"heartbeat_interval"`
+	ConfigPollInterval string `json:"config_poll_interval"`
+	ConsentRequired    bool   `json:"consent_required"`
+	PolicyVersion      string `json:"policy_version"`
+}
+
+// consentRequired is set while the backend's collection policy requires
+// consent the user has not given; the main loop then samples nothing.
+var consentRequired atomic.Bool
+
+// Bounds applied to intervals dictated by the backend, so a bad setting
+// can neither flood it nor silence the agent for days.
+const (
+	minControlInterval = 30 * time.Second
+	maxControlInterval = 24 * time.Hour
+)
+
+// dictatedInterval parses an interval from a heartbeat response. ok is
+// false when the backend sent none (older backends) or garbage.
+func dictatedInterval(s string) (d time.Duration, ok bool) {
+	d, err := time.ParseDuration(s)
+	if s == "" || err != nil {
+		return 0, false
+	}
+	if d < minControlInterval {
+		d = minControlInterval
+	}
+	if d > maxControlInterval {
+		d = maxControlInterval
+	}
+	return d, true
+}
+
+// heartbeatLoop announces the agent to the backend every HeartbeatEvery,
+// starting after a random offset below FlushOffsetMax, until ctx is done. An "upgrade required" answer is logged each time and
+// shown to the user once. Intervals in the answer replace HeartbeatEvery
+// and the config poll period held by poll.
+func heartbeatLoop(ctx context.Context, cfg Config, httpClient *http.Client, poll *configPoller, writeLine func(string)) {
+	every := cfg.HeartbeatEvery
+	t := time.NewTicker(every)
+	defer t.Stop()
+
+	notified := false
+	var rtt time.Duration
+	beat := func() {
+		ts := time.Now().Format(time.RFC3339)
+		sent := time.Now()
+		resp, err := sendHeartbeat(ctx, httpClient, cfg, rtt)
+		if err != nil {
+			writeLine(fmt.Sprintf("[%s] HEARTBEAT error: %v", ts, err))
+			return
+		}
+		rtt = time.Since(sent)
+		if d, ok := dictatedInterval(resp.HeartbeatInterval); ok && d != every {
+			writeLine(fmt.Sprintf("[%s] HEARTBEAT interval %s -> %s (set by backend)", ts, every, d))
+			every = d
+			t.Reset(every)
+		}
+		if d, ok := dictatedInterval(resp.ConfigPollInterval); ok && poll.setEvery(d) {
+			writeLine(fmt.Sprintf("[%s] CONFIG poll interval now %s (set by backend)", ts, d))
+		}
+		if was := consentRequired.Swap(resp.ConsentRequired); was != resp.ConsentRequired {
+			if resp.ConsentRequired {
+				writeLine(fmt.Sprintf("[%s] CONSENT REQUIRED policy=%s: sampling stopped until %s consents", ts, resp.PolicyVersion, cfg.UserName))
+				notifyUser("Activity Monitor: consent required",
+					"Activity is not measured until you accept the collection policy (version "+resp.PolicyVersion+").")
+			} else {
+				writeLine(fmt.Sprintf("[%s] CONSENT given policy=%s: sampling resumed", ts, resp.PolicyVersion))
+			}
+		}
+		if !resp.UpgradeRequired {
+			return
+		}
+		writeLine(fmt.Sprintf("[%s] UPGRADE REQUIRED agent=%s protocol=%d backend_protocol=%d min_protocol=%d: %s",
+			ts, agentVersion, protocolVersion, resp.ProtocolVersion, resp.MinProtocolVersion, resp.Message))
+		if !notified {
+			notifyUser("Activity Monitor: upgrade required", resp.Message)
+			notified = true
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(randomDelay(cfg.FlushOffsetMax)):
+	}
+	t.Reset(every)
+	beat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			beat()
+		}
+	}
+}
+
+// presence is the user's latest input and the windowed mode (empty unless
+// WindowedPipeline is on), sent with each heartbeat so the backend can
+// tell who is at their desk between hourly rows, and served on the
+// PresencePipe.
+type presence struct {
+	LastInput string
+	Mode      string
+	Host      string
+	User      string
+	At        time.Time // when it was sampled
+}
+
+// lastPresence is refreshed every sample by the main loop.
+var lastPresence atomic.Pointer[presence]
+
+// sendHeartbeat posts one heartbeat; rtt is the previous round trip (0 on
+// the first one), which the backend uses to back off slow links.
+func sendHeartbeat(ctx context.Context, httpClient *http.Client, cfg Config, rtt time.Duration) (heartbeatResponse, error) {
+	var out heartbeatResponse
+	if cfg.DryRun {
+		return out, errDryRun
+	}
+	p := lastPresence.Load()
+	if p == nil {
+		p = &presence{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"host":             cfg.HostName,
+		"user_name":        cfg.UserName,
+		"agent_version":    agentVersion,
+		"agent_commit":     agentCommit,
+		"agent_build_date": agentBuildDate,
+		"protocol_version": protocolVersion,
+		"os":               runtime.GOOS + "/" + runtime.GOARCH,
+		"rtt_ms":           rtt.Milliseconds(),
+		"resources":        lastSelfStats.Load(),
+		"last_input":       p.LastInput,
+		"mode":             p.Mode,
+	})
+	if err != nil {
+		return out, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(cfg.BackendBaseURL, "/")+"/agent/heartbeat", bytes.NewReader(body))
+	if err != nil {
+		return out, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := ingestToken(cfg); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	respBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return out, fmt.Errorf("HTTP %s body=%s", resp.Status, string(respBytes))
+	}
+	if err := json.Unmarshal(respBytes, &out); err != nil {
+		return out, fmt.Errorf("cannot parse JSON: %v body=%s", err, string(respBytes))
+	}
+	return out, nil
+}
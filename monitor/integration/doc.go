@@ -0,0 +1,4 @@
+// Package integration holds the end-to-end suite of the tty pipeline, in
+// a module of its own so the agent does not depend on testcontainers-go;
+// see integration_test.go.
+package integration
@@ -0,0 +1,298 @@
+//go:build integration
+
+// The integration suite runs the tty pipeline end to end: an rqlite node
+// in Docker (testcontainers-go), the backend built from
+// ../../detector/backend and started against it, and a Pipeline fed by
+// a scripted hour of three users. It checks the rows that land in
+// activity_hourly and the JSON served by GET /activity/today:
+//
+//	cd monitor/integration && go test -tags integration .
+//
+// It needs a Docker daemon and the go command; the rqlite image is pulled
+// on the first run.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"idle/tty"
+)
+
+const ingestToken = "integration-token"
+
+// hourRow is the subset of a row the suite compares.
+type hourRow struct {
+	HourStart   string  `json:"hour_start"`
+	Host        string  `json:"host"`
+	UserName    string  `json:"user_name"`
+	ActivityPct float64 `json:"activity_pct"`
+	IdleSeconds float64 `json:"idle_seconds"`
+	Samples     int64   `json:"samples"`
+	Status      string  `json:"status"`
+	FirstInput  string  `json:"first_input"`
+	LastInput   string  `json:"last_input"`
+}
+
+func TestIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	rqliteURL := startRqlite(ctx, t)
+	backend := startBackend(ctx, t, rqliteURL)
+
+	// the last whole hour, which the backend takes as a normal late upload
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	host := fmt.Sprintf("it-%d", time.Now().UnixNano())
+	p := &tty.Pipeline{Host: host, Team: "infra", Every: 10 * time.Second, Active: 30 * time.Second, Input: officeHour(hour)}
+	rows := runHour(t, p, hour)
+	if err := tty.Post(&http.Client{Timeout: 30 * time.Second}, backend, ingestToken, rows); err != nil {
+		t.Fatalf("POST /ingest/hourly: %v", err)
+	}
+
+	var want []hourRow
+	for _, r := range rows {
+		first, _ := r["first_input"].(string)
+		last, _ := r["last_input"].(string)
+		want = append(want, hourRow{
+			HourStart: r["hour_start"].(string), Host: host, UserName: r["user_name"].(string),
+			ActivityPct: r["activity_pct"].(float64), IdleSeconds: r["idle_seconds"].(float64),
+			Samples: r["samples"].(int64), Status: r["status"].(string), FirstInput: first, LastInput: last,
+		})
+	}
+	if len(want) != 3 || want[0].Status != "HIGH_PRODUCTION" || want[1].Status != "OFF" {
+		t.Fatalf("pipeline rows: %+v", want)
+	}
+
+	t.Run("activity_hourly", func(t *testing.T) {
+		conn, err := gorqlite.Open(rqliteURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		qr, err := conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+			Query: `SELECT hour_start, host, user_name, activity_pct, idle_seconds, samples, status,
+			               COALESCE(first_input, ''), COALESCE(last_input, '')
+			        FROM activity_hourly WHERE host = ? AND deleted_at IS NULL ORDER BY user_name`,
+			Arguments: []interface{}{host},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []hourRow
+		for qr.Next() {
+			var r hourRow
+			if err := qr.Scan(&r.HourStart, &r.Host, &r.UserName, &r.ActivityPct, &r.IdleSeconds, &r.Samples, &r.Status,
+				&r.FirstInput, &r.LastInput); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, r)
+		}
+		compareRows(t, got, want)
+	})
+
+	t.Run("GET /activity/today", func(t *testing.T) {
+		q := url.Values{
+			"date": {hour.Format("2006-01-02")}, "start": {"00:00"}, "end": {"23:59"}, "tz": {"UTC"},
+			"host": {host}, "consistency": {"strong"},
+		}
+		resp, err := http.Get(backend + "/activity/today?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("HTTP %d", resp.StatusCode)
+		}
+		var today struct {
+			Count int       `json:"count"`
+			Rows  []hourRow `json:"rows"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&today); err != nil {
+			t.Fatal(err)
+		}
+		if today.Count != len(today.Rows) {
+			t.Errorf("count = %d with %d rows", today.Count, len(today.Rows))
+		}
+		sort.Slice(today.Rows, func(i, j int) bool { return today.Rows[i].UserName < today.Rows[j].UserName })
+		compareRows(t, today.Rows, want)
+	})
+}
+
+// officeHour is an hour of three users: alice works until 45 minutes in,
+// bob never touches his session and carol logs in at 30 minutes and works
+// to the end.
+type officeHour time.Time
+
+func (h officeHour) LastInputs(now time.Time) (map[string]time.Time, error) {
+	hour := time.Time(h)
+	alice := now
+	if now.Sub(hour) > 45*time.Minute {
+		alice = hour.Add(45 * time.Minute)
+	}
+	users := map[string]time.Time{"alice": alice, "bob": {}}
+	if now.Sub(hour) >= 30*time.Minute {
+		users["carol"] = now
+	}
+	return users, nil
+}
+
+// runHour samples p every p.Every over the hour starting at hour and
+// returns the rows closed at the next hour, sorted by user.
+func runHour(t *testing.T, p *tty.Pipeline, hour time.Time) []tty.Row {
+	t.Helper()
+	for now := hour; now.Before(hour.Add(time.Hour)); now = now.Add(p.Every) {
+		p.Rollover(now)
+		if err := p.Sample(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, ok := p.Rollover(hour.Add(time.Hour))
+	if !ok {
+		t.Fatal("hour not closed")
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i]["user_name"].(string) < rows[j]["user_name"].(string) })
+	return rows
+}
+
+func compareRows(t *testing.T, got, want []hourRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// startRqlite runs a throwaway rqlite node and returns its HTTP URL.
+func startRqlite(ctx context.Context, t *testing.T) string {
+	t.Helper()
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "rqlite/rqlite",
+			ExposedPorts: []string{"4001/tcp"},
+			WaitingFor:   wait.ForHTTP("/readyz").WithPort("4001/tcp").WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+	if c != nil {
+		t.Cleanup(func() {
+			if err := c.Terminate(context.Background()); err != nil {
+				t.Logf("rqlite: %v", err)
+			}
+		})
+	}
+	if err != nil {
+		t.Fatalf("rqlite container: %v", err)
+	}
+	endpoint, err := c.PortEndpoint(ctx, "4001/tcp", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint
+}
+
+// startBackend builds the backend, starts it against rqliteURL on a free
+// local port and waits for GET /health/ready. Its output is logged if the
+// test fails.
+func startBackend(ctx context.Context, t *testing.T, rqliteURL string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "detector-api")
+	build := exec.CommandContext(ctx, "go", "build", "-o", bin, ".")
+	build.Dir = filepath.Join("..", "..", "detector", "backend")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building the backend: %v\n%s", err, out)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+	)
+	cmd := exec.Command(bin)
+	cmd.Env = append(os.Environ(),
+		"RQLITE_URL="+rqliteURL,
+		"LISTEN_ADDR="+addr,
+		"INGEST_TOKEN="+ingestToken,
+		"DASHBOARD=off",
+		// keep gap rows for the test host out of the checks
+		"GAP_FILL_INTERVAL=24h",
+	)
+	cmd.Stdout = lockedWriter{&mu, &out}
+	cmd.Stderr = lockedWriter{&mu, &out}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var waitErr error
+	exited := make(chan struct{})
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(10 * time.Second):
+			_ = cmd.Process.Kill()
+		}
+		if t.Failed() {
+			mu.Lock()
+			t.Logf("backend output:\n%s", out.String())
+			mu.Unlock()
+		}
+	})
+
+	base := "http://" + addr
+	for {
+		if resp, err := http.Get(base + "/health/ready"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return base
+			}
+		}
+		select {
+		case <-exited:
+			t.Fatalf("backend exited: %v", waitErr)
+		case <-ctx.Done():
+			t.Fatal("backend not ready in time")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,77 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Log shipping bounds: lines wait in a buffer of logShipBuffer (oldest
+// dropped first while the backend is unreachable) and go out in batches
+// of at most logShipBatch. send-logs uploads the last sendLogsBytes of
+// the current log file.
+const (
+	logShipBuffer = 10000
+	logShipBatch  = 500
+	sendLogsBytes = 256 << 10
+)
+
+// logShipper tees log lines to the backend's POST /logs, so a helpdesk
+// can read an agent's log without access to the machine.
+type logShipper struct {
+	queue uploadQueue[string]
+}
+
+func newLogShipper() *logShipper {
+	return &logShipper{queue: uploadQueue[string]{limit: logShipBuffer}}
+}
+
+// add queues one line; called from writeLine, so it never blocks.
+func (s *logShipper) add(line string) {
+	s.queue.add(line)
+}
+
+// loop uploads queued lines every cfg.LogShipEvery until ctx is done, then
+// makes a last attempt so the STOP line gets out. A batch after lines were
+// dropped starts with a line saying how many.
+func (s *logShipper) loop(ctx context.Context, cfg Config, writeLine func(string)) {
+	client := &http.Client{Timeout: 20 * time.Second}
+	every := cfg.LogShipEvery
+	if every <= 0 {
+		every = time.Minute
+	}
+	uploadLoop(ctx, every, "LOGSHIP", func(ctx context.Context) error {
+		return s.queue.flush(ctx, logShipBatch, func(ctx context.Context, batch []string, dropped int) error {
+			if dropped > 0 {
+				note := fmt.Sprintf("[%s] LOGSHIP dropped %d lines while the backend was unreachable", time.Now().Format(time.RFC3339), dropped)
+				batch = append([]string{note}, batch...)
+			}
+			return postLogs(ctx, client, cfg, batch)
+		})
+	}, writeLine)
+}
+
+// sendLogs uploads the tail of the current log file, for the send-logs
+// command; it works whether or not LogShipping is on.
+func sendLogs(ctx context.Context, cfg Config, rot *RotatingLogger) (int, error) {
+	lines, err := rot.Tail(sendLogsBytes)
+	if err != nil {
+		return 0, err
+	}
+	client := &http.Client{Timeout: 20 * time.Second}
+	for start := 0; start < len(lines); start += logShipBatch {
+		if err := postLogs(ctx, client, cfg, lines[start:min(start+logShipBatch, len(lines))]); err != nil {
+			return start, err
+		}
+	}
+	return len(lines), nil
+}
+
+// postLogs sends one gzipped batch to POST /logs.
+func postLogs(ctx context.Context, client *http.Client, cfg Config, lines []string) error {
+	return postCompressedJSON(ctx, client, cfg, "/logs", map[string]interface{}{"host": cfg.HostName, "lines": lines})
+}
@@ -7,19 +7,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"unsafe"
 
+	"taxonomy"
+
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
 )
 
 var (
@@ -78,7 +85,83 @@ func getMousePos() (POINT, error) {
 type Config struct {
 	SampleEvery          time.Duration
 	ActiveIfIdleLessThan time.Duration
-	PrintMouseMoveEvery  time.Duration
+
+	// MOUSE_MOVE lines: at most one per PrintMouseMoveEvery (0 = every
+	// move) and only PrintMouseMoveMinDistance pixels or more away from
+	// the last one logged. A MOUSE_MOVE_SUMMARY line counts each day's
+	// moves; MouseMoveSummary keeps only that line (see mousemove.go)
+	PrintMouseMoveEvery       time.Duration
+	PrintMouseMoveMinDistance int
+	MouseMoveSummary          bool
+
+	// slower sampling once the user is idle (0 keeps SampleEvery);
+	// snaps back to SampleEvery on the first input seen
+	IdleSampleEvery time.Duration
+
+	// pipelines, enabled independently: the windowed one logs live modes
+	// (STATUS / MODE CHANGE lines), the hourly one uploads to rqlite
+	WindowedPipeline bool
+	HourlyPipeline   bool
+
+	// windowed pipeline settings
+	WindowSize              time.Duration
+	HighProductiveRatio     float64
+	SimpleProductiveRatio   float64
+	ContinuousIdleThreshold time.Duration
+	PrintStatusEvery        time.Duration
+	// a mode is left only once the ratio falls ModeHysteresis below the
+	// threshold that entered it, and no sooner than ModeMinDwell after
+	ModeHysteresis float64
+	ModeMinDwell   time.Duration
+	// how the window's activity ratio is computed: "threshold", "decay"
+	// or "weighted" (see scoring.go)
+	Scoring         string
+	ScoringHalfLife time.Duration      // decay
+	ScoringWeights  map[string]float64 // weighted: "mouse", "key", "touch" in [0, 1]
+
+	// half-life of the EWMA score uploaded with each hour (ewma_pct);
+	// 0 leaves it out
+	EWMAHalfLife time.Duration
+
+	// idle periods from BreakMin to BreakMax are breaks, counted per hour
+	// (breaks, break_seconds) and logged as BREAK lines; BreakMin 0 turns
+	// detection off
+	BreakMin time.Duration
+	BreakMax time.Duration
+
+	// attribute each sample to the user logged on to the console rather
+	// than UserName, splitting hours between the users of a shared
+	// workstation (see sessionuser.go)
+	SessionUser bool
+
+	// log and upload focus sessions: at least FocusMinDuration in one
+	// foreground application with an active share of at least
+	// FocusMinRatio (see focus.go)
+	FocusSessions    bool
+	FocusMinDuration time.Duration
+	FocusMinRatio    float64
+
+	// sample the foreground window title every TitleSampleEvery into the
+	// window_titles table, rewritten by TitleRedact first (see titles.go)
+	WindowTitles     bool
+	TitleSampleEvery time.Duration
+	TitleRedact      []TitleRule
+
+	// active foreground time per application category, uploaded as
+	// category_seconds; AppCategories maps lower-case executable names
+	// to categories, anything else is "other" (see apps.go)
+	TrackAppCategories bool
+	AppCategories      map[string]string
+
+	// active time per web domain while a browser is in the foreground,
+	// uploaded as domain_seconds. The tab comes from the companion
+	// browser extension posting to DomainListen (loopback only); domains
+	// outside DomainAllow (when set) or inside DomainDeny count as
+	// "other" (see domains.go)
+	DomainTracking bool
+	DomainListen   string
+	DomainAllow    []string
+	DomainDeny     []string
 
 	LogDir      string
 	LogBaseName string
@@ -89,9 +172,82 @@ type Config struct {
 	RqliteUser    string // optional basic auth username
 	RqlitePass    string // optional basic auth password
 
-	// identity fields (kept for logs; not inserted unless your table has columns)
-	HostName string
-	UserName string
+	// identity fields, attached to every row. HostName and UserName default
+	// to os.Hostname() and %USERNAME% but can be overridden in config.json.
+	HostName        string
+	UserName        string
+	UserDisplayName string
+	Team            string
+	Labels          map[string]string
+
+	// IANA zone the local_hour column is written in ("Europe/Paris");
+	// empty uses the machine's zone. hour_start is always UTC.
+	TimeZone string
+
+	// site key for pseudonymizing HostName and UserName (see pseudonym.go);
+	// empty keeps them in clear text
+	PseudonymKey string
+
+	// shared secret (the backend's ENROLLMENT_SECRET) traded once for this
+	// agent's own token, see enroll.go; can be removed once enrolled
+	EnrollmentSecret string
+
+	// hex key from the backend's GET /admin/agents/:host/signing-key;
+	// each hourly row is then signed (see signing.go). Empty leaves rows
+	// unsigned, as older backends expect.
+	SigningKey string
+
+	// boot-storm avoidance: when a whole office powers on at once, spread
+	// the first sample and the first upload over these windows.
+	StartupDelayMax     time.Duration // random delay before sampling starts
+	InitialUploadJitter time.Duration // random delay applied to the first hourly insert
+	// agents that stay up together still roll over the hour on the same
+	// second: each picks a fixed offset below FlushOffsetMax (at most
+	// maxFlushOffset) for its later hourly inserts and its heartbeats
+	FlushOffsetMax time.Duration
+
+	// backend control plane (heartbeats, version handshake); empty
+	// BackendBaseURL disables it
+	BackendBaseURL string // e.g. "http://192.168.1.15:8080"
+	IngestToken    string // matches the backend's INGEST_TOKEN, if set
+	HeartbeatEvery time.Duration
+
+	// how often config.json is re-read; the backend can override it
+	ConfigPollEvery time.Duration
+
+	// local control channel, \\.\pipe\<ControlPipe>; empty disables it
+	ControlPipe string
+	// read-only presence for other local software (see package
+	// idle/presence), \\.\pipe\<PresencePipe>; empty disables it
+	PresencePipe string
+
+	// mirror start, stop and error lines to the Windows Event Log
+	EventLog bool
+
+	// take admin commands (flush, send-logs, ...) from the backend; needs
+	// BackendBaseURL
+	RemoteCommands bool
+
+	// copy log lines to the backend's POST /logs; needs BackendBaseURL
+	LogShipping  bool
+	LogShipEvery time.Duration
+
+	// upload every measured tick to the backend's POST /ingest/samples,
+	// in gzipped chunks every RawSampleEvery; needs BackendBaseURL
+	RawSamples     bool
+	RawSampleEvery time.Duration
+
+	// Content-Encoding of log and raw sample uploads: gzip, zstd or none
+	UploadCompression string
+
+	// sample, aggregate and log as usual but send nothing over the
+	// network: no rqlite inserts, heartbeats, remote commands or log
+	// shipping. Rows that would have been uploaded are logged instead.
+	DryRun bool
+
+	// time-of-day overrides (worktime, after-hours, weekend, ...),
+	// switched automatically; see profiles.go
+	Profiles []ConfigProfile
 }
 
 type RotatingLogger struct {
@@ -154,6 +310,63 @@ func (r *RotatingLogger) Println(line string) {
 	}
 }
 
+// Rotate moves the current file aside as <base>-<date>-<hhmmss>.log and
+// starts a fresh one, for collecting a log without stopping the agent.
+func (r *RotatingLogger) Rotate(now time.Time) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur := r.filenameFor(now)
+	if r.file != nil {
+		cur = r.file.Name()
+		_ = r.file.Sync()
+		_ = r.file.Close()
+		r.file = nil
+		r.logger = nil
+	}
+	r.curDate = ""
+	aside := strings.TrimSuffix(cur, ".log") + now.Format("-150405") + ".log"
+	renameErr := os.Rename(cur, aside)
+	if err := r.rotateIfNeeded(now); err != nil {
+		return "", err
+	}
+	return aside, renameErr
+}
+
+// Tail returns the lines in the last maxBytes of the current file, for
+// send-logs; a line cut by the limit is left out.
+func (r *RotatingLogger) Tail(maxBytes int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil, fmt.Errorf("no log file open")
+	}
+	f, err := os.Open(r.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	off := max(st.Size()-maxBytes, 0)
+	buf := make([]byte, st.Size()-off)
+	if _, err := f.ReadAt(buf, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	text := strings.TrimRight(string(buf), "\r\n")
+	if off > 0 {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), nil
+}
+
 func (r *RotatingLogger) Sync() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -173,18 +386,105 @@ func (r *RotatingLogger) Close() {
 	}
 }
 
-// statusFor returns OFF/LOW/ACTIVE/HIGH_PRODUCTION based on activity%.
+// statusFor returns OFF/LOW/ACTIVE/HIGH_PRODUCTION based on activity%,
+// with the default thresholds of the shared taxonomy.
 func statusFor(activityPct float64, samplesInHour int) string {
-	if samplesInHour == 0 || activityPct == 0 {
-		return "OFF"
+	return string(taxonomy.Classify(activityPct, int64(samplesInHour), taxonomy.DefaultThresholds))
+}
+
+// nextInterval picks the sampling period after a tick: IdleSampleEvery
+// once idle reaches ActiveIfIdleLessThan, back to SampleEvery as soon as
+// input shows up (idle shorter than the tick that just elapsed).
+func nextInterval(cfg Config, cur, idleNow time.Duration) time.Duration {
+	if cfg.IdleSampleEvery <= cfg.SampleEvery {
+		return cfg.SampleEvery
+	}
+	if cur == cfg.SampleEvery {
+		if idleNow >= cfg.ActiveIfIdleLessThan {
+			return cfg.IdleSampleEvery
+		}
+		return cur
+	}
+	if idleNow < cur {
+		return cfg.SampleEvery
 	}
-	if activityPct < 50.0 {
-		return "LOW"
+	return cur
+}
+
+// slowTickIdle is the idle part of a slow tick: all of it without input,
+// otherwise the part before the input.
+func slowTickIdle(interval, idleNow time.Duration) time.Duration {
+	if idleNow >= interval {
+		return interval
+	}
+	return interval - idleNow
+}
+
+// sampleWeight is how many SampleEvery samples one tick of interval is worth.
+func sampleWeight(interval, sampleEvery time.Duration) int {
+	if n := int((interval + sampleEvery/2) / sampleEvery); n > 1 {
+		return n
 	}
-	if activityPct < 60.0 {
-		return "ACTIVE"
+	return 1
+}
+
+// maxFlushOffset bounds FlushOffsetMax: a later insert would leave the
+// previous hour missing from dashboards for too long.
+const maxFlushOffset = 2 * time.Minute
+
+// randomDelay returns a uniformly random duration in [0, max).
+func randomDelay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
 	}
-	return "HIGH_PRODUCTION"
+	return rand.N(max)
+}
+
+// activityPctFor converts idle seconds over a span (in seconds) into an
+// activity percentage clamped to [0, 100].
+func activityPctFor(idleSeconds, spanSeconds float64) float64 {
+	if spanSeconds <= 0 {
+		return 0
+	}
+	idleRatio := idleSeconds / spanSeconds
+	if idleRatio < 0 {
+		idleRatio = 0
+	}
+	if idleRatio > 1 {
+		idleRatio = 1
+	}
+	return (1.0 - idleRatio) * 100.0
+}
+
+// hourlyRow is one computed hour waiting to be inserted.
+type hourlyRow struct {
+	hourStart   time.Time
+	localHour   string // hourStart in Config.TimeZone, with its offset
+	userName    string // who held the hour, see sessionuser.go
+	displayName string
+	activityPct float64
+	idleSeconds float64
+	samples     int
+	status      string
+
+	batterySeconds float64 // time spent on battery power
+	batteryPct     int     // charge at the last sample, -1 without a battery
+
+	monitorSeconds map[string]float64 // active time per display, by device name
+
+	ewmaPct float64 // EWMA activity score at the end of the hour, -1 when off
+
+	degradedSeconds float64 // measured from the cursor only, see degraded.go
+
+	categorySeconds map[string]float64 // active foreground time per application category
+	domainSeconds   map[string]float64 // active browser time per web domain
+
+	inputs inputSpan // first and last keyboard/mouse input within the hour
+
+	breaks       int     // idle periods of break length that ended in the hour
+	breakSeconds float64 // their total length
+
+	inputEvents // clicks and wheel notches, key presses, touch contacts
 }
 
 // --- rqlite helpers (robust) ---
@@ -198,6 +498,9 @@ type rqliteExecuteResp struct {
 	Error string `json:"error"`
 }
 
+// errDryRun is returned by every network write attempted with DryRun set.
+var errDryRun = errors.New("dry run: network writes disabled")
+
 // escapeSQLString escapes double quotes for SQL strings we wrap in "..."
 func escapeSQLString(s string) string {
 	return strings.ReplaceAll(s, `"`, `""`)
@@ -205,9 +508,15 @@ func escapeSQLString(s string) string {
 
 // rqliteExec posts SQL statements to rqlite /db/execute and validates JSON result errors.
 func rqliteExec(httpClient *http.Client, cfg Config, stmts []string) error {
+	if cfg.DryRun {
+		return errDryRun
+	}
 	if cfg.RqliteBaseURL == "" {
 		return fmt.Errorf("RqliteBaseURL is empty")
 	}
+	if err := chaos.beforeRqlite(); err != nil {
+		return err
+	}
 
 	body, err := json.Marshal(stmts)
 	if err != nil {
@@ -255,35 +564,167 @@ func rqliteExec(httpClient *http.Client, cfg Config, stmts []string) error {
 }
 
 // insertHourly inserts (or replaces) one hourly row into an already-existing table.
+// battery_pct is NULL on machines without a battery.
 //
-// IMPORTANT: This matches YOUR schema:
-// hour_start (TEXT PK), activity_pct (REAL), idle_seconds (REAL), samples (INTEGER), status (TEXT), created_at (TEXT)
-func insertHourly(httpClient *http.Client, cfg Config, hourStart time.Time, activityPct float64, idleSeconds float64, samples int, status string, createdAt time.Time) error {
-	stat := escapeSQLString(status)
+// IMPORTANT: This matches the schema created by the backend migrations:
+// hour_start (TEXT), host (TEXT), user_name, display_name, team, labels (JSON TEXT),
+// activity_pct (REAL), idle_seconds (REAL), samples (INTEGER), status (TEXT), created_at (TEXT)
+// with PRIMARY KEY (tenant, hour_start, host, user_name); rows written here
+// take the default tenant.
+//
+// Enrolled agents (see enroll.go) post the row to the backend instead.
+func insertHourly(httpClient *http.Client, cfg Config, row hourlyRow, createdAt time.Time) error {
+	if enrolled.Load() != nil && cfg.BackendBaseURL != "" {
+		return postHourly(httpClient, cfg, row)
+	}
+	stat := escapeSQLString(row.status)
+
+	labels := "{}"
+	if len(cfg.Labels) > 0 {
+		b, err := json.Marshal(cfg.Labels)
+		if err != nil {
+			return err
+		}
+		labels = string(b)
+	}
+	batteryPct := "NULL"
+	if row.batteryPct >= 0 {
+		batteryPct = fmt.Sprintf("%d", row.batteryPct)
+	}
+	ewmaPct := "NULL"
+	if row.ewmaPct >= 0 {
+		ewmaPct = fmt.Sprintf("%.2f", row.ewmaPct)
+	}
+	monitorSeconds := "{}"
+	if len(row.monitorSeconds) > 0 {
+		b, err := json.Marshal(row.monitorSeconds)
+		if err != nil {
+			return err
+		}
+		monitorSeconds = string(b)
+	}
+	categorySeconds := "{}"
+	if len(row.categorySeconds) > 0 {
+		b, err := json.Marshal(row.categorySeconds)
+		if err != nil {
+			return err
+		}
+		categorySeconds = string(b)
+	}
+	domainSeconds := "{}"
+	if len(row.domainSeconds) > 0 {
+		b, err := json.Marshal(row.domainSeconds)
+		if err != nil {
+			return err
+		}
+		domainSeconds = string(b)
+	}
 
+	suspected := 0
+	if row.synthetic.suspected {
+		suspected = 1
+	}
+	sig := signatureFor(cfg, row)
 	stmt := fmt.Sprintf(
-		`INSERT OR REPLACE INTO activity_hourly(hour_start, activity_pct, idle_seconds, samples, status, created_at)
-         VALUES ("%s", %.4f, %.0f, %d, "%s", "%s");`,
-		hourStart.UTC().Format("2006-01-02T15:00:00Z"),
-		activityPct,
-		idleSeconds,
-		samples,
+		`INSERT INTO activity_hourly(hour_start, host, user_name, display_name, team, labels, activity_pct, idle_seconds, samples, status, created_at, battery_seconds, battery_pct, monitor_seconds,
+                                      mouse_events, key_events, touch_events, local_hour, ewma_pct, degraded_seconds, category_seconds, domain_seconds,
+                                      first_input, last_input, breaks, break_seconds, suspected_synthetic, synthetic_confidence%s)
+         VALUES ("%s", "%s", "%s", "%s", "%s", "%s", %.4f, %.0f, %d, "%s", "%s", %.0f, %s, "%s", %d, %d, %d, "%s", %s, %.0f, "%s", "%s", "%s", "%s", %d, %.0f, %d, %.2f%s)
+         ON CONFLICT(tenant, hour_start, host, user_name) DO UPDATE SET
+           user_name = excluded.user_name, display_name = excluded.display_name, team = excluded.team, labels = excluded.labels,
+           activity_pct = excluded.activity_pct, idle_seconds = excluded.idle_seconds, samples = excluded.samples,
+           status = excluded.status, created_at = excluded.created_at,
+           battery_seconds = excluded.battery_seconds, battery_pct = excluded.battery_pct,
+           monitor_seconds = excluded.monitor_seconds,
+           mouse_events = excluded.mouse_events, key_events = excluded.key_events, touch_events = excluded.touch_events,
+           local_hour = excluded.local_hour, ewma_pct = excluded.ewma_pct,
+           degraded_seconds = excluded.degraded_seconds, category_seconds = excluded.category_seconds,
+           domain_seconds = excluded.domain_seconds,
+           first_input = excluded.first_input, last_input = excluded.last_input,
+           breaks = excluded.breaks, break_seconds = excluded.break_seconds,
+           suspected_synthetic = excluded.suspected_synthetic, synthetic_confidence = excluded.synthetic_confidence%s
+         WHERE activity_hourly.deleted_at IS NULL;`,
+		sig.columns,
+		row.hourStart.UTC().Format("2006-01-02T15:00:00Z"),
+		escapeSQLString(cfg.HostName),
+		escapeSQLString(row.userName),
+		escapeSQLString(row.displayName),
+		escapeSQLString(cfg.Team),
+		escapeSQLString(labels),
+		row.activityPct,
+		row.idleSeconds,
+		row.samples,
 		stat,
 		createdAt.UTC().Format(time.RFC3339),
+		row.batterySeconds,
+		batteryPct,
+		escapeSQLString(monitorSeconds),
+		row.mouse,
+		row.key,
+		row.touch,
+		row.localHour,
+		ewmaPct,
+		row.degradedSeconds,
+		escapeSQLString(categorySeconds),
+		escapeSQLString(domainSeconds),
+		inputTime(row.inputs.first),
+		inputTime(row.inputs.last),
+		row.breaks,
+		row.breakSeconds,
+		suspected,
+		row.synthetic.confidence,
+		sig.values,
+		sig.update,
 	)
 
-	return rqliteExec(httpClient, cfg, []string{stmt})
+	stmts := []string{stmt}
+	if taxonomy.Status(row.status).Measured() {
+		// a measured row replaces other users' gap placeholders
+		stmts = append(stmts, fmt.Sprintf(
+			`DELETE FROM activity_hourly WHERE hour_start = "%s" AND host = "%s" AND user_name != "%s"
+         AND deleted_at IS NULL AND status IN ('NO_DATA', 'AGENT_DOWN');`,
+			row.hourStart.UTC().Format("2006-01-02T15:00:00Z"),
+			escapeSQLString(cfg.HostName),
+			escapeSQLString(row.userName),
+		))
+	}
+	return rqliteExec(httpClient, cfg, stmts)
 }
 
-func main() {
+// defaultConfig returns the built-in agent configuration.
+func defaultConfig() Config {
 	hn, _ := os.Hostname()
 	un := os.Getenv("USERNAME")
 
-	cfg := Config{
+	return Config{
 		SampleEvery:          1 * time.Second,
 		ActiveIfIdleLessThan: 30 * time.Second,
+		IdleSampleEvery:      15 * time.Second,
 		PrintMouseMoveEvery:  0,
 
+		WindowedPipeline: true,
+		HourlyPipeline:   true,
+
+		WindowSize:              30 * time.Minute,
+		HighProductiveRatio:     0.60,
+		SimpleProductiveRatio:   0.30,
+		ContinuousIdleThreshold: 30 * time.Minute,
+		PrintStatusEvery:        30 * time.Second,
+		ModeHysteresis:          0.05,
+		ModeMinDwell:            2 * time.Minute,
+		Scoring:                 scoringThreshold,
+		ScoringHalfLife:         5 * time.Minute,
+		EWMAHalfLife:            5 * time.Minute,
+		BreakMin:                5 * time.Minute,
+		BreakMax:                60 * time.Minute,
+		SessionUser:             true,
+		FocusMinDuration:        25 * time.Minute,
+		FocusMinRatio:           0.8,
+		TitleSampleEvery:        5 * time.Minute,
+		TitleRedact:             defaultTitleRedact,
+		AppCategories:           defaultAppCategories,
+		DomainListen:            "127.0.0.1:17345",
+
 		LogDir:      `C:\ProgramData\ActivityMonitor`,
 		LogBaseName: "activity",
 		FlushEvery:  5 * time.Second,
@@ -295,19 +736,117 @@ func main() {
 
 		HostName: hn,
 		UserName: un,
+
+		StartupDelayMax:     60 * time.Second,
+		InitialUploadJitter: 2 * time.Minute,
+		FlushOffsetMax:      2 * time.Minute,
+
+		HeartbeatEvery:  5 * time.Minute,
+		ConfigPollEvery: 15 * time.Minute,
+
+		ControlPipe:  "ActivityMonitor",
+		PresencePipe: "ActivityMonitorPresence",
+		EventLog:     true,
+
+		RemoteCommands: true,
+
+		LogShipEvery: time.Minute,
+
+		RawSampleEvery:    5 * time.Minute,
+		UploadCompression: "gzip",
 	}
+}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+func main() {
+	if name, value, fromStdin, ok := setSecretArg(os.Args[1:]); ok {
+		if err := setSecret(configPath(), name, value, fromStdin); err != nil {
+			fmt.Println("Cannot set secret:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s stored in %s\n", name, secretsPath(configPath()))
+		if plain := plainSecrets(configPath()); len(plain) > 0 {
+			fmt.Printf("config.json still holds %s in clear text: remove it\n", strings.Join(plain, ", "))
+		}
+		return
+	}
+
+	cfg := defaultConfig()
+	if err := loadConfigFile(configPath(), &cfg); err != nil {
+		fmt.Println("Cannot load config:", err)
+		events := openEventSink()
+		events.mirror("CONFIG error: " + err.Error())
+		events.Close()
+		return
+	}
+	cfg = pseudonymize(cfg)
+	if err := parseChaosFlags(os.Args[1:]); err != nil {
+		fmt.Println("Invalid chaos flags:", err)
+		return
+	}
+
+	if isService, err := svc.IsWindowsService(); err == nil && isService {
+		runService(cfg)
+		return
+	}
+
+	// SIGTERM covers console close, logoff and shutdown events; the Go
+	// runtime keeps the process alive until run returns.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Built with -H=windowsgui there is no console, so session end only
+	// arrives as WM_ENDSESSION on a window.
+	done := make(chan struct{})
+	watchEndSession(stop, done)
+
+	run(ctx, cfg)
+	close(done)
+}
+
+// run samples activity until ctx is cancelled, then flushes and returns.
+func run(ctx context.Context, cfg Config) {
+	// in service mode there is no console, so the Event Log is the only
+	// place left for a logger that cannot start
+	var events *eventSink
+	if cfg.EventLog {
+		events = openEventSink()
+		defer events.Close()
+	}
+
 	rot, err := NewRotatingLogger(cfg.LogDir, cfg.LogBaseName)
 	if err != nil {
 		fmt.Println("Cannot create rotating logger:", err)
+		events.mirror("LOG error: cannot create rotating logger in " + cfg.LogDir + ": " + err.Error())
 		return
 	}
 	defer rot.Close()
 
-	writeLine := func(line string) { rot.Println(line) }
+	var shipper *logShipper
+	if cfg.BackendBaseURL != "" && cfg.LogShipping && !cfg.DryRun {
+		shipper = newLogShipper()
+		go shipper.loop(ctx, cfg, func(line string) { rot.Println(line) })
+	}
+	writeLine := func(line string) {
+		rot.Println(line)
+		events.mirror(line)
+		if shipper != nil {
+			shipper.add(line)
+		}
+	}
+
+	if plain := plainSecrets(configPath()); len(plain) > 0 {
+		writeLine(fmt.Sprintf("[%s] CONFIG %s in clear text in %s; move to secrets.dat with --set-secret",
+			time.Now().Format(time.RFC3339), strings.Join(plain, ", "), configPath()))
+	}
+
+	if d := randomDelay(cfg.StartupDelayMax); d > 0 {
+		writeLine(fmt.Sprintf("[%s] STARTUP DELAY %s", time.Now().Format(time.RFC3339), d))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d):
+		}
+	}
 
 	flushTicker := time.NewTicker(cfg.FlushEvery)
 	defer flushTicker.Stop()
@@ -318,90 +857,640 @@ func main() {
 		return
 	}
 
+	// display layout, for per-monitor usage; see monitors.go
+	var (
+		screens          monitors
+		screensRefreshed time.Time
+	)
+	refreshScreens := func(now time.Time) {
+		screensRefreshed = now
+		ms, err := listMonitors()
+		if err != nil {
+			writeLine(fmt.Sprintf("[%s] EnumDisplayMonitors error: %v", now.Format(time.RFC3339), err))
+			return
+		}
+		if ms.String() != screens.String() {
+			writeLine(fmt.Sprintf("[%s] MONITORS %s", now.Format(time.RFC3339), ms))
+		}
+		screens = ms
+	}
+	refreshScreens(time.Now())
+
+	// per-device input counts for the hourly rows; see rawinput.go
+	watchRawInput(writeLine)
+
 	var (
-		lastMousePrint  time.Time
+		mouseMoves      mouseMoveLog
+		dayInput        dayInputs
 		lastMouseMoveAt time.Time
+		window          activityWindow
+		lastSelfStatsAt time.Time
 	)
 
 	httpClient := &http.Client{Timeout: 8 * time.Second}
 
-	// Hourly counters
-	hourStart := time.Now().Truncate(time.Hour)
+	// Hourly counters; buckets are UTC hours, labelled in zone as well
+	zone, err := loadZone(cfg.TimeZone)
+	if err != nil {
+		writeLine(fmt.Sprintf("[%s] CONFIG TimeZone error: %v (using the machine zone)", time.Now().Format(time.RFC3339), err))
+		zone = time.Local
+	}
+
+	// cfg is base with the profile of the moment applied
+	base := cfg
+	profile := profileAt(base.Profiles, time.Now().In(zone))
+	cfg = withProfile(base, profile)
+	if cfg.FlushEvery != base.FlushEvery {
+		flushTicker.Reset(cfg.FlushEvery)
+	}
+
+	hourStart := bucketStart(chaos.now())
 	idleSecondsInHour := 0.0
 	samplesInHour := 0
+	batterySecondsInHour := 0.0
+	batteryPctInHour := -1
+	monitorSecondsInHour := make(map[string]float64)
+	degradedSecondsInHour := 0.0
+	var fallback idleFallback
+	categorySecondsInHour := make(map[string]float64)
+	domainSecondsInHour := make(map[string]float64)
+	var inputsInHour inputSpan
+	breaksInHour, breakSecondsInHour := 0, 0.0
+	var breaks breakDetector
+	var focus focusTracker
+	var (
+		apps    appTracker
+		domains domainTracker
+	)
+
+	// Rows computed at rollover wait here until uploadNotBefore: the first
+	// one by a fresh InitialUploadJitter so agents booted together don't
+	// insert together at the first hour boundary, later ones by this
+	// agent's flushOffset so the fleet doesn't at every boundary.
+	var (
+		pending         []hourlyRow
+		uploadNotBefore time.Time
+		firstUpload     = true
+		flushOffset     = randomDelay(cfg.FlushOffsetMax)
+	)
+	writeLine(fmt.Sprintf("[%s] FLUSH OFFSET %s", time.Now().Format(time.RFC3339), flushOffset.Truncate(time.Second)))
+
+	// set by the "pause" control command; ticks before it sample nothing
+	var pausedUntil time.Time
+
+	// tick lengths come from the monotonic clock, see clock.go
+	var clock tickClock
+
+	// fast-reacting activity score uploaded next to activity_pct
+	ewma := decayScorer{halfLife: cfg.EWMAHalfLife}
+
+	// foreground window titles, when WindowTitles is on
+	var titles titleSampler
+	if err := titles.configure(cfg); err != nil {
+		writeLine(fmt.Sprintf("[%s] CONFIG %v", time.Now().Format(time.RFC3339), err))
+	}
+
+	// the hour's counters belong to bucket; with SessionUser on they are
+	// split between the users taking the console (see sessionuser.go)
+	bucket := userBucket{user: cfg.UserName, display: cfg.UserDisplayName, from: hourStart}
+	parked := make(map[string]userBucket)
+
+	// hourRow builds the row of the hour's counters so far
+	hourRow := func(activityPct float64) hourlyRow {
+		return hourlyRow{
+			hourStart:   hourStart,
+			localHour:   localHour(hourStart, zone),
+			userName:    bucket.user,
+			displayName: bucket.display,
+			activityPct: activityPct,
+			idleSeconds: idleSecondsInHour,
+			samples:     samplesInHour,
+			status:      statusFor(activityPct, samplesInHour),
+
+			batterySeconds: batterySecondsInHour,
+			batteryPct:     batteryPctInHour,
+			monitorSeconds: monitorSecondsInHour,
+			ewmaPct:        ewma.pct(),
+			inputEvents:    takeInputEvents(),
+
+			degradedSeconds: degradedSecondsInHour,
+			categorySeconds: categorySecondsInHour,
+			domainSeconds:   domainSecondsInHour,
+			inputs:          inputsInHour,
+			breaks:          breaksInHour,
+			breakSeconds:    breakSecondsInHour,
+		}
+	}
+	resetHour := func() {
+		idleSecondsInHour = 0
+		samplesInHour = 0
+		batterySecondsInHour = 0
+		batteryPctInHour = -1
+		monitorSecondsInHour = make(map[string]float64)
+		degradedSecondsInHour = 0
+		categorySecondsInHour = make(map[string]float64)
+		domainSecondsInHour = make(map[string]float64)
+		inputsInHour = inputSpan{}
+		breaksInHour, breakSecondsInHour = 0, 0
+	}
+	// resumeHour takes the counters back from a parked row; the maps are
+	// copied since the queued row still holds them
+	resumeHour := func(row hourlyRow) {
+		idleSecondsInHour = row.idleSeconds
+		samplesInHour = row.samples
+		batterySecondsInHour = row.batterySeconds
+		batteryPctInHour = row.batteryPct
+		monitorSecondsInHour = maps.Clone(row.monitorSeconds)
+		degradedSecondsInHour = row.degradedSeconds
+		categorySecondsInHour = maps.Clone(row.categorySeconds)
+		domainSecondsInHour = maps.Clone(row.domainSeconds)
+		inputsInHour = row.inputs
+		breaksInHour, breakSecondsInHour = row.breaks, row.breakSeconds
+		putBackInputEvents(row.inputEvents)
+	}
+
+	// A restart within the hour the agent stopped in carries on with the
+	// counters saved at shutdown, see partialhour.go; another user's are
+	// parked for when they take the console back. An earlier hour is
+	// queued again in case its upload at shutdown failed.
+	if cfg.HourlyPipeline {
+		ts := time.Now().Format(time.RFC3339)
+		saved, held, ok, err := takePartialHour()
+		switch {
+		case err != nil:
+			writeLine(fmt.Sprintf("[%s] RESUME error: %v", ts, err))
+		case !ok:
+		case saved.hourStart.Equal(hourStart) && saved.userName == bucket.user:
+			resumeHour(saved)
+			bucket.from, bucket.heldBefore = chaos.now(), held
+			writeLine(fmt.Sprintf("[%s] RESUME hour=%s samples=%d idleSeconds=%.0f", ts, hourStart.Format(time.RFC3339), saved.samples, saved.idleSeconds))
+		case saved.hourStart.Equal(hourStart):
+			parked[saved.userName] = userBucket{user: saved.userName, display: saved.displayName, heldBefore: held, row: saved}
+			writeLine(fmt.Sprintf("[%s] RESUME hour=%s parked for %s", ts, hourStart.Format(time.RFC3339), orUnknown(saved.userName)))
+		case saved.hourStart.Before(hourStart):
+			pending = append(pending, saved)
+		}
+	}
+
+	uploadPending := func(now time.Time) {
+		ts := now.Format(time.RFC3339)
+		if cfg.DryRun {
+			for _, row := range pending {
+				writeLine(fmt.Sprintf("[%s] DRYRUN hourly row not uploaded: hour=%s activity=%.0f%% ewma=%.0f%% idleSeconds=%.0f samples=%d status=%s mouse=%d key=%d touch=%d",
+					ts, row.hourStart.UTC().Format("2006-01-02T15:00:00Z"), row.activityPct, row.ewmaPct, row.idleSeconds,
+					row.samples, row.status, row.mouse, row.key, row.touch))
+			}
+			pending = pending[:0]
+			if n := titles.discard(); n > 0 {
+				writeLine(fmt.Sprintf("[%s] DRYRUN titles not uploaded: %d", ts, n))
+			}
+			if n := focus.discard(); n > 0 {
+				writeLine(fmt.Sprintf("[%s] DRYRUN focus sessions not uploaded: %d", ts, n))
+			}
+			return
+		}
+		for _, row := range pending {
+			if err := insertHourly(httpClient, cfg, row, now); err != nil {
+				writeLine(fmt.Sprintf("[%s] RQLITE insert error: %v", ts, err))
+			} else {
+				writeLine(fmt.Sprintf("[%s] RQLITE insert ok: hour=%s activity=%.0f%% ewma=%.0f%% idleSeconds=%.0f samples=%d status=%s mouse=%d key=%d touch=%d",
+					ts,
+					row.hourStart.UTC().Format("2006-01-02T15:00:00Z"),
+					row.activityPct,
+					row.ewmaPct,
+					row.idleSeconds,
+					row.samples,
+					row.status,
+					row.mouse,
+					row.key,
+					row.touch,
+				))
+			}
+		}
+		pending = pending[:0]
+		if n, err := titles.upload(httpClient, cfg); err != nil {
+			writeLine(fmt.Sprintf("[%s] RQLITE titles error: %v", ts, err))
+		} else if n > 0 {
+			writeLine(fmt.Sprintf("[%s] RQLITE titles ok: %d", ts, n))
+		}
+		if n, err := focus.upload(httpClient, cfg); err != nil {
+			writeLine(fmt.Sprintf("[%s] RQLITE focus error: %v", ts, err))
+		} else if n > 0 {
+			writeLine(fmt.Sprintf("[%s] RQLITE focus ok: %d", ts, n))
+		}
+	}
 
 	ticker := time.NewTicker(cfg.SampleEvery)
 	defer ticker.Stop()
+	// adaptive sampling: interval is the current tick period, SampleEvery
+	// or IdleSampleEvery while the user is idle
+	interval := cfg.SampleEvery
+
+	// reconfigure switches the loop to next, after a config reload or a
+	// profile change
+	reconfigure := func(next Config, ts string) {
+		if next.SampleEvery != cfg.SampleEvery || interval != next.SampleEvery {
+			interval = next.SampleEvery
+			ticker.Reset(interval)
+		}
+		if next.FlushEvery != cfg.FlushEvery {
+			flushTicker.Reset(next.FlushEvery)
+		}
+		if next.EWMAHalfLife != cfg.EWMAHalfLife {
+			ewma = decayScorer{halfLife: next.EWMAHalfLife}
+		}
+		if err := titles.configure(next); err != nil {
+			writeLine(fmt.Sprintf("[%s] CONFIG %v", ts, err))
+		}
+		if next.TimeZone != cfg.TimeZone {
+			if z, err := loadZone(next.TimeZone); err != nil {
+				writeLine(fmt.Sprintf("[%s] CONFIG TimeZone error: %v (keeping %s)", ts, err, zone))
+			} else {
+				zone = z
+			}
+		}
+		cfg = next
+	}
 
-	writeLine(fmt.Sprintf("[%s] START host=%s user=%s rqlite=%s", time.Now().Format(time.RFC3339), cfg.HostName, cfg.UserName, cfg.RqliteBaseURL))
+	poll := newConfigPoller(configPath(), cfg.ConfigPollEvery)
+	go poll.loop(ctx, writeLine)
+	if cfg.BackendBaseURL != "" && !cfg.DryRun {
+		startEnrollment(ctx, cfg, httpClient, writeLine)
+		go heartbeatLoop(ctx, cfg, httpClient, poll, writeLine)
+	}
+	control := make(chan controlRequest)
+	if cfg.ControlPipe != "" {
+		go serveControl(ctx, cfg.ControlPipe, control, writeLine)
+	}
+	if cfg.PresencePipe != "" {
+		go servePresence(ctx, cfg.PresencePipe, writeLine)
+	}
+	if cfg.BackendBaseURL != "" && cfg.RemoteCommands && !cfg.DryRun {
+		go remoteCommandLoop(ctx, cfg, control, writeLine)
+	}
+	if cfg.DomainTracking {
+		go domains.serve(ctx, cfg.DomainListen, writeLine)
+	}
+	var rawSamples *sampleUploader
+	if cfg.BackendBaseURL != "" && cfg.RawSamples && !cfg.DryRun {
+		rawSamples = newSampleUploader()
+		go rawSamples.loop(ctx, cfg, writeLine)
+	}
+
+	mode := ""
+	if cfg.DryRun {
+		mode = " DRY-RUN (no network writes)"
+	}
+	writeLine(fmt.Sprintf("[%s] START %s host=%s user=%s team=%s labels=%v rqlite=%s windowed=%t hourly=%t profile=%s%s", time.Now().Format(time.RFC3339), buildLabel(), cfg.HostName, cfg.UserName, cfg.Team, cfg.Labels, cfg.RqliteBaseURL, cfg.WindowedPipeline, cfg.HourlyPipeline, profileName(profile), mode))
+	if chaos.enabled() {
+		writeLine(fmt.Sprintf("[%s] CHAOS %s", time.Now().Format(time.RFC3339), chaos))
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			writeLine(fmt.Sprintf("[%s] STOP", time.Now().Format(time.RFC3339)))
+			// Shutdown (Ctrl+C, logoff, OS power-off or service stop):
+			// flush the partial hour and anything still pending so the
+			// last minutes before power-off are not lost.
+			now := chaos.now()
+			if cfg.HourlyPipeline && samplesInHour > 0 {
+				elapsed := float64(samplesInHour) * cfg.SampleEvery.Seconds() // samples are weighted, see sampleWeight
+				activityPct := activityPctFor(idleSecondsInHour, elapsed)
+				row := hourRow(activityPct)
+				pending = append(pending, row)
+				// for a restart within the hour, see partialhour.go
+				if err := savePartialHour(row, bucket.held(now)); err != nil {
+					writeLine(fmt.Sprintf("[%s] RESUME cannot save %s: %v", now.Format(time.RFC3339), partialHourPath(), err))
+				}
+			}
+			titles.closeHour()
+			if s := focus.close(cfg); cfg.FocusSessions && s != nil {
+				writeLine(fmt.Sprintf("[%s] %s", now.Format(time.RFC3339), s))
+			}
+			uploadPending(now)
+			if s := mouseMoves.summary(); s != "" {
+				writeLine(fmt.Sprintf("[%s] %s", now.Format(time.RFC3339), s))
+			}
+			// the last input before shutdown
+			if s := dayInput.summary(); s != "" {
+				writeLine(fmt.Sprintf("[%s] %s", now.Format(time.RFC3339), s))
+			}
+			writeLine(fmt.Sprintf("[%s] STOP", now.Format(time.RFC3339)))
 			return
 
 		case <-flushTicker.C:
 			rot.Sync()
 
+		case next := <-poll.updates:
+			ts := time.Now().Format(time.RFC3339)
+			if next.SampleEvery <= 0 || next.FlushEvery <= 0 {
+				writeLine(fmt.Sprintf("[%s] CONFIG reload ignored: SampleEvery and FlushEvery must be positive", ts))
+				continue
+			}
+			next, skipped := applyConfig(cfg, next)
+			base = pseudonymize(next)
+			profile = profileAt(base.Profiles, time.Now().In(zone))
+			reconfigure(withProfile(base, profile), ts)
+			writeLine(fmt.Sprintf("[%s] CONFIG reloaded host=%s user=%s team=%s labels=%v rqlite=%s profile=%s", ts, cfg.HostName, cfg.UserName, cfg.Team, cfg.Labels, cfg.RqliteBaseURL, profileName(profile)))
+			if len(skipped) > 0 {
+				writeLine(fmt.Sprintf("[%s] CONFIG restart required to apply %v", ts, skipped))
+			}
+
+		case req := <-control:
+			now := chaos.now()
+			switch req.cmd {
+			case "status":
+				state := "running"
+				if now.Before(pausedUntil) {
+					state = "paused until " + pausedUntil.Format(time.RFC3339)
+				}
+				if consentRequired.Load() {
+					state = "waiting for consent"
+				}
+				elapsed := float64(samplesInHour) * cfg.SampleEvery.Seconds()
+				req.reply <- fmt.Sprintf("ok host=%s user=%s version=%s commit=%s state=%q profile=%s hour=%s activity=%.0f%% idleSeconds=%.0f samples=%d pending=%d sampling=%s uploaded=%dB wire=%dB ratio=%.1f",
+					cfg.HostName, cfg.UserName, agentVersion, orUnknown(agentCommit), state, profileName(profile), hourStart.Format(time.RFC3339),
+					activityPctFor(idleSecondsInHour, elapsed), idleSecondsInHour, samplesInHour, len(pending), interval,
+					uploads.raw.Load(), uploads.wire.Load(), uploads.ratio())
+			case "pause":
+				d, err := parsePause(req.arg)
+				if err != nil {
+					req.reply <- "error: " + err.Error()
+					continue
+				}
+				pausedUntil = now.Add(d)
+				writeLine(fmt.Sprintf("[%s] PAUSED until %s", now.Format(time.RFC3339), pausedUntil.Format(time.RFC3339)))
+				req.reply <- "ok paused until " + pausedUntil.Format(time.RFC3339)
+			case "resume":
+				if now.Before(pausedUntil) {
+					writeLine(fmt.Sprintf("[%s] RESUMED", now.Format(time.RFC3339)))
+				}
+				pausedUntil = time.Time{}
+				req.reply <- "ok running"
+			case "flush":
+				n := len(pending)
+				uploadPending(now)
+				rot.Sync()
+				req.reply <- fmt.Sprintf("ok flushed log, uploaded %d pending rows", n)
+			case "reload-config":
+				if err := poll.reload(ctx); err != nil {
+					req.reply <- "error: " + err.Error()
+					continue
+				}
+				req.reply <- "ok reload requested"
+			case "rotate-log":
+				aside, err := rot.Rotate(time.Now())
+				if err != nil {
+					req.reply <- "error: " + err.Error()
+					continue
+				}
+				writeLine(fmt.Sprintf("[%s] LOG rotated, previous file %s", now.Format(time.RFC3339), aside))
+				req.reply <- "ok previous log at " + aside
+			case "send-logs":
+				if cfg.BackendBaseURL == "" {
+					req.reply <- "error: send-logs needs BackendBaseURL"
+					continue
+				}
+				if cfg.DryRun {
+					req.reply <- "error: send-logs is disabled in dry-run mode"
+					continue
+				}
+				rot.Sync()
+				sctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+				n, err := sendLogs(sctx, cfg, rot)
+				cancel()
+				if err != nil {
+					req.reply <- fmt.Sprintf("error: sent %d lines: %v", n, err)
+					continue
+				}
+				req.reply <- fmt.Sprintf("ok sent %d log lines", n)
+			default:
+				req.reply <- fmt.Sprintf("error: unknown command %q (want %s)", req.cmd, controlCommands)
+			}
+
 		case now := <-ticker.C:
+			now = now.Add(chaos.clockSkew)
 			ts := now.Format(time.RFC3339)
-
-			// Hour rollover: compute + INSERT once per hour
-			curHour := now.Truncate(time.Hour)
+			step, jump := clock.tick(now, interval)
+
+			// Hour rollover: compute + INSERT once per hour. A clock set
+			// back into an earlier hour keeps filling the current bucket,
+			// which may already be partly uploaded, until the wall clock
+			// catches up; a clock set forward closes it early.
+			curHour := bucketStart(now)
+			if jump != 0 {
+				writeLine(fmt.Sprintf("[%s] CLOCK_JUMP delta=%s expected=%s hour=%s",
+					ts, jump.Round(time.Second), now.Add(-jump).Format(time.RFC3339), hourStart.Format(time.RFC3339)))
+			}
 			if curHour.After(hourStart) {
-				activityPct := 0.0
-				if samplesInHour > 0 {
-					idleRatio := idleSecondsInHour / 3600.0
-					if idleRatio < 0 {
-						idleRatio = 0
+				if cfg.HourlyPipeline {
+					activityPct := 0.0
+					if samplesInHour > 0 {
+						// 3600 unless the hour was shared, see sessionuser.go
+						activityPct = activityPctFor(idleSecondsInHour, bucket.held(hourStart.Add(time.Hour)))
+					}
+					row := hourRow(activityPct)
+					if row.synthetic.suspected {
+						writeLine(fmt.Sprintf("[%s] SYNTHETIC_INPUT hour=%s source=%s confidence=%.2f",
+							ts, hourStart.Format(time.RFC3339), row.synthetic.source, row.synthetic.confidence))
 					}
-					if idleRatio > 1 {
-						idleRatio = 1
+					pending = append(pending, row)
+					if firstUpload {
+						uploadNotBefore = now.Add(randomDelay(cfg.InitialUploadJitter))
+						firstUpload = false
+					} else {
+						uploadNotBefore = now.Add(flushOffset)
 					}
-					activityPct = (1.0 - idleRatio) * 100.0
 				}
 
-				status := statusFor(activityPct, samplesInHour)
+				// Reset counters for the new hour
+				titles.closeHour()
+				hourStart = curHour
+				resetHour()
+				bucket.from, bucket.heldBefore = curHour, 0
+				clear(parked)
+				if !cfg.HourlyPipeline {
+					takeInputEvents()
+				}
+				refreshScreens(now)
+			}
 
-				if err := insertHourly(httpClient, cfg, hourStart, activityPct, idleSecondsInHour, samplesInHour, status, now); err != nil {
-					writeLine(fmt.Sprintf("[%s] RQLITE insert error: %v", ts, err))
-				} else {
-					writeLine(fmt.Sprintf("[%s] RQLITE insert ok: hour=%s activity=%.0f%% idleSeconds=%.0f samples=%d status=%s",
-						ts,
-						hourStart.UTC().Format("2006-01-02T15:00:00Z"),
-						activityPct,
-						idleSecondsInHour,
-						samplesInHour,
-						status,
-					))
+			// Shared workstation: another console user closes the current
+			// user's share of the hour and resumes their own, if any
+			if cfg.SessionUser {
+				if user, display, ok := sessionIdentity(cfg, consoleUser()); ok && user != bucket.user {
+					writeLine(fmt.Sprintf("[%s] SESSION_USER %s -> %s", ts, orUnknown(bucket.user), user))
+					held := bucket.held(now)
+					row := hourRow(activityPctFor(idleSecondsInHour, held))
+					if cfg.HourlyPipeline && samplesInHour > 0 {
+						pending = append(pending, row)
+					}
+					bucket.heldBefore, bucket.row = held, row
+					parked[bucket.user] = bucket
+					next, seen := parked[user]
+					if seen {
+						resumeHour(next.row)
+					} else {
+						resetHour()
+						next = userBucket{user: user, display: display}
+					}
+					next.from = now
+					bucket = next
 				}
+			}
 
-				// Reset counters for the new hour
-				hourStart = curHour
-				idleSecondsInHour = 0
-				samplesInHour = 0
+			if !now.Before(uploadNotBefore) {
+				uploadPending(now)
+			}
+
+			if p := profileAt(base.Profiles, now.In(zone)); profileName(p) != profileName(profile) {
+				writeLine(fmt.Sprintf("[%s] PROFILE %s -> %s", ts, profileName(profile), profileName(p)))
+				profile = p
+				reconfigure(withProfile(base, p), ts)
+			}
+			// an Off profile samples nothing, and input counted meanwhile
+			// is dropped
+			if profile != nil && profile.Off {
+				takeInputEvents()
+				continue
+			}
+			// nor does a user who has not consented to the collection
+			// policy, when the backend requires it
+			if consentRequired.Load() {
+				takeInputEvents()
+				continue
+			}
+
+			// Paused ticks count as idle without samples, so a pause never
+			// inflates the hour's activity
+			if !pausedUntil.IsZero() {
+				if now.Before(pausedUntil) {
+					idleSecondsInHour += step.Seconds()
+					if cfg.EWMAHalfLife > 0 {
+						ewma.add(windowSample{at: now})
+					}
+					continue
+				}
+				pausedUntil = time.Time{}
+				writeLine(fmt.Sprintf("[%s] RESUMED (pause expired)", ts))
+			}
+
+			titles.sample(cfg, now, hourStart)
+
+			// Power source, for correlating idle policies with battery use
+			if ps, err := getPowerState(); err == nil {
+				if ps.onBattery {
+					batterySecondsInHour += step.Seconds()
+				}
+				batteryPctInHour = ps.batteryPct
 			}
 
 			// Poll idle time and update hourly counters
 			idleNow, idleErr := getIdleDuration()
+			// after repeated failures, fall back to cursor movement
+			idleNow, measured, degraded := fallback.idle(cfg, now, idleNow, idleErr, writeLine)
+			if measured {
+				idleErr = nil
+			}
+			if degraded {
+				degradedSecondsInHour += step.Seconds()
+			}
 			idleStr := "unknown"
 			if idleErr == nil {
 				idleStr = idleNow.String()
-				samplesInHour++
+				input := now.Add(-idleNow)
+				if s := dayInput.observe(now.In(zone), input.In(zone)); s != "" {
+					writeLine(fmt.Sprintf("[%s] %s", now.Format(time.RFC3339), s))
+				}
+				if !input.Before(hourStart) {
+					inputsInHour.add(input.Truncate(time.Second))
+				}
+				if d, ok := breaks.observe(cfg, idleNow); ok {
+					breaksInHour++
+					breakSecondsInHour += d.Seconds()
+					writeLine(fmt.Sprintf("[%s] BREAK %s", now.Format(time.RFC3339), d.Truncate(time.Second)))
+				}
+				// a slow tick stands for several SampleEvery samples
+				n := sampleWeight(interval, cfg.SampleEvery)
+				samplesInHour += n
 				// NOTE: your original logic counts "idle seconds" when idle >= threshold
 				// If you intended the opposite (count idle when user IS idle), keep as-is.
-				if idleNow >= cfg.ActiveIfIdleLessThan {
-					idleSecondsInHour += cfg.SampleEvery.Seconds()
+				if interval == cfg.SampleEvery {
+					if idleNow >= cfg.ActiveIfIdleLessThan {
+						idleSecondsInHour += step.Seconds()
+					}
+				} else {
+					// the user was idle when the slow tick was armed, so
+					// everything up to the last input counts as idle
+					idleSecondsInHour += slowTickIdle(step, idleNow).Seconds()
+				}
+				if rawSamples != nil {
+					rawSamples.add(now, idleNow, step, bucket.user)
+				}
+				if cfg.EWMAHalfLife > 0 {
+					ewma.add(windowSample{at: now, active: idleNow < cfg.ActiveIfIdleLessThan})
+				}
+				active := idleNow < cfg.ActiveIfIdleLessThan
+				process := ""
+				if (cfg.TrackAppCategories || cfg.DomainTracking || cfg.FocusSessions) && active {
+					process = apps.foreground()
+					if c := appCategory(cfg, process); cfg.TrackAppCategories && c != "" {
+						categorySecondsInHour[c] += step.Seconds()
+					}
+					if d := domains.current(cfg, process); cfg.DomainTracking && d != "" {
+						if _, seen := domainSecondsInHour[d]; !seen && len(domainSecondsInHour) >= maxDomainsPerHour {
+							d = otherCategory
+						}
+						domainSecondsInHour[d] += step.Seconds()
+					}
+				}
+				if cfg.FocusSessions {
+					if s := focus.observe(cfg, now, step, active, process, bucket.user); s != nil {
+						writeLine(fmt.Sprintf("[%s] %s", ts, s))
+					}
+				}
+				if cfg.WindowedPipeline {
+					window.observe(cfg, now, idleNow, n, inputKind(lastInputKind.Load()), writeLine)
+				}
+				lastPresence.Store(&presence{LastInput: input.UTC().Truncate(time.Second).Format(time.RFC3339), Mode: window.mode,
+					Host: cfg.HostName, User: cfg.UserName, At: now})
+
+				if next := nextInterval(cfg, interval, idleNow); next != interval {
+					writeLine(fmt.Sprintf("[%s] SAMPLING every %s idleNow=%s lastInput=%s", ts, next, idleStr, inputKind(lastInputKind.Load())))
+					interval = next
+					ticker.Reset(interval)
 				}
 			}
 
+			// Own footprint, every status interval
+			if cfg.PrintStatusEvery > 0 && now.Sub(lastSelfStatsAt) >= cfg.PrintStatusEvery {
+				if st, err := readSelfStats(); err != nil {
+					writeLine(fmt.Sprintf("[%s] SELF error: %v", ts, err))
+				} else {
+					lastSelfStats.Store(&st)
+					writeLine(fmt.Sprintf("[%s] SELF %s", ts, st))
+				}
+				lastSelfStatsAt = now
+			}
+
 			// Mouse move event logging (file only)
 			p, err := getMousePos()
 			if err != nil {
 				writeLine(fmt.Sprintf("[%s] GetCursorPos error: %v", ts, err))
 				continue
 			}
+			mon, local, onScreen := screens.at(p)
+			if !onScreen && now.Sub(screensRefreshed) >= time.Minute {
+				refreshScreens(now)
+				mon, local, onScreen = screens.at(p)
+			}
+			monName := "unknown"
+			if onScreen {
+				monName = mon.name
+				if idleErr == nil && idleNow < cfg.ActiveIfIdleLessThan {
+					monitorSecondsInHour[mon.name] += step.Seconds()
+				}
+			}
 			if p.X == lastMouse.X && p.Y == lastMouse.Y {
 				continue
 			}
@@ -411,10 +1500,13 @@ func main() {
 				prevMoveStr = lastMouseMoveAt.UTC().Format(time.RFC3339)
 			}
 
-			if cfg.PrintMouseMoveEvery == 0 || lastMousePrint.IsZero() || now.Sub(lastMousePrint) >= cfg.PrintMouseMoveEvery {
-				writeLine(fmt.Sprintf("[%s] EVENT=MOUSE_MOVE pos=(%d,%d) prevMouseMoveAt=%s idleNow=%s",
-					ts, p.X, p.Y, prevMoveStr, idleStr))
-				lastMousePrint = now
+			print, summary := mouseMoves.move(cfg, now, lastMouse, p)
+			if summary != "" {
+				writeLine(fmt.Sprintf("[%s] %s", ts, summary))
+			}
+			if print {
+				writeLine(fmt.Sprintf("[%s] EVENT=MOUSE_MOVE pos=(%d,%d) monitor=%s local=(%d,%d) prevMouseMoveAt=%s idleNow=%s",
+					ts, p.X, p.Y, monName, local.X, local.Y, prevMoveStr, idleStr))
 			}
 
 			lastMouse = p
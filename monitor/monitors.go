@@ -0,0 +1,108 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfoW     = user32.NewProc("GetMonitorInfoW")
+)
+
+const monitorInfoFPrimary = 0x1
+
+type RECT struct {
+	Left, Top, Right, Bottom int32
+}
+
+type MONITORINFOEX struct {
+	CbSize    uint32
+	RcMonitor RECT
+	RcWork    RECT
+	DwFlags   uint32
+	SzDevice  [32]uint16
+}
+
+// monitor is one display in virtual-desktop coordinates, which go negative
+// for screens left of or above the primary one.
+type monitor struct {
+	name    string // device name without the \\.\ prefix, e.g. DISPLAY2
+	rect    RECT
+	primary bool
+}
+
+func (m monitor) contains(p POINT) bool {
+	return p.X >= m.rect.Left && p.X < m.rect.Right && p.Y >= m.rect.Top && p.Y < m.rect.Bottom
+}
+
+// monitors is the display layout, refreshed at every hour rollover and
+// whenever the cursor lands outside all known screens (a display was
+// plugged in or rearranged).
+type monitors []monitor
+
+// at returns the monitor holding p and p relative to its top-left corner.
+func (ms monitors) at(p POINT) (monitor, POINT, bool) {
+	for _, m := range ms {
+		if m.contains(p) {
+			return m, POINT{X: p.X - m.rect.Left, Y: p.Y - m.rect.Top}, true
+		}
+	}
+	return monitor{}, p, false
+}
+
+func (ms monitors) String() string {
+	parts := make([]string, len(ms))
+	for i, m := range ms {
+		primary := ""
+		if m.primary {
+			primary = "*"
+		}
+		parts[i] = fmt.Sprintf("%s%s(%d,%d %dx%d)", m.name, primary,
+			m.rect.Left, m.rect.Top, m.rect.Right-m.rect.Left, m.rect.Bottom-m.rect.Top)
+	}
+	return strings.Join(parts, " ")
+}
+
+// enumMonitorsFound collects monitors during one EnumDisplayMonitors call;
+// the callback is created once since Windows callbacks are never freed.
+var (
+	enumMonitorsFound    monitors
+	enumMonitorsCallback = windows.NewCallback(func(hMonitor, hdc, rect, data uintptr) uintptr {
+		var mi MONITORINFOEX
+		mi.CbSize = uint32(unsafe.Sizeof(mi))
+		if r1, _, _ := procGetMonitorInfoW.Call(hMonitor, uintptr(unsafe.Pointer(&mi))); r1 != 0 {
+			enumMonitorsFound = append(enumMonitorsFound, monitor{
+				name:    strings.TrimPrefix(windows.UTF16ToString(mi.SzDevice[:]), `\\.\`),
+				rect:    mi.RcMonitor,
+				primary: mi.DwFlags&monitorInfoFPrimary != 0,
+			})
+		}
+		return 1 // continue enumeration
+	})
+)
+
+// listMonitors enumerates the displays, ordered left to right. Only the
+// sampling loop calls it.
+func listMonitors() (monitors, error) {
+	enumMonitorsFound = nil
+	r1, _, err := procEnumDisplayMonitors.Call(0, 0, enumMonitorsCallback, 0)
+	if r1 == 0 {
+		return nil, err
+	}
+	ms := enumMonitorsFound
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].rect.Left != ms[j].rect.Left {
+			return ms[i].rect.Left < ms[j].rect.Left
+		}
+		return ms[i].rect.Top < ms[j].rect.Top
+	})
+	return ms, nil
+}
@@ -0,0 +1,65 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// mouseMoveLog decides which cursor moves become EVENT=MOUSE_MOVE lines
+// and counts all of them for the daily MOUSE_MOVE_SUMMARY line. A move is
+// logged when PrintMouseMoveEvery has passed since the last logged one
+// and the cursor is at least PrintMouseMoveMinDistance pixels away from
+// it; MouseMoveSummary logs no moves at all, only the summary.
+type mouseMoveLog struct {
+	lastPrint   time.Time
+	lastPrinted POINT
+
+	day      string // local day being counted
+	moves    int
+	distance float64 // pixels travelled
+	logged   int
+}
+
+// move records a move from -> to and reports whether it should be logged.
+// summary is the previous day's summary line when this is the first move
+// of a new day.
+func (m *mouseMoveLog) move(cfg Config, now time.Time, from, to POINT) (print bool, summary string) {
+	if day := now.Format("2006-01-02"); day != m.day {
+		summary = m.summary()
+		m.day, m.moves, m.distance, m.logged = day, 0, 0, 0
+	}
+	m.moves++
+	m.distance += pixelDistance(from, to)
+
+	if cfg.MouseMoveSummary {
+		return false, summary
+	}
+	if !m.lastPrint.IsZero() {
+		if cfg.PrintMouseMoveEvery > 0 && now.Sub(m.lastPrint) < cfg.PrintMouseMoveEvery {
+			return false, summary
+		}
+		if cfg.PrintMouseMoveMinDistance > 0 && pixelDistance(m.lastPrinted, to) < float64(cfg.PrintMouseMoveMinDistance) {
+			return false, summary
+		}
+	}
+	m.lastPrint, m.lastPrinted = now, to
+	m.logged++
+	return true, summary
+}
+
+// summary returns the counted day's MOUSE_MOVE_SUMMARY body, or "" before
+// the first move.
+func (m *mouseMoveLog) summary() string {
+	if m.day == "" {
+		return ""
+	}
+	return fmt.Sprintf("MOUSE_MOVE_SUMMARY day=%s moves=%d distance=%.0fpx logged=%d", m.day, m.moves, m.distance, m.logged)
+}
+
+func pixelDistance(a, b POINT) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+)
+
+var procMessageBoxW = user32.NewProc("MessageBoxW")
+
+const (
+	mbOK            = 0x00000000
+	mbIconWarning   = 0x00000030
+	mbSetForeground = 0x00010000
+	mbTopmost       = 0x00040000
+)
+
+// notifyUser shows a non-blocking warning box on the interactive desktop.
+// Under the service there is no desktop to show it on (session 0), so the
+// log line written by the caller is all there is.
+func notifyUser(title, message string) {
+	if isService, err := svc.IsWindowsService(); err != nil || isService {
+		return
+	}
+	t, err := windows.UTF16PtrFromString(title)
+	if err != nil {
+		return
+	}
+	m, err := windows.UTF16PtrFromString(message)
+	if err != nil {
+		return
+	}
+	go procMessageBoxW.Call(0, uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(t)),
+		mbOK|mbIconWarning|mbSetForeground|mbTopmost)
+}
@@ -0,0 +1,137 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// savedHour is the partial hour written at shutdown. The row is uploaded
+// then as well, but activity_hourly keeps one row per hour, host and
+// user: an agent restarted within the same hour would replace it at
+// rollover with the minutes after the restart only. Reloading the
+// counters instead makes that row cover the whole hour.
+type savedHour struct {
+	HourStart   time.Time `json:"hour_start"`
+	LocalHour   string    `json:"local_hour"`
+	UserName    string    `json:"user_name"`
+	DisplayName string    `json:"display_name,omitempty"`
+	// seconds the user held the hour before shutdown, the span
+	// activity_pct is computed over; the agent's downtime is left out
+	Held float64 `json:"held"`
+
+	ActivityPct     float64            `json:"activity_pct"`
+	IdleSeconds     float64            `json:"idle_seconds"`
+	Samples         int                `json:"samples"`
+	Status          string             `json:"status"`
+	BatterySeconds  float64            `json:"battery_seconds"`
+	BatteryPct      int                `json:"battery_pct"`
+	MonitorSeconds  map[string]float64 `json:"monitor_seconds"`
+	EWMAPct         float64            `json:"ewma_pct"`
+	DegradedSeconds float64            `json:"degraded_seconds"`
+	CategorySeconds map[string]float64 `json:"category_seconds"`
+	DomainSeconds   map[string]float64 `json:"domain_seconds"`
+	FirstInput      time.Time          `json:"first_input"`
+	LastInput       time.Time          `json:"last_input"`
+	Breaks          int                `json:"breaks"`
+	BreakSeconds    float64            `json:"break_seconds"`
+
+	MouseEvents int64 `json:"mouse_events"`
+	KeyEvents   int64 `json:"key_events"`
+	TouchEvents int64 `json:"touch_events"`
+}
+
+func partialHourPath() string {
+	return filepath.Join(filepath.Dir(configPath()), "partial-hour.json")
+}
+
+// savePartialHour writes row, held for held seconds, for the next start.
+func savePartialHour(row hourlyRow, held float64) error {
+	blob, err := json.Marshal(savedHour{
+		HourStart:   row.hourStart.UTC(),
+		LocalHour:   row.localHour,
+		UserName:    row.userName,
+		DisplayName: row.displayName,
+		Held:        held,
+
+		ActivityPct:     row.activityPct,
+		IdleSeconds:     row.idleSeconds,
+		Samples:         row.samples,
+		Status:          row.status,
+		BatterySeconds:  row.batterySeconds,
+		BatteryPct:      row.batteryPct,
+		MonitorSeconds:  row.monitorSeconds,
+		EWMAPct:         row.ewmaPct,
+		DegradedSeconds: row.degradedSeconds,
+		CategorySeconds: row.categorySeconds,
+		DomainSeconds:   row.domainSeconds,
+		FirstInput:      row.inputs.first,
+		LastInput:       row.inputs.last,
+		Breaks:          row.breaks,
+		BreakSeconds:    row.breakSeconds,
+
+		MouseEvents: row.mouse,
+		KeyEvents:   row.key,
+		TouchEvents: row.touch,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partialHourPath(), blob, 0o600)
+}
+
+// takePartialHour reads and removes the hour saved at the last shutdown;
+// ok is false when there is none. The input timings behind the synthetic
+// verdict are not kept, so a resumed hour is judged on what follows.
+func takePartialHour() (row hourlyRow, held float64, ok bool, err error) {
+	path := partialHourPath()
+	blob, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return hourlyRow{}, 0, false, nil
+	}
+	if err != nil {
+		return hourlyRow{}, 0, false, err
+	}
+	// read once: a crash later in the hour must not resume it twice
+	if err := os.Remove(path); err != nil {
+		return hourlyRow{}, 0, false, err
+	}
+	var s savedHour
+	if err := json.Unmarshal(blob, &s); err != nil || s.HourStart.IsZero() {
+		return hourlyRow{}, 0, false, errors.New(path + ": not a saved hour")
+	}
+	// the hour's counters are written to, never nil
+	for _, m := range []*map[string]float64{&s.MonitorSeconds, &s.CategorySeconds, &s.DomainSeconds} {
+		if *m == nil {
+			*m = make(map[string]float64)
+		}
+	}
+	return hourlyRow{
+		hourStart:   s.HourStart,
+		localHour:   s.LocalHour,
+		userName:    s.UserName,
+		displayName: s.DisplayName,
+		activityPct: s.ActivityPct,
+		idleSeconds: s.IdleSeconds,
+		samples:     s.Samples,
+		status:      s.Status,
+
+		batterySeconds:  s.BatterySeconds,
+		batteryPct:      s.BatteryPct,
+		monitorSeconds:  s.MonitorSeconds,
+		ewmaPct:         s.EWMAPct,
+		degradedSeconds: s.DegradedSeconds,
+		categorySeconds: s.CategorySeconds,
+		domainSeconds:   s.DomainSeconds,
+		inputs:          inputSpan{first: s.FirstInput, last: s.LastInput},
+		breaks:          s.Breaks,
+		breakSeconds:    s.BreakSeconds,
+
+		inputEvents: inputEvents{mouse: s.MouseEvents, key: s.KeyEvents, touch: s.TouchEvents},
+	}, s.Held, true, nil
+}
@@ -0,0 +1,80 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPartialHourRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ACTIVITY_MONITOR_CONFIG", filepath.Join(dir, "config.json"))
+
+	if _, _, ok, err := takePartialHour(); ok || err != nil {
+		t.Fatalf("nothing saved: ok=%v err=%v", ok, err)
+	}
+
+	hour := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	row := hourlyRow{
+		hourStart:       hour,
+		localHour:       "2026-02-02T10:00:00+01:00",
+		userName:        "alice",
+		displayName:     "Alice",
+		activityPct:     75,
+		idleSeconds:     300,
+		samples:         1200,
+		status:          "ACTIVE",
+		batterySeconds:  60,
+		batteryPct:      -1,
+		monitorSeconds:  map[string]float64{"DISPLAY1": 900},
+		ewmaPct:         70,
+		degradedSeconds: 5,
+		categorySeconds: map[string]float64{"dev": 800},
+		domainSeconds:   map[string]float64{},
+		inputs:          inputSpan{first: hour.Add(time.Minute), last: hour.Add(19 * time.Minute)},
+		breaks:          1,
+		breakSeconds:    360,
+		inputEvents:     inputEvents{mouse: 40, key: 900, touch: 2},
+	}
+	if err := savePartialHour(row, 1200); err != nil {
+		t.Fatal(err)
+	}
+
+	got, held, ok, err := takePartialHour()
+	if err != nil || !ok {
+		t.Fatalf("take: ok=%v err=%v", ok, err)
+	}
+	if held != 1200 {
+		t.Errorf("held = %v, want 1200", held)
+	}
+	if !reflect.DeepEqual(got, row) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, row)
+	}
+
+	// taken once only
+	if _, err := os.Stat(partialHourPath()); !os.IsNotExist(err) {
+		t.Errorf("saved hour left behind: %v", err)
+	}
+	if _, _, ok, _ := takePartialHour(); ok {
+		t.Error("saved hour taken twice")
+	}
+}
+
+func TestPartialHourCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ACTIVITY_MONITOR_CONFIG", filepath.Join(dir, "config.json"))
+	if err := os.WriteFile(partialHourPath(), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, err := takePartialHour(); ok || err == nil {
+		t.Errorf("corrupt file: ok=%v err=%v", ok, err)
+	}
+	if _, err := os.Stat(partialHourPath()); !os.IsNotExist(err) {
+		t.Errorf("corrupt file left behind: %v", err)
+	}
+}
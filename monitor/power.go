@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"unsafe"
+)
+
+var procGetSystemPowerStatus = kernel32.NewProc("GetSystemPowerStatus")
+
+type SYSTEM_POWER_STATUS struct {
+	ACLineStatus        byte // 0 battery, 1 AC, 255 unknown
+	BatteryFlag         byte // 128 no system battery, 255 unknown
+	BatteryLifePercent  byte // 255 unknown
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// powerState is one GetSystemPowerStatus reading.
+type powerState struct {
+	onBattery  bool
+	batteryPct int // -1 without a battery or when unknown
+}
+
+func getPowerState() (powerState, error) {
+	var sps SYSTEM_POWER_STATUS
+	r1, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&sps)))
+	if r1 == 0 {
+		return powerState{batteryPct: -1}, err
+	}
+	ps := powerState{onBattery: sps.ACLineStatus == 0, batteryPct: -1}
+	if sps.BatteryFlag != 128 && sps.BatteryFlag != 255 && sps.BatteryLifePercent <= 100 {
+		ps.batteryPct = int(sps.BatteryLifePercent)
+	}
+	return ps, nil
+}
@@ -0,0 +1,86 @@
+//go:build windows
+// +build windows
+
+// Package presence reads the agent's presence pipe, so that other local
+// software (a screensaver, a chat client) can reuse the agent's idle
+// detection instead of polling the system itself:
+//
+//	s, err := presence.Query(presence.DefaultPipe, 2*time.Second)
+//	if err == nil && s.Idle() > 5*time.Minute {
+//		// start the screensaver
+//	}
+//
+// The agent writes one JSON line per connection and hangs up; the pipe is
+// read-only and local.
+package presence
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// DefaultPipe is the agent's default PresencePipe.
+const DefaultPipe = "ActivityMonitorPresence"
+
+// Status is the line the agent sends.
+type Status struct {
+	Host string `json:"host"`
+	User string `json:"user"`
+	// windowed mode (HIGH_PRODUCTIVE, LOW, ...); empty unless the agent
+	// runs with WindowedPipeline
+	Mode      string    `json:"mode,omitempty"`
+	LastInput time.Time `json:"last_input"`
+	// idle time when the agent answered
+	IdleMs int64 `json:"idle_ms"`
+	// the agent's last sample; it stops moving while the agent is paused
+	// or off by profile
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// Idle is the user's idle time when the agent answered.
+func (s Status) Idle() time.Duration {
+	return time.Duration(s.IdleMs) * time.Millisecond
+}
+
+// Query connects to the agent's presence pipe and reads its Status,
+// retrying a busy pipe until timeout.
+func Query(pipe string, timeout time.Duration) (Status, error) {
+	var s Status
+	path, err := windows.UTF16PtrFromString(`\\.\pipe\` + pipe)
+	if err != nil {
+		return s, err
+	}
+	deadline := time.Now().Add(timeout)
+	var h windows.Handle
+	for {
+		h, err = windows.CreateFile(path, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, 0, 0)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, windows.ERROR_PIPE_BUSY) && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			return s, fmt.Errorf("agent not running or PresencePipe disabled (no pipe %s)", pipe)
+		}
+		return s, err
+	}
+	f := os.NewFile(uintptr(h), pipe)
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return s, fmt.Errorf("no reply from agent: %w", err)
+	}
+	if err := json.Unmarshal(line, &s); err != nil {
+		return s, fmt.Errorf("bad reply from agent: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	presenceapi "idle/presence"
+
+	"golang.org/x/sys/windows"
+)
+
+// servePresence answers every client of the PresencePipe named pipe with
+// one presenceapi.Status line, until ctx is done. Unlike the control pipe
+// it is read-only and open to interactive users, so a screensaver running
+// in the user's session can read it.
+func servePresence(ctx context.Context, name string, writeLine func(string)) {
+	sa, err := pipeSecurity("(A;;GR;;;IU)")
+	if err != nil {
+		writeLine(fmt.Sprintf("[%s] PRESENCE security error: %v", time.Now().Format(time.RFC3339), err))
+		return
+	}
+	servePipe(ctx, "PRESENCE", name, windows.PIPE_ACCESS_OUTBOUND, sa, writeLine, func(h windows.Handle) {
+		f := os.NewFile(uintptr(h), "presence")
+		defer func() {
+			windows.FlushFileBuffers(h)
+			windows.DisconnectNamedPipe(h)
+			f.Close()
+		}()
+		line, err := json.Marshal(presenceStatus(time.Now()))
+		if err != nil {
+			return
+		}
+		f.Write(append(line, '\n'))
+	})
+}
+
+// presenceStatus is the latest sample's presence as of now.
+func presenceStatus(now time.Time) presenceapi.Status {
+	p := lastPresence.Load()
+	if p == nil {
+		return presenceapi.Status{}
+	}
+	s := presenceapi.Status{Host: p.Host, User: p.User, Mode: p.Mode, SampledAt: p.At.UTC().Truncate(time.Second)}
+	if t, err := time.Parse(time.RFC3339, p.LastInput); err == nil {
+		s.LastInput = t
+		s.IdleMs = now.Sub(t).Milliseconds()
+	}
+	return s
+}
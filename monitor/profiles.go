@@ -0,0 +1,147 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ConfigProfile overrides part of the config during a weekly time window,
+// e.g. lighter sampling after hours or nothing at all on weekends. The
+// sampling loop switches profiles by itself; the first profile whose
+// window contains the current time (in TimeZone) wins, and outside all of
+// them the config applies as written.
+type ConfigProfile struct {
+	Name     string
+	Weekdays []int  // 0 = Sunday; empty is every day
+	Start    string // HH:MM, empty is midnight
+	End      string // HH:MM, exclusive; empty is midnight, before Start spans midnight
+	// no sampling at all while active: the hours are uploaded with no
+	// samples, as during a pause
+	Off bool
+	// Config fields as in config.json, e.g. {"SampleEvery": "10s"};
+	// restart-only and identity fields cannot be overridden
+	Settings map[string]json.RawMessage
+}
+
+// profileFixedFields cannot be set by a profile: besides the restart-only
+// ones, identity is pseudonymized once per config load and the zone
+// decides which profile applies.
+var profileFixedFields = append([]string{
+	"Profiles", "TimeZone", "HostName", "UserName", "UserDisplayName", "SessionUser", "Team", "Labels",
+}, restartOnlyFields...)
+
+// parseClock reads HH:MM as minutes since midnight; "" is 0.
+func parseClock(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q: want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validateProfiles checks names, windows and settings, so a bad profile
+// fails the config load instead of a switch hours later.
+func validateProfiles(profiles []ConfigProfile) error {
+	seen := make(map[string]bool)
+	for i, p := range profiles {
+		if p.Name == "" {
+			return fmt.Errorf("Profiles[%d]: Name is required", i)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("Profiles: duplicate name %q", p.Name)
+		}
+		seen[p.Name] = true
+		for _, d := range p.Weekdays {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("Profiles %q: weekday %d out of 0-6", p.Name, d)
+			}
+		}
+		if _, err := parseClock(p.Start); err != nil {
+			return fmt.Errorf("Profiles %q: Start %v", p.Name, err)
+		}
+		if _, err := parseClock(p.End); err != nil {
+			return fmt.Errorf("Profiles %q: End %v", p.Name, err)
+		}
+		for _, name := range profileFixedFields {
+			if _, ok := p.Settings[name]; ok {
+				return fmt.Errorf("Profiles %q: %s cannot be set by a profile", p.Name, name)
+			}
+		}
+		var c Config
+		if err := setConfigFields(&c, p.Settings); err != nil {
+			return fmt.Errorf("Profiles %q: %w", p.Name, err)
+		}
+		for _, name := range []string{"SampleEvery", "FlushEvery"} {
+			if _, ok := p.Settings[name]; ok && reflect.ValueOf(c).FieldByName(name).Int() <= 0 {
+				return fmt.Errorf("Profiles %q: %s must be positive", p.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// covers reports whether the profile's window contains t, read in t's zone.
+func (p ConfigProfile) covers(t time.Time) bool {
+	start, _ := parseClock(p.Start)
+	end, _ := parseClock(p.End)
+	min := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	switch {
+	case start == end: // all day
+	case start < end:
+		if min < start || min >= end {
+			return false
+		}
+	default: // spans midnight: the part after it belongs to the previous day
+		if min < end {
+			day = (day + 6) % 7
+		} else if min < start {
+			return false
+		}
+	}
+	if len(p.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range p.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// profileAt returns the first profile covering t, or nil.
+func profileAt(profiles []ConfigProfile, t time.Time) *ConfigProfile {
+	for i := range profiles {
+		if profiles[i].covers(t) {
+			return &profiles[i]
+		}
+	}
+	return nil
+}
+
+// withProfile returns base with p's settings applied; nil p returns base.
+func withProfile(base Config, p *ConfigProfile) Config {
+	if p == nil {
+		return base
+	}
+	// checked by validateProfiles
+	_ = setConfigFields(&base, p.Settings)
+	return base
+}
+
+// profileName is how logs and the status command name p.
+func profileName(p *ConfigProfile) string {
+	if p == nil {
+		return "default"
+	}
+	return p.Name
+}
@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// pseudonym is the stable token stored instead of a clear identity:
+// "u-" or "h-" and the first 16 hex digits of HMAC-SHA256(site key,
+// kind + NUL + lower-cased value). The backend computes the same tokens
+// (PSEUDONYM_KEY) to keep its admin-only de-anonymization mapping.
+func pseudonym(key, kind, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(kind + "\x00" + strings.ToLower(strings.TrimSpace(value))))
+	return kind[:1] + "-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// pseudonymize replaces HostName and UserName with their pseudonyms and
+// drops UserDisplayName when PseudonymKey is set, before anything is
+// logged, inserted or sent with a heartbeat.
+func pseudonymize(cfg Config) Config {
+	if cfg.PseudonymKey == "" {
+		return cfg
+	}
+	cfg.HostName = pseudonym(cfg.PseudonymKey, "host", cfg.HostName)
+	cfg.UserName = pseudonym(cfg.PseudonymKey, "user", cfg.UserName)
+	cfg.UserDisplayName = ""
+	return cfg
+}
@@ -0,0 +1,258 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procRegisterRawInputDevices = user32.NewProc("RegisterRawInputDevices")
+	procGetRawInputData         = user32.NewProc("GetRawInputData")
+)
+
+const (
+	wmInput = 0x00FF
+
+	ridevInputSink = 0x00000100 // receive input while not in the foreground
+	ridInput       = 0x10000003
+	ridHeader      = 0x10000005
+
+	rimTypeMouse    = 0
+	rimTypeKeyboard = 1
+	rimTypeHID      = 2
+
+	riKeyBreak = 0x01
+
+	mouseMoveAbsolute = 0x01 // RAWMOUSE.usFlags: tablets, remote desktop
+
+	// button-down and wheel flags of RAWMOUSE.usButtonFlags; plain
+	// movement is not counted, it arrives hundreds of times a second
+	riMouseClicksAndWheel = 0x0001 | 0x0004 | 0x0010 | 0x0040 | 0x0100 | 0x0400 | 0x0800
+
+	// touchGap separates touch contacts: digitizers stream reports while
+	// a finger is down, so a burst of reports counts as one touch event
+	touchGap = 100 * time.Millisecond
+)
+
+// hwndMessage is HWND_MESSAGE, the parent of message-only windows.
+const hwndMessage = ^uintptr(2)
+
+type RAWINPUTDEVICE struct {
+	UsUsagePage uint16
+	UsUsage     uint16
+	DwFlags     uint32
+	HwndTarget  windows.HWND
+}
+
+type RAWINPUTHEADER struct {
+	DwType  uint32
+	DwSize  uint32
+	HDevice windows.Handle
+	WParam  uintptr
+}
+
+type RAWMOUSE struct {
+	UsFlags            uint16
+	_                  uint16
+	UsButtonFlags      uint16
+	UsButtonData       uint16
+	UlRawButtons       uint32
+	LLastX             int32
+	LLastY             int32
+	UlExtraInformation uint32
+}
+
+type RAWKEYBOARD struct {
+	MakeCode         uint16
+	Flags            uint16
+	Reserved         uint16
+	VKey             uint16
+	Message          uint32
+	ExtraInformation uint32
+}
+
+// inputKind is the device class of a raw input event.
+type inputKind int32
+
+const (
+	inputNone inputKind = iota
+	inputMouse
+	inputKey
+	inputTouch
+)
+
+func (k inputKind) String() string {
+	switch k {
+	case inputMouse:
+		return "mouse"
+	case inputKey:
+		return "key"
+	case inputTouch:
+		return "touch"
+	}
+	return "unknown"
+}
+
+// inputEvents counts input per device class since the last take, with
+// the verdict on whether it looked machine-made.
+type inputEvents struct {
+	mouse, key, touch int64
+	synthetic         syntheticScore
+}
+
+var (
+	mouseEvents, keyEvents, touchEvents atomic.Int64
+	// lastInputKind is the device behind the most recent raw input,
+	// movement included; GetLastInputInfo only says when, not what
+	lastInputKind atomic.Int32
+)
+
+// takeInputEvents returns the counts so far and starts over.
+func takeInputEvents() inputEvents {
+	return inputEvents{
+		mouse: mouseEvents.Swap(0),
+		key:   keyEvents.Swap(0),
+		touch: touchEvents.Swap(0),
+
+		synthetic: synthetic.take(),
+	}
+}
+
+// putBackInputEvents returns counts taken by takeInputEvents, when a
+// user's parked hour resumes. Input timings cannot be put back, so the
+// resumed hour is judged on what follows.
+func putBackInputEvents(e inputEvents) {
+	mouseEvents.Add(e.mouse)
+	keyEvents.Add(e.key)
+	touchEvents.Add(e.touch)
+}
+
+// watchRawInput registers for mouse, keyboard and touchscreen raw input on
+// a message-only window and counts clicks and wheel notches, key presses
+// and touch contacts. Raw input needs the interactive desktop, so agents
+// running as a service in session 0 see no events and report zeros.
+func watchRawInput(writeLine func(string)) {
+	go func() {
+		runtime.LockOSThread()
+
+		fail := func(what string, err error) {
+			writeLine(fmt.Sprintf("[%s] RAWINPUT %s error: %v", time.Now().Format(time.RFC3339), what, err))
+		}
+
+		var lastTouch time.Time
+		wndProc := func(hwnd windows.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+			if msg == wmInput {
+				countRawInput(lParam, &lastTouch)
+			}
+			r, _, _ := procDefWindowProcW.Call(uintptr(hwnd), uintptr(msg), wParam, lParam)
+			return r
+		}
+
+		var hinst windows.Handle
+		_ = windows.GetModuleHandleEx(0, nil, &hinst)
+
+		className, _ := windows.UTF16PtrFromString("ActivityMonitorRawInput")
+		wc := WNDCLASSEXW{
+			LpfnWndProc:   windows.NewCallback(wndProc),
+			HInstance:     hinst,
+			LpszClassName: className,
+		}
+		wc.CbSize = uint32(unsafe.Sizeof(wc))
+		if r, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+			fail("RegisterClassExW", err)
+			return
+		}
+
+		hwnd, _, err := procCreateWindowExW.Call(0,
+			uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+			0, 0, 0, 0, 0, hwndMessage, 0, uintptr(hinst), 0)
+		if hwnd == 0 {
+			fail("CreateWindowExW", err)
+			return
+		}
+
+		devices := []RAWINPUTDEVICE{
+			{UsUsagePage: 0x01, UsUsage: 0x02, DwFlags: ridevInputSink, HwndTarget: windows.HWND(hwnd)}, // mouse
+			{UsUsagePage: 0x01, UsUsage: 0x06, DwFlags: ridevInputSink, HwndTarget: windows.HWND(hwnd)}, // keyboard
+			{UsUsagePage: 0x0D, UsUsage: 0x04, DwFlags: ridevInputSink, HwndTarget: windows.HWND(hwnd)}, // touch screen
+		}
+		if r, _, err := procRegisterRawInputDevices.Call(uintptr(unsafe.Pointer(&devices[0])),
+			uintptr(len(devices)), unsafe.Sizeof(devices[0])); r == 0 {
+			fail("RegisterRawInputDevices", err)
+			return
+		}
+
+		var m MSG
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			procTranslateMessage.Call(uintptr(unsafe.Pointer(&m)))
+			procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+}
+
+// countRawInput classifies one WM_INPUT message. Touch reports carry
+// device-specific HID data, so only their header is read.
+func countRawInput(hRawInput uintptr, lastTouch *time.Time) {
+	var hdr RAWINPUTHEADER
+	size := uint32(unsafe.Sizeof(hdr))
+	if r, _, _ := procGetRawInputData.Call(hRawInput, ridHeader, uintptr(unsafe.Pointer(&hdr)),
+		uintptr(unsafe.Pointer(&size)), unsafe.Sizeof(hdr)); int32(r) <= 0 {
+		return
+	}
+
+	switch hdr.DwType {
+	case rimTypeMouse:
+		var in struct {
+			hdr   RAWINPUTHEADER
+			mouse RAWMOUSE
+		}
+		size = uint32(unsafe.Sizeof(in))
+		if r, _, _ := procGetRawInputData.Call(hRawInput, ridInput, uintptr(unsafe.Pointer(&in)),
+			uintptr(unsafe.Pointer(&size)), unsafe.Sizeof(hdr)); int32(r) <= 0 {
+			return
+		}
+		lastInputKind.Store(int32(inputMouse))
+		if in.mouse.UsFlags&mouseMoveAbsolute == 0 {
+			synthetic.mouse(time.Now(), in.mouse.LLastX, in.mouse.LLastY)
+		}
+		if n := bits.OnesCount16(in.mouse.UsButtonFlags & riMouseClicksAndWheel); n > 0 {
+			mouseEvents.Add(int64(n))
+		}
+	case rimTypeKeyboard:
+		var in struct {
+			hdr RAWINPUTHEADER
+			kbd RAWKEYBOARD
+		}
+		size = uint32(unsafe.Sizeof(in))
+		if r, _, _ := procGetRawInputData.Call(hRawInput, ridInput, uintptr(unsafe.Pointer(&in)),
+			uintptr(unsafe.Pointer(&size)), unsafe.Sizeof(hdr)); int32(r) <= 0 {
+			return
+		}
+		lastInputKind.Store(int32(inputKey))
+		down := in.kbd.Flags&riKeyBreak == 0
+		if down {
+			keyEvents.Add(1)
+		}
+		synthetic.key(time.Now(), in.kbd.VKey, down)
+	case rimTypeHID:
+		lastInputKind.Store(int32(inputTouch))
+		now := time.Now()
+		if now.Sub(*lastTouch) >= touchGap {
+			touchEvents.Add(1)
+		}
+		*lastTouch = now
+	}
+}
@@ -0,0 +1,169 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// One long poll on GET /agent/commands waits up to remoteCommandWait on
+// the backend; remoteCommandRetry spaces polls after an error, and polls
+// are never closer than remoteCommandMinGap.
+const (
+	remoteCommandWait   = 25 * time.Second
+	remoteCommandRetry  = time.Minute
+	remoteCommandMinGap = 5 * time.Second
+)
+
+// httpStatusError is a non-2xx backend reply.
+type httpStatusError struct {
+	status string
+	code   int
+	body   string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %s body=%s", e.status, e.body)
+}
+
+type remoteCommand struct {
+	ID      int64  `json:"id"`
+	Command string `json:"command"`
+}
+
+// remoteCommandLoop long-polls the backend for admin commands ("flush",
+// "send-logs", ...) and hands each to the sampling loop exactly like the
+// same word on the control pipe, then posts the reply line back. The
+// backend answers within seconds of a command being queued, so an admin
+// does not have to remote into the machine.
+func remoteCommandLoop(ctx context.Context, cfg Config, requests chan<- controlRequest, writeLine func(string)) {
+	client := &http.Client{Timeout: remoteCommandWait + 10*time.Second}
+	for ctx.Err() == nil {
+		started := time.Now()
+		cmds, err := pollCommands(ctx, client, cfg)
+		var se *httpStatusError
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.As(err, &se) && se.code == http.StatusNotFound:
+			writeLine(fmt.Sprintf("[%s] REMOTE commands not supported by the backend, polling stopped", time.Now().Format(time.RFC3339)))
+			return
+		case err != nil:
+			writeLine(fmt.Sprintf("[%s] REMOTE poll error: %v", time.Now().Format(time.RFC3339), err))
+			sleepCtx(ctx, remoteCommandRetry)
+			continue
+		case len(cmds) == 0:
+			sleepCtx(ctx, remoteCommandMinGap-time.Since(started))
+			continue
+		}
+		for _, rc := range cmds {
+			writeLine(fmt.Sprintf("[%s] REMOTE command id=%d %s", time.Now().Format(time.RFC3339), rc.ID, rc.Command))
+			req := controlRequest{cmd: rc.Command, reply: make(chan string, 1)}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+			reply := <-req.reply
+			if err := postCommandResult(ctx, client, cfg, rc.ID, reply); err != nil {
+				writeLine(fmt.Sprintf("[%s] REMOTE result error: id=%d: %v", time.Now().Format(time.RFC3339), rc.ID, err))
+			}
+		}
+	}
+}
+
+// sleepCtx waits d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+func pollCommands(ctx context.Context, client *http.Client, cfg Config) ([]remoteCommand, error) {
+	q := url.Values{"host": {cfg.HostName}, "wait": {remoteCommandWait.String()}}
+	var out struct {
+		Commands []remoteCommand `json:"commands"`
+	}
+	err := backendJSON(ctx, client, cfg, http.MethodGet, "/agent/commands?"+q.Encode(), nil, &out)
+	return out.Commands, err
+}
+
+func postCommandResult(ctx context.Context, client *http.Client, cfg Config, id int64, result string) error {
+	body, err := json.Marshal(map[string]string{"host": cfg.HostName, "result": result})
+	if err != nil {
+		return err
+	}
+	return backendJSON(ctx, client, cfg, http.MethodPost, fmt.Sprintf("/agent/commands/%d/result", id), body, nil)
+}
+
+// backendJSON sends one request to the backend with the ingest token and
+// decodes a JSON reply into out when out is non-nil.
+func backendJSON(ctx context.Context, client *http.Client, cfg Config, method, path string, body []byte, out interface{}) error {
+	req, err := backendRequest(ctx, cfg, method, path, body)
+	if err != nil {
+		return err
+	}
+	return backendDo(client, req, out)
+}
+
+// backendRequest builds a request to the backend carrying the ingest
+// token; a non-nil body is sent as JSON.
+func backendRequest(ctx context.Context, cfg Config, method, path string, body []byte) (*http.Request, error) {
+	if cfg.DryRun {
+		return nil, errDryRun
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(cfg.BackendBaseURL, "/")+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := ingestToken(cfg); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	// the backend's default budget is shorter than a long poll
+	req.Header.Set("X-Request-Timeout", (remoteCommandWait + 3*time.Second).String())
+	return req, nil
+}
+
+// backendDo sends req and decodes a JSON reply into out when out is
+// non-nil; non-2xx replies are *httpStatusError.
+func backendDo(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpStatusError{status: resp.Status, code: resp.StatusCode, body: string(respBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBytes, out); err != nil {
+		return fmt.Errorf("cannot parse JSON: %v body=%s", err, string(respBytes))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Raw sample upload bounds: samples wait in a buffer of rawSampleBuffer
+// (four hours at one per second, oldest dropped first while the backend
+// is unreachable) and go out in batches of at most rawSampleBatch.
+const (
+	rawSampleBuffer = 4 * 3600
+	rawSampleBatch  = 3600
+)
+
+// rawSample is one measured tick as sent to POST /ingest/samples, with
+// the session user it was measured for; a batch holds one user's samples.
+type rawSample struct {
+	TS         string `json:"ts"`
+	IdleMs     int64  `json:"idle_ms"`
+	IntervalMs int64  `json:"interval_ms"`
+	user       string
+}
+
+// sampleUploader sends every measured tick to the backend in chunks, so
+// hourly rows can be recomputed there under another idle policy.
+type sampleUploader struct {
+	queue uploadQueue[rawSample]
+}
+
+func newSampleUploader() *sampleUploader {
+	return &sampleUploader{queue: uploadQueue[rawSample]{
+		limit: rawSampleBuffer,
+		same:  func(a, b rawSample) bool { return a.user == b.user },
+	}}
+}
+
+// add queues one tick of user's; called from the sampling loop, so it
+// never blocks.
+func (u *sampleUploader) add(at time.Time, idle, step time.Duration, user string) {
+	u.queue.add(rawSample{
+		TS:         at.UTC().Format(time.RFC3339),
+		IdleMs:     idle.Milliseconds(),
+		IntervalMs: max(step.Milliseconds(), 1),
+		user:       user,
+	})
+}
+
+// loop uploads queued samples every cfg.RawSampleEvery until ctx is done,
+// then makes a last attempt for the partial chunk.
+func (u *sampleUploader) loop(ctx context.Context, cfg Config, writeLine func(string)) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	every := cfg.RawSampleEvery
+	if every <= 0 {
+		every = 5 * time.Minute
+	}
+	uploadLoop(ctx, every, "SAMPLES", func(ctx context.Context) error {
+		return u.queue.flush(ctx, rawSampleBatch, func(ctx context.Context, batch []rawSample, dropped int) error {
+			err := postCompressedJSON(ctx, client, cfg, "/ingest/samples", map[string]interface{}{
+				"host":      cfg.HostName,
+				"user_name": batch[0].user,
+				"samples":   batch,
+			})
+			if err == nil && dropped > 0 {
+				writeLine(fmt.Sprintf("[%s] SAMPLES dropped %d samples while the backend was unreachable", time.Now().Format(time.RFC3339), dropped))
+			}
+			return err
+		})
+	}, writeLine)
+}
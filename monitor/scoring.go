@@ -0,0 +1,154 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Scoring strategies for the windowed pipeline, chosen with Config.Scoring.
+const (
+	scoringThreshold = "threshold" // share of active samples (default)
+	scoringDecay     = "decay"     // recent samples count more, see ScoringHalfLife
+	scoringWeighted  = "weighted"  // active samples count by input device, see ScoringWeights
+)
+
+// scorer turns the samples in the window into the activity ratio in
+// [0, 1] that modes are classified on. The window tells it which samples
+// enter and leave; a scorer is free to ignore either.
+type scorer interface {
+	add(s windowSample)
+	remove(s windowSample)
+	ratio(now time.Time) float64
+}
+
+// newScorer builds the strategy cfg asks for.
+func newScorer(cfg Config) (scorer, error) {
+	switch cfg.Scoring {
+	case "", scoringThreshold:
+		return &thresholdScorer{}, nil
+	case scoringDecay:
+		if cfg.ScoringHalfLife <= 0 {
+			return nil, fmt.Errorf("ScoringHalfLife must be positive")
+		}
+		return &decayScorer{halfLife: cfg.ScoringHalfLife}, nil
+	case scoringWeighted:
+		w := &weightedScorer{weights: [...]float64{1, 1, 1, 1}}
+		for name, v := range cfg.ScoringWeights {
+			if v < 0 || v > 1 {
+				return nil, fmt.Errorf("ScoringWeights[%q] must be within 0-1", name)
+			}
+			switch name {
+			case "mouse":
+				w.weights[inputMouse] = v
+			case "key":
+				w.weights[inputKey] = v
+			case "touch":
+				w.weights[inputTouch] = v
+			default:
+				return nil, fmt.Errorf("ScoringWeights: unknown input %q (want mouse, key or touch)", name)
+			}
+		}
+		return w, nil
+	}
+	return nil, fmt.Errorf("unknown Scoring %q (want %s, %s or %s)", cfg.Scoring, scoringThreshold, scoringDecay, scoringWeighted)
+}
+
+// thresholdScorer is the plain share of active samples.
+type thresholdScorer struct {
+	active, total int
+}
+
+func (t *thresholdScorer) add(s windowSample) {
+	t.total += s.n
+	if s.active {
+		t.active += s.n
+	}
+}
+
+func (t *thresholdScorer) remove(s windowSample) {
+	t.total -= s.n
+	if s.active {
+		t.active -= s.n
+	}
+}
+
+func (t *thresholdScorer) ratio(time.Time) float64 {
+	if t.total == 0 {
+		return 0
+	}
+	return float64(t.active) / float64(t.total)
+}
+
+// decayScorer is an exponentially decayed activity level: a sample's
+// weight halves every halfLife, so a return from a long break shows
+// within minutes instead of after half a window. It ignores the window
+// bounds.
+type decayScorer struct {
+	halfLife time.Duration
+	level    float64
+	last     time.Time
+}
+
+func (d *decayScorer) add(s windowSample) {
+	x := 0.0
+	if s.active {
+		x = 1
+	}
+	if d.last.IsZero() {
+		d.level, d.last = x, s.at
+		return
+	}
+	keep := math.Pow(0.5, s.at.Sub(d.last).Seconds()/d.halfLife.Seconds())
+	d.level = x + (d.level-x)*keep
+	d.last = s.at
+}
+
+func (d *decayScorer) remove(windowSample) {}
+
+func (d *decayScorer) ratio(time.Time) float64 { return d.level }
+
+// pct is the level as a percentage, -1 before the first sample.
+func (d *decayScorer) pct() float64 {
+	if d.last.IsZero() {
+		return -1
+	}
+	return d.level * 100
+}
+
+// weightedScorer counts an active sample by the weight of the device that
+// produced the last input, e.g. keyboard 1 and mouse 0.5 for teams that
+// do not want mouse jiggling to read as work. Devices without a weight,
+// and input raw input could not attribute, count fully.
+type weightedScorer struct {
+	weights [inputTouch + 1]float64
+	sum     float64
+	total   int
+}
+
+func (w *weightedScorer) value(s windowSample) float64 {
+	if !s.active {
+		return 0
+	}
+	return w.weights[s.kind] * float64(s.n)
+}
+
+func (w *weightedScorer) add(s windowSample) {
+	w.sum += w.value(s)
+	w.total += s.n
+}
+
+func (w *weightedScorer) remove(s windowSample) {
+	w.sum -= w.value(s)
+	w.total -= s.n
+}
+
+func (w *weightedScorer) ratio(time.Time) float64 {
+	if w.total == 0 {
+		return 0
+	}
+	return math.Max(0, w.sum/float64(w.total))
+}
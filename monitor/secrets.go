@@ -0,0 +1,150 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// secretFields are the Config fields that may be kept out of config.json
+// in secrets.dat, a DPAPI-protected (machine scope) JSON object next to it
+// written by "--set-secret". Values there override config.json.
+var secretFields = []string{"RqliteUser", "RqlitePass", "IngestToken", "EnrollmentSecret", "SigningKey", "PseudonymKey"}
+
+func secretsPath(configFile string) string {
+	return filepath.Join(filepath.Dir(configFile), "secrets.dat")
+}
+
+func isSecretField(name string) bool {
+	for _, f := range secretFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readSecrets(path string) (map[string]string, error) {
+	blob, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plain, err := unprotectData(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+func writeSecrets(path string, secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	blob, err := protectData(plain)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, blob, 0o600)
+}
+
+// applySecrets sets the fields stored in the secrets file of configFile.
+func applySecrets(configFile string, cfg *Config) error {
+	secrets, err := readSecrets(secretsPath(configFile))
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(cfg).Elem()
+	for name, value := range secrets {
+		if !isSecretField(name) {
+			return fmt.Errorf("%s: unknown secret %q", secretsPath(configFile), name)
+		}
+		v.FieldByName(name).SetString(value)
+	}
+	return nil
+}
+
+// plainSecrets names the secret fields config.json still holds in clear.
+func plainSecrets(configFile string) []string {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(data, &raw) != nil {
+		return nil
+	}
+	var names []string
+	for name, msg := range raw {
+		var s string
+		if isSecretField(name) && json.Unmarshal(msg, &s) == nil && s != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setSecretArg finds "--set-secret NAME=VALUE" or "--set-secret NAME" (the
+// value then read from stdin, so it stays out of the shell history) in
+// args.
+func setSecretArg(args []string) (name, value string, fromStdin, ok bool) {
+	for i, a := range args {
+		var spec string
+		switch {
+		case a == "--set-secret" || a == "-set-secret":
+			if i+1 < len(args) {
+				spec = args[i+1]
+			}
+		case strings.HasPrefix(a, "--set-secret=") || strings.HasPrefix(a, "-set-secret="):
+			spec = a[strings.Index(a, "=")+1:]
+		default:
+			continue
+		}
+		name, value, found := strings.Cut(spec, "=")
+		return name, value, !found, true
+	}
+	return "", "", false, false
+}
+
+// setSecret stores one secret for configFile, an empty value deleting it.
+func setSecret(configFile, name, value string, fromStdin bool) error {
+	if !isSecretField(name) {
+		return fmt.Errorf("%q is not a secret setting (use one of %s)", name, strings.Join(secretFields, ", "))
+	}
+	if fromStdin {
+		fmt.Printf("%s: ", name)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+	path := secretsPath(configFile)
+	secrets, err := readSecrets(path)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		delete(secrets, name)
+	} else {
+		secrets[name] = value
+	}
+	return writeSecrets(path, secrets)
+}
@@ -0,0 +1,75 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procK32GetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+
+type PROCESS_MEMORY_COUNTERS struct {
+	Cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// selfStats is the agent's own footprint, logged every PrintStatusEvery
+// and sent with heartbeats so deployments can show it is negligible.
+type selfStats struct {
+	CPUSeconds    float64 `json:"cpu_seconds"` // user + kernel since start
+	RSSBytes      uint64  `json:"rss_bytes"`   // working set
+	Goroutines    int     `json:"goroutines"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+}
+
+func (s selfStats) String() string {
+	return fmt.Sprintf("cpu=%.1fs rss=%.1fMB goroutines=%d uptime=%s",
+		s.CPUSeconds, float64(s.RSSBytes)/(1<<20), s.Goroutines, time.Duration(s.UptimeSeconds*float64(time.Second)).Truncate(time.Second))
+}
+
+var (
+	processStart = time.Now()
+	// lastSelfStats is the latest reading, picked up by heartbeats
+	lastSelfStats atomic.Pointer[selfStats]
+)
+
+// readSelfStats measures the current process.
+func readSelfStats() (selfStats, error) {
+	s := selfStats{
+		Goroutines:    runtime.NumGoroutine(),
+		UptimeSeconds: time.Since(processStart).Seconds(),
+	}
+	h := windows.CurrentProcess()
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return s, err
+	}
+	// FILETIME durations count 100ns ticks
+	ticks := func(ft windows.Filetime) uint64 { return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime) }
+	s.CPUSeconds = float64(ticks(kernel)+ticks(user)) / 1e7
+
+	var pmc PROCESS_MEMORY_COUNTERS
+	pmc.Cb = uint32(unsafe.Sizeof(pmc))
+	r1, _, err := procK32GetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&pmc)), uintptr(pmc.Cb))
+	if r1 == 0 {
+		return s, err
+	}
+	s.RSSBytes = uint64(pmc.WorkingSetSize)
+	return s, nil
+}
@@ -0,0 +1,58 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+const serviceName = "ActivityMonitor"
+
+// agentService runs the agent under the Windows service control manager.
+// PreShutdown is accepted so the SCM gives us time to flush the partial
+// hour before the OS powers off.
+type agentService struct {
+	cfg Config
+}
+
+func (s *agentService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPreShutdown
+
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		run(ctx, s.cfg)
+		close(done)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case <-done:
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 0
+
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown, svc.PreShutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: 20000}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+func runService(cfg Config) {
+	_ = svc.Run(serviceName, &agentService{cfg: cfg})
+}
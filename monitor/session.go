@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"runtime"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procRegisterClassExW = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW  = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW   = user32.NewProc("DefWindowProcW")
+	procGetMessageW      = user32.NewProc("GetMessageW")
+	procTranslateMessage = user32.NewProc("TranslateMessage")
+	procDispatchMessageW = user32.NewProc("DispatchMessageW")
+)
+
+const (
+	wmQueryEndSession = 0x0011
+	wmEndSession      = 0x0016
+
+	// endSessionWait bounds how long WM_ENDSESSION blocks while the agent
+	// flushes; Windows kills unresponsive apps after about 5 seconds.
+	endSessionWait = 4 * time.Second
+)
+
+type WNDCLASSEXW struct {
+	CbSize        uint32
+	Style         uint32
+	LpfnWndProc   uintptr
+	CbClsExtra    int32
+	CbWndExtra    int32
+	HInstance     windows.Handle
+	HIcon         windows.Handle
+	HCursor       windows.Handle
+	HbrBackground windows.Handle
+	LpszMenuName  *uint16
+	LpszClassName *uint16
+	HIconSm       windows.Handle
+}
+
+type MSG struct {
+	Hwnd    windows.HWND
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      POINT
+}
+
+// watchEndSession creates a hidden top-level window whose only job is to
+// receive WM_ENDSESSION (message-only windows don't get that broadcast).
+// On session end it calls stop and holds the message until done is closed,
+// because Windows may terminate the process as soon as it returns.
+func watchEndSession(stop func(), done <-chan struct{}) {
+	go func() {
+		runtime.LockOSThread()
+
+		wndProc := func(hwnd windows.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+			switch msg {
+			case wmQueryEndSession:
+				return 1
+			case wmEndSession:
+				if wParam != 0 {
+					stop()
+					select {
+					case <-done:
+					case <-time.After(endSessionWait):
+					}
+				}
+				return 0
+			}
+			r, _, _ := procDefWindowProcW.Call(uintptr(hwnd), uintptr(msg), wParam, lParam)
+			return r
+		}
+
+		var hinst windows.Handle
+		_ = windows.GetModuleHandleEx(0, nil, &hinst)
+
+		className, _ := windows.UTF16PtrFromString("ActivityMonitorSession")
+		wc := WNDCLASSEXW{
+			LpfnWndProc:   windows.NewCallback(wndProc),
+			HInstance:     hinst,
+			LpszClassName: className,
+		}
+		wc.CbSize = uint32(unsafe.Sizeof(wc))
+		if r, _, _ := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+			return
+		}
+
+		hwnd, _, _ := procCreateWindowExW.Call(0,
+			uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+			0, 0, 0, 0, 0, 0, 0, uintptr(hinst), 0)
+		if hwnd == 0 {
+			return
+		}
+
+		var m MSG
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			procTranslateMessage.Call(uintptr(unsafe.Pointer(&m)))
+			procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+}
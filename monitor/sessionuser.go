@@ -0,0 +1,74 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	wtsapi32                        = windows.NewLazySystemDLL("wtsapi32.dll")
+	procWTSQuerySessionInformationW = wtsapi32.NewProc("WTSQuerySessionInformationW")
+)
+
+const (
+	wtsUserName      = 5          // WTS_INFO_CLASS WTSUserName
+	noConsoleSession = 0xFFFFFFFF // WTSGetActiveConsoleSessionId while the console is detached
+)
+
+// consoleUser returns the user logged on to the console session, "" when
+// nobody is (logon screen, session switch in progress).
+func consoleUser() string {
+	id := windows.WTSGetActiveConsoleSessionId()
+	if id == noConsoleSession {
+		return ""
+	}
+	var buf *uint16
+	var n uint32
+	r, _, _ := procWTSQuerySessionInformationW.Call(0, uintptr(id), wtsUserName,
+		uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&n)))
+	if r == 0 || buf == nil {
+		return ""
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buf)))
+	return windows.UTF16PtrToString(buf)
+}
+
+// sessionIdentity maps the console user to the identity attached to rows:
+// pseudonymized like UserName, with UserDisplayName only when it is the
+// configured user. ok is false when nobody is logged on, in which case the
+// hour stays with its current owner.
+func sessionIdentity(cfg Config, name string) (user, display string, ok bool) {
+	if name == "" {
+		return "", "", false
+	}
+	if cfg.PseudonymKey != "" {
+		name = pseudonym(cfg.PseudonymKey, "user", name)
+	}
+	if strings.EqualFold(name, cfg.UserName) {
+		return cfg.UserName, cfg.UserDisplayName, true
+	}
+	return name, "", true
+}
+
+// userBucket is one user's share of the current hour on a shared
+// workstation. The hourly counters belong to the current bucket; when
+// another user takes the console, its row is queued and the bucket parked,
+// to resume if that user comes back before the hour ends.
+type userBucket struct {
+	user, display string
+	from          time.Time // when the user last took the counters
+	heldBefore    float64   // seconds held earlier in the hour
+	row           hourlyRow // counters when parked
+}
+
+// held is how long the user has held the hour up to t, the span their
+// activity_pct is computed over.
+func (b userBucket) held(t time.Time) float64 {
+	return b.heldBefore + t.Sub(b.from).Seconds()
+}
@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// bucketPayload is the text signed for one hourly row: the fields a
+// tamperer would touch, formatted as insertHourly writes them. It must
+// match the backend's bucketPayload.
+func bucketPayload(cfg Config, row hourlyRow) string {
+	return fmt.Sprintf("%s\n%s\n%s\n%.4f\n%.0f\n%d\n%s\n%d\n%d\n%d",
+		row.hourStart.UTC().Format("2006-01-02T15:00:00Z"), cfg.HostName, row.userName,
+		row.activityPct, row.idleSeconds, row.samples, row.status, row.mouse, row.key, row.touch)
+}
+
+// signBucket returns the hex HMAC-SHA256 of row under cfg.SigningKey, or
+// the key received at enrollment, empty when there is no usable key.
+func signBucket(cfg Config, row hourlyRow) string {
+	hexKey := cfg.SigningKey
+	if e := enrolled.Load(); hexKey == "" && e != nil {
+		hexKey = e.SigningKey
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(bucketPayload(cfg, row)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureSQL holds the fragments insertHourly adds for a signed row:
+// the signature column, its value, and on conflict the new signature
+// with the backend's verdict cleared, so the row is checked again.
+type signatureSQL struct {
+	columns, values, update string
+}
+
+func signatureFor(cfg Config, row hourlyRow) signatureSQL {
+	s := signBucket(cfg, row)
+	if s == "" {
+		return signatureSQL{}
+	}
+	return signatureSQL{
+		columns: ", signature",
+		values:  fmt.Sprintf(`, "%s"`, s),
+		update:  ",\n           signature = excluded.signature, signature_status = ''",
+	}
+}
@@ -0,0 +1,152 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Mouse jigglers, USB or software, keep a machine "active" with input no
+// person produces: tiny cursor nudges on a fixed beat, or keys pressed on
+// a metronome. People are irregular, so the hour is flagged when nudges
+// or key presses arrive at near-constant intervals. Only timings and
+// movement sizes are kept, never positions or keys.
+const (
+	// raw mouse reports closer than nudgeGap belong to one movement
+	nudgeGap = 250 * time.Millisecond
+	// movements of at most tinyMove counts (|dx|+|dy|) are nudges
+	tinyMove = 4
+	// gaps needed before a pattern is judged, and the coefficient of
+	// variation under which they count as machine-made
+	syntheticMinGaps = 12
+	syntheticMaxCV   = 0.1
+	// confidence from which the hour is flagged
+	syntheticFlagAt = 0.5
+)
+
+// gapStats accumulates the gaps between events (Welford's algorithm).
+type gapStats struct {
+	last     time.Time
+	n        int
+	mean, m2 float64 // seconds
+}
+
+func (s *gapStats) add(t time.Time) {
+	if !s.last.IsZero() {
+		gap := t.Sub(s.last).Seconds()
+		s.n++
+		d := gap - s.mean
+		s.mean += d / float64(s.n)
+		s.m2 += d * (gap - s.mean)
+	}
+	s.last = t
+}
+
+// periodicity is 0 for irregular gaps, rising to 1 for many gaps of
+// (nearly) the same length.
+func (s gapStats) periodicity() float64 {
+	if s.n < syntheticMinGaps || s.mean <= 0 {
+		return 0
+	}
+	cv := math.Sqrt(s.m2/float64(s.n-1)) / s.mean
+	if cv >= syntheticMaxCV {
+		return 0
+	}
+	return (1 - cv/syntheticMaxCV) * math.Min(1, float64(s.n)/(2*syntheticMinGaps))
+}
+
+// syntheticScore is the verdict on one hour's input.
+type syntheticScore struct {
+	suspected  bool
+	confidence float64 // 0-1
+	source     string  // "mouse" or "key", for the log
+}
+
+// syntheticDetector is fed by the raw input thread and read at rollover.
+type syntheticDetector struct {
+	mu sync.Mutex
+
+	moveStart, moveLast time.Time
+	moveSize            int32
+	nudges              gapStats
+	moves               int // movements larger than tinyMove
+
+	keys    gapStats
+	pressed [256]bool // held keys, so auto-repeat is not a press
+}
+
+var synthetic syntheticDetector
+
+// mouse records one relative raw mouse report.
+func (d *syntheticDetector) mouse(now time.Time, dx, dy int32) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.moveLast.IsZero() && now.Sub(d.moveLast) >= nudgeGap {
+		d.endMove()
+	}
+	if d.moveStart.IsZero() {
+		d.moveStart = now
+	}
+	d.moveLast = now
+	d.moveSize += abs32(dx) + abs32(dy)
+}
+
+// endMove closes the current movement; the caller holds mu.
+func (d *syntheticDetector) endMove() {
+	if d.moveStart.IsZero() {
+		return
+	}
+	if d.moveSize <= tinyMove {
+		d.nudges.add(d.moveStart)
+	} else {
+		d.moves++
+	}
+	d.moveStart, d.moveLast, d.moveSize = time.Time{}, time.Time{}, 0
+}
+
+// key records a key going down (down) or up.
+func (d *syntheticDetector) key(now time.Time, vkey uint16, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := vkey & 0xFF
+	if down && !d.pressed[k] {
+		d.keys.add(now)
+	}
+	d.pressed[k] = down
+}
+
+// take scores the input since the last take and starts over; the time of
+// the last nudge and key press is kept so a beat spanning the hour
+// boundary is still seen.
+func (d *syntheticDetector) take() syntheticScore {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endMove()
+	var s syntheticScore
+	if p := d.nudges.periodicity(); p > 0 {
+		// nudges drowned in real movement are someone at the desk
+		s = syntheticScore{confidence: p * float64(d.nudges.n) / float64(d.nudges.n+d.moves), source: "mouse"}
+	}
+	if p := d.keys.periodicity(); p > s.confidence {
+		s = syntheticScore{confidence: p, source: "key"}
+	}
+	s.confidence = math.Round(s.confidence*100) / 100
+	s.suspected = s.confidence >= syntheticFlagAt
+	d.nudges = gapStats{last: d.nudges.last}
+	d.keys = gapStats{last: d.keys.last}
+	d.moves = 0
+	return s
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"time"
+	_ "time/tzdata" // Windows has no zoneinfo database for LoadLocation
+)
+
+// bucketStart is the hour t falls in. Buckets are whole UTC hours, which
+// never repeat or vanish across DST changes, so hour_start stays a
+// stable key whatever the machine's zone.
+func bucketStart(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// localHour labels a bucket in loc with the offset in force at that
+// instant, so the two 02:00 hours of a DST fall-back stay distinct.
+func localHour(start time.Time, loc *time.Location) string {
+	return start.In(loc).Format(time.RFC3339)
+}
+
+// loadZone resolves Config.TimeZone; empty or "Local" is the machine zone.
+func loadZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,105 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHourKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		zone   string
+		at     string // sample time, UTC
+		bucket string // hour_start
+		local  string // local_hour
+	}{
+		{"before spring forward", "America/New_York", "2026-03-08T06:59:59Z", "2026-03-08T06:00:00Z", "2026-03-08T01:00:00-05:00"},
+		// 02:00 local does not exist that day: 01:00 EST is followed by 03:00 EDT
+		{"after spring forward", "America/New_York", "2026-03-08T07:10:00Z", "2026-03-08T07:00:00Z", "2026-03-08T03:00:00-04:00"},
+		// 01:00 local happens twice; the offset keeps the two hours apart
+		{"first 01:00 of fall back", "America/New_York", "2026-11-01T05:30:00Z", "2026-11-01T05:00:00Z", "2026-11-01T01:00:00-04:00"},
+		{"second 01:00 of fall back", "America/New_York", "2026-11-01T06:30:00Z", "2026-11-01T06:00:00Z", "2026-11-01T01:00:00-05:00"},
+		{"half-hour offset", "Asia/Kolkata", "2026-02-02T09:45:00Z", "2026-02-02T09:00:00Z", "2026-02-02T14:30:00+05:30"},
+		{"half-hour offset, day boundary", "Asia/Kolkata", "2026-02-02T18:40:00Z", "2026-02-02T18:00:00Z", "2026-02-02T23:30:00+05:30"},
+		{"half-hour offset, DST end", "Australia/Adelaide", "2026-04-04T16:10:00Z", "2026-04-04T16:00:00Z", "2026-04-05T02:30:00+10:30"},
+		{"half-hour offset, after DST end", "Australia/Adelaide", "2026-04-04T17:10:00Z", "2026-04-04T17:00:00Z", "2026-04-05T02:30:00+09:30"},
+		{"UTC", "UTC", "2026-02-02T09:00:00Z", "2026-02-02T09:00:00Z", "2026-02-02T09:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := loadZone(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the agent sees local wall-clock times; the key must not depend on it
+			start := bucketStart(at.In(loc))
+			if got := start.UTC().Format("2006-01-02T15:00:00Z"); got != tt.bucket {
+				t.Errorf("hour_start = %s, want %s", got, tt.bucket)
+			}
+			if got := localHour(start, loc); got != tt.local {
+				t.Errorf("local_hour = %s, want %s", got, tt.local)
+			}
+		})
+	}
+}
+
+// TestLocalDayHours walks a local day a minute at a time, as the sampling
+// loop does, and checks that every bucket is seen once with a distinct
+// label: 23 on a spring-forward day, 25 on a fall-back day. In a
+// half-hour-offset zone local midnight falls mid-bucket, so a local day
+// touches one UTC hour more.
+func TestLocalDayHours(t *testing.T) {
+	tests := []struct {
+		zone  string
+		day   string
+		hours int
+	}{
+		{"America/New_York", "2026-03-08", 23},
+		{"America/New_York", "2026-11-01", 25},
+		{"America/New_York", "2026-02-02", 24},
+		{"Australia/Adelaide", "2026-04-05", 26},
+		{"Australia/Adelaide", "2026-10-04", 24},
+		{"Asia/Kolkata", "2026-02-02", 25},
+	}
+	for _, tt := range tests {
+		loc, err := loadZone(tt.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		day, err := time.ParseInLocation("2006-01-02", tt.day, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := day.AddDate(0, 0, 1)
+		buckets := make(map[time.Time]bool)
+		labels := make(map[string]bool)
+		for at := day; at.Before(end); at = at.Add(time.Minute) {
+			start := bucketStart(at)
+			if !buckets[start] {
+				buckets[start] = true
+				labels[localHour(start, loc)] = true
+			}
+		}
+		if len(buckets) != tt.hours || len(labels) != tt.hours {
+			t.Errorf("%s %s: %d buckets, %d labels, want %d", tt.zone, tt.day, len(buckets), len(labels), tt.hours)
+		}
+	}
+}
+
+func TestLoadZone(t *testing.T) {
+	for _, name := range []string{"", "Local"} {
+		if loc, err := loadZone(name); err != nil || loc != time.Local {
+			t.Errorf("loadZone(%q) = %v, %v, want Local", name, loc, err)
+		}
+	}
+	if _, err := loadZone("Mars/Olympus_Mons"); err == nil {
+		t.Error("unknown zone accepted")
+	}
+}
@@ -0,0 +1,207 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetWindowTextW       = user32.NewProc("GetWindowTextW")
+	procGetWindowTextLengthW = user32.NewProc("GetWindowTextLengthW")
+)
+
+// Window title bounds: titles are cut to maxTitleRunes, and at most
+// maxPendingTitles samples wait for rqlite before the oldest are dropped.
+const (
+	maxTitleRunes    = 256
+	maxPendingTitles = 1000
+)
+
+// TitleRule rewrites every match of Pattern (Go regexp syntax) in a window
+// title to Replace, which may use $1-style references.
+type TitleRule struct {
+	Pattern string
+	Replace string
+}
+
+// defaultTitleRedact hides e-mail addresses, which mail and chat clients
+// put in their titles.
+var defaultTitleRedact = []TitleRule{
+	{Pattern: `[\w.+-]+@[\w-]+(\.[\w-]+)+`, Replace: "<email>"},
+}
+
+type titleSample struct {
+	at        time.Time
+	hourStart time.Time
+	title     string
+	process   string // executable name, e.g. "EXCEL.EXE"
+}
+
+type compiledRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// titleSampler records the foreground window title every
+// TitleSampleEvery, as evidence of what a low-activity hour was spent on
+// without going as far as screenshots. Titles are redacted before they
+// are kept anywhere, including the log.
+type titleSampler struct {
+	rules   []compiledRule
+	key     string // TitleRedact the rules were built from
+	broken  bool   // a rule did not compile: sample nothing rather than leak
+	last    time.Time
+	cur     []titleSample // the hour being sampled
+	pending []titleSample // closed hours, waiting for upload
+	due     bool          // an hour closed since the last upload attempt
+}
+
+// configure rebuilds the redaction rules when TitleRedact changed. On an
+// invalid pattern sampling stops until the config is fixed.
+func (s *titleSampler) configure(cfg Config) error {
+	key := fmt.Sprint(cfg.TitleRedact)
+	if key == s.key && s.rules != nil {
+		return nil
+	}
+	s.key = key
+	rules := make([]compiledRule, 0, len(cfg.TitleRedact))
+	for i, r := range cfg.TitleRedact {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			s.rules, s.broken = nil, true
+			return fmt.Errorf("TitleRedact[%d]: %v (window titles not sampled)", i, err)
+		}
+		rules = append(rules, compiledRule{re: re, replace: r.Replace})
+	}
+	s.rules, s.broken = rules, false
+	return nil
+}
+
+// sample takes one title if one is due; hourStart is the bucket it
+// belongs to.
+func (s *titleSampler) sample(cfg Config, now, hourStart time.Time) {
+	if !cfg.WindowTitles || s.broken || cfg.TitleSampleEvery <= 0 || now.Sub(s.last) < cfg.TitleSampleEvery {
+		return
+	}
+	s.last = now
+	title, process := foregroundWindow()
+	if title == "" {
+		return // desktop, lock screen, or no foreground window
+	}
+	s.cur = append(s.cur, titleSample{at: now, hourStart: hourStart, title: s.redact(title), process: process})
+}
+
+// closeHour queues the current hour's titles for upload, like the hourly
+// row they go with.
+func (s *titleSampler) closeHour() {
+	s.pending = append(s.pending, s.cur...)
+	if over := len(s.pending) - maxPendingTitles; over > 0 {
+		s.pending = s.pending[over:]
+	}
+	s.cur = s.cur[:0]
+	s.due = true
+}
+
+func (s *titleSampler) redact(title string) string {
+	for _, r := range s.rules {
+		title = r.re.ReplaceAllString(title, r.replace)
+	}
+	if utf8.RuneCountInString(title) > maxTitleRunes {
+		title = string([]rune(title)[:maxTitleRunes])
+	}
+	return title
+}
+
+// upload inserts the pending titles once per closed hour; on failure
+// they wait for the next hour. Replays of the same sample are ignored.
+func (s *titleSampler) upload(httpClient *http.Client, cfg Config) (int, error) {
+	n := len(s.pending)
+	if !s.due || n == 0 {
+		return 0, nil
+	}
+	s.due = false
+	if err := insertTitles(httpClient, cfg, s.pending); err != nil {
+		return 0, err
+	}
+	s.pending = s.pending[:0]
+	return n, nil
+}
+
+// discard drops the titles upload would have sent, for dry-run mode,
+// and returns how many there were.
+func (s *titleSampler) discard() int {
+	n := len(s.pending)
+	if !s.due || n == 0 {
+		return 0
+	}
+	s.due = false
+	s.pending = s.pending[:0]
+	return n
+}
+
+// foregroundWindow returns the foreground window's title and the name of
+// the executable that owns it; both are empty when there is none.
+func foregroundWindow() (title, process string) {
+	hwnd := windows.GetForegroundWindow()
+	if hwnd == 0 {
+		return "", ""
+	}
+	n, _, _ := procGetWindowTextLengthW.Call(uintptr(hwnd))
+	if n == 0 {
+		return "", ""
+	}
+	buf := make([]uint16, n+1)
+	n, _, _ = procGetWindowTextW.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	title = windows.UTF16ToString(buf[:n])
+
+	var pid uint32
+	if _, err := windows.GetWindowThreadProcessId(hwnd, &pid); err != nil || pid == 0 {
+		return title, ""
+	}
+	return title, processName(pid)
+}
+
+// processName returns the executable name of process pid, "" when it
+// cannot be read.
+func processName(pid uint32) string {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+	name := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(name))
+	if err := windows.QueryFullProcessImageName(h, 0, &name[0], &size); err != nil {
+		return ""
+	}
+	return filepath.Base(windows.UTF16ToString(name[:size]))
+}
+
+// insertTitles writes samples to the window_titles table created by the
+// backend migrations.
+func insertTitles(httpClient *http.Client, cfg Config, samples []titleSample) error {
+	values := make([]string, 0, len(samples))
+	for _, t := range samples {
+		values = append(values, fmt.Sprintf(`("%s", "%s", "%s", "%s", "%s")`,
+			escapeSQLString(cfg.HostName),
+			t.at.UTC().Format(time.RFC3339),
+			t.hourStart.UTC().Format("2006-01-02T15:00:00Z"),
+			escapeSQLString(t.title),
+			escapeSQLString(t.process),
+		))
+	}
+	stmt := `INSERT OR IGNORE INTO window_titles(host, sampled_at, hour_start, title, process) VALUES ` +
+		strings.Join(values, ", ") + `;`
+	return rqliteExec(httpClient, cfg, []string{stmt})
+}
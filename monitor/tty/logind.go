@@ -0,0 +1,81 @@
+package tty
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// logindSession is what logind reports of one login session.
+type logindSession struct {
+	user      string
+	class     string // user, greeter, lock-screen, background, manager
+	typ       string // tty, x11, wayland, mir, unspecified
+	state     string // online, active, closing
+	idle      bool   // IdleHint
+	locked    bool   // LockedHint
+	idleSince time.Time
+}
+
+// graphical reports whether the session's desktop, rather than logind,
+// sets its idle hint.
+func (s logindSession) graphical() bool {
+	return s.typ == "x11" || s.typ == "wayland" || s.typ == "mir"
+}
+
+// lastInput is the session's latest input as the pipeline counts it. A
+// locked session is idle whatever its idle hint says, the way a locked
+// Windows workstation is, and a graphical session the desktop does not
+// call idle has input now. For terminal sessions logind takes
+// IdleSinceHint from the terminal's access time, as Utmp does, whether
+// or not it calls them idle yet.
+func (s logindSession) lastInput(now time.Time) time.Time {
+	switch {
+	case s.locked:
+		return time.Time{}
+	case s.graphical() && !s.idle:
+		return now
+	}
+	return s.idleSince
+}
+
+// logindInputs folds sessions into each user's latest input. Sessions
+// that are not a user's own (greeters, lock screens, the per-user
+// manager) and sessions being closed are left out.
+func logindInputs(now time.Time, sessions []logindSession) map[string]time.Time {
+	latest := map[string]time.Time{}
+	for _, s := range sessions {
+		if s.class != "user" || s.state == "closing" || s.user == "" {
+			continue
+		}
+		if t := s.lastInput(now); t.After(latest[s.user]) {
+			latest[s.user] = t
+		} else if _, seen := latest[s.user]; !seen {
+			latest[s.user] = time.Time{}
+		}
+	}
+	return latest
+}
+
+// logindInhibitor is one inhibitor lock taken through logind, as listed
+// by ListInhibitors.
+type logindInhibitor struct {
+	what string // colon-separated: shutdown, sleep, idle, handle-*
+	mode string // block or delay
+	uid  uint32
+}
+
+// idleInhibited reports the users, by name from users, holding a block
+// on idle. Inhibitors of uids without a session are left out.
+func idleInhibited(inhibitors []logindInhibitor, users map[uint32]string) map[string]bool {
+	out := map[string]bool{}
+	for _, in := range inhibitors {
+		if in.mode != "block" || !slices.Contains(strings.Split(in.what, ":"), "idle") {
+			continue
+		}
+		if user, ok := users[in.uid]; ok {
+			out[user] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package tty
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	login1Dest    = "org.freedesktop.login1"
+	login1Path    = "/org/freedesktop/login1"
+	login1Manager = "org.freedesktop.login1.Manager"
+	login1Session = "org.freedesktop.login1.Session"
+)
+
+// Logind is the InputProvider of systemd-logind's sessions, local and
+// remote, terminal and graphical: every sample it lists the sessions on
+// the system bus and reads their IdleHint, IdleSinceHint and LockedHint.
+// A session locked with loginctl lock-session or by its desktop counts
+// idle until it is unlocked. Suspended time needs no signal: no sample
+// is taken while the machine sleeps, so it counts for nobody, as on
+// Windows. Logind is also IdleInhibitors: a user holding an idle block
+// inhibitor, as players and call clients take one through
+// systemd-inhibit or the desktop portal, gets media_inhibit on the hour.
+// Use a *Logind; it keeps its bus connection between samples.
+type Logind struct {
+	conn *dbus.Conn
+}
+
+func (l *Logind) LastInputs(now time.Time) (map[string]time.Time, error) {
+	sessions, err := l.sessions()
+	if err != nil {
+		l.reset()
+		return nil, fmt.Errorf("logind: %w", err)
+	}
+	return logindInputs(now, sessions), nil
+}
+
+func (l *Logind) IdleInhibited(time.Time) (map[string]bool, error) {
+	inhibitors, users, err := l.inhibitors()
+	if err != nil {
+		l.reset()
+		return nil, fmt.Errorf("logind inhibitors: %w", err)
+	}
+	return idleInhibited(inhibitors, users), nil
+}
+
+// reset drops the bus connection after a failed call, to reconnect on the
+// next sample: logind or the bus may have restarted.
+func (l *Logind) reset() {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+// listedSession is an entry of ListSessions.
+type listedSession struct {
+	ID   string
+	UID  uint32
+	User string
+	Seat string
+	Path dbus.ObjectPath
+}
+
+// list calls ListSessions, connecting to the system bus first if needed.
+func (l *Logind) list() ([]listedSession, error) {
+	if l.conn == nil {
+		conn, err := dbus.ConnectSystemBus()
+		if err != nil {
+			return nil, err
+		}
+		l.conn = conn
+	}
+	var listed []listedSession
+	err := l.conn.Object(login1Dest, login1Path).Call(login1Manager+".ListSessions", 0).Store(&listed)
+	return listed, err
+}
+
+// sessions reads every session logind knows of.
+func (l *Logind) sessions() ([]logindSession, error) {
+	listed, err := l.list()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]logindSession, 0, len(listed))
+	for _, ls := range listed {
+		var props map[string]dbus.Variant
+		err := l.conn.Object(login1Dest, ls.Path).Call("org.freedesktop.DBus.Properties.GetAll", 0, login1Session).Store(&props)
+		if err != nil {
+			// the session ended since it was listed
+			continue
+		}
+		s := logindSession{user: ls.User}
+		s.class, _ = props["Class"].Value().(string)
+		s.typ, _ = props["Type"].Value().(string)
+		s.state, _ = props["State"].Value().(string)
+		s.idle, _ = props["IdleHint"].Value().(bool)
+		s.locked, _ = props["LockedHint"].Value().(bool)
+		if us, _ := props["IdleSinceHint"].Value().(uint64); us > 0 {
+			s.idleSince = time.UnixMicro(int64(us))
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// inhibitors reads the inhibitor locks held, with the names of the users
+// that have a session.
+func (l *Logind) inhibitors() ([]logindInhibitor, map[uint32]string, error) {
+	listed, err := l.list()
+	if err != nil {
+		return nil, nil, err
+	}
+	users := make(map[uint32]string, len(listed))
+	for _, ls := range listed {
+		users[ls.UID] = ls.User
+	}
+	// a(ssssuu): what, who, why, mode, uid, pid
+	var locks []struct {
+		What, Who, Why, Mode string
+		UID, PID             uint32
+	}
+	if err := l.conn.Object(login1Dest, login1Path).Call(login1Manager+".ListInhibitors", 0).Store(&locks); err != nil {
+		return nil, nil, err
+	}
+	out := make([]logindInhibitor, len(locks))
+	for i, k := range locks {
+		out[i] = logindInhibitor{what: k.What, mode: k.Mode, uid: k.UID}
+	}
+	return out, users, nil
+}
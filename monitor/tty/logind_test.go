@@ -0,0 +1,124 @@
+package tty
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogindInputs(t *testing.T) {
+	now := time.Date(2026, 2, 2, 9, 30, 0, 0, time.UTC)
+	typed := now.Add(-5 * time.Second)
+	away := now.Add(-20 * time.Minute)
+	sessions := []logindSession{
+		// a terminal that logind does not call idle yet: its access time
+		{user: "alice", class: "user", typ: "tty", state: "active", idleSince: typed},
+		// a desktop that is not idle has input now, whatever the hint time
+		{user: "bob", class: "user", typ: "wayland", state: "active", idleSince: away},
+		// an idle desktop since its hint time
+		{user: "carol", class: "user", typ: "x11", state: "active", idle: true, idleSince: away},
+		// locked: idle even if the desktop never set its idle hint
+		{user: "dave", class: "user", typ: "wayland", state: "active", locked: true, idleSince: away},
+		{user: "dave", class: "user", typ: "tty", state: "online", locked: true, idleSince: typed},
+		// a second, unlocked session of a locked user still counts
+		{user: "erin", class: "user", typ: "x11", state: "active", locked: true},
+		{user: "erin", class: "user", typ: "tty", state: "online", idleSince: typed},
+		// a terminal whose access time logind could not read
+		{user: "frank", class: "user", typ: "tty", state: "online"},
+		// not a user's own session, or on its way out
+		{user: "gdm", class: "greeter", typ: "wayland", state: "online"},
+		{user: "grace", class: "manager", state: "active"},
+		{user: "heidi", class: "user", typ: "tty", state: "closing", idleSince: typed},
+	}
+	want := map[string]time.Time{
+		"alice": typed,
+		"bob":   now,
+		"carol": away,
+		"dave":  {},
+		"erin":  typed,
+		"frank": {},
+	}
+	got := logindInputs(now, sessions)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for user, w := range want {
+		if g, ok := got[user]; !ok || !g.Equal(w) {
+			t.Errorf("%s: last input %v, want %v", user, g, w)
+		}
+	}
+}
+
+// A locked hour is idle from the lock on, as on Windows.
+func TestPipelineLockedSession(t *testing.T) {
+	hour := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	p := &Pipeline{Every: 10 * time.Second, Active: 30 * time.Second, Input: inputFunc(func(now time.Time) (map[string]time.Time, error) {
+		s := logindSession{user: "alice", class: "user", typ: "wayland", state: "active"}
+		s.locked = now.Sub(hour) >= 40*time.Minute
+		return logindInputs(now, []logindSession{s}), nil
+	})}
+	rows := runHour(t, p, hour)
+	if len(rows) != 1 || rows[0]["idle_seconds"] != 1200.0 || rows[0]["last_input"] != "2026-02-02T09:39:50Z" {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestIdleInhibited(t *testing.T) {
+	users := map[uint32]string{1000: "alice", 1001: "bob", 1002: "carol"}
+	got := idleInhibited([]logindInhibitor{
+		{what: "idle", mode: "block", uid: 1000},
+		// a delay lock only postpones, it does not keep the session awake
+		{what: "idle", mode: "delay", uid: 1001},
+		{what: "sleep:shutdown", mode: "block", uid: 1001},
+		{what: "sleep:idle", mode: "block", uid: 1002},
+		// a system service's lock, for no user with a session
+		{what: "idle", mode: "block", uid: 0},
+	}, users)
+	if len(got) != 2 || !got["alice"] || !got["carol"] {
+		t.Errorf("inhibited = %v, want alice and carol", got)
+	}
+}
+
+// inhibitedInput is officeHour with carol watching a video, holding an
+// idle inhibitor, from 40 to 50 minutes in; reading inhibitors fails at
+// 55 minutes.
+type inhibitedInput struct {
+	InputProvider
+	hour time.Time
+}
+
+func (in inhibitedInput) IdleInhibited(now time.Time) (map[string]bool, error) {
+	switch m := now.Sub(in.hour); {
+	case m == 55*time.Minute:
+		return nil, errors.New("logind inhibitors: timeout")
+	case m >= 40*time.Minute && m < 50*time.Minute:
+		return map[string]bool{"carol": true}, nil
+	}
+	return nil, nil
+}
+
+func TestPipelineMediaInhibit(t *testing.T) {
+	hour := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	p := &Pipeline{Every: 10 * time.Second, Active: 30 * time.Second, Input: inhibitedInput{officeHour(hour), hour}}
+	var errs int
+	for now := hour; now.Before(hour.Add(time.Hour)); now = now.Add(p.Every) {
+		p.Rollover(now)
+		if err := p.Sample(now); err != nil {
+			errs++
+		}
+	}
+	rows, _ := p.Rollover(hour.Add(time.Hour))
+	if errs != 1 {
+		t.Errorf("%d errors, want 1", errs)
+	}
+	for _, r := range rows {
+		_, flagged := r["media_inhibit"]
+		if want := r["user_name"] == "carol"; flagged != want {
+			t.Errorf("%s: media_inhibit %v, want %v", r["user_name"], flagged, want)
+		}
+		// the sample whose inhibitors failed still counts
+		if r["user_name"] == "alice" && r["samples"] != int64(360) {
+			t.Errorf("alice: %v samples", r["samples"])
+		}
+	}
+}
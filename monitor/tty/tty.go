@@ -0,0 +1,190 @@
+// Package tty is the sampling pipeline of cmd/ttyagent, which measures
+// admin activity on headless Linux servers. Each sample asks an
+// InputProvider for every user's latest input and aggregates the answers
+// into per-user hourly rows in the shape of the backend's
+// POST /ingest/hourly, labelled source=tty:
+//
+//	p := &tty.Pipeline{Host: "bastion-1", Every: 10 * time.Second, Active: 30 * time.Second, Input: tty.Utmp{Path: "/var/run/utmp"}}
+//	for now := range ticker.C {
+//		if rows, ok := p.Rollover(now); ok {
+//			_ = tty.Post(client, backend, token, rows)
+//		}
+//		_ = p.Sample(now)
+//	}
+//
+// Utmp, on Linux, reads remote terminal logins and Logind asks
+// systemd-logind about every session; tests feed the pipeline
+// their own InputProvider.
+package tty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"taxonomy"
+)
+
+// InputProvider reports the users with a live session and the time of
+// each one's latest input, over all their sessions. A zero time is a
+// session with no input known, counted idle.
+type InputProvider interface {
+	LastInputs(now time.Time) (map[string]time.Time, error)
+}
+
+// IdleInhibitors is implemented by InputProviders that can also tell
+// which users hold an idle inhibitor: an application, typically a video
+// player or a call, keeping the session from going idle while its user
+// watches or listens without input. Such hours are flagged
+// media_inhibit, since idle time in them may be undercounted.
+type IdleInhibitors interface {
+	IdleInhibited(now time.Time) (map[string]bool, error)
+}
+
+// Row is one hourly row, in the shape of POST /ingest/hourly.
+type Row = map[string]interface{}
+
+// userHour accumulates one user's samples for the current hour.
+type userHour struct {
+	samples     int64
+	idleSeconds float64
+	first, last time.Time // inputs within the hour
+	inhibited   bool      // an idle inhibitor was seen in a sample
+}
+
+// row is the hourly row of u.
+func (u *userHour) row(hourStart time.Time, host, user, team string, every time.Duration) Row {
+	elapsed := float64(u.samples) * every.Seconds()
+	pct := 0.0
+	if elapsed > 0 {
+		pct = 100 * (1 - u.idleSeconds/elapsed)
+	}
+	r := Row{
+		"hour_start":   hourStart.UTC().Format("2006-01-02T15:00:00Z"),
+		"host":         host,
+		"user_name":    user,
+		"team":         team,
+		"labels":       map[string]string{"source": "tty"},
+		"activity_pct": pct,
+		"idle_seconds": u.idleSeconds,
+		"samples":      u.samples,
+		"status":       string(taxonomy.Classify(pct, u.samples, taxonomy.DefaultThresholds)),
+	}
+	if u.inhibited {
+		r["media_inhibit"] = true
+	}
+	if !u.first.IsZero() {
+		r["first_input"] = u.first.UTC().Format(time.RFC3339)
+		r["last_input"] = u.last.UTC().Format(time.RFC3339)
+	}
+	return r
+}
+
+// Pipeline aggregates samples into hourly rows per user. A user with no
+// session during an hour gets no row for it.
+type Pipeline struct {
+	Host, Team string
+	Every      time.Duration // sampling interval, what one sample stands for
+	Active     time.Duration // a user idle for less than this is active
+	Input      InputProvider
+
+	hourStart time.Time
+	hours     map[string]*userHour
+}
+
+// Rollover closes the current hour when now is in another one and returns
+// its rows; ok is false while the hour goes on.
+func (p *Pipeline) Rollover(now time.Time) (rows []Row, ok bool) {
+	h := now.Truncate(time.Hour)
+	if h.Equal(p.hourStart) {
+		return nil, false
+	}
+	rows = p.Flush()
+	p.hourStart = h
+	return rows, true
+}
+
+// Flush returns the rows of the current hour so far and starts it over,
+// for a shutdown.
+func (p *Pipeline) Flush() []Row {
+	rows := make([]Row, 0, len(p.hours))
+	for user, u := range p.hours {
+		rows = append(rows, u.row(p.hourStart, p.Host, user, p.Team, p.Every))
+	}
+	p.hours = nil
+	return rows
+}
+
+// Sample records one sample at now, in the hour of the last Rollover. If
+// Input is also IdleInhibitors and reading the inhibitors fails, the
+// sample is still recorded, without them, and the error returned.
+func (p *Pipeline) Sample(now time.Time) error {
+	if p.hourStart.IsZero() {
+		p.hourStart = now.Truncate(time.Hour)
+	}
+	latest, err := p.Input.LastInputs(now)
+	if err != nil {
+		return err
+	}
+	var inhibited map[string]bool
+	var inhibitErr error
+	if ii, ok := p.Input.(IdleInhibitors); ok {
+		inhibited, inhibitErr = ii.IdleInhibited(now)
+	}
+	if p.hours == nil {
+		p.hours = make(map[string]*userHour)
+	}
+	for user, t := range latest {
+		u := p.hours[user]
+		if u == nil {
+			u = &userHour{}
+			p.hours[user] = u
+		}
+		u.samples++
+		if inhibited[user] {
+			u.inhibited = true
+		}
+		if t.IsZero() || now.Sub(t) >= p.Active {
+			u.idleSeconds += p.Every.Seconds()
+		}
+		if !t.Before(p.hourStart) {
+			if u.first.IsZero() || t.Before(u.first) {
+				u.first = t
+			}
+			if t.After(u.last) {
+				u.last = t
+			}
+		}
+	}
+	return inhibitErr
+}
+
+// Post sends rows to the backend's POST /ingest/hourly.
+func Post(client *http.Client, backend, token string, rows []Row) error {
+	body, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(backend, "/")+"/ingest/hourly", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(msg.String()))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package tty
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// inputFunc is an InputProvider scripted by the test.
+type inputFunc func(now time.Time) (map[string]time.Time, error)
+
+func (f inputFunc) LastInputs(now time.Time) (map[string]time.Time, error) { return f(now) }
+
+// officeHour scripts one hour starting at hour: alice types until 45
+// minutes in and then leaves her session open, bob's session never sees
+// input, and carol logs in half way and types until the end.
+func officeHour(hour time.Time) InputProvider {
+	return inputFunc(func(now time.Time) (map[string]time.Time, error) {
+		in := now.Sub(hour)
+		alice := now
+		if in > 45*time.Minute {
+			alice = hour.Add(45 * time.Minute)
+		}
+		users := map[string]time.Time{"alice": alice, "bob": {}}
+		if in >= 30*time.Minute {
+			users["carol"] = now
+		}
+		return users, nil
+	})
+}
+
+// runHour samples p every p.Every over the hour starting at hour and
+// returns the rows closed at the next hour, sorted by user.
+func runHour(t *testing.T, p *Pipeline, hour time.Time) []Row {
+	t.Helper()
+	for now := hour; now.Before(hour.Add(time.Hour)); now = now.Add(p.Every) {
+		if rows, ok := p.Rollover(now); ok && len(rows) > 0 {
+			t.Fatalf("rows closed at %s: %v", now, rows)
+		}
+		if err := p.Sample(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, ok := p.Rollover(hour.Add(time.Hour))
+	if !ok {
+		t.Fatal("hour not closed")
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i]["user_name"].(string) < rows[j]["user_name"].(string) })
+	return rows
+}
+
+func TestPipelineHour(t *testing.T) {
+	hour := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	p := &Pipeline{Host: "bastion-1", Team: "infra", Every: 10 * time.Second, Active: 30 * time.Second, Input: officeHour(hour)}
+	rows := runHour(t, p, hour)
+
+	want := []struct {
+		user        string
+		samples     int64
+		idleSeconds float64
+		pct         float64
+		status      string
+		first, last string
+	}{
+		// idle from 45:30, once the last input is Active old: 87 samples
+		{"alice", 360, 870, 100 * (1 - 870.0/3600), "HIGH_PRODUCTION", "2026-02-02T09:00:00Z", "2026-02-02T09:45:00Z"},
+		{"bob", 360, 3600, 0, "OFF", "", ""},
+		{"carol", 180, 0, 100, "HIGH_PRODUCTION", "2026-02-02T09:30:00Z", "2026-02-02T09:59:50Z"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r["user_name"] != w.user || r["samples"] != w.samples || r["idle_seconds"] != w.idleSeconds ||
+			r["activity_pct"] != w.pct || r["status"] != w.status {
+			t.Errorf("row %d = %v, want %+v", i, r, w)
+		}
+		first, _ := r["first_input"].(string)
+		last, _ := r["last_input"].(string)
+		if first != w.first || last != w.last {
+			t.Errorf("%s: inputs %q-%q, want %q-%q", w.user, first, last, w.first, w.last)
+		}
+		if r["hour_start"] != "2026-02-02T09:00:00Z" || r["host"] != "bastion-1" || r["team"] != "infra" {
+			t.Errorf("%s: keys %v", w.user, r)
+		}
+	}
+
+	// the next hour starts empty
+	if rows := p.Flush(); len(rows) != 0 {
+		t.Errorf("after rollover: %v", rows)
+	}
+}
+
+func TestPipelineInputError(t *testing.T) {
+	hour := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	fail := true
+	p := &Pipeline{Every: 10 * time.Second, Active: 30 * time.Second, Input: inputFunc(func(now time.Time) (map[string]time.Time, error) {
+		if fail {
+			return nil, errors.New("utmp: permission denied")
+		}
+		return map[string]time.Time{"alice": now}, nil
+	})}
+	if err := p.Sample(hour); err == nil {
+		t.Fatal("error not returned")
+	}
+	fail = false
+	if err := p.Sample(hour.Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// a failed sample counts for nobody
+	rows := p.Flush()
+	if len(rows) != 1 || rows[0]["samples"] != int64(1) {
+		t.Errorf("rows = %v", rows)
+	}
+}
@@ -0,0 +1,102 @@
+package tty
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// utmp record layout on Linux (glibc, 64-bit and 32-bit alike).
+const (
+	utmpSize      = 384
+	utUserProcess = 7
+	utPidOffset   = 4
+	utLineOffset  = 8
+	utLineSize    = 32
+	utUserOffset  = 44
+	utUserSize    = 32
+	utHostOffset  = 76
+	utHostSize    = 256
+)
+
+// Utmp is the InputProvider of remote terminal logins: it lists the live
+// USER_PROCESS entries of the utmp file at Path that have a remote host,
+// and takes each terminal's access time (/dev/pts/N), which the kernel
+// moves on input, as that session's last input. Linux updates terminal
+// times at most every few seconds, so sampling more often than every 10s
+// gains nothing.
+type Utmp struct {
+	Path string
+}
+
+func (u Utmp) LastInputs(time.Time) (map[string]time.Time, error) {
+	sessions, err := remoteSessions(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]time.Time{}
+	for _, s := range sessions {
+		t, ok := lastInput(s)
+		if ok && t.After(latest[s.user]) {
+			latest[s.user] = t
+		} else if _, seen := latest[s.user]; !seen {
+			latest[s.user] = time.Time{}
+		}
+	}
+	return latest, nil
+}
+
+// session is one remote terminal login.
+type session struct {
+	user, line, host string
+}
+
+// remoteSessions reads the live remote logins from the utmp file at path;
+// entries whose process is gone are left out.
+func remoteSessions(path string) ([]session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []session
+	for off := 0; off+utmpSize <= len(data); off += utmpSize {
+		rec := data[off : off+utmpSize]
+		if int16(binary.LittleEndian.Uint16(rec)) != utUserProcess {
+			continue
+		}
+		s := session{
+			user: cString(rec[utUserOffset : utUserOffset+utUserSize]),
+			line: cString(rec[utLineOffset : utLineOffset+utLineSize]),
+			host: cString(rec[utHostOffset : utHostOffset+utHostSize]),
+		}
+		pid := int32(binary.LittleEndian.Uint32(rec[utPidOffset:]))
+		if s.user == "" || s.host == "" || !strings.HasPrefix(s.line, "pts/") {
+			continue
+		}
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err != nil {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// lastInput is the access time of the session's terminal.
+func lastInput(s session) (time.Time, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat("/dev/"+s.line, &st); err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Atim.Sec, st.Atim.Nsec), true
+}
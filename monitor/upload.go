@@ -0,0 +1,131 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// uploadCompressions are the UploadCompression values; "" is gzip.
+var uploadCompressions = map[string]bool{"": true, "gzip": true, "zstd": true, "none": true}
+
+// uploadMeter counts the bytes of compressed uploads before and after
+// compression, for the status command.
+type uploadMeter struct {
+	raw, wire atomic.Int64
+}
+
+var uploads uploadMeter
+
+// ratio is raw bytes per wire byte, 0 before the first upload.
+func (m *uploadMeter) ratio() float64 {
+	wire := m.wire.Load()
+	if wire == 0 {
+		return 0
+	}
+	return float64(m.raw.Load()) / float64(wire)
+}
+
+// zstdEncoder is shared by all uploads; EncodeAll is safe for concurrent
+// use.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+
+// compressBody encodes raw as cfg.UploadCompression asks and returns the
+// Content-Encoding to send it with, "" for none.
+func compressBody(cfg Config, raw []byte) ([]byte, string, error) {
+	switch cfg.UploadCompression {
+	case "none":
+		return raw, "", nil
+	case "zstd":
+		return zstdEncoder.EncodeAll(raw, make([]byte, 0, len(raw)/4)), "zstd", nil
+	case "", "gzip":
+		var body bytes.Buffer
+		zw := gzip.NewWriter(&body)
+		if _, err := zw.Write(raw); err != nil {
+			return nil, "", err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", err
+		}
+		return body.Bytes(), "gzip", nil
+	}
+	return nil, "", fmt.Errorf("unknown UploadCompression %q", cfg.UploadCompression)
+}
+
+// postCompressedJSON posts v to the backend as JSON, compressed per
+// cfg.UploadCompression.
+func postCompressedJSON(ctx context.Context, client *http.Client, cfg Config, path string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	body, encoding, err := compressBody(cfg, raw)
+	if err != nil {
+		return err
+	}
+	req, err := backendRequest(ctx, cfg, http.MethodPost, path, body)
+	if err != nil {
+		return err
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if err := backendDo(client, req, nil); err != nil {
+		return err
+	}
+	uploads.raw.Add(int64(len(raw)))
+	uploads.wire.Add(int64(len(body)))
+	return nil
+}
+
+// postHourly sends one hourly row to the backend's POST /ingest/hourly,
+// the path of enrolled agents, which hold no rqlite credentials.
+func postHourly(httpClient *http.Client, cfg Config, row hourlyRow) error {
+	in := map[string]interface{}{
+		"hour_start":           row.hourStart.UTC().Format("2006-01-02T15:00:00Z"),
+		"host":                 cfg.HostName,
+		"user_name":            row.userName,
+		"display_name":         row.displayName,
+		"team":                 cfg.Team,
+		"labels":               cfg.Labels,
+		"activity_pct":         row.activityPct,
+		"idle_seconds":         row.idleSeconds,
+		"samples":              row.samples,
+		"status":               row.status,
+		"battery_seconds":      row.batterySeconds,
+		"monitor_seconds":      row.monitorSeconds,
+		"mouse_events":         row.mouse,
+		"key_events":           row.key,
+		"touch_events":         row.touch,
+		"local_hour":           row.localHour,
+		"degraded_seconds":     row.degradedSeconds,
+		"category_seconds":     row.categorySeconds,
+		"domain_seconds":       row.domainSeconds,
+		"first_input":          inputTime(row.inputs.first),
+		"last_input":           inputTime(row.inputs.last),
+		"breaks":               row.breaks,
+		"break_seconds":        row.breakSeconds,
+		"suspected_synthetic":  row.synthetic.suspected,
+		"synthetic_confidence": row.synthetic.confidence,
+		"signature":            signBucket(cfg, row),
+	}
+	if row.batteryPct >= 0 {
+		in["battery_pct"] = row.batteryPct
+	}
+	if row.ewmaPct >= 0 {
+		in["ewma_pct"] = row.ewmaPct
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), httpClient.Timeout+5*time.Second)
+	defer cancel()
+	return postCompressedJSON(ctx, httpClient, cfg, "/ingest/hourly", in)
+}
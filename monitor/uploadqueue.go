@@ -0,0 +1,125 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// uploadQueue holds items waiting for the backend, up to limit: add
+// never blocks and drops the oldest item when the queue is full, and a
+// batch that fails to upload goes back to the front. Drops are counted
+// and handed to the next batch that goes out. With same set, a batch
+// ends before the first item that does not go with the batch's first,
+// as samples of another session user do.
+type uploadQueue[T any] struct {
+	limit int
+	same  func(a, b T) bool
+
+	mu      sync.Mutex
+	items   []T
+	dropped int
+}
+
+// add queues one item; called from the sampling loop or writeLine, so it
+// never blocks.
+func (q *uploadQueue[T]) add(item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.limit {
+		q.items = q.items[1:]
+		q.dropped++
+	}
+	q.items = append(q.items, item)
+}
+
+// take removes up to n queued items and the count dropped since the last
+// take.
+func (q *uploadQueue[T]) take(n int) ([]T, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n = min(n, len(q.items))
+	if q.same != nil {
+		for i := 1; i < n; i++ {
+			if !q.same(q.items[0], q.items[i]) {
+				n = i
+				break
+			}
+		}
+	}
+	batch := append([]T(nil), q.items[:n]...)
+	q.items = append(q.items[:0:0], q.items[n:]...)
+	dropped := q.dropped
+	q.dropped = 0
+	return batch, dropped
+}
+
+// putBack returns a batch that failed to upload, and the drops it was to
+// report, to the front of the queue.
+func (q *uploadQueue[T]) putBack(batch []T, dropped int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(batch, q.items...)
+	q.dropped += dropped
+	if over := len(q.items) - q.limit; over > 0 {
+		q.items = q.items[over:]
+		q.dropped += over
+	}
+}
+
+// flush uploads everything queued with send, in batches of at most n,
+// stopping at the first failure.
+func (q *uploadQueue[T]) flush(ctx context.Context, n int, send func(ctx context.Context, batch []T, dropped int) error) error {
+	for {
+		batch, dropped := q.take(n)
+		if len(batch) == 0 {
+			q.putBack(nil, dropped)
+			return nil
+		}
+		if err := send(ctx, batch, dropped); err != nil {
+			q.putBack(batch, dropped)
+			return err
+		}
+	}
+}
+
+// uploadLoop calls flush every interval until ctx is done, then once more
+// with a short deadline so the last items get out. Errors are logged
+// under tag once per outage, or the error lines would pile up in a log
+// shipper's queue that cannot be emptied; a 404 means the backend does
+// not take these uploads and ends the loop.
+func uploadLoop(ctx context.Context, every time.Duration, tag string, flush func(ctx context.Context) error, writeLine func(string)) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = flush(final)
+			cancel()
+			return
+		case <-t.C:
+		}
+		err := flush(ctx)
+		var se *httpStatusError
+		switch {
+		case ctx.Err() != nil:
+		case errors.As(err, &se) && se.code == http.StatusNotFound:
+			writeLine(fmt.Sprintf("[%s] %s not supported by the backend, upload stopped", time.Now().Format(time.RFC3339), tag))
+			return
+		case err != nil && !failing:
+			writeLine(fmt.Sprintf("[%s] %s upload error: %v", time.Now().Format(time.RFC3339), tag, err))
+			failing = true
+		case err == nil && failing:
+			writeLine(fmt.Sprintf("[%s] %s upload recovered", time.Now().Format(time.RFC3339), tag))
+			failing = false
+		}
+	}
+}
@@ -0,0 +1,104 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestUploadQueueDropsOldest(t *testing.T) {
+	q := uploadQueue[int]{limit: 3}
+	for i := 1; i <= 5; i++ {
+		q.add(i)
+	}
+	batch, dropped := q.take(2)
+	if !reflect.DeepEqual(batch, []int{3, 4}) || dropped != 2 {
+		t.Fatalf("take = %v, %d dropped; want [3 4], 2", batch, dropped)
+	}
+	if _, dropped := q.take(2); dropped != 0 {
+		t.Errorf("drops reported twice: %d", dropped)
+	}
+}
+
+func TestUploadQueuePutBack(t *testing.T) {
+	q := uploadQueue[int]{limit: 4}
+	for i := 1; i <= 3; i++ {
+		q.add(i)
+	}
+	batch, _ := q.take(2)
+	q.add(4)
+	q.add(5)
+	// the failed batch goes in front, one over the limit: its oldest goes
+	q.putBack(batch, 1)
+	rest, dropped := q.take(10)
+	if !reflect.DeepEqual(rest, []int{2, 3, 4, 5}) {
+		t.Errorf("after putBack: %v, want [2 3 4 5]", rest)
+	}
+	// the drop handed back with the batch, and the overflow
+	if dropped != 2 {
+		t.Errorf("dropped = %d, want 2", dropped)
+	}
+}
+
+func TestUploadQueueFlush(t *testing.T) {
+	q := uploadQueue[int]{limit: 10}
+	for i := 1; i <= 5; i++ {
+		q.add(i)
+	}
+	var sent [][]int
+	fail := errors.New("503 Service Unavailable")
+	send := func(_ context.Context, batch []int, _ int) error {
+		if len(sent) == 1 {
+			return fail
+		}
+		sent = append(sent, batch)
+		return nil
+	}
+	if err := q.flush(context.Background(), 2, send); err != fail {
+		t.Fatalf("flush = %v, want the send error", err)
+	}
+	if !reflect.DeepEqual(sent, [][]int{{1, 2}}) {
+		t.Errorf("sent %v before the failure", sent)
+	}
+
+	sent = nil
+	send = func(_ context.Context, batch []int, _ int) error {
+		sent = append(sent, batch)
+		return nil
+	}
+	if err := q.flush(context.Background(), 2, send); err != nil {
+		t.Fatal(err)
+	}
+	// the failed batch went out first, then the rest, nothing twice
+	if !reflect.DeepEqual(sent, [][]int{{3, 4}, {5}}) {
+		t.Errorf("sent %v after recovery", sent)
+	}
+}
+
+func TestUploadQueueSame(t *testing.T) {
+	q := uploadQueue[rawSample]{limit: 10, same: func(a, b rawSample) bool { return a.user == b.user }}
+	for _, user := range []string{"alice", "alice", "bob", "alice"} {
+		q.add(rawSample{user: user})
+	}
+	var users []string
+	err := q.flush(context.Background(), 10, func(_ context.Context, batch []rawSample, _ int) error {
+		for _, s := range batch[1:] {
+			if s.user != batch[0].user {
+				t.Errorf("batch mixes %s and %s", batch[0].user, s.user)
+			}
+		}
+		users = append(users, fmt.Sprintf("%s:%d", batch[0].user, len(batch)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice:2", "bob:1", "alice:1"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("batches %v, want %v", users, want)
+	}
+}
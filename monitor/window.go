@@ -0,0 +1,182 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"time"
+)
+
+// Modes of the windowed (live) pipeline.
+const (
+	modeHighProductive   = "HIGH_PRODUCTIVE"
+	modeSimpleProductive = "SIMPLE_PRODUCTIVE"
+	modeIdle             = "IDLE"
+)
+
+type windowSample struct {
+	at     time.Time
+	active bool
+	n      int       // SampleEvery samples this one stands for, see sampleWeight
+	kind   inputKind // device behind the last input, for weighted scoring
+}
+
+// sampleRing is a FIFO of samples over one reused array, so a window
+// that runs for weeks neither reallocates nor pins a growing backing
+// array. It only grows when full, i.e. while the first window fills or
+// after WindowSize is raised.
+type sampleRing struct {
+	buf  []windowSample
+	head int // oldest sample
+	n    int
+}
+
+func (r *sampleRing) push(s windowSample) {
+	if r.n == len(r.buf) {
+		grown := make([]windowSample, max(2*len(r.buf), 64))
+		for i := 0; i < r.n; i++ {
+			grown[i] = r.buf[(r.head+i)%len(r.buf)]
+		}
+		r.buf, r.head = grown, 0
+	}
+	r.buf[(r.head+r.n)%len(r.buf)] = s
+	r.n++
+}
+
+// oldest returns the oldest sample; ok is false when the ring is empty.
+func (r *sampleRing) oldest() (s windowSample, ok bool) {
+	if r.n == 0 {
+		return windowSample{}, false
+	}
+	return r.buf[r.head], true
+}
+
+func (r *sampleRing) pop() {
+	r.head = (r.head + 1) % len(r.buf)
+	r.n--
+}
+
+// each calls fn on every sample, oldest first.
+func (r *sampleRing) each(fn func(windowSample)) {
+	for i := 0; i < r.n; i++ {
+		fn(r.buf[(r.head+i)%len(r.buf)])
+	}
+}
+
+// activityWindow is the windowed pipeline: it keeps the samples of the
+// last WindowSize and classifies the share of active ones into a mode.
+// It only writes to the local log; the hourly pipeline does the uploads.
+// total and the scorer's state are running sums over samples, so each
+// observation costs O(1) however long the window.
+type activityWindow struct {
+	samples    sampleRing
+	total      int
+	scorer     scorer
+	scoring    scoringSettings // settings scorer was built from
+	mode       string
+	modeSince  time.Time
+	lastStatus time.Time
+}
+
+// modeLevel ranks modes so hysteresis can tell moving up from moving down.
+var modeLevel = map[string]int{modeIdle: 0, modeSimpleProductive: 1, modeHighProductive: 2}
+
+// modeFor classifies ratio with both thresholds lowered by margin.
+func modeFor(cfg Config, ratio, margin float64) string {
+	switch {
+	case ratio >= cfg.HighProductiveRatio-margin:
+		return modeHighProductive
+	case ratio >= cfg.SimpleProductiveRatio-margin:
+		return modeSimpleProductive
+	}
+	return modeIdle
+}
+
+// modeFrom is the mode after cur for the window's active ratio. Moving up
+// takes the full threshold, moving down a drop ModeHysteresis below it, so
+// a ratio hovering around one threshold no longer flips the mode on
+// every sample. A continuous idle of ContinuousIdleThreshold is always
+// IDLE.
+func modeFrom(cfg Config, cur string, ratio float64, idleNow time.Duration) string {
+	if idleNow >= cfg.ContinuousIdleThreshold {
+		return modeIdle
+	}
+	if up := modeFor(cfg, ratio, 0); cur == "" || modeLevel[up] > modeLevel[cur] {
+		return up
+	}
+	if down := modeFor(cfg, ratio, cfg.ModeHysteresis); modeLevel[down] < modeLevel[cur] {
+		return down
+	}
+	return cur
+}
+
+// observe adds one sample and logs MODE CHANGE on transitions and STATUS
+// every PrintStatusEvery, in the format /import and the backfill parse.
+func (w *activityWindow) observe(cfg Config, now time.Time, idleNow time.Duration, n int, kind inputKind, writeLine func(string)) {
+	w.useScorer(cfg, now, writeLine)
+	s := windowSample{at: now, active: idleNow < cfg.ActiveIfIdleLessThan, n: n, kind: kind}
+	w.samples.push(s)
+	w.scorer.add(s)
+	w.total += n
+	// drop samples that left the window; WindowSize may change on reload
+	cutoff := now.Add(-cfg.WindowSize)
+	for {
+		s, ok := w.samples.oldest()
+		if !ok || s.at.After(cutoff) {
+			break
+		}
+		w.scorer.remove(s)
+		w.total -= s.n
+		w.samples.pop()
+	}
+
+	ratio := w.scorer.ratio(now)
+	mode := modeFrom(cfg, w.mode, ratio, idleNow)
+	// hold a fresh mode for ModeMinDwell, unless the user left for good
+	if w.mode != "" && now.Sub(w.modeSince) < cfg.ModeMinDwell && idleNow < cfg.ContinuousIdleThreshold {
+		mode = w.mode
+	}
+
+	if mode != w.mode {
+		writeLine(fmt.Sprintf("[%s] MODE CHANGE: %s idleNow=%s activeRatio=%.0f%% samples=%d",
+			now.Format(time.RFC3339), mode, idleNow.Truncate(time.Second), ratio*100, w.total))
+		w.mode = mode
+		w.modeSince = now
+	}
+	if cfg.PrintStatusEvery > 0 && now.Sub(w.lastStatus) >= cfg.PrintStatusEvery {
+		writeLine(fmt.Sprintf("[%s] STATUS: mode=%s idleNow=%s activeRatio=%.0f%% samples=%d",
+			now.Format(time.RFC3339), mode, idleNow.Truncate(time.Second), ratio*100, w.total))
+		w.lastStatus = now
+	}
+}
+
+// scoringSettings are the Config fields a scorer is built from.
+type scoringSettings struct {
+	scoring  string
+	halfLife time.Duration
+	weights  map[string]float64
+}
+
+func (s scoringSettings) equal(cfg Config) bool {
+	return s.scoring == cfg.Scoring && s.halfLife == cfg.ScoringHalfLife && maps.Equal(s.weights, cfg.ScoringWeights)
+}
+
+// useScorer (re)builds the scorer when the scoring settings change and
+// replays the window into it. Invalid settings are logged and fall back
+// to the threshold scorer. It runs on every sample, so the unchanged case
+// must not allocate.
+func (w *activityWindow) useScorer(cfg Config, now time.Time, writeLine func(string)) {
+	if w.scorer != nil && w.scoring.equal(cfg) {
+		return
+	}
+	sc, err := newScorer(cfg)
+	if err != nil {
+		writeLine(fmt.Sprintf("[%s] CONFIG Scoring error: %v (using %s)", now.Format(time.RFC3339), err, scoringThreshold))
+		sc = &thresholdScorer{}
+	}
+	w.samples.each(sc.add)
+	w.scorer = sc
+	w.scoring = scoringSettings{cfg.Scoring, cfg.ScoringHalfLife, maps.Clone(cfg.ScoringWeights)}
+}
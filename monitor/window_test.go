@@ -0,0 +1,123 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func ringContents(r *sampleRing) []int {
+	var out []int
+	r.each(func(s windowSample) { out = append(out, s.n) })
+	return out
+}
+
+func checkRing(t *testing.T, r *sampleRing, from, to int) {
+	t.Helper()
+	got := ringContents(r)
+	if len(got) != to-from || r.n != len(got) {
+		t.Fatalf("ring holds %d samples (n=%d), want %d", len(got), r.n, to-from)
+	}
+	for i, n := range got {
+		if n != from+i {
+			t.Fatalf("ring[%d] = %d, want %d (ring %v)", i, n, from+i, got)
+		}
+	}
+	if s, ok := r.oldest(); to > from && (!ok || s.n != from) {
+		t.Fatalf("oldest = %d, %v, want %d", s.n, ok, from)
+	}
+}
+
+func TestSampleRingGrowth(t *testing.T) {
+	var r sampleRing
+	if _, ok := r.oldest(); ok {
+		t.Fatal("empty ring has an oldest sample")
+	}
+	for i := 0; i < 64; i++ {
+		r.push(windowSample{n: i})
+	}
+	if len(r.buf) != 64 {
+		t.Fatalf("cap = %d after 64 pushes, want 64", len(r.buf))
+	}
+	r.push(windowSample{n: 64})
+	if len(r.buf) != 128 {
+		t.Fatalf("cap = %d after 65 pushes, want 128", len(r.buf))
+	}
+	checkRing(t, &r, 0, 65)
+}
+
+func TestSampleRingWrapAround(t *testing.T) {
+	var r sampleRing
+	for i := 0; i < 64; i++ {
+		r.push(windowSample{n: i})
+	}
+	// a steady window: one in, one out, for several laps of the array
+	for i := 64; i < 64*5+17; i++ {
+		r.pop()
+		r.push(windowSample{n: i})
+		if len(r.buf) != 64 {
+			t.Fatalf("steady ring grew to %d at push %d", len(r.buf), i)
+		}
+	}
+	from := 64*5 + 17 - 64
+	checkRing(t, &r, from, from+64)
+	if r.head == 0 {
+		t.Fatal("head did not move; wrap-around not exercised")
+	}
+
+	// growing while wrapped keeps the order
+	r.push(windowSample{n: from + 64})
+	if len(r.buf) != 128 || r.head != 0 {
+		t.Fatalf("after growth: cap %d head %d, want 128, 0", len(r.buf), r.head)
+	}
+	checkRing(t, &r, from, from+65)
+
+	for i := 0; i < 65; i++ {
+		r.pop()
+	}
+	checkRing(t, &r, 0, 0)
+}
+
+func TestActivityWindowSteadyState(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.WindowSize = time.Minute
+	cfg.PrintStatusEvery = 0
+	var w activityWindow
+	now := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 600; i++ {
+		w.observe(cfg, now, 0, 1, inputKey, func(string) {})
+		now = now.Add(time.Second)
+	}
+	// the sample exactly WindowSize old has left
+	if w.samples.n != 60 || w.total != 60 {
+		t.Errorf("window holds %d samples, total %d, want 60", w.samples.n, w.total)
+	}
+	if len(w.samples.buf) != 64 {
+		t.Errorf("ring grew to %d in steady state", len(w.samples.buf))
+	}
+	if w.mode != modeHighProductive {
+		t.Errorf("mode = %s, want %s", w.mode, modeHighProductive)
+	}
+}
+
+func BenchmarkActivityWindowObserve(b *testing.B) {
+	cfg := defaultConfig()
+	cfg.PrintStatusEvery = 0
+	var w activityWindow
+	now := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	writeLine := func(string) {}
+	// fill the window so the benchmark measures the steady state
+	for i := 0; i < int(cfg.WindowSize/cfg.SampleEvery); i++ {
+		w.observe(cfg, now, 0, 1, inputKey, writeLine)
+		now = now.Add(cfg.SampleEvery)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idle := time.Duration(i%90) * time.Second
+		w.observe(cfg, now, idle, 1, inputMouse, writeLine)
+		now = now.Add(cfg.SampleEvery)
+	}
+}
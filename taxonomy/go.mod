@@ -0,0 +1,3 @@
+module taxonomy
+
+go 1.25.3
@@ -0,0 +1,129 @@
+// Package taxonomy is the hourly status vocabulary shared by the agent,
+// which classifies hours, and the backend, which validates, stores and
+// reports them. Anything reading activity_hourly.status can rely on the
+// values listed here.
+package taxonomy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is the classification of one host-hour.
+type Status string
+
+const (
+	Off            Status = "OFF"
+	Low            Status = "LOW"
+	Active         Status = "ACTIVE"
+	HighProduction Status = "HIGH_PRODUCTION"
+
+	// InMeeting replaces Low for hours that overlap an accepted calendar
+	// meeting: the user was away from the keyboard for a reason.
+	InMeeting Status = "IN_MEETING"
+
+	// Gap statuses are never sent by agents: the backend writes them for
+	// scheduled hours without a row, so a dead agent is not mistaken for
+	// an idle employee.
+	NoData    Status = "NO_DATA"    // heartbeats arrived, the hourly row did not
+	AgentDown Status = "AGENT_DOWN" // no heartbeat either
+)
+
+// Thresholds are the activity cut-offs of Classify: below LowBelow is
+// Low, below ActiveBelow is Active, anything else HighProduction.
+type Thresholds struct {
+	LowBelow    float64 `json:"low_below"`
+	ActiveBelow float64 `json:"active_below"`
+}
+
+// DefaultThresholds are the agent's cut-offs and the backend's default
+// status_thresholds setting.
+var DefaultThresholds = Thresholds{LowBelow: 50, ActiveBelow: 60}
+
+// Validate checks 0 < LowBelow <= ActiveBelow <= 100.
+func (t Thresholds) Validate() error {
+	if t.LowBelow <= 0 || t.LowBelow > t.ActiveBelow || t.ActiveBelow > 100 {
+		return fmt.Errorf("need 0 < low_below <= active_below <= 100")
+	}
+	return nil
+}
+
+// Classify returns the status of an hour with activityPct over samples.
+func Classify(activityPct float64, samples int64, t Thresholds) Status {
+	if samples == 0 || activityPct == 0 {
+		return Off
+	}
+	if activityPct < t.LowBelow {
+		return Low
+	}
+	if activityPct < t.ActiveBelow {
+		return Active
+	}
+	return HighProduction
+}
+
+// Info describes one status, as served by the backend's GET /statuses.
+type Info struct {
+	Status      Status `json:"status"`
+	Description string `json:"description"`
+	// Reported statuses come from agents; the others are assigned by the
+	// backend and rejected on ingestion.
+	Reported bool `json:"reported"`
+	// Measured statuses come from samples and count in averages; gap
+	// statuses do not.
+	Measured bool `json:"measured"`
+}
+
+// Statuses lists every status, in increasing order of activity for the
+// reported ones.
+var Statuses = []Info{
+	{Off, "no samples or no activity at all", true, true},
+	{Low, "activity below low_below", true, true},
+	{Active, "activity from low_below up to active_below", true, true},
+	{HighProduction, "activity at or above active_below", true, true},
+	{InMeeting, "a LOW hour overlapping an accepted calendar meeting", false, true},
+	{NoData, "scheduled hour with heartbeats but no hourly row", false, false},
+	{AgentDown, "scheduled hour with neither heartbeats nor an hourly row", false, false},
+}
+
+func (s Status) info() (Info, bool) {
+	for _, i := range Statuses {
+		if i.Status == s {
+			return i, true
+		}
+	}
+	return Info{}, false
+}
+
+// Reported reports whether agents may send s.
+func (s Status) Reported() bool {
+	i, _ := s.info()
+	return i.Reported
+}
+
+// Measured reports whether s comes from an agent's samples; averages and
+// active-hour counts skip gap rows.
+func (s Status) Measured() bool {
+	return s != NoData && s != AgentDown
+}
+
+// aliases maps spellings from older or windowed-mode agents onto the
+// canonical statuses, so mixed fleets don't split one status in two.
+var aliases = map[string]Status{
+	"HIGH_PRODUCTIVE":   HighProduction,
+	"SIMPLE_PRODUCTIVE": Active,
+	"IDLE":              Low,
+}
+
+// Parse normalizes s (case, surrounding spaces and legacy spellings) and
+// rejects anything that is not a known status.
+func Parse(s string) (Status, error) {
+	norm := strings.ToUpper(strings.TrimSpace(s))
+	if st, ok := aliases[norm]; ok {
+		return st, nil
+	}
+	if _, ok := Status(norm).info(); ok {
+		return Status(norm), nil
+	}
+	return "", fmt.Errorf("unknown status %q (want OFF, LOW, ACTIVE or HIGH_PRODUCTION)", s)
+}